@@ -2,9 +2,13 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -12,8 +16,22 @@ import (
 	"github.com/labstack/echo/middleware"
 
 	"github.com/radean0909/guild-chat/api/handlers"
+	"github.com/radean0909/guild-chat/api/internal/auth"
+	"github.com/radean0909/guild-chat/api/internal/commands"
 	"github.com/radean0909/guild-chat/api/internal/db"
 	"github.com/radean0909/guild-chat/api/internal/db/mem"
+	"github.com/radean0909/guild-chat/api/internal/db/pg"
+	"github.com/radean0909/guild-chat/api/internal/db/sqlite"
+	"github.com/radean0909/guild-chat/api/internal/events"
+	"github.com/radean0909/guild-chat/api/internal/presence"
+	"github.com/radean0909/guild-chat/api/internal/ratelimit"
+	"github.com/radean0909/guild-chat/api/internal/realtime"
+	"github.com/radean0909/guild-chat/api/internal/search"
+	"github.com/radean0909/guild-chat/api/internal/storage"
+	"github.com/radean0909/guild-chat/api/internal/storage/local"
+	"github.com/radean0909/guild-chat/api/internal/storage/memory"
+	"github.com/radean0909/guild-chat/api/internal/webhooks"
+	"github.com/radean0909/guild-chat/api/models"
 )
 
 // HealthGracePeriod provided enough time to wait after a SIGTERM has been
@@ -22,49 +40,225 @@ import (
 // graceful shutdown.
 const HealthGracePeriod time.Duration = 10 * time.Second
 
+// eventBuffer - events queued for each bus subscriber before further events are dropped
+const eventBuffer = 1024
+
+// DefaultTokenTTL - how long an issued token is valid for, unless configured otherwise
+const DefaultTokenTTL = 24 * time.Hour
+
+// DefaultMaxAttachmentSize - the largest file that can be attached to a message, unless configured otherwise
+const DefaultMaxAttachmentSize = 25 << 20
+
+// DefaultPresenceTTL - how long a user stays online after they were last heard from, unless configured otherwise
+const DefaultPresenceTTL = 2 * time.Minute
+
+// DefaultTypingTTL - how long a user is shown typing, unless configured otherwise
+const DefaultTypingTTL = 10 * time.Second
+
+// Rate limit defaults - people can make 20 requests a second, in bursts of up to 100. Bots get less room by
+// default, 5 a second in bursts of up to 20, so a runaway automation can't crowd out people
+const (
+	DefaultUserRate  = 20
+	DefaultUserBurst = 100
+	DefaultBotRate   = 5
+	DefaultBotBurst  = 20
+)
+
+// authAttemptBurst, authAttemptRate - how many logins and password resets each address and each username can try
+// at once, and how many a second they get back: a burst of 10, then one every 6 seconds
+const (
+	authAttemptBurst = 10
+	authAttemptRate  = 1.0 / 6
+)
+
+// Webhook delivery defaults - a delivery is attempted 8 times, backing off from 30 seconds and doubling each time,
+// so a receiver can be down for about an hour without missing anything
+const (
+	DefaultWebhookAttempts   = webhooks.DefaultMaxAttempts
+	DefaultWebhookBackoff    = webhooks.DefaultBackoff
+	DefaultWebhookMaxBackoff = webhooks.DefaultMaxBackoff
+)
+
 type Service struct {
-	echo         *echo.Echo
-	DB           db.Driver
-	MsgHandler   *handlers.MessageHandler
-	ConvoHandler *handlers.ConversationHandler
-	UserHandler  *handlers.UserHandler
-	ready        bool
+	echo          *echo.Echo
+	DB            db.Driver
+	MsgHandler    *handlers.MessageHandler
+	ConvoHandler  *handlers.ConversationHandler
+	UserHandler   *handlers.UserHandler
+	GroupHandler  *handlers.GroupHandler
+	GuildHandler  *handlers.GuildHandler
+	SockHandler   *handlers.SocketHandler
+	AuthHandler   *handlers.AuthHandler
+	SearchHandler *handlers.SearchHandler
+	PresHandler   *handlers.PresenceHandler
+	BotHandler    *handlers.BotHandler
+	CmdHandler    *handlers.CommandHandler
+	HookHandler   *handlers.WebhookHandler
+	Bus           *events.Bus
+	Hub           *realtime.Hub
+	Webhooks      *webhooks.Dispatcher
+	ready         bool
 }
 
-func New() *Service {
+func New(cfg Config) (*Service, error) {
 	s := &Service{}
 	e := echo.New()
 	e.HideBanner = false
 	e.HidePort = false
 
-	// Set up the database, for the example we are using an in memory datastore
-	// In production, this would connect to something more permanent
-	// Depending on more specific details (more reads than writes, future features)
-	// I would likely choosd Postgres or MongoDB
-	s.DB = mem.NewDriver()
+	// Set up the database - the in memory datastore is the default for local development, optionally
+	// backed by a write-ahead log, postgres or an embedded sqlite file are used for anything that needs to survive a restart
+	driver, err := newDriver(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// every successful write is published on the bus, so realtime delivery, webhooks, indexing etc
+	// can subscribe in one place rather than each handler calling them
+	s.Bus = events.NewBus()
+	s.DB = events.NewDriver(driver, s.Bus)
+
+	// realtime delivery to connected clients - in production with several replicas this would sit on a shared pub/sub
+	s.Hub = realtime.NewHub()
+	s.Bus.Subscribe("realtime", eventBuffer, s.Hub.HandleEvent, events.MessageCreated, events.MessageEdited, events.MessageDeleted,
+		events.MessageReacted, events.MessageAttached, events.MessageRead)
+
+	// attached files are kept apart from the datastore, in blob storage
+	blobs, err := newBlobStore(cfg.Attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	maxAttachment := cfg.Attachments.MaxSize
+	if maxAttachment == 0 {
+		maxAttachment = DefaultMaxAttachmentSize
+	}
+
+	// slash commands - run wherever messages are sent, bots' commands are posted to the bots
+	s.CmdHandler = &handlers.CommandHandler{
+		DB:        s.DB,
+		Callbacks: &commands.Client{},
+	}
 
 	// Set up the individual "handlers" - in production this might dial out to gRPC handler services
 	s.MsgHandler = &handlers.MessageHandler{
-		DB: s.DB,
+		DB:                s.DB,
+		Blobs:             blobs,
+		MaxAttachmentSize: maxAttachment,
+		Commands:          s.CmdHandler,
 	}
 
 	s.ConvoHandler = &handlers.ConversationHandler{
-		DB: s.DB,
+		DB:  s.DB,
+		Hub: s.Hub,
 	}
 
 	s.UserHandler = &handlers.UserHandler{
 		DB: s.DB,
 	}
 
+	s.GroupHandler = &handlers.GroupHandler{
+		DB:       s.DB,
+		Commands: s.CmdHandler,
+	}
+
+	s.GuildHandler = &handlers.GuildHandler{
+		DB:       s.DB,
+		Commands: s.CmdHandler,
+	}
+
+	// how often people, and bots, can make requests - held in memory, so per instance
+	limits := newRateLimits(cfg.RateLimits)
+
+	// who is online, held in memory only
+	presenceTTL := cfg.Presence.TTL
+	if presenceTTL == 0 {
+		presenceTTL = DefaultPresenceTTL
+	}
+
+	typingTTL := cfg.Presence.TypingTTL
+	if typingTTL == 0 {
+		typingTTL = DefaultTypingTTL
+	}
+
+	tracker := presence.NewTracker(presenceTTL)
+
+	s.SockHandler = &handlers.SocketHandler{
+		DB:       s.DB,
+		Hub:      s.Hub,
+		Presence: tracker,
+		Limits:   limits,
+		Commands: s.CmdHandler,
+	}
+
+	s.PresHandler = &handlers.PresenceHandler{
+		DB:        s.DB,
+		Hub:       s.Hub,
+		Presence:  tracker,
+		TypingTTL: typingTTL,
+	}
+
+	tokens, err := newIssuer(cfg.Auth, e.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// full-text search - natively by the driver if it can, otherwise from an index kept in process
+	searcher, err := newSearcher(driver, s.Bus)
+	if err != nil {
+		return nil, err
+	}
+
+	s.SearchHandler = &handlers.SearchHandler{
+		DB:     s.DB,
+		Search: searcher,
+	}
+
+	// outbound webhooks - deliveries are kept in the datastore, so any left pending by the last run are picked up again
+	s.Webhooks = webhooks.NewDispatcher(driver, webhooks.Config{
+		MaxAttempts: cfg.Webhooks.MaxAttempts,
+		Backoff:     cfg.Webhooks.Backoff,
+		MaxBackoff:  cfg.Webhooks.MaxBackoff,
+	})
+	if err := s.Webhooks.Resume(); err != nil {
+		return nil, err
+	}
+	s.Bus.Subscribe("webhooks", eventBuffer, s.Webhooks.HandleEvent, webhooks.Events...)
+
+	s.HookHandler = &handlers.WebhookHandler{
+		DB:         s.DB,
+		Dispatcher: s.Webhooks,
+	}
+
+	s.AuthHandler = &handlers.AuthHandler{
+		DB:        s.DB,
+		Tokens:    tokens,
+		Limits:    limits,
+		SendReset: logReset(e.Logger),
+		Attempts:  ratelimit.NewLimiter(authAttemptRate, authAttemptBurst),
+	}
+
+	s.BotHandler = &handlers.BotHandler{
+		DB: s.DB,
+	}
+
 	// logger - in production this would likely be more robust
 	e.Use(middleware.Logger())
 
 	// global middleware
 	e.Use(middleware.AddTrailingSlash())
-	e.Use(middleware.GzipWithConfig(middleware.DefaultGzipConfig))
+	e.Use(middleware.GzipWithConfig(middleware.GzipConfig{
+		// streaming connections can't be compressed as a single response
+		Skipper: isStream,
+	}))
 	e.Use(middleware.RecoverWithConfig(middleware.DefaultRecoverConfig))
 
-	// authentication/authorization middlewares could exist at the top level or on individual groups or routes
+	// authentication - everything but health checks, signing up and logging in requires a token or an API key,
+	// individual handlers then check the caller is allowed to see or do what they asked. API keys are also limited
+	// to the areas their scopes cover
+	authenticated := s.AuthHandler.Authenticate
+	scope := s.AuthHandler.RequireScope
+	session := s.AuthHandler.RequireSession
 
 	// kubernetes health checks - important for pod green status when deployed in a container on the cloud
 	e.GET("/alive", s.HandleAlive())
@@ -76,25 +270,205 @@ func New() *Service {
 		return c.String(http.StatusOK, "It's alive!")
 	})
 
+	// auth endpoints
+	authn := e.Group("/auth")
+	authn.POST("/register", s.register)
+	authn.POST("/login", s.login)
+	authn.PUT("/password", s.changePassword, authenticated, session)
+	authn.POST("/reset", s.requestReset)
+	authn.POST("/reset/confirm", s.resetPassword)
+
 	// message endpoints - singular message between two users
-	msgs := e.Group("/message")
+	msgs := e.Group("/message", authenticated, scope(models.ScopeMessages))
 	msgs.POST("", s.postMessage)
 	msgs.GET("/:id", s.getMessageByID)
+	msgs.PATCH("/:id", s.patchMessage)
+	msgs.DELETE("/:id", s.deleteMessage)
+	msgs.GET("/:id/revisions", s.listRevisions)
+	msgs.GET("/:id/replies", s.listReplies)
+	msgs.PUT("/:id/reactions/:emoji", s.putReaction)
+	msgs.DELETE("/:id/reactions/:emoji", s.deleteReaction)
+	msgs.POST("/:id/attachments", s.postAttachment)
+	msgs.GET("/:id/attachments/:attachment", s.getAttachment)
+	msgs.PUT("/:id/read", s.putRead)
+	msgs.GET("/:id/receipts", s.listReceipts)
 
 	// converstion endpoints - a conversation includes all messages between two users
-	conversations := e.Group("/conversation")
+	conversations := e.Group("/conversation", authenticated, scope(models.ScopeMessages))
+	conversations.GET("", s.listInbox)
 	conversations.GET("/:to/:from", s.getConversation)
 	conversations.GET("/:to", s.listConversations)
 
+	// server-sent event streams of new messages, for clients that can't use websockets. Browsers can't set headers on
+	// an event stream, so a token, but not an API key, can also be passed as a query param here
+	e.GET("/conversation/:to/stream", s.streamConversations, handlers.QueryToken, authenticated, scope(models.ScopeMessages))
+	e.GET("/conversation/:to/:from/stream", s.streamConversation, handlers.QueryToken, authenticated, scope(models.ScopeMessages))
+
+	// group conversation endpoints - conversations between any number of participants
+	groups := e.Group("/group", authenticated, scope(models.ScopeMessages))
+	groups.POST("", s.postGroup)
+	groups.GET("", s.listGroups)
+	groups.GET("/:id", s.getGroup)
+	groups.POST("/:id/participants", s.postParticipant)
+	groups.DELETE("/:id/participants/:user", s.deleteParticipant)
+	groups.POST("/:id/messages", s.postGroupMessage)
+	groups.GET("/:id/messages", s.listGroupMessages)
+
+	// guild endpoints - guilds have members, roles and named channels. Only members can see a guild, and
+	// what else they can do depends on the permissions their role has
+	require := s.GuildHandler.Require
+	guilds := e.Group("/guild", authenticated, scope(models.ScopeGuilds))
+	guilds.POST("", s.postGuild)
+	guilds.GET("", s.listGuilds)
+	guilds.GET("/:id", s.getGuild, require(0))
+	guilds.POST("/:id/members", s.joinGuild)
+	guilds.DELETE("/:id/members", s.leaveGuild)
+	guilds.GET("/:id/members", s.listMembers, require(0))
+	guilds.DELETE("/:id/members/:user", s.kickMember, require(models.PermKick))
+	guilds.PUT("/:id/members/:user/role", s.putMemberRole, require(models.PermManageRoles))
+	guilds.GET("/:id/roles", s.listRoles, require(0))
+	guilds.POST("/:id/roles", s.postRole, require(models.PermManageRoles))
+	guilds.POST("/:id/channels", s.postChannel, require(models.PermManageChannels))
+	guilds.POST("/:id/channels/:channel/messages", s.postChannelMessage, require(models.PermSend))
+	guilds.GET("/:id/channels/:channel/messages", s.listChannelMessages, require(0))
+
 	// user endpoints
 	users := e.Group("/user")
-	users.POST("", s.postUser)
-	users.GET("/:id", s.getUserByID)
-	users.DELETE("/:id", s.deleteUserByID)
+	users.POST("", s.register) // same as /auth/register
+
+	users.GET("/:id", s.getUserByID, authenticated, scope(models.ScopeUsers))
+	users.DELETE("/:id", s.deleteUserByID, authenticated, scope(models.ScopeUsers))
+
+	// bot endpoints - bots are users owned by whoever made them, and authenticate with API keys. Bots, their slash
+	// commands and keys can only be managed with a token from logging in, not with a key
+	bots := e.Group("/bot", authenticated, session)
+	bots.POST("", s.postBot)
+	bots.GET("", s.listBots)
+	bots.POST("/:id/commands", s.postCommand)
+	bots.GET("/:id/commands", s.listCommands)
+	bots.DELETE("/:id/commands/:name", s.deleteCommand)
+
+	keys := e.Group("/key", authenticated, session)
+	keys.POST("", s.postKey)
+	keys.GET("", s.listKeys)
+	keys.DELETE("/:id", s.revokeKey)
+
+	// search endpoint - finds messages in any conversation the caller can read
+	e.GET("/search", s.search, authenticated, scope(models.ScopeMessages))
+
+	// presence endpoints - who is online, and who is typing. Held in memory only, see internal/presence
+	e.GET("/presence", s.getPresence, authenticated, scope(models.ScopeUsers))
+	e.PUT("/presence", s.putPresence, authenticated, scope(models.ScopeUsers))
+	e.POST("/typing", s.postTyping, authenticated, scope(models.ScopeMessages))
+
+	// webhook endpoints - a user's or guild's events posted to a URL, see internal/webhooks
+	hooks := e.Group("/webhook", authenticated, scope(models.ScopeWebhooks))
+	hooks.POST("", s.postWebhook)
+	hooks.GET("", s.listWebhooks)
+	hooks.GET("/:id", s.getWebhook)
+	hooks.DELETE("/:id", s.deleteWebhook)
+	hooks.GET("/:id/deliveries", s.listDeliveries)
+	hooks.POST("/:id/deliveries/:delivery/retry", s.retryDelivery)
+
+	// realtime endpoint - pushes new messages to the connected user, who can also send messages over the socket.
+	// API keys can connect with messages:read, but need messages:write to send
+	e.GET("/ws", s.connectSocket, handlers.QueryToken, authenticated, scope(models.ScopeMessages))
 
 	s.echo = e
 
-	return s
+	return s, nil
+}
+
+// newDriver - connects to the datastore selected in the config
+func newDriver(cfg Config) (db.Driver, error) {
+	switch cfg.DBDriver {
+	case "", DriverMem:
+		if cfg.Mem.Dir != "" {
+			return mem.NewPersistentDriver(cfg.Mem)
+		}
+		return mem.NewDriver(), nil
+	case DriverPostgres:
+		return pg.NewDriver(cfg.PG)
+	case DriverSQLite:
+		return sqlite.NewDriver(cfg.SQLite)
+	}
+
+	return nil, fmt.Errorf("unknown db driver %q", cfg.DBDriver)
+}
+
+// newSearcher - the driver itself if it can search messages natively, otherwise an index of its messages that is
+// kept up to date from the bus
+func newSearcher(driver db.Driver, bus *events.Bus) (db.Searcher, error) {
+	if searcher, ok := driver.(db.Searcher); ok {
+		return searcher, nil
+	}
+
+	index := search.NewIndex(driver)
+	if err := index.Rebuild(); err != nil {
+		return nil, err
+	}
+
+	bus.Subscribe("search", eventBuffer, index.HandleEvent, events.MessageCreated, events.MessageEdited, events.MessageDeleted)
+
+	return index, nil
+}
+
+// newRateLimits - creates the rate limiters for people and bots from the config, filling in defaults
+func newRateLimits(cfg RateLimitConfig) *handlers.RateLimits {
+	users, bots := cfg.Users, cfg.Bots
+	if users.Rate == 0 {
+		users.Rate = DefaultUserRate
+	}
+	if users.Burst == 0 {
+		users.Burst = DefaultUserBurst
+	}
+	if bots.Rate == 0 {
+		bots.Rate = DefaultBotRate
+	}
+	if bots.Burst == 0 {
+		bots.Burst = DefaultBotBurst
+	}
+
+	return &handlers.RateLimits{
+		Users: ratelimit.NewLimiter(users.Rate, users.Burst),
+		Bots:  ratelimit.NewLimiter(bots.Rate, bots.Burst),
+	}
+}
+
+// newBlobStore - opens the blob store attached files are kept in
+func newBlobStore(cfg AttachmentConfig) (storage.BlobStore, error) {
+	if cfg.Local.Dir == "" {
+		return memory.NewStore(), nil
+	}
+	return local.NewStore(cfg.Local)
+}
+
+// newIssuer - creates the token issuer from the config, generating a key if none is configured
+func newIssuer(cfg AuthConfig, logger echo.Logger) (*auth.Issuer, error) {
+	key := []byte(cfg.Key)
+	if len(key) == 0 {
+		logger.Warn("no token signing key configured, generating one - tokens will not survive a restart")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	ttl := cfg.TokenTTL
+	if ttl == 0 {
+		ttl = DefaultTokenTTL
+	}
+
+	return auth.NewIssuer(key, ttl), nil
+}
+
+// logReset - stands in for sending password reset tokens until there is a mailer, by logging them.
+// Replace AuthHandler.SendReset before running anywhere the logs aren't private
+func logReset(logger echo.Logger) func(*models.User, string) error {
+	return func(user *models.User, token string) error {
+		logger.Warnf("password reset requested for %s, token: %s", user.Username, token)
+		return nil
+	}
 }
 
 // Start the Service listening on addr. On a SIGTERM the Service will
@@ -111,7 +485,20 @@ func (s *Service) Start(addr string) error {
 		s.echo.Logger.Info("shutting down...")
 		s.ready = false
 		time.Sleep(HealthGracePeriod)
+
+		// hijacked websockets and open event streams would hold up shutdown, so tell those clients to reconnect elsewhere first
+		s.Hub.Close()
 		s.echo.Shutdown(context.Background())
+
+		// let subscribers finish handling events from the last requests, then stop retrying webhooks. Deliveries still
+		// pending are resumed on the next start
+		s.Bus.Close()
+		s.Webhooks.Close()
+
+		// release the datastore once in flight requests have drained
+		if closer, ok := s.DB.(io.Closer); ok {
+			closer.Close()
+		}
 	}()
 
 	return s.echo.Start(addr)
@@ -134,6 +521,12 @@ func (s *Service) HandleAlive() echo.HandlerFunc {
 	}
 }
 
+// isStream - whether a request is for a long lived streaming connection, ie: a websocket upgrade or event stream
+func isStream(c echo.Context) bool {
+	return strings.EqualFold(c.Request().Header.Get(echo.HeaderUpgrade), "websocket") ||
+		strings.HasSuffix(strings.TrimSuffix(c.Request().URL.Path, "/"), "/stream")
+}
+
 // root handlers - these are used to help pass DB down to the lower level handler
 // messages
 func (s *Service) getMessageByID(c echo.Context) error {
@@ -144,6 +537,46 @@ func (s *Service) postMessage(c echo.Context) error {
 	return s.MsgHandler.PostMessage(c)
 }
 
+func (s *Service) patchMessage(c echo.Context) error {
+	return s.MsgHandler.PatchMessage(c)
+}
+
+func (s *Service) deleteMessage(c echo.Context) error {
+	return s.MsgHandler.DeleteMessage(c)
+}
+
+func (s *Service) listRevisions(c echo.Context) error {
+	return s.MsgHandler.ListRevisions(c)
+}
+
+func (s *Service) listReplies(c echo.Context) error {
+	return s.MsgHandler.ListReplies(c)
+}
+
+func (s *Service) putReaction(c echo.Context) error {
+	return s.MsgHandler.PutReaction(c)
+}
+
+func (s *Service) deleteReaction(c echo.Context) error {
+	return s.MsgHandler.DeleteReaction(c)
+}
+
+func (s *Service) postAttachment(c echo.Context) error {
+	return s.MsgHandler.PostAttachment(c)
+}
+
+func (s *Service) getAttachment(c echo.Context) error {
+	return s.MsgHandler.GetAttachment(c)
+}
+
+func (s *Service) putRead(c echo.Context) error {
+	return s.MsgHandler.PutRead(c)
+}
+
+func (s *Service) listReceipts(c echo.Context) error {
+	return s.MsgHandler.ListReceipts(c)
+}
+
 // conversations
 func (s *Service) getConversation(c echo.Context) error {
 	return s.ConvoHandler.GetConversation(c)
@@ -153,11 +586,177 @@ func (s *Service) listConversations(c echo.Context) error {
 	return s.ConvoHandler.ListConversations(c)
 }
 
-// users
-func (s *Service) postUser(c echo.Context) error {
-	return s.UserHandler.PostUser(c)
+func (s *Service) listInbox(c echo.Context) error {
+	return s.ConvoHandler.ListInbox(c)
+}
+
+func (s *Service) streamConversation(c echo.Context) error {
+	return s.ConvoHandler.StreamConversation(c)
+}
+
+func (s *Service) streamConversations(c echo.Context) error {
+	return s.ConvoHandler.StreamConversations(c)
+}
+
+// search
+func (s *Service) search(c echo.Context) error {
+	return s.SearchHandler.GetSearch(c)
+}
+
+// presence
+func (s *Service) getPresence(c echo.Context) error {
+	return s.PresHandler.GetPresence(c)
+}
+
+func (s *Service) putPresence(c echo.Context) error {
+	return s.PresHandler.PutPresence(c)
+}
+
+func (s *Service) postTyping(c echo.Context) error {
+	return s.PresHandler.PostTyping(c)
+}
+
+// bots
+func (s *Service) postBot(c echo.Context) error {
+	return s.BotHandler.PostBot(c)
+}
+
+func (s *Service) listBots(c echo.Context) error {
+	return s.BotHandler.ListBots(c)
+}
+
+func (s *Service) postCommand(c echo.Context) error {
+	return s.BotHandler.PostCommand(c)
+}
+
+func (s *Service) listCommands(c echo.Context) error {
+	return s.BotHandler.ListCommands(c)
+}
+
+func (s *Service) deleteCommand(c echo.Context) error {
+	return s.BotHandler.DeleteCommand(c)
+}
+
+func (s *Service) postKey(c echo.Context) error {
+	return s.BotHandler.PostKey(c)
+}
+
+func (s *Service) listKeys(c echo.Context) error {
+	return s.BotHandler.ListKeys(c)
+}
+
+func (s *Service) revokeKey(c echo.Context) error {
+	return s.BotHandler.RevokeKey(c)
+}
+
+// webhooks
+func (s *Service) postWebhook(c echo.Context) error {
+	return s.HookHandler.PostWebhook(c)
+}
+
+func (s *Service) listWebhooks(c echo.Context) error {
+	return s.HookHandler.ListWebhooks(c)
+}
+
+func (s *Service) getWebhook(c echo.Context) error {
+	return s.HookHandler.GetWebhook(c)
+}
+
+func (s *Service) deleteWebhook(c echo.Context) error {
+	return s.HookHandler.DeleteWebhook(c)
+}
+
+func (s *Service) listDeliveries(c echo.Context) error {
+	return s.HookHandler.ListDeliveries(c)
+}
+
+func (s *Service) retryDelivery(c echo.Context) error {
+	return s.HookHandler.RetryDelivery(c)
+}
+
+// groups
+func (s *Service) postGroup(c echo.Context) error {
+	return s.GroupHandler.PostGroup(c)
 }
 
+func (s *Service) listGroups(c echo.Context) error {
+	return s.GroupHandler.ListGroups(c)
+}
+
+func (s *Service) getGroup(c echo.Context) error {
+	return s.GroupHandler.GetGroup(c)
+}
+
+func (s *Service) postParticipant(c echo.Context) error {
+	return s.GroupHandler.PostParticipant(c)
+}
+
+func (s *Service) deleteParticipant(c echo.Context) error {
+	return s.GroupHandler.DeleteParticipant(c)
+}
+
+func (s *Service) postGroupMessage(c echo.Context) error {
+	return s.GroupHandler.PostGroupMessage(c)
+}
+
+func (s *Service) listGroupMessages(c echo.Context) error {
+	return s.GroupHandler.ListGroupMessages(c)
+}
+
+// guilds
+func (s *Service) postGuild(c echo.Context) error {
+	return s.GuildHandler.PostGuild(c)
+}
+
+func (s *Service) listGuilds(c echo.Context) error {
+	return s.GuildHandler.ListGuilds(c)
+}
+
+func (s *Service) getGuild(c echo.Context) error {
+	return s.GuildHandler.GetGuild(c)
+}
+
+func (s *Service) joinGuild(c echo.Context) error {
+	return s.GuildHandler.JoinGuild(c)
+}
+
+func (s *Service) leaveGuild(c echo.Context) error {
+	return s.GuildHandler.LeaveGuild(c)
+}
+
+func (s *Service) listMembers(c echo.Context) error {
+	return s.GuildHandler.ListMembers(c)
+}
+
+func (s *Service) kickMember(c echo.Context) error {
+	return s.GuildHandler.KickMember(c)
+}
+
+func (s *Service) putMemberRole(c echo.Context) error {
+	return s.GuildHandler.PutMemberRole(c)
+}
+
+func (s *Service) listRoles(c echo.Context) error {
+	return s.GuildHandler.ListRoles(c)
+}
+
+func (s *Service) postRole(c echo.Context) error {
+	return s.GuildHandler.PostRole(c)
+}
+
+func (s *Service) postChannel(c echo.Context) error {
+	return s.GuildHandler.PostChannel(c)
+}
+
+func (s *Service) postChannelMessage(c echo.Context) error {
+	return s.GuildHandler.PostChannelMessage(c)
+}
+
+func (s *Service) listChannelMessages(c echo.Context) error {
+	return s.GuildHandler.ListChannelMessages(c)
+}
+
+// users
 func (s *Service) getUserByID(c echo.Context) error {
 	return s.UserHandler.GetUserByID(c)
 }
@@ -165,3 +764,29 @@ func (s *Service) getUserByID(c echo.Context) error {
 func (s *Service) deleteUserByID(c echo.Context) error {
 	return s.UserHandler.DeleteUserbyID(c)
 }
+
+// auth
+func (s *Service) register(c echo.Context) error {
+	return s.AuthHandler.Register(c)
+}
+
+func (s *Service) login(c echo.Context) error {
+	return s.AuthHandler.Login(c)
+}
+
+func (s *Service) changePassword(c echo.Context) error {
+	return s.AuthHandler.ChangePassword(c)
+}
+
+func (s *Service) requestReset(c echo.Context) error {
+	return s.AuthHandler.RequestReset(c)
+}
+
+func (s *Service) resetPassword(c echo.Context) error {
+	return s.AuthHandler.ResetPassword(c)
+}
+
+// realtime
+func (s *Service) connectSocket(c echo.Context) error {
+	return s.SockHandler.Connect(c)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/db/mem"
+	"github.com/radean0909/guild-chat/api/internal/db/pg"
+	"github.com/radean0909/guild-chat/api/internal/db/sqlite"
+	"github.com/radean0909/guild-chat/api/internal/storage/local"
+)
+
+// Datastore names accepted by Config.DBDriver
+const (
+	DriverMem      = "mem"
+	DriverPostgres = "pg"
+	DriverSQLite   = "sqlite"
+)
+
+// Config - service configuration, populated by cmd/main.go from flags and environment
+type Config struct {
+	// DBDriver - the datastore to use, DriverMem (the default), DriverPostgres or DriverSQLite
+	DBDriver string
+	// Mem - persistence settings for DriverMem. If Mem.Dir is empty, nothing survives a restart
+	Mem mem.Config
+	// PG - postgres connection and pool settings, used by DriverPostgres
+	PG pg.Config
+	// SQLite - database file settings, used by DriverSQLite
+	SQLite sqlite.Config
+	// Auth - token signing settings
+	Auth AuthConfig
+	// Attachments - where attached files are stored, and how large they can be
+	Attachments AttachmentConfig
+	// Presence - how long users stay online, and typing, after they were last heard from
+	Presence PresenceConfig
+	// Webhooks - how often, and how far apart, webhook deliveries are attempted
+	Webhooks WebhookConfig
+	// RateLimits - how often people and bots can make requests
+	RateLimits RateLimitConfig
+}
+
+// AuthConfig - token signing settings
+type AuthConfig struct {
+	// Key - the HMAC key tokens are signed with. If empty a random key is generated, so tokens don't survive a restart
+	Key string
+	// TokenTTL - how long an issued token is valid for, defaults to 24 hours
+	TokenTTL time.Duration
+}
+
+// AttachmentConfig - attached file settings
+type AttachmentConfig struct {
+	// Local - stores files on the local filesystem. If Local.Dir is empty files are kept in memory, so nothing
+	// survives a restart
+	Local local.Config
+	// MaxSize - the largest file that can be attached, in bytes, defaults to DefaultMaxAttachmentSize
+	MaxSize int64
+}
+
+// PresenceConfig - presence and typing indicator settings
+type PresenceConfig struct {
+	// TTL - how long a user stays online after they were last heard from, defaults to DefaultPresenceTTL. Connected
+	// sockets answer a ping about once a minute, so this should be longer than that
+	TTL time.Duration
+	// TypingTTL - how long a user is shown typing unless they say they still are, defaults to DefaultTypingTTL
+	TypingTTL time.Duration
+}
+
+// WebhookConfig - webhook delivery settings
+type WebhookConfig struct {
+	// MaxAttempts - how many times a delivery is attempted before it is failed, defaults to DefaultWebhookAttempts
+	MaxAttempts int
+	// Backoff - how long to wait before retrying a delivery the first time, doubling after each failed attempt,
+	// defaults to DefaultWebhookBackoff
+	Backoff time.Duration
+	// MaxBackoff - the longest wait between attempts, defaults to DefaultWebhookMaxBackoff
+	MaxBackoff time.Duration
+}
+
+// RateLimitConfig - request rate limits, people and bots are limited separately
+type RateLimitConfig struct {
+	// Users - the limit for people, defaults to DefaultUserRate and DefaultUserBurst
+	Users RateLimit
+	// Bots - the limit for bots, defaults to DefaultBotRate and DefaultBotBurst
+	Bots RateLimit
+}
+
+// RateLimit - how many requests each user can make
+type RateLimit struct {
+	// Rate - requests a second
+	Rate float64
+	// Burst - requests that can be made at once, after a quiet spell
+	Burst int
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+const (
+	// attachmentField - the multipart form field files are uploaded in
+	attachmentField = "file"
+	// maxNameLength - the longest file name kept, in bytes. Longer names are cut short
+	maxNameLength = 255
+	// sniffLength - how much of a file is read to detect its type, see http.DetectContentType
+	sniffLength = 512
+	// formOverhead - room in an upload request for the multipart headers and boundaries around the file
+	formOverhead = 64 << 10
+)
+
+// PostAttachment - POST: upload a file as multipart/form-data, in the file field, and attach it to a message.
+// Only the sender can attach files to their message. The file's type is detected from its content rather than
+// trusted from the client, and its size and sha256 checksum are recorded alongside it
+func (h *MessageHandler) PostAttachment(c echo.Context) error {
+	msg, err := h.DB.GetMessage(c.Param("id"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	caller := callerID(c)
+	if msg.Sender != caller {
+		return handleError(c, constants.ErrForbidden)
+	}
+
+	// members who can no longer send to a channel can't add to what they sent either
+	if err := checkSend(h.DB, msg); err != nil {
+		return handleError(c, err)
+	}
+
+	if msg.DeletedAt != nil {
+		return handleError(c, constants.ErrBadRequest)
+	}
+
+	req := c.Request()
+	if req.ContentLength > h.MaxAttachmentSize+formOverhead {
+		return handleError(c, constants.ErrTooLarge)
+	}
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, h.MaxAttachmentSize+formOverhead)
+
+	// the file is streamed straight into blob storage, rather than buffered by the multipart form parser
+	form, err := req.MultipartReader()
+	if err != nil {
+		return handleError(c, constants.ErrBadRequest)
+	}
+
+	var part io.Reader
+	var name string
+	for part == nil {
+		p, err := form.NextPart()
+		if err != nil {
+			return handleError(c, constants.ErrBadRequest)
+		}
+		defer p.Close()
+
+		if p.FormName() == attachmentField {
+			part, name = p, fileName(p.FileName())
+		}
+	}
+
+	if name == "" {
+		return handleError(c, constants.ErrBadRequest)
+	}
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return handleError(c, constants.ErrBadRequest)
+	}
+	head = head[:n]
+
+	att := &models.Attachment{
+		ID:        uuid.New().String(),
+		MessageID: msg.ID,
+		Name:      name,
+		MIMEType:  http.DetectContentType(head),
+	}
+
+	upload := &upload{r: io.MultiReader(bytes.NewReader(head), part), hash: sha256.New(), max: h.MaxAttachmentSize}
+	if err := h.Blobs.Put(att.ID, upload); err != nil {
+		return handleError(c, err)
+	}
+
+	att.Size = upload.size
+	att.Checksum = hex.EncodeToString(upload.hash.Sum(nil))
+
+	added, err := h.DB.AddAttachment(caller, att)
+	if err != nil {
+		h.deleteFiles(c, []*models.Attachment{att})
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, added)
+}
+
+// GetAttachment - GET: download a file attached to a message. Anyone who can read a message can download its files
+func (h *MessageHandler) GetAttachment(c echo.Context) error {
+	msg, err := h.DB.GetMessage(c.Param("id"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if err := h.canRead(msg, callerID(c)); err != nil {
+		return handleError(c, err)
+	}
+
+	att, err := h.DB.GetAttachment(msg.ID, c.Param("attachment"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	file, err := h.Blobs.Get(att.ID)
+	if err != nil {
+		return handleError(c, err)
+	}
+	defer file.Close()
+
+	// always download rather than display, so an uploaded page can't run as this site, and never let the
+	// browser second guess the type
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": att.Name}))
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(att.Size, 10))
+
+	return c.Stream(http.StatusOK, att.MIMEType, file)
+}
+
+// deleteFiles - removes attachments' files from blob storage. Failures only leave an unreachable file behind,
+// so they are logged rather than failing the request
+func (h *MessageHandler) deleteFiles(c echo.Context, atts []*models.Attachment) {
+	for _, att := range atts {
+		if err := h.Blobs.Delete(att.ID); err != nil {
+			c.Logger().Warnf("deleting attachment %s: %v", att.ID, err)
+		}
+	}
+}
+
+// upload - reads an uploaded file, counting and hashing it as it goes, and fails with constants.ErrTooLarge
+// once it is larger than max
+type upload struct {
+	r    io.Reader
+	hash hash.Hash
+	size int64
+	max  int64
+}
+
+func (u *upload) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	u.size += int64(n)
+	if u.size > u.max {
+		return 0, constants.ErrTooLarge
+	}
+
+	u.hash.Write(p[:n])
+
+	return n, err
+}
+
+// fileName - the name an uploaded file is kept under, without any directories the client sent and cut short
+// if it is too long. Empty if there is nothing usable left
+func fileName(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.Replace(name, `\`, "/", -1)))
+	if name == "." || name == ".." || name == "/" || !utf8.ValidString(name) {
+		return ""
+	}
+
+	for len(name) > maxNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	return name
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/radean0909/guild-chat/api/internal/db/mem"
+	"github.com/radean0909/guild-chat/api/internal/storage/local"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// pngHeader - the start of every png file, enough for its type to be detected
+const pngHeader = "\x89PNG\r\n\x1a\n"
+
+func TestPostAttachment(t *testing.T) {
+	h, dir := newAttachmentHandler(t, 1<<10)
+	defer os.RemoveAll(dir)
+
+	alice := newTestUser(t, h.DB, "alice")
+	bob := newTestUser(t, h.DB, "bob")
+	msg := newTestMessage(t, h, alice, bob)
+
+	// the type is detected from the content, whatever the client says it is
+	content := pngHeader + strings.Repeat("x", 100)
+	rec := postAttachment(t, h, alice, msg, `..\..\photos/cat.png`, "text/html", strings.NewReader(content))
+	expectStatus(t, "attach", rec, http.StatusOK)
+
+	att := &models.Attachment{}
+	decode(t, rec, att)
+
+	sum := sha256.Sum256([]byte(content))
+	if att.Name != "cat.png" || att.MIMEType != "image/png" || att.Size != int64(len(content)) ||
+		att.Checksum != hex.EncodeToString(sum[:]) || att.MessageID != msg.ID {
+		t.Errorf("expected cat.png as an image/png with its size and checksum, got %+v", att)
+	}
+
+	// only the sender can attach files
+	rec = postAttachment(t, h, bob, msg, "cat.png", "image/png", strings.NewReader(content))
+	expectStatus(t, "attach to someone else's message", rec, http.StatusForbidden)
+
+	rec = postAttachment(t, h, alice, msg, "", "image/png", strings.NewReader(content))
+	expectStatus(t, "attach without a file name", rec, http.StatusBadRequest)
+}
+
+func TestPostAttachmentTooLarge(t *testing.T) {
+	h, dir := newAttachmentHandler(t, 1<<10)
+	defer os.RemoveAll(dir)
+
+	alice := newTestUser(t, h.DB, "alice")
+	bob := newTestUser(t, h.DB, "bob")
+	msg := newTestMessage(t, h, alice, bob)
+
+	// without a length up front the upload is only found to be too large part way through storing it
+	content := strings.Repeat("x", 2<<10)
+	rec := postAttachment(t, h, alice, msg, "big.txt", "text/plain", io.MultiReader(strings.NewReader(content)))
+	expectStatus(t, "attach a file too large", rec, http.StatusRequestEntityTooLarge)
+
+	// a request declaring more than could be allowed is refused before it is read
+	body := bytes.NewReader(make([]byte, 1<<20))
+	rec = postAttachment(t, h, alice, msg, "huge.txt", "text/plain", body)
+	expectStatus(t, "attach a file declared too large", rec, http.StatusRequestEntityTooLarge)
+
+	// neither left anything behind
+	stored, err := h.DB.GetMessage(msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Attachments) != 0 {
+		t.Errorf("expected no attachments, got %+v", stored.Attachments)
+	}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			t.Errorf("expected no blobs left behind, found %s", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostAttachmentChannelPermissions(t *testing.T) {
+	h, dir := newAttachmentHandler(t, 1<<10)
+	defer os.RemoveAll(dir)
+
+	owner := newTestUser(t, h.DB, "owner")
+	member := newTestUser(t, h.DB, "member")
+	guild := newTestGuild(t, h.DB, owner, member)
+
+	msg, err := h.DB.CreateMessage(&models.Message{Sender: member.ID, ChannelID: guild.Channels[0].ID, Content: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := postAttachment(t, h, member, msg, "a.txt", "text/plain", strings.NewReader("allowed"))
+	expectStatus(t, "attach while allowed to send", rec, http.StatusOK)
+
+	// once the member can't send to the channel, they can't add to what they sent either
+	if _, err := h.DB.CreateRole(guild.ID, "readonly", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.DB.SetRole(guild.ID, member.ID, "readonly"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = postAttachment(t, h, member, msg, "b.txt", "text/plain", strings.NewReader("not allowed"))
+	expectStatus(t, "attach without send", rec, http.StatusForbidden)
+}
+
+func TestGetAttachment(t *testing.T) {
+	h, dir := newAttachmentHandler(t, 1<<10)
+	defer os.RemoveAll(dir)
+
+	alice := newTestUser(t, h.DB, "alice")
+	bob := newTestUser(t, h.DB, "bob")
+	carol := newTestUser(t, h.DB, "carol")
+	msg := newTestMessage(t, h, alice, bob)
+
+	rec := postAttachment(t, h, alice, msg, "page.html", "text/html", strings.NewReader("<html><script></script></html>"))
+	expectStatus(t, "attach", rec, http.StatusOK)
+
+	att := &models.Attachment{}
+	decode(t, rec, att)
+
+	get := func(caller *models.User) *httptest.ResponseRecorder {
+		c, rec := newTestContext(t, testRequest{caller: caller.ID, params: map[string]string{"id": msg.ID, "attachment": att.ID}})
+		if err := h.GetAttachment(c); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	// the recipient can download it, always as a download so it can't run as this site
+	rec = get(bob)
+	expectStatus(t, "recipient downloads", rec, http.StatusOK)
+	if rec.Body.String() != "<html><script></script></html>" {
+		t.Errorf("expected the file's content, got %q", rec.Body.String())
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment") || rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("expected an attachment that isn't sniffed, got %v", rec.Header())
+	}
+
+	expectStatus(t, "sender downloads", get(alice), http.StatusOK)
+	expectStatus(t, "third party downloads", get(carol), http.StatusForbidden)
+}
+
+func TestFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"cat.png", "cat.png"},
+		{"  cat.png  ", "cat.png"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\alice\cat.png`, "cat.png"},
+		{"photos/", "photos"},
+		{"", ""},
+		{".", ""},
+		{"..", ""},
+		{"/", ""},
+		{"\xff.png", ""},
+		// cut short on a character boundary
+		{strings.Repeat("é", 200), strings.Repeat("é", maxNameLength/2)},
+	}
+
+	for _, tt := range tests {
+		if got := fileName(tt.name); got != tt.want {
+			t.Errorf("fileName(%q): expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+// newAttachmentHandler - a message handler storing files in a new temporary directory, which the caller removes
+func newAttachmentHandler(t *testing.T, maxSize int64) (*MessageHandler, string) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "guild-attachments")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blobs, err := local.NewStore(local.Config{Dir: dir})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return &MessageHandler{DB: mem.NewDriver(), Blobs: blobs, MaxAttachmentSize: maxSize}, dir
+}
+
+// newTestMessage - sends a message between two users, failing the test on error
+func newTestMessage(t *testing.T, h *MessageHandler, sender, recipient *models.User) *models.Message {
+	t.Helper()
+
+	msg, err := h.DB.CreateMessage(&models.Message{Sender: sender.ID, Recipient: recipient.ID, Content: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// postAttachment - uploads a file to a message as caller, with the file name and type the client sends
+func postAttachment(t *testing.T, h *MessageHandler, caller *models.User, msg *models.Message, name, mimeType string,
+	content io.Reader) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form := &bytes.Buffer{}
+	w := multipart.NewWriter(form)
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="`+attachmentField+`"; filename="`+name+`"`)
+	header.Set("Content-Type", mimeType)
+	part, err := w.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// keep the content's type, so a reader with no length up front is sent without one
+	var body io.Reader = form
+	if _, ok := content.(interface{ Len() int }); !ok {
+		body = io.MultiReader(form)
+	}
+
+	c, rec := newTestContext(t, testRequest{
+		method:      http.MethodPost,
+		caller:      caller.ID,
+		params:      map[string]string{"id": msg.ID},
+		raw:         body,
+		contentType: w.FormDataContentType(),
+	})
+	if err := h.PostAttachment(c); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/auth"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/ratelimit"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// keyTouchInterval - how often an API key's last used time is updated while it is in use
+const keyTouchInterval = time.Minute
+
+// AuthHandler - registers users and manages their passwords, issues tokens, and authenticates requests carrying them
+// or an API key
+type AuthHandler struct {
+	DB     db.Driver
+	Tokens *auth.Issuer
+	Limits *RateLimits
+
+	// SendReset - delivers a password reset token to a user, ie: by email
+	SendReset func(user *models.User, token string) error
+
+	// Attempts - limits password guessing on login and password resets, both per address and per username, so
+	// neither spreading guesses over many accounts nor over many addresses gets far. Nil doesn't limit anyone
+	Attempts *ratelimit.Limiter
+}
+
+// addressKey, usernameKey - the Attempts keys for a client address and a username. The address is echo's RealIP,
+// which trusts X-Forwarded-For - the service is expected to run behind a load balancer that sets it
+func addressKey(c echo.Context) string {
+	return "ip|" + c.RealIP()
+}
+
+func usernameKey(username string) string {
+	return "user|" + username
+}
+
+// Register - creates a new user with a password
+func (h *AuthHandler) Register(c echo.Context) error {
+	reg := &models.Registration{}
+
+	if err := c.Bind(reg); err != nil {
+		return handleError(c, err)
+	}
+
+	hash, err := auth.HashPassword(reg.Password)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	// the user and their password are created together, a user without a password could never log in
+	user, err := h.DB.CreateAccount(&models.User{Username: reg.Username, Email: reg.Email}, hash)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+// Login - exchanges a username and password for a signed token
+func (h *AuthHandler) Login(c echo.Context) error {
+	creds := &models.Credentials{}
+
+	if err := c.Bind(creds); err != nil {
+		return handleError(c, err)
+	}
+
+	if creds.Username == "" || creds.Password == "" {
+		return handleError(c, constants.ErrBadRequest)
+	}
+
+	if err := throttle(c, h.Attempts, addressKey(c), usernameKey(creds.Username)); err != nil {
+		return handleError(c, err)
+	}
+
+	// don't tip off whether it was the username or the password that was wrong
+	var hash string
+	user, err := h.DB.GetUserByUsername(creds.Username)
+	if err == nil {
+		hash, _ = h.DB.GetPassword(user.ID)
+	}
+
+	if err := auth.CheckPassword(hash, creds.Password); err != nil {
+		return handleError(c, err)
+	}
+
+	token, expires, err := h.Tokens.Issue(user.ID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &models.Token{Token: token, UserID: user.ID, Expires: &expires})
+}
+
+// ChangePassword - replaces the caller's password, given their current one
+func (h *AuthHandler) ChangePassword(c echo.Context) error {
+	change := &models.PasswordChange{}
+
+	if err := c.Bind(change); err != nil {
+		return handleError(c, err)
+	}
+
+	userID := callerID(c)
+
+	// a user who has never set a password can't prove they know it
+	hash, _ := h.DB.GetPassword(userID)
+	if err := auth.CheckPassword(hash, change.CurrentPassword); err != nil {
+		return handleError(c, err)
+	}
+
+	newHash, err := auth.HashPassword(change.NewPassword)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if err := h.DB.SetPassword(userID, newHash); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// RequestReset - sends a password reset token to a user. Always accepted, so it can't be used to find
+// out which usernames exist
+func (h *AuthHandler) RequestReset(c echo.Context) error {
+	req := &models.ResetRequest{}
+
+	if err := c.Bind(req); err != nil {
+		return handleError(c, err)
+	}
+
+	if req.Username == "" {
+		return handleError(c, constants.ErrBadRequest)
+	}
+
+	if err := throttle(c, h.Attempts, addressKey(c), usernameKey(req.Username)); err != nil {
+		return handleError(c, err)
+	}
+
+	user, err := h.DB.GetUserByUsername(req.Username)
+	if err != nil {
+		if err == constants.ErrNotFound {
+			return c.JSON(http.StatusAccepted, nil)
+		}
+		return handleError(c, err)
+	}
+
+	token, hash, err := auth.NewResetToken()
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if err := h.DB.CreatePasswordReset(user.ID, hash, time.Now().Add(auth.ResetTTL)); err != nil {
+		return handleError(c, err)
+	}
+
+	if err := h.SendReset(user, token); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusAccepted, nil)
+}
+
+// ResetPassword - sets a new password using a token from RequestReset. Each token works once
+func (h *AuthHandler) ResetPassword(c echo.Context) error {
+	reset := &models.PasswordReset{}
+
+	if err := c.Bind(reset); err != nil {
+		return handleError(c, err)
+	}
+
+	if reset.Token == "" {
+		return handleError(c, constants.ErrBadRequest)
+	}
+
+	// the token doesn't say whose it is until it's used, so only the address can be limited
+	if err := throttle(c, h.Attempts, addressKey(c)); err != nil {
+		return handleError(c, err)
+	}
+
+	// check the new password before using up the token, so a typo doesn't need a new reset
+	hash, err := auth.HashPassword(reset.NewPassword)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	userID, err := h.DB.ConsumePasswordReset(auth.HashResetToken(reset.Token))
+	if err != nil {
+		if err == constants.ErrNotFound {
+			return handleError(c, constants.ErrUnauthorized)
+		}
+		return handleError(c, err)
+	}
+
+	if err := h.DB.SetPassword(userID, hash); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// Authenticate - middleware requiring a valid token or API key, in the Authorization header, for a user that still
+// exists. The user id is available to handlers through callerID. Each user is then held to their rate limit
+func (h *AuthHandler) Authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		credential := strings.TrimPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if credential == "" {
+			return handleError(c, constants.ErrUnauthorized)
+		}
+
+		var key *models.APIKey
+		var userID string
+		var err error
+		if auth.IsAPIKey(credential) {
+			// revoked keys aren't found
+			if key, err = h.DB.GetAPIKeyByHash(auth.HashAPIKey(credential)); err != nil {
+				return handleError(c, constants.ErrUnauthorized)
+			}
+			userID = key.UserID
+		} else if userID, err = h.Tokens.Parse(credential); err != nil {
+			return handleError(c, err)
+		}
+
+		// deleted users' tokens and keys stop working straight away
+		user, err := h.DB.GetUser(userID)
+		if err != nil {
+			return handleError(c, constants.ErrUnauthorized)
+		}
+
+		if err := h.Limits.take(c, user); err != nil {
+			return handleError(c, err)
+		}
+
+		if key != nil {
+			h.touch(key)
+			c.Set(apiKeyKey, key)
+		}
+
+		c.Set(callerKey, userID)
+		c.Set(botKey, user.Bot)
+		return next(c)
+	}
+}
+
+// RequireScope - middleware for routes in an area API keys need a scope for. GET requests need the area's read
+// scope, anything else its write scope. Requests with a token from Login aren't limited by scopes
+func (h *AuthHandler) RequireScope(area string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			method := c.Request().Method
+			if !allowed(c, area, method != http.MethodGet && method != http.MethodHead) {
+				return handleError(c, constants.ErrForbidden)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RequireSession - middleware for routes that need a token from Login, so an API key can't be used to change a
+// password, or to make or manage bots and keys
+func (h *AuthHandler) RequireSession(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if callerAPIKey(c) != nil {
+			return handleError(c, constants.ErrForbidden)
+		}
+
+		return next(c)
+	}
+}
+
+// accessTokenParam - the query param QueryToken reads a token from
+const accessTokenParam = "access_token"
+
+// QueryToken - middleware for the routes clients can't set headers on (browser websockets and event streams),
+// accepting the token in the access_token query param instead. It goes before Authenticate, moving the token
+// into the Authorization header and cutting it from the request's url so it never reaches the access log.
+// API keys are refused: they live until revoked, so one in a url that is kept somewhere would be usable long after,
+// and clients with a key can set the header
+func QueryToken(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+
+		query := req.URL.Query()
+		if token := query.Get(accessTokenParam); token != "" {
+			query.Del(accessTokenParam)
+			req.URL.RawQuery = query.Encode()
+			req.RequestURI = req.URL.RequestURI()
+
+			if auth.IsAPIKey(token) {
+				return handleError(c, constants.ErrUnauthorized)
+			}
+
+			if req.Header.Get(echo.HeaderAuthorization) == "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			}
+		}
+
+		return next(c)
+	}
+}
+
+// touch - records that an API key was used. It is only recorded once every keyTouchInterval, rather than writing to
+// the datastore on every request, and a failure to record it doesn't fail the request
+func (h *AuthHandler) touch(key *models.APIKey) {
+	now := time.Now()
+	if key.LastUsed != nil && now.Sub(*key.LastUsed) < keyTouchInterval {
+		return
+	}
+
+	h.DB.TouchAPIKey(key.ID, now)
+}
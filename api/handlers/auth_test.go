@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db/mem"
+	"github.com/radean0909/guild-chat/api/internal/ratelimit"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func TestAuthenticate(t *testing.T) {
+	driver := mem.NewDriver()
+	h := &AuthHandler{DB: driver, Tokens: testTokens}
+
+	alice := newTestUser(t, driver, "alice")
+	gone := newTestUser(t, driver, "gone")
+	if err := driver.DeleteUser(gone.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.GET("/me", func(c echo.Context) error {
+		return c.String(http.StatusOK, callerID(c))
+	}, h.Authenticate)
+
+	rec := serve(t, e, http.MethodGet, "/me", newTestToken(t, alice.ID), nil)
+	expectStatus(t, "valid token", rec, http.StatusOK)
+	if rec.Body.String() != alice.ID {
+		t.Errorf("expected the caller to be alice, got %q", rec.Body.String())
+	}
+
+	expectStatus(t, "no token", serve(t, e, http.MethodGet, "/me", "", nil), http.StatusUnauthorized)
+	expectStatus(t, "bad token", serve(t, e, http.MethodGet, "/me", "not-a-token", nil), http.StatusUnauthorized)
+	expectStatus(t, "deleted user", serve(t, e, http.MethodGet, "/me", newTestToken(t, gone.ID), nil), http.StatusUnauthorized)
+
+	// tokens in the url end up in logs and browser history, so only the routes behind QueryToken accept them
+	query := serve(t, e, http.MethodGet, "/me?access_token="+newTestToken(t, alice.ID), "", nil)
+	expectStatus(t, "token as a query param", query, http.StatusUnauthorized)
+}
+
+func TestQueryToken(t *testing.T) {
+	driver := mem.NewDriver()
+	h := &AuthHandler{DB: driver, Tokens: testTokens}
+
+	alice := newTestUser(t, driver, "alice")
+	token := newTestToken(t, alice.ID)
+
+	logged := &bytes.Buffer{}
+	e := echo.New()
+	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{Format: "${uri}\n", Output: logged}))
+	e.GET("/stream", func(c echo.Context) error {
+		// the rest of the query is left for the handler
+		return c.String(http.StatusOK, callerID(c)+" "+c.QueryParam("last_event_id")+c.QueryParam("access_token"))
+	}, QueryToken, h.Authenticate)
+
+	rec := serve(t, e, http.MethodGet, "/stream?access_token="+token+"&last_event_id=42", "", nil)
+	expectStatus(t, "token as a query param", rec, http.StatusOK)
+	if rec.Body.String() != alice.ID+" 42" {
+		t.Errorf("expected alice with the last event id and no token, got %q", rec.Body.String())
+	}
+
+	if strings.Contains(logged.String(), token) || strings.Contains(logged.String(), "access_token") ||
+		!strings.Contains(logged.String(), "last_event_id=42") {
+		t.Errorf("expected the token cut from the logged url, got %q", logged.String())
+	}
+
+	// the header still works, and is preferred
+	rec = serve(t, e, http.MethodGet, "/stream?access_token=not-a-token", token, nil)
+	expectStatus(t, "token in the header", rec, http.StatusOK)
+
+	expectStatus(t, "bad token as a query param", serve(t, e, http.MethodGet, "/stream?access_token=not-a-token", "", nil),
+		http.StatusUnauthorized)
+	expectStatus(t, "no token", serve(t, e, http.MethodGet, "/stream", "", nil), http.StatusUnauthorized)
+
+	// API keys only work in the header, though one in the url is still kept out of the log
+	key := newTestAPIKey(t, driver, alice, models.ReadScope(models.ScopeMessages))
+	logged.Reset()
+
+	expectStatus(t, "key as a query param", serve(t, e, http.MethodGet, "/stream?access_token="+key, "", nil),
+		http.StatusUnauthorized)
+	if strings.Contains(logged.String(), key) {
+		t.Errorf("expected the key cut from the logged url, got %q", logged.String())
+	}
+
+	expectStatus(t, "key in the header", serve(t, e, http.MethodGet, "/stream", key, nil), http.StatusOK)
+}
+
+func TestRequireScope(t *testing.T) {
+	driver := mem.NewDriver()
+	h := &AuthHandler{DB: driver, Tokens: testTokens}
+	e := newMessageRoutes(h)
+
+	alice := newTestUser(t, driver, "alice")
+	bob := newTestUser(t, driver, "bob")
+
+	rec := sendTestMessage(t, e, newTestToken(t, alice.ID), bob)
+	expectStatus(t, "send with a token", rec, http.StatusOK)
+	msg := &models.Message{}
+	decode(t, rec, msg)
+
+	read := func(credential string) *httptest.ResponseRecorder {
+		return serve(t, e, http.MethodGet, "/message/"+msg.ID, credential, nil)
+	}
+
+	readOnly := newTestAPIKey(t, driver, alice, models.ReadScope(models.ScopeMessages))
+	expectStatus(t, "send with a read only key", sendTestMessage(t, e, readOnly, bob), http.StatusForbidden)
+	expectStatus(t, "read with a read only key", read(readOnly), http.StatusOK)
+
+	writer := newTestAPIKey(t, driver, alice, models.WriteScope(models.ScopeMessages))
+	expectStatus(t, "send with a write key", sendTestMessage(t, e, writer, bob), http.StatusOK)
+
+	other := newTestAPIKey(t, driver, alice, models.ReadScope(models.ScopeGuilds), models.WriteScope(models.ScopeGuilds))
+	expectStatus(t, "send with another area's key", sendTestMessage(t, e, other, bob), http.StatusForbidden)
+	expectStatus(t, "read with another area's key", read(other), http.StatusForbidden)
+
+	expectStatus(t, "send with an unknown key", sendTestMessage(t, e, "gk_unknown", bob), http.StatusUnauthorized)
+	expectStatus(t, "send without credentials", sendTestMessage(t, e, "", bob), http.StatusUnauthorized)
+}
+
+func TestRequireSession(t *testing.T) {
+	driver := mem.NewDriver()
+	h := &AuthHandler{DB: driver, Tokens: testTokens}
+
+	alice := newTestUser(t, driver, "alice")
+
+	e := echo.New()
+	e.GET("/key", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, h.Authenticate, h.RequireSession)
+
+	expectStatus(t, "token", serve(t, e, http.MethodGet, "/key", newTestToken(t, alice.ID), nil), http.StatusOK)
+
+	// however much it is allowed
+	key := newTestAPIKey(t, driver, alice, models.ReadScope(models.ScopeUsers), models.WriteScope(models.ScopeUsers))
+	expectStatus(t, "API key", serve(t, e, http.MethodGet, "/key", key, nil), http.StatusForbidden)
+}
+
+func TestRateLimits(t *testing.T) {
+	driver := mem.NewDriver()
+	h := &AuthHandler{
+		DB:     driver,
+		Tokens: testTokens,
+		Limits: &RateLimits{
+			Users: ratelimit.NewLimiter(1, 2),
+			Bots:  ratelimit.NewLimiter(1, 4),
+		},
+	}
+	e := newMessageRoutes(h)
+
+	alice := newTestUser(t, driver, "alice")
+	bob := newTestUser(t, driver, "bob")
+
+	bot, err := driver.CreateUser(&models.User{Username: "robot", Bot: true, Owner: alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// people and bots are held to their own limits
+	token := newTestToken(t, alice.ID)
+	for i := 0; i < 2; i++ {
+		expectStatus(t, "send within the user burst", sendTestMessage(t, e, token, bob), http.StatusOK)
+	}
+	rec := sendTestMessage(t, e, token, bob)
+	expectStatus(t, "send past the user burst", rec, http.StatusTooManyRequests)
+	if after := rec.Header().Get("Retry-After"); after != "1" {
+		t.Errorf("expected Retry-After 1, got %q", after)
+	}
+
+	robot := newTestAPIKey(t, driver, bot, models.WriteScope(models.ScopeMessages))
+	for i := 0; i < 4; i++ {
+		expectStatus(t, "send within the bot burst", sendTestMessage(t, e, robot, bob), http.StatusOK)
+	}
+	expectStatus(t, "send past the bot burst", sendTestMessage(t, e, robot, bob), http.StatusTooManyRequests)
+
+	// each user has a bucket of their own
+	expectStatus(t, "send as another user", sendTestMessage(t, e, newTestToken(t, bob.ID), alice), http.StatusOK)
+}
+
+func TestRegister(t *testing.T) {
+	driver := mem.NewDriver()
+	h := &AuthHandler{DB: driver, Tokens: testTokens}
+
+	register := func(reg *models.Registration) *httptest.ResponseRecorder {
+		c, rec := newTestContext(t, testRequest{method: http.MethodPost, body: reg})
+		if err := h.Register(c); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	rec := register(&models.Registration{Username: "alice", Email: "alice@example.com", Password: "correct horse"})
+	expectStatus(t, "register", rec, http.StatusOK)
+
+	alice := &models.User{}
+	decode(t, rec, alice)
+	if _, err := driver.GetPassword(alice.ID); err != nil {
+		t.Errorf("expected alice's password to be set, got %v", err)
+	}
+
+	// a refused registration leaves nothing behind, so the username can still be taken
+	rec = register(&models.Registration{Username: "bob", Email: "bob@example.com", Password: "short"})
+	expectStatus(t, "short password", rec, http.StatusBadRequest)
+	if _, err := driver.GetUserByUsername("bob"); err != constants.ErrNotFound {
+		t.Errorf("expected no user left by a refused registration, got %v", err)
+	}
+
+	rec = register(&models.Registration{Username: "bob", Email: "bob@example.com", Password: "correct horse"})
+	expectStatus(t, "register after a refusal", rec, http.StatusOK)
+
+	rec = register(&models.Registration{Username: "alice", Email: "other@example.com", Password: "correct horse"})
+	expectStatus(t, "duplicate username", rec, http.StatusBadRequest)
+}
+
+func TestLogin(t *testing.T) {
+	driver := mem.NewDriver()
+	h := &AuthHandler{DB: driver, Tokens: testTokens}
+
+	alice := newTestAccount(t, driver, "alice", "correct horse")
+
+	tests := []struct {
+		name   string
+		creds  *models.Credentials
+		status int
+	}{
+		{"matching password", &models.Credentials{Username: "alice", Password: "correct horse"}, http.StatusOK},
+		{"wrong password", &models.Credentials{Username: "alice", Password: "battery staple"}, http.StatusUnauthorized},
+		{"unknown user", &models.Credentials{Username: "nobody", Password: "correct horse"}, http.StatusUnauthorized},
+		{"missing password", &models.Credentials{Username: "alice"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		c, rec := newTestContext(t, testRequest{method: http.MethodPost, body: tt.creds})
+		if err := h.Login(c); err != nil {
+			t.Fatal(err)
+		}
+		expectStatus(t, tt.name, rec, tt.status)
+
+		if tt.status != http.StatusOK {
+			continue
+		}
+
+		token := &models.Token{}
+		decode(t, rec, token)
+		if userID, err := testTokens.Parse(token.Token); err != nil || userID != alice.ID || token.UserID != alice.ID {
+			t.Errorf("%s: expected a token for alice, got %+v, %v", tt.name, token, err)
+		}
+	}
+}
+
+func TestAuthAttempts(t *testing.T) {
+	driver := mem.NewDriver()
+	h := &AuthHandler{
+		DB:        driver,
+		Tokens:    testTokens,
+		SendReset: func(user *models.User, token string) error { return nil },
+		// two attempts each, and none back during the test
+		Attempts: ratelimit.NewLimiter(1.0/3600, 2),
+	}
+
+	newTestAccount(t, driver, "alice", "correct horse")
+	newTestAccount(t, driver, "bob", "correct horse")
+
+	// from is the client's address, as the load balancer forwards it
+	attempt := func(call echo.HandlerFunc, from string, body interface{}) *httptest.ResponseRecorder {
+		c, rec := newTestContext(t, testRequest{method: http.MethodPost, body: body})
+		c.Request().Header.Set(echo.HeaderXForwardedFor, from)
+		if err := call(c); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	guess := &models.Credentials{Username: "alice", Password: "battery staple"}
+
+	// guessing one username is limited however many addresses the guesses come from
+	expectStatus(t, "first guess", attempt(h.Login, "192.0.2.1", guess), http.StatusUnauthorized)
+	expectStatus(t, "second guess", attempt(h.Login, "192.0.2.2", guess), http.StatusUnauthorized)
+
+	rec := attempt(h.Login, "192.0.2.3", &models.Credentials{Username: "alice", Password: "correct horse"})
+	expectStatus(t, "third guess", rec, http.StatusTooManyRequests)
+	// less however long hashing the earlier guesses took
+	if after, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || after < 3500 || after > 3600 {
+		t.Errorf("expected to retry after about an hour, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	reset := &models.ResetRequest{Username: "alice"}
+	expectStatus(t, "reset for a guessed username", attempt(h.RequestReset, "192.0.2.4", reset), http.StatusTooManyRequests)
+
+	// as is one address however many usernames it tries
+	expectStatus(t, "reset", attempt(h.RequestReset, "198.51.100.1", &models.ResetRequest{Username: "bob"}), http.StatusAccepted)
+	expectStatus(t, "reset unknown", attempt(h.RequestReset, "198.51.100.1", &models.ResetRequest{Username: "nobody"}), http.StatusAccepted)
+
+	bob := &models.Credentials{Username: "bob", Password: "correct horse"}
+	expectStatus(t, "login from a limited address", attempt(h.Login, "198.51.100.1", bob), http.StatusTooManyRequests)
+
+	confirm := &models.PasswordReset{Token: "not-a-token", NewPassword: "correct horse"}
+	expectStatus(t, "confirm from a limited address", attempt(h.ResetPassword, "198.51.100.1", confirm), http.StatusTooManyRequests)
+
+	// guessing reset tokens is limited by address
+	expectStatus(t, "first token guess", attempt(h.ResetPassword, "203.0.113.1", confirm), http.StatusUnauthorized)
+	expectStatus(t, "second token guess", attempt(h.ResetPassword, "203.0.113.1", confirm), http.StatusUnauthorized)
+	expectStatus(t, "third token guess", attempt(h.ResetPassword, "203.0.113.1", confirm), http.StatusTooManyRequests)
+}
+
+// newMessageRoutes - sending and reading messages behind Authenticate and RequireScope, as the service has them
+func newMessageRoutes(h *AuthHandler) *echo.Echo {
+	messages := &MessageHandler{DB: h.DB}
+	scope := h.RequireScope(models.ScopeMessages)
+
+	e := echo.New()
+	e.POST("/message", messages.PostMessage, h.Authenticate, scope)
+	e.GET("/message/:id", messages.GetMessageByID, h.Authenticate, scope)
+	return e
+}
+
+// sendTestMessage - sends a message to recipient through e, with credential as the bearer
+func sendTestMessage(t *testing.T, e *echo.Echo, credential string, recipient *models.User) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return serve(t, e, http.MethodPost, "/message", credential, &models.Message{Recipient: recipient.ID, Content: "hi"})
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/auth"
+	"github.com/radean0909/guild-chat/api/internal/commands"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/webhooks"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// BotHandler - bot accounts and API keys. A bot is owned by the user who made it, who manages its keys. Bots can't
+// log in, so keys are the only way they authenticate. People can have keys of their own too
+type BotHandler struct {
+	DB db.Driver
+}
+
+// PostBot - creates a bot owned by the caller. It can't do anything until it is given an API key
+func (h *BotHandler) PostBot(c echo.Context) error {
+	bot := &models.User{}
+
+	if err := c.Bind(bot); err != nil {
+		return handleError(c, err)
+	}
+
+	bot, err := h.DB.CreateUser(&models.User{Username: bot.Username, Bot: true, Owner: callerID(c)})
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, bot)
+}
+
+// ListBots - lists the caller's bots, by username
+func (h *BotHandler) ListBots(c echo.Context) error {
+	bots, err := h.DB.ListBots(callerID(c))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, bots)
+}
+
+// PostKey - creates an API key for the caller or, with a user_id, one of their bots. Responds with the key, which
+// is never returned again
+func (h *BotHandler) PostKey(c echo.Context) error {
+	key := &models.APIKey{}
+
+	if err := c.Bind(key); err != nil {
+		return handleError(c, err)
+	}
+
+	if key.UserID == "" {
+		key.UserID = callerID(c)
+	}
+
+	if err := h.canManage(c, key.UserID); err != nil {
+		return handleError(c, err)
+	}
+
+	secret, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	key, err = h.DB.CreateAPIKey(&models.APIKey{UserID: key.UserID, Name: key.Name, Scopes: key.Scopes, Prefix: prefix}, hash)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	key.Key = secret
+	return c.JSON(http.StatusOK, key)
+}
+
+// ListKeys - lists the caller's API keys or, with a user_id, one of their bots', revoked ones included, oldest first
+func (h *BotHandler) ListKeys(c echo.Context) error {
+	userID := c.QueryParam("user_id")
+	if userID == "" {
+		userID = callerID(c)
+	}
+
+	if err := h.canManage(c, userID); err != nil {
+		return handleError(c, err)
+	}
+
+	keys, err := h.DB.ListAPIKeys(userID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, keys)
+}
+
+// RevokeKey - revokes one of the caller's, or their bots', API keys. It stops working straight away
+func (h *BotHandler) RevokeKey(c echo.Context) error {
+	key, err := h.DB.GetAPIKey(c.Param("id"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if err := h.canManage(c, key.UserID); err != nil {
+		return handleError(c, err)
+	}
+
+	if err := h.DB.RevokeAPIKey(key.ID); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// PostCommand - registers a slash command for one of the caller's bots. Invocations are posted to the command's URL,
+// and the response is the secret they are signed with, which is never returned again
+func (h *BotHandler) PostCommand(c echo.Context) error {
+	cmd := &models.Command{}
+
+	if err := c.Bind(cmd); err != nil {
+		return handleError(c, err)
+	}
+
+	bot, err := h.bot(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	cmd.Name = strings.ToLower(strings.TrimPrefix(cmd.Name, commands.Prefix))
+	if !commands.ValidName(cmd.Name) || findBuiltin(cmd.Name) != nil {
+		return handleError(c, constants.ErrBadRequest)
+	}
+
+	// the server posts to the URL, so it can't be used to reach the server itself or the network behind it
+	if err := webhooks.CheckURL(cmd.URL); err != nil {
+		return handleError(c, err)
+	}
+
+	cmd.BotID = bot.ID
+	if cmd.Secret, err = webhooks.NewSecret(); err != nil {
+		return handleError(c, err)
+	}
+
+	cmd, err = h.DB.CreateCommand(cmd)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, cmd)
+}
+
+// ListCommands - lists one of the caller's bots' slash commands, by name, without their secrets
+func (h *BotHandler) ListCommands(c echo.Context) error {
+	bot, err := h.bot(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	cmds, err := h.DB.ListCommands(bot.ID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	for _, cmd := range cmds {
+		cmd.Secret = ""
+	}
+
+	return c.JSON(http.StatusOK, cmds)
+}
+
+// DeleteCommand - removes one of the caller's bots' slash commands
+func (h *BotHandler) DeleteCommand(c echo.Context) error {
+	bot, err := h.bot(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if err := h.DB.DeleteCommand(bot.ID, strings.ToLower(c.Param("name"))); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// bot - the bot in the path, forbidden unless it is one of the caller's
+func (h *BotHandler) bot(c echo.Context) (*models.User, error) {
+	bot, err := h.DB.GetUser(c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if !bot.Bot || bot.Owner != callerID(c) {
+		return nil, constants.ErrForbidden
+	}
+
+	return bot, nil
+}
+
+// canManage - forbidden unless the user is the caller, or one of the caller's bots
+func (h *BotHandler) canManage(c echo.Context, userID string) error {
+	caller := callerID(c)
+	if userID == caller {
+		return nil
+	}
+
+	user, err := h.DB.GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.Bot || user.Owner != caller {
+		return constants.ErrForbidden
+	}
+
+	return nil
+}
@@ -0,0 +1,510 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/commands"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// defaultMuteDuration - how long /mute mutes a member for, unless it is given a duration
+const defaultMuteDuration = 10 * time.Minute
+
+type (
+	// CommandHandler - slash commands. A message starting with a slash is run as a command rather than sent, either
+	// one of the built-in commands or one registered by a bot in the conversation, group or channel, which is posted
+	// to the bot. Commands answer by sending a message as usual, or with an ephemeral reply that only the caller
+	// sees and that is never stored. Commands that need guild permissions can only be run in a guild's channels
+	CommandHandler struct {
+		DB db.Driver
+		// Callbacks - posts invocations of bots' commands to the bots
+		Callbacks *commands.Client
+	}
+
+	// builtin - a command the service runs itself
+	builtin struct {
+		name        string
+		usage       string
+		description string
+		perms       models.Permission // guild permissions needed to run it
+		scope       string            // the area an API key needs to be able to write to, to run it
+		run         func(h *CommandHandler, call *commandCall) (*models.Message, error)
+	}
+
+	// commandCall - a command being run, who by, and where
+	commandCall struct {
+		*commands.Invocation
+		caller *models.User
+		msg    *models.Message      // the message that invoked it, for the recipient, group or channel it was sent to
+		group  *models.Conversation // the group it was sent to, if it was
+		access *guildAccess         // the caller's access to the guild, when it was sent to a channel
+	}
+)
+
+// builtins - the built-in commands, by name
+func builtins() []*builtin {
+	return []*builtin{
+		{name: "help", usage: "[command]", description: "lists the commands you can run here, or explains one", run: (*CommandHandler).help},
+		{name: "me", usage: "<action>", description: "sends an action, ie: /me waves", run: (*CommandHandler).me},
+		{name: "mute", usage: "<username> [duration]", description: "stops a member sending to this guild's channels, for 10m unless given a duration",
+			perms: models.PermMute, scope: models.ScopeGuilds, run: (*CommandHandler).mute},
+		{name: "unmute", usage: "<username>", description: "lets a muted member send to this guild's channels again",
+			perms: models.PermMute, scope: models.ScopeGuilds, run: (*CommandHandler).unmute},
+	}
+}
+
+// findBuiltin - the built-in command called name, nil if there isn't one
+func findBuiltin(name string) *builtin {
+	for _, cmd := range builtins() {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// Run - runs a message as a slash command, if it is one. ok is false for an ordinary message, which is left ready to
+// send. Otherwise reply is either a message the command sent, or an ephemeral reply for the caller, and nil when the
+// command had nothing to say. key is the API key the caller authenticated with, nil for a token from Login.
+// A nil handler runs nothing
+func (h *CommandHandler) Run(msg *models.Message, key *models.APIKey) (reply *models.Message, ok bool, err error) {
+	// ephemeral messages only come from commands, they can't be sent
+	msg.Ephemeral = false
+
+	if h == nil {
+		return nil, false, nil
+	}
+
+	inv, err := commands.Parse(msg.Content)
+	if err != nil {
+		return nil, true, err
+	}
+
+	if inv == nil {
+		msg.Content = commands.Unescape(msg.Content)
+		return nil, false, nil
+	}
+
+	call, err := h.call(inv, msg)
+	if err != nil {
+		return nil, true, err
+	}
+
+	if inv.Bot == "" {
+		if cmd := findBuiltin(inv.Name); cmd != nil {
+			if cmd.scope != "" && key != nil && !key.Allows(cmd.scope, true) {
+				return nil, true, constants.ErrForbidden
+			}
+
+			if reply, err := call.require(cmd.name, cmd.perms); reply != nil || err != nil {
+				return reply, true, err
+			}
+
+			reply, err := cmd.run(h, call)
+			return reply, true, err
+		}
+	}
+
+	reply, err = h.runBot(call)
+	return reply, true, err
+}
+
+// call - checks the caller can send where a command was sent, forbidden if they can't
+func (h *CommandHandler) call(inv *commands.Invocation, msg *models.Message) (*commandCall, error) {
+	caller, err := h.DB.GetUser(msg.Sender)
+	if err != nil {
+		return nil, err
+	}
+
+	call := &commandCall{Invocation: inv, caller: caller, msg: msg}
+
+	switch {
+	case msg.GroupID != "" && msg.ChannelID == "" && msg.Recipient == "":
+		if call.group, err = h.DB.GetGroup(msg.GroupID); err != nil {
+			return nil, err
+		}
+
+		if !isParticipant(call.group, caller.ID) {
+			return nil, constants.ErrForbidden
+		}
+
+	case msg.ChannelID != "" && msg.GroupID == "" && msg.Recipient == "":
+		if call.access, err = sendAccess(h.DB, msg); err != nil {
+			return nil, err
+		}
+
+	case msg.Recipient != "" && msg.GroupID == "" && msg.ChannelID == "":
+		if _, err := h.DB.GetUser(msg.Recipient); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, constants.ErrBadRequest
+	}
+
+	return call, nil
+}
+
+// require - checks the caller has every guild permission in perms, forbidden if they don't. Outside a guild's
+// channels, commands that need permissions are answered with a reply saying so
+func (call *commandCall) require(name string, perms models.Permission) (*models.Message, error) {
+	if perms == 0 {
+		return nil, nil
+	}
+
+	if call.access == nil {
+		return call.ephemeral("", fmt.Sprintf("/%s can only be used in a guild's channels", name)), nil
+	}
+
+	if !call.access.Permissions.Has(perms) {
+		return nil, constants.ErrForbidden
+	}
+
+	return nil, nil
+}
+
+// ephemeral - a reply that only the caller sees, from a bot or with an empty from the service itself. It is addressed
+// the same way as the command, so it shows up where the command was sent
+func (call *commandCall) ephemeral(from, content string) *models.Message {
+	now := time.Now()
+	return &models.Message{
+		Sender:    from,
+		Recipient: call.msg.Recipient,
+		GroupID:   call.msg.GroupID,
+		ChannelID: call.msg.ChannelID,
+		ParentID:  call.msg.ParentID,
+		Content:   content,
+		Date:      &now,
+		Ephemeral: true,
+	}
+}
+
+// usage - a reply explaining how to use a built-in command
+func (call *commandCall) usage() *models.Message {
+	cmd := findBuiltin(call.Name)
+	return call.ephemeral("", fmt.Sprintf("usage: /%s %s", cmd.name, cmd.usage))
+}
+
+// help - /help [command]
+func (h *CommandHandler) help(call *commandCall) (*models.Message, error) {
+	if len(call.Args) > 1 {
+		return call.usage(), nil
+	}
+
+	bots, err := h.botCommands(call)
+	if err != nil {
+		return nil, err
+	}
+
+	// explain a single command
+	if len(call.Args) == 1 {
+		name := strings.ToLower(strings.TrimPrefix(call.Args[0], commands.Prefix))
+		lines := []string{}
+
+		if cmd := findBuiltin(name); cmd != nil {
+			lines = append(lines, fmt.Sprintf("/%s %s - %s", cmd.name, cmd.usage, cmd.description))
+		}
+
+		for _, bc := range bots {
+			if bc.cmd.Name == name {
+				lines = append(lines, bc.String())
+			}
+		}
+
+		if len(lines) == 0 {
+			return call.ephemeral("", fmt.Sprintf("there's no /%s here", name)), nil
+		}
+
+		return call.ephemeral("", strings.Join(lines, "\n")), nil
+	}
+
+	lines := []string{"commands you can use here:"}
+	for _, cmd := range builtins() {
+		if cmd.perms == 0 || (call.access != nil && call.access.Permissions.Has(cmd.perms)) {
+			lines = append(lines, fmt.Sprintf("/%s %s - %s", cmd.name, cmd.usage, cmd.description))
+		}
+	}
+
+	for _, bc := range bots {
+		if bc.cmd.Permissions == 0 || (call.access != nil && call.access.Permissions.Has(bc.cmd.Permissions)) {
+			lines = append(lines, bc.String())
+		}
+	}
+
+	lines = append(lines, "start a message with // to send it as it is, less a slash")
+
+	return call.ephemeral("", strings.Join(lines, "\n")), nil
+}
+
+// me - /me <action>, sends the action as the caller, ie: *alice waves*
+func (h *CommandHandler) me(call *commandCall) (*models.Message, error) {
+	if call.Text == "" {
+		return call.usage(), nil
+	}
+
+	msg := *call.msg
+	msg.ID = ""
+	msg.Content = fmt.Sprintf("*%s %s*", call.caller.Username, call.Text)
+
+	return h.DB.CreateMessage(&msg)
+}
+
+// mute - /mute <username> [duration]
+func (h *CommandHandler) mute(call *commandCall) (*models.Message, error) {
+	if len(call.Args) < 1 || len(call.Args) > 2 {
+		return call.usage(), nil
+	}
+
+	duration := defaultMuteDuration
+	if len(call.Args) == 2 {
+		var err error
+		if duration, err = time.ParseDuration(call.Args[1]); err != nil || duration <= 0 {
+			return call.usage(), nil
+		}
+	}
+
+	target, reply, err := h.moderate(call)
+	if target == nil {
+		return reply, err
+	}
+
+	member, err := h.DB.MuteMember(call.access.Guild.ID, target.ID, time.Now().Add(duration))
+	if err != nil {
+		return nil, err
+	}
+
+	return call.ephemeral("", fmt.Sprintf("%s is muted until %s", target.Username, member.MutedUntil.Format(time.RFC3339))), nil
+}
+
+// unmute - /unmute <username>
+func (h *CommandHandler) unmute(call *commandCall) (*models.Message, error) {
+	if len(call.Args) != 1 {
+		return call.usage(), nil
+	}
+
+	target, reply, err := h.moderate(call)
+	if target == nil {
+		return reply, err
+	}
+
+	if _, err := h.DB.MuteMember(call.access.Guild.ID, target.ID, time.Time{}); err != nil {
+		return nil, err
+	}
+
+	return call.ephemeral("", fmt.Sprintf("%s can send again", target.Username)), nil
+}
+
+// moderate - the member named by a moderation command's first argument. Forbidden if they outrank the caller,
+// and when there's no such member, or it's the caller, target is nil and reply says so
+func (h *CommandHandler) moderate(call *commandCall) (target *models.User, reply *models.Message, err error) {
+	username := strings.TrimPrefix(call.Args[0], "@")
+
+	user, err := h.DB.GetUserByUsername(username)
+	if err == constants.ErrNotFound {
+		return nil, call.ephemeral("", fmt.Sprintf("%s isn't a member of this guild", username)), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if user.ID == call.caller.ID {
+		return nil, call.ephemeral("", fmt.Sprintf("you can't /%s yourself", call.Name)), nil
+	}
+
+	_, err = outranked(h.DB, call.access, user.ID)
+	if err == constants.ErrNotFound {
+		return nil, call.ephemeral("", fmt.Sprintf("%s isn't a member of this guild", username)), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, nil, nil
+}
+
+// botCommand - a command registered by a bot, and the bot
+type botCommand struct {
+	bot *models.User
+	cmd *models.Command
+}
+
+func (bc *botCommand) String() string {
+	line := fmt.Sprintf("/%s", bc.cmd.Name)
+	if bc.cmd.Usage != "" {
+		line += " " + bc.cmd.Usage
+	}
+	if bc.cmd.Description != "" {
+		line += " - " + bc.cmd.Description
+	}
+	return line + fmt.Sprintf(" (%s)", bc.bot.Username)
+}
+
+// runBot - posts a command to the bot here that registered it. A command no bot here has, or that several do
+// without saying which bot it is for, is answered with a reply saying so
+func (h *CommandHandler) runBot(call *commandCall) (*models.Message, error) {
+	cmds, err := h.DB.FindCommands(call.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []*botCommand{}
+	for _, cmd := range cmds {
+		bot, here, err := h.botHere(call, cmd.BotID)
+		if err != nil {
+			return nil, err
+		}
+
+		if here && (call.Bot == "" || call.Bot == bot.Username) {
+			matches = append(matches, &botCommand{bot: bot, cmd: cmd})
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return call.ephemeral("", fmt.Sprintf("there's no /%s here, see /help", call.Name)), nil
+	case 1:
+	default:
+		names := make([]string, len(matches))
+		for i, match := range matches {
+			names[i] = fmt.Sprintf("/%s@%s", call.Name, match.bot.Username)
+		}
+		return call.ephemeral("", fmt.Sprintf("more than one bot here has /%s, use one of %s", call.Name, strings.Join(names, ", "))), nil
+	}
+
+	bot, cmd := matches[0].bot, matches[0].cmd
+	if reply, err := call.require(cmd.Name, cmd.Permissions); reply != nil || err != nil {
+		return reply, err
+	}
+
+	where := *call.msg
+	answer, err := h.Callbacks.Invoke(cmd, &commands.Payload{
+		Type:    commands.EventCommand,
+		Date:    time.Now(),
+		Command: cmd.Name,
+		Args:    call.Args,
+		Text:    call.Text,
+		User:    call.caller.Public(),
+		Message: &where,
+	})
+	if err != nil {
+		return call.ephemeral(bot.ID, fmt.Sprintf("%s didn't answer /%s", bot.Username, cmd.Name)), nil
+	}
+
+	if answer.Content == "" {
+		return nil, nil
+	}
+
+	if answer.Ephemeral {
+		return call.ephemeral(bot.ID, answer.Content), nil
+	}
+
+	// the bot answers where the command was sent, a direct message to the bot is answered to the caller
+	msg := &models.Message{
+		Sender:    bot.ID,
+		Recipient: call.msg.Recipient,
+		GroupID:   call.msg.GroupID,
+		ChannelID: call.msg.ChannelID,
+		ParentID:  call.msg.ParentID,
+		Content:   answer.Content,
+	}
+	if msg.Recipient != "" {
+		msg.Recipient = call.caller.ID
+	}
+
+	if err := checkSend(h.DB, msg); err != nil {
+		return call.ephemeral(bot.ID, fmt.Sprintf("%s can't send here", bot.Username)), nil
+	}
+
+	return h.DB.CreateMessage(msg)
+}
+
+// botCommands - the commands registered by the bots here, by name
+func (h *CommandHandler) botCommands(call *commandCall) ([]*botCommand, error) {
+	userIDs := []string{}
+	switch {
+	case call.group != nil:
+		userIDs = call.group.Participants
+	case call.access != nil:
+		members, err := h.DB.ListMembers(call.access.Guild.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			userIDs = append(userIDs, member.UserID)
+		}
+	default:
+		userIDs = append(userIDs, call.msg.Recipient)
+	}
+
+	out := []*botCommand{}
+	for _, userID := range userIDs {
+		user, err := h.DB.GetUser(userID)
+		if err == constants.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !user.Bot {
+			continue
+		}
+
+		cmds, err := h.DB.ListCommands(user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cmd := range cmds {
+			out = append(out, &botCommand{bot: user, cmd: cmd})
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].cmd.Name < out[j].cmd.Name
+	})
+
+	return out, nil
+}
+
+// botHere - a bot, and whether it is in the conversation, group or guild a command was sent to. A bot is only in a
+// conversation when the command was sent to it directly
+func (h *CommandHandler) botHere(call *commandCall, botID string) (*models.User, bool, error) {
+	bot, err := h.DB.GetUser(botID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch {
+	case call.group != nil:
+		return bot, isParticipant(call.group, bot.ID), nil
+	case call.access != nil:
+		_, err := h.DB.GetMember(call.access.Guild.ID, bot.ID)
+		if err == constants.ErrNotFound {
+			return bot, false, nil
+		}
+		return bot, err == nil, err
+	default:
+		return bot, call.msg.Recipient == bot.ID, nil
+	}
+}
+
+// commandResponse - responds with what a command sent or replied, or no content when it had nothing to say
+func commandResponse(c echo.Context, reply *models.Message, err error) error {
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if reply == nil {
+		return c.JSON(http.StatusNoContent, nil)
+	}
+
+	return c.JSON(http.StatusOK, reply)
+}
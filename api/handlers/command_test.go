@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/commands"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/db/mem"
+	"github.com/radean0909/guild-chat/api/internal/webhooks"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// commandSecret - the secret test commands are registered with
+const commandSecret = "secret"
+
+// botReceiver - a bot's command URL, answering every invocation with status and answer, and keeping the last one
+type botReceiver struct {
+	*httptest.Server
+
+	mux      sync.Mutex
+	status   int
+	answer   string
+	received *commands.Payload
+	raw      []byte
+}
+
+func newBotReceiver(t *testing.T) *botReceiver {
+	recv := &botReceiver{status: http.StatusOK}
+	recv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := ioutil.ReadAll(r.Body)
+		if !webhooks.Verify(commandSecret, r.Header.Get(webhooks.HeaderTimestamp), r.Header.Get(webhooks.HeaderSignature), raw, time.Minute) {
+			t.Error("expected the invocation to be signed with the command's secret")
+		}
+
+		payload := &commands.Payload{}
+		if err := json.Unmarshal(raw, payload); err != nil {
+			t.Error(err)
+		}
+
+		recv.mux.Lock()
+		defer recv.mux.Unlock()
+
+		recv.received, recv.raw = payload, raw
+		w.WriteHeader(recv.status)
+		w.Write([]byte(recv.answer))
+	}))
+	return recv
+}
+
+// answerWith - sets what the bot answers with from now on
+func (recv *botReceiver) answerWith(status int, answer string) {
+	recv.mux.Lock()
+	defer recv.mux.Unlock()
+
+	recv.status, recv.answer = status, answer
+}
+
+// last - the last invocation posted to the bot, as it was sent and decoded, and forgets it
+func (recv *botReceiver) last() ([]byte, *commands.Payload) {
+	recv.mux.Lock()
+	defer recv.mux.Unlock()
+
+	raw, received := recv.raw, recv.received
+	recv.raw, recv.received = nil, nil
+	return raw, received
+}
+
+func TestBuiltinCommands(t *testing.T) {
+	driver := mem.NewDriver()
+	h := &MessageHandler{DB: driver, Commands: &CommandHandler{DB: driver}}
+
+	alice := newTestUser(t, driver, "alice")
+	bob := newTestUser(t, driver, "bob")
+
+	_, reply := sendCommand(t, h, alice, bob, "/help")
+	expectEphemeral(t, "/help", reply, "", "/me <action>")
+	if reply != nil && strings.Contains(reply.Content, "/mute") {
+		t.Error("/help: expected commands that need guild permissions to be left out of a conversation")
+	}
+
+	_, reply = sendCommand(t, h, alice, bob, "/help me")
+	expectEphemeral(t, "/help me", reply, "", "sends an action")
+
+	_, reply = sendCommand(t, h, alice, bob, "/help nope")
+	expectEphemeral(t, "/help nope", reply, "", "there's no /nope here")
+
+	_, reply = sendCommand(t, h, alice, bob, "/me waves")
+	if reply == nil || reply.Ephemeral || reply.ID == "" || reply.Sender != alice.ID || reply.Content != "*alice waves*" {
+		t.Errorf("/me waves: expected a message from alice, got %+v", reply)
+	} else if _, err := driver.GetMessage(reply.ID); err != nil {
+		t.Errorf("/me waves: expected the message to be stored, got %v", err)
+	}
+
+	_, reply = sendCommand(t, h, alice, bob, "/me")
+	expectEphemeral(t, "/me", reply, "", "usage: /me <action>")
+
+	_, reply = sendCommand(t, h, alice, bob, "/mute bob")
+	expectEphemeral(t, "/mute bob", reply, "", "can only be used in a guild's channels")
+
+	rec, _ := sendCommand(t, h, alice, bob, "/me \"unterminated")
+	expectStatus(t, "an unterminated quote", rec, http.StatusBadRequest)
+
+	// escaped and ordinary messages are sent as they are
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"//me is a command", "/me is a command"},
+		{"/usr/bin is a path", "/usr/bin is a path"},
+		{"hello /me", "hello /me"},
+	}
+
+	for _, tt := range tests {
+		_, msg := sendCommand(t, h, alice, bob, tt.content)
+		if msg == nil || msg.ID == "" || msg.Ephemeral || msg.Content != tt.want {
+			t.Errorf("%s: expected a message containing %q, got %+v", tt.content, tt.want, msg)
+		}
+	}
+}
+
+func TestBotCommands(t *testing.T) {
+	driver := mem.NewDriver()
+	recv := newBotReceiver(t)
+	defer recv.Close()
+
+	// the receiver is on loopback, which the default client refuses
+	h := &MessageHandler{DB: driver, Commands: &CommandHandler{DB: driver, Callbacks: &commands.Client{HTTP: recv.Client()}}}
+
+	alice := newTestUser(t, driver, "alice")
+	bob := newTestUser(t, driver, "bob")
+	bot := newTestBot(t, driver, alice, "dicebot")
+	newTestCommand(t, driver, bot, "roll", recv.URL)
+
+	// the bot is posted the invocation, and its answer is sent from it to alice
+	recv.answerWith(http.StatusOK, `{"content":"rolled 23"}`)
+	_, reply := sendCommand(t, h, alice, bot, "/roll 2 \"twenty sided\"")
+	if reply == nil || reply.Ephemeral || reply.ID == "" || reply.Sender != bot.ID || reply.Recipient != alice.ID || reply.Content != "rolled 23" {
+		t.Errorf("/roll: expected a message from the bot, got %+v", reply)
+	}
+
+	raw, received := recv.last()
+	if received == nil {
+		t.Fatal("/roll: expected the bot to be posted the invocation")
+	}
+	if received.Command != "roll" || len(received.Args) != 2 || received.Args[1] != "twenty sided" || received.Text != "2 \"twenty sided\"" {
+		t.Errorf("/roll: unexpected invocation %s", raw)
+	}
+	if received.User == nil || received.User.ID != alice.ID || received.User.Username != "alice" || received.User.Bot {
+		t.Errorf("/roll: expected alice as the user, got %s", raw)
+	}
+	if strings.Contains(string(raw), alice.Email) {
+		t.Errorf("/roll: expected alice's email to be left out, got %s", raw)
+	}
+	if received.Message == nil || received.Message.Recipient != bot.ID || received.Message.Sender != alice.ID {
+		t.Errorf("/roll: expected where the command was sent, got %s", raw)
+	}
+
+	recv.answerWith(http.StatusOK, `{"content":"only you rolled 23","ephemeral":true}`)
+	_, reply = sendCommand(t, h, alice, bot, "/roll@dicebot 1")
+	expectEphemeral(t, "/roll@dicebot", reply, bot.ID, "only you rolled 23")
+
+	recv.answerWith(http.StatusOK, "")
+	rec, _ := sendCommand(t, h, alice, bot, "/roll 1")
+	expectStatus(t, "/roll with nothing to say", rec, http.StatusNoContent)
+
+	recv.answerWith(http.StatusInternalServerError, "")
+	_, reply = sendCommand(t, h, alice, bot, "/roll 1")
+	expectEphemeral(t, "/roll failing", reply, bot.ID, "dicebot didn't answer /roll")
+
+	// the bot isn't in alice's conversation with bob, and has no /flip
+	recv.last()
+	_, reply = sendCommand(t, h, alice, bob, "/roll 1")
+	expectEphemeral(t, "/roll elsewhere", reply, "", "there's no /roll here")
+	_, reply = sendCommand(t, h, alice, bot, "/flip")
+	expectEphemeral(t, "/flip", reply, "", "there's no /flip here")
+	if _, received := recv.last(); received != nil {
+		t.Error("expected the bot only to be posted its own commands, where it is")
+	}
+
+	_, reply = sendCommand(t, h, alice, bot, "/help roll")
+	expectEphemeral(t, "/help roll", reply, "", "/roll <dice> (dicebot)")
+}
+
+func TestPostCommandURLs(t *testing.T) {
+	driver := mem.NewDriver()
+	h := &BotHandler{DB: driver}
+
+	alice := newTestUser(t, driver, "alice")
+	bot := newTestBot(t, driver, alice, "dicebot")
+
+	recv := newBotReceiver(t)
+	defer recv.Close()
+
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{"https://93.184.216.34/roll", http.StatusOK},
+		{recv.URL, http.StatusBadRequest},
+		{"http://localhost/roll", http.StatusBadRequest},
+		{"http://169.254.169.254/latest/meta-data", http.StatusBadRequest},
+		{"http://10.0.0.1/roll", http.StatusBadRequest},
+		{"ftp://93.184.216.34/roll", http.StatusBadRequest},
+		{"not a url", http.StatusBadRequest},
+	}
+
+	for i, tt := range tests {
+		c, rec := newTestContext(t, testRequest{
+			method: http.MethodPost,
+			caller: alice.ID,
+			body:   &models.Command{Name: "flip" + string(rune('a'+i)), URL: tt.url},
+			params: map[string]string{"id": bot.ID},
+		})
+		if err := h.PostCommand(c); err != nil {
+			t.Fatal(err)
+		}
+		expectStatus(t, tt.url, rec, tt.status)
+	}
+}
+
+// newTestBot - creates a bot owned by owner, failing the test on error
+func newTestBot(t *testing.T, driver db.Driver, owner *models.User, name string) *models.User {
+	t.Helper()
+
+	bot, err := driver.CreateUser(&models.User{Username: name, Bot: true, Owner: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot
+}
+
+// newTestCommand - registers a command for bot posted to url, straight in the datastore as test urls are on
+// loopback, failing the test on error
+func newTestCommand(t *testing.T, driver db.Driver, bot *models.User, name, url string) *models.Command {
+	t.Helper()
+
+	cmd, err := driver.CreateCommand(&models.Command{BotID: bot.ID, Name: name, Usage: "<dice>", URL: url, Secret: commandSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+// sendCommand - sends content from sender to recipient, returning the response and, for a 200, the message in it
+func sendCommand(t *testing.T, h *MessageHandler, sender, recipient *models.User, content string) (*httptest.ResponseRecorder, *models.Message) {
+	t.Helper()
+
+	c, rec := newTestContext(t, testRequest{
+		method: http.MethodPost,
+		caller: sender.ID,
+		body:   &models.Message{Recipient: recipient.ID, Content: content},
+	})
+	// writing the empty body of a no content response fails, but its status is recorded
+	if err := h.PostMessage(c); err != nil && rec.Code != http.StatusNoContent {
+		t.Fatal(err)
+	}
+
+	if rec.Code != http.StatusOK {
+		return rec, nil
+	}
+
+	msg := &models.Message{}
+	decode(t, rec, msg)
+	return rec, msg
+}
+
+// expectEphemeral - fails the test unless msg is a reply only the caller sees, from sender, containing content
+func expectEphemeral(t *testing.T, call string, msg *models.Message, sender, content string) {
+	t.Helper()
+
+	if msg == nil {
+		t.Errorf("%s: expected a reply", call)
+		return
+	}
+	if !msg.Ephemeral || msg.ID != "" || msg.Sender != sender || !strings.Contains(msg.Content, content) {
+		t.Errorf("%s: expected an ephemeral reply from %q containing %q, got %+v", call, sender, content, msg)
+	}
+}
@@ -2,143 +2,86 @@ package handlers
 
 import (
 	"net/http"
-	"strconv"
-	"time"
 
 	"github.com/labstack/echo"
 	"github.com/radean0909/guild-chat/api/internal/constants"
 	"github.com/radean0909/guild-chat/api/internal/db"
-	"github.com/radean0909/guild-chat/api/models"
+	"github.com/radean0909/guild-chat/api/internal/realtime"
 )
 
 type ConversationHandler struct {
-	DB db.Driver
+	DB  db.Driver
+	Hub *realtime.Hub // new messages, for streaming
 }
 
-// GetConversation - returns all messages sent from a person to another person.
+// GetConversation - returns a page of the messages sent from a person to another person, the most recent first
+// unless a cursor is passed
 func (h *ConversationHandler) GetConversation(c echo.Context) error {
 	sender := c.Param("from")
 	recipient := c.Param("to")
 
-	// additional query params (to satisfy challenege requirements)
-	startParam := c.QueryParam("start")
-	untilParam := c.QueryParam("until")
-	limitParam := c.QueryParam("limit")
-
-	var start, until time.Time
-	var err error
-	limit := 100 // set a default limit to 100
-	if startParam != "" {
-		start, err = time.Parse("2006-01-02", startParam)
-		if err != nil {
-			return handleError(c, err)
-		}
-	} else {
-		start = time.Now().AddDate(0, 0, -30)
+	// only the people in the conversation can read it
+	if caller := callerID(c); caller != sender && caller != recipient {
+		return handleError(c, constants.ErrForbidden)
 	}
 
-	if untilParam != "" {
-		until, err = time.Parse("2006-01-02", untilParam)
-		if err != nil {
-			return handleError(c, err)
-		}
-	} else {
-		until = time.Now()
-	}
-
-	if limitParam != "" {
-		limit, err = strconv.Atoi(limitParam)
-		if err != nil {
-			return handleError(c, err)
-		}
-	}
-
-	convo, err := h.DB.GetConversation(sender, recipient, start, until)
-
+	page, err := pageParams(c, 100) // set a default limit to 100
 	if err != nil {
 		return handleError(c, err)
 	}
 
-	// Now filter the messages
-	messages := []*models.Message{}
-	for _, msg := range convo.Messages {
-		if len(messages) >= limit {
-			break
-		}
-		if msg.Recipient == recipient {
-			messages = append(messages, msg)
-		}
-	}
-
-	if len(messages) > 0 {
-		return c.JSON(http.StatusOK, messages)
+	msgs, err := h.DB.PageConversation(sender, recipient, page)
+	if err != nil {
+		return handleError(c, err)
 	}
 
-	// this shouldn't normally happen, but if there are orphaned conversations, we don't want to return empty messages
-	return handleError(c, constants.ErrNotFound)
-
+	return c.JSON(http.StatusOK, msgs)
 }
 
-// ListConversations - lists all messages sent to a particular person
+// ListConversations - returns a page of the messages sent to a particular person, the most recent first unless
+// a cursor is passed
 func (h *ConversationHandler) ListConversations(c echo.Context) error {
 	recipient := c.Param("to")
 
-	// additional query params (to satisfy challenege requirements)
-	startParam := c.QueryParam("start")
-	untilParam := c.QueryParam("until")
-	limitParam := c.QueryParam("limit")
-
-	var start, until time.Time
-	var err error
-	limit := 100 // set a default limit to 100
-	if startParam != "" {
-		start, err = time.Parse("2006-01-02", startParam)
-		if err != nil {
-			return handleError(c, err)
-		}
-	} else {
-		start = time.Now().AddDate(0, 0, -30)
+	// you can only list your own conversations
+	if callerID(c) != recipient {
+		return handleError(c, constants.ErrForbidden)
 	}
 
-	if untilParam != "" {
-		until, err = time.Parse("2006-01-02", untilParam)
-		if err != nil {
-			return handleError(c, err)
-		}
-	} else {
-		until = time.Now()
+	page, err := pageParams(c, 100) // set a default limit to 100
+	if err != nil {
+		return handleError(c, err)
 	}
 
-	if limitParam != "" {
-		limit, err = strconv.Atoi(limitParam)
-		if err != nil {
-			return handleError(c, err)
-		}
+	msgs, err := h.DB.PageMessages(recipient, page)
+	if err != nil {
+		return handleError(c, err)
 	}
 
-	convos, err := h.DB.ListConversations(recipient, start, until)
+	return c.JSON(http.StatusOK, msgs)
+}
 
+// ListInbox - returns the caller's conversations, most recently updated first, each with how many messages the
+// caller hasn't read and the last one they have. Messages are left out, page through a conversation for those
+func (h *ConversationHandler) ListInbox(c echo.Context) error {
+	start, err := dateParam(c, "start")
 	if err != nil {
 		return handleError(c, err)
 	}
 
-	// Now filter the messages
-	messages := []*models.Message{}
-	for _, convo := range convos {
-		for _, msg := range convo.Messages {
-			if len(messages) >= limit {
-				break
-			}
-			if msg.Recipient == recipient {
-				messages = append(messages, msg)
-			}
-		}
+	until, err := dateParam(c, "until")
+	if err != nil {
+		return handleError(c, err)
 	}
 
-	if len(messages) > 0 {
-		return c.JSON(http.StatusOK, messages)
+	convos, err := h.DB.ListConversations(callerID(c), start, until)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	for _, convo := range convos {
+		convo.Messages = nil
 	}
 
-	// this shouldn't normally happen, but if there are orphaned conversations, we don't want to return empty messages
-	return handleError(c, constants.ErrNotFound)
+	return c.JSON(http.StatusOK, convos)
 }
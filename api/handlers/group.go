@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// GroupHandler - group conversations between any number of participants. Only participants can see
+// a group or its messages
+type GroupHandler struct {
+	DB db.Driver
+	// Commands - runs messages starting with a slash as commands
+	Commands *CommandHandler
+}
+
+// PostGroup - creates a group conversation owned by the caller, between the caller and any participants given
+func (h *GroupHandler) PostGroup(c echo.Context) error {
+	group := &models.Conversation{}
+
+	if err := c.Bind(group); err != nil {
+		return handleError(c, err)
+	}
+
+	group, err := h.DB.CreateGroup(callerID(c), group.Name, group.Participants)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, group)
+}
+
+// GetGroup - returns a group conversation and its participants
+func (h *GroupHandler) GetGroup(c echo.Context) error {
+	group, err := h.participantGroup(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, group)
+}
+
+// ListGroups - lists the group conversations the caller is in, most recently updated first
+func (h *GroupHandler) ListGroups(c echo.Context) error {
+	start, err := dateParam(c, "start")
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	until, err := dateParam(c, "until")
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	groups, err := h.DB.ListGroups(callerID(c), start, until)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, groups)
+}
+
+// PostParticipant - adds a user to a group, any participant can add people
+func (h *GroupHandler) PostParticipant(c echo.Context) error {
+	participant := &models.Participant{}
+
+	if err := c.Bind(participant); err != nil {
+		return handleError(c, err)
+	}
+
+	group, err := h.participantGroup(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if err := h.DB.AddParticipant(group.ID, participant.UserID); err != nil {
+		return handleError(c, err)
+	}
+
+	group, err = h.DB.GetGroup(group.ID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, group)
+}
+
+// DeleteParticipant - removes a user from a group. Participants can leave, and the owner can remove anyone
+func (h *GroupHandler) DeleteParticipant(c echo.Context) error {
+	userID := c.Param("user")
+
+	group, err := h.participantGroup(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if caller := callerID(c); userID != caller && group.Owner != caller {
+		return handleError(c, constants.ErrForbidden)
+	}
+
+	if err := h.DB.RemoveParticipant(group.ID, userID); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// PostGroupMessage - sends a message from the caller to everyone in a group
+func (h *GroupHandler) PostGroupMessage(c echo.Context) error {
+	msg := &models.Message{}
+
+	if err := c.Bind(msg); err != nil {
+		return handleError(c, err)
+	}
+
+	// you can only send messages as yourself, and the datastore checks you are a participant
+	msg.Sender = callerID(c)
+	msg.GroupID = c.Param("id")
+
+	if reply, ok, err := h.Commands.Run(msg, callerAPIKey(c)); ok {
+		return commandResponse(c, reply, err)
+	}
+
+	msg, err := h.DB.CreateMessage(msg)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, msg)
+}
+
+// ListGroupMessages - lists the messages sent to a group, oldest first
+func (h *GroupHandler) ListGroupMessages(c echo.Context) error {
+	group, err := h.participantGroup(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	start, err := dateParam(c, "start")
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	until, err := dateParam(c, "until")
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	limit, err := limitParam(c, 100) // set a default limit to 100
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	msgs, err := h.DB.ListGroupMessages(group.ID, start, until, limit)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, msgs)
+}
+
+// participantGroup - the group named in the path, forbidden unless the caller is one of its participants
+func (h *GroupHandler) participantGroup(c echo.Context) (*models.Conversation, error) {
+	group, err := h.DB.GetGroup(c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if !isParticipant(group, callerID(c)) {
+		return nil, constants.ErrForbidden
+	}
+
+	return group, nil
+}
+
+// isParticipant - whether a user is one of a group's participants
+func isParticipant(group *models.Conversation, userID string) bool {
+	for _, id := range group.Participants {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
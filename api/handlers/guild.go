@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// GuildHandler - guilds, their members, roles and channels. Anyone can join a guild, but only its members
+// can see it, and what else they can do depends on their role. Routes for a single guild sit behind Require
+type GuildHandler struct {
+	DB db.Driver
+	// Commands - runs messages starting with a slash as commands
+	Commands *CommandHandler
+}
+
+// defaultRoles - the default roles, most permissive first
+var defaultRoles = []string{models.RoleOwner, models.RoleAdmin, models.RoleModerator, models.RoleMember}
+
+// PostGuild - creates a guild owned by the caller, with the default channel
+func (h *GuildHandler) PostGuild(c echo.Context) error {
+	guild := &models.Guild{}
+
+	if err := c.Bind(guild); err != nil {
+		return handleError(c, err)
+	}
+
+	guild, err := h.DB.CreateGuild(callerID(c), guild.Name)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, guild)
+}
+
+// GetGuild - returns a guild and its channels
+func (h *GuildHandler) GetGuild(c echo.Context) error {
+	return c.JSON(http.StatusOK, callerAccess(c).Guild)
+}
+
+// ListGuilds - lists the guilds the caller is a member of, most recently updated first
+func (h *GuildHandler) ListGuilds(c echo.Context) error {
+	start, err := dateParam(c, "start")
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	until, err := dateParam(c, "until")
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	guilds, err := h.DB.ListGuilds(callerID(c), start, until)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, guilds)
+}
+
+// JoinGuild - makes the caller a member of a guild
+func (h *GuildHandler) JoinGuild(c echo.Context) error {
+	member, err := h.DB.JoinGuild(c.Param("id"), callerID(c))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, member)
+}
+
+// LeaveGuild - removes the caller from a guild. The owner can't leave
+func (h *GuildHandler) LeaveGuild(c echo.Context) error {
+	if err := h.DB.LeaveGuild(c.Param("id"), callerID(c)); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// ListMembers - lists the members of a guild and their roles, in the order they joined
+func (h *GuildHandler) ListMembers(c echo.Context) error {
+	members, err := h.DB.ListMembers(callerAccess(c).Guild.ID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, members)
+}
+
+// KickMember - removes another member from a guild. Nobody can kick the owner, or anyone whose role
+// allows something the caller's doesn't
+func (h *GuildHandler) KickMember(c echo.Context) error {
+	access := callerAccess(c)
+
+	target, err := outranked(h.DB, access, c.Param("user"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if err := h.DB.LeaveGuild(access.Guild.ID, target.UserID); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// PutMemberRole - gives another member a different role. The caller can only give roles that allow no more
+// than their own does, to members who also have no more permissions than they do
+func (h *GuildHandler) PutMemberRole(c echo.Context) error {
+	update := &models.Member{}
+
+	if err := c.Bind(update); err != nil {
+		return handleError(c, err)
+	}
+
+	access := callerAccess(c)
+
+	target, err := outranked(h.DB, access, c.Param("user"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	perms, err := rolePermissions(h.DB, access.Guild.ID, update.Role)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if !access.Permissions.Has(perms) {
+		return handleError(c, constants.ErrForbidden)
+	}
+
+	member, err := h.DB.SetRole(access.Guild.ID, target.UserID, update.Role)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, member)
+}
+
+// ListRoles - lists the default roles, then the guild's custom roles by name
+func (h *GuildHandler) ListRoles(c echo.Context) error {
+	guildID := callerAccess(c).Guild.ID
+
+	custom, err := h.DB.ListRoles(guildID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	roles := make([]*models.Role, 0, len(defaultRoles)+len(custom))
+	for _, name := range defaultRoles {
+		roles = append(roles, &models.Role{GuildID: guildID, Name: name, Permissions: models.DefaultRoles[name]})
+	}
+
+	return c.JSON(http.StatusOK, append(roles, custom...))
+}
+
+// PostRole - creates a custom role in a guild. The caller can't create a role that allows more than their own does
+func (h *GuildHandler) PostRole(c echo.Context) error {
+	role := &models.Role{}
+
+	if err := c.Bind(role); err != nil {
+		return handleError(c, err)
+	}
+
+	access := callerAccess(c)
+	if !access.Permissions.Has(role.Permissions) {
+		return handleError(c, constants.ErrForbidden)
+	}
+
+	role, err := h.DB.CreateRole(access.Guild.ID, role.Name, role.Permissions)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, role)
+}
+
+// PostChannel - creates a named channel in a guild
+func (h *GuildHandler) PostChannel(c echo.Context) error {
+	channel := &models.Channel{}
+
+	if err := c.Bind(channel); err != nil {
+		return handleError(c, err)
+	}
+
+	channel, err := h.DB.CreateChannel(callerAccess(c).Guild.ID, channel.Name)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, channel)
+}
+
+// PostChannelMessage - sends a message from the caller to a channel in a guild
+func (h *GuildHandler) PostChannelMessage(c echo.Context) error {
+	msg := &models.Message{}
+
+	if err := c.Bind(msg); err != nil {
+		return handleError(c, err)
+	}
+
+	channel, err := h.guildChannel(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	// you can only send messages as yourself
+	msg.Sender = callerID(c)
+	msg.ChannelID = channel.ID
+
+	if reply, ok, err := h.Commands.Run(msg, callerAPIKey(c)); ok {
+		return commandResponse(c, reply, err)
+	}
+
+	// Require checked the caller's role, but they could still be muted
+	if !canSend(callerAccess(c)) {
+		return handleError(c, constants.ErrForbidden)
+	}
+
+	msg, err = h.DB.CreateMessage(msg)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, msg)
+}
+
+// ListChannelMessages - lists the messages sent to a channel in a guild, oldest first
+func (h *GuildHandler) ListChannelMessages(c echo.Context) error {
+	channel, err := h.guildChannel(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	start, err := dateParam(c, "start")
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	until, err := dateParam(c, "until")
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	limit, err := limitParam(c, 100) // set a default limit to 100
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	msgs, err := h.DB.ListChannelMessages(channel.ID, start, until, limit)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, msgs)
+}
+
+// guildChannel - the channel named in the path, not found unless it belongs to the guild in the path
+func (h *GuildHandler) guildChannel(c echo.Context) (*models.Channel, error) {
+	channel, err := h.DB.GetChannel(c.Param("channel"))
+	if err != nil {
+		return nil, err
+	}
+
+	if channel.GuildID != callerAccess(c).Guild.ID {
+		return nil, constants.ErrNotFound
+	}
+
+	return channel, nil
+}
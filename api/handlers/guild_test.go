@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/db/mem"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func TestGuildPermissions(t *testing.T) {
+	driver := mem.NewDriver()
+	h := &GuildHandler{DB: driver}
+
+	owner := newTestUser(t, driver, "owner")
+	moderator := newTestUser(t, driver, "moderator")
+	member := newTestUser(t, driver, "member")
+	outsider := newTestUser(t, driver, "outsider")
+
+	guild := newTestGuild(t, driver, owner, moderator, member)
+	if _, err := driver.SetRole(guild.ID, moderator.ID, models.RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		perm    models.Permission
+		handler echo.HandlerFunc
+		caller  *models.User
+		body    interface{}
+		params  map[string]string
+		status  int
+	}{
+		// roles need manage roles
+		{"owner creates a role", models.PermManageRoles, h.PostRole, owner, map[string]interface{}{"name": "helper", "permissions": models.PermSend}, nil, http.StatusOK},
+		{"moderator creates a role", models.PermManageRoles, h.PostRole, moderator, map[string]interface{}{"name": "helper2"}, nil, http.StatusForbidden},
+		{"member creates a role", models.PermManageRoles, h.PostRole, member, map[string]interface{}{"name": "helper3"}, nil, http.StatusForbidden},
+		{"outsider creates a role", models.PermManageRoles, h.PostRole, outsider, map[string]interface{}{"name": "helper4"}, nil, http.StatusForbidden},
+		{"member gives a role", models.PermManageRoles, h.PutMemberRole, member, map[string]string{"role": models.RoleAdmin}, map[string]string{"user": member.ID}, http.StatusForbidden},
+		{"outsider gives a role", models.PermManageRoles, h.PutMemberRole, outsider, map[string]string{"role": models.RoleMember}, map[string]string{"user": member.ID}, http.StatusForbidden},
+		{"owner gives a role", models.PermManageRoles, h.PutMemberRole, owner, map[string]string{"role": "helper"}, map[string]string{"user": member.ID}, http.StatusOK},
+
+		// channels need manage channels
+		{"owner creates a channel", models.PermManageChannels, h.PostChannel, owner, map[string]string{"name": "random"}, nil, http.StatusOK},
+		{"moderator creates a channel", models.PermManageChannels, h.PostChannel, moderator, map[string]string{"name": "mods"}, nil, http.StatusForbidden},
+		{"member creates a channel", models.PermManageChannels, h.PostChannel, member, map[string]string{"name": "members"}, nil, http.StatusForbidden},
+		{"outsider creates a channel", models.PermManageChannels, h.PostChannel, outsider, map[string]string{"name": "outside"}, nil, http.StatusForbidden},
+
+		// kicking needs kick, and can't reach anyone who outranks the caller
+		{"member kicks", models.PermKick, h.KickMember, member, nil, map[string]string{"user": moderator.ID}, http.StatusForbidden},
+		{"moderator kicks the owner", models.PermKick, h.KickMember, moderator, nil, map[string]string{"user": owner.ID}, http.StatusForbidden},
+		{"outsider kicks", models.PermKick, h.KickMember, outsider, nil, map[string]string{"user": member.ID}, http.StatusForbidden},
+
+		// sending needs send
+		{"member sends", models.PermSend, h.PostChannelMessage, member, map[string]string{"content": "hi"}, nil, http.StatusOK},
+		{"outsider sends", models.PermSend, h.PostChannelMessage, outsider, map[string]string{"content": "hi"}, nil, http.StatusForbidden},
+
+		// listing only needs membership
+		{"member lists members", 0, h.ListMembers, member, nil, nil, http.StatusOK},
+		{"outsider lists members", 0, h.ListMembers, outsider, nil, nil, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		method := http.MethodPost
+		if tt.body == nil {
+			method = http.MethodDelete
+		}
+
+		req := testRequest{method: method, caller: tt.caller.ID, body: tt.body, params: tt.params}
+		expectStatus(t, tt.name, callGuildRoute(t, h, guild, tt.perm, tt.handler, req), tt.status)
+	}
+}
+
+func TestGuildMutes(t *testing.T) {
+	driver := mem.NewDriver()
+	h := &GuildHandler{DB: driver, Commands: &CommandHandler{DB: driver}}
+
+	owner := newTestUser(t, driver, "owner")
+	moderator := newTestUser(t, driver, "moderator")
+	member := newTestUser(t, driver, "member")
+	outsider := newTestUser(t, driver, "outsider")
+
+	guild := newTestGuild(t, driver, owner, moderator, member)
+	if _, err := driver.SetRole(guild.ID, moderator.ID, models.RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(caller *models.User, content string) *httptest.ResponseRecorder {
+		req := testRequest{method: http.MethodPost, caller: caller.ID, body: map[string]string{"content": content}}
+		return callGuildRoute(t, h, guild, models.PermSend, h.PostChannelMessage, req)
+	}
+
+	// muting needs mute, and can't reach anyone who outranks the caller
+	expectStatus(t, "member mutes", send(member, "/mute moderator"), http.StatusForbidden)
+	expectStatus(t, "outsider mutes", send(outsider, "/mute member"), http.StatusForbidden)
+	expectStatus(t, "moderator mutes the owner", send(moderator, "/mute owner"), http.StatusForbidden)
+
+	rec := send(moderator, "/mute member 1h")
+	expectStatus(t, "moderator mutes", rec, http.StatusOK)
+
+	reply := &models.Message{}
+	decode(t, rec, reply)
+	if !reply.Ephemeral || reply.ID != "" {
+		t.Errorf("mute: expected an ephemeral reply, got %+v", reply)
+	}
+
+	// a muted member keeps their role, but can't send until they are unmuted
+	expectStatus(t, "muted member sends", send(member, "hi"), http.StatusForbidden)
+	expectStatus(t, "muted member runs a command", send(member, "/help"), http.StatusForbidden)
+
+	muted, err := driver.GetMember(guild.ID, member.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if muted.Role != models.RoleMember || muted.MutedUntil == nil {
+		t.Errorf("GetMember: expected a muted member, got %+v", muted)
+	}
+
+	expectStatus(t, "member unmutes", send(member, "/unmute member"), http.StatusForbidden)
+	expectStatus(t, "moderator unmutes", send(moderator, "/unmute member"), http.StatusOK)
+	expectStatus(t, "unmuted member sends", send(member, "hi"), http.StatusOK)
+}
+
+// callGuildRoute - calls a route for guild's default channel behind Require(perm), as the route is in api.go
+func callGuildRoute(t *testing.T, h *GuildHandler, guild *models.Guild, perm models.Permission, handler echo.HandlerFunc,
+	req testRequest) *httptest.ResponseRecorder {
+	t.Helper()
+
+	params := map[string]string{"id": guild.ID, "channel": guild.Channels[0].ID}
+	for name, value := range req.params {
+		params[name] = value
+	}
+	req.params = params
+
+	c, rec := newTestContext(t, req)
+	if err := h.Require(perm)(handler)(c); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/auth"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/events"
+	"github.com/radean0909/guild-chat/api/internal/realtime"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// testRequest - a request to a handler, made as caller, with names and values for the path params. The body is
+// sent as JSON, unless raw is set to send as it is with contentType
+type testRequest struct {
+	method      string
+	caller      string
+	body        interface{}
+	params      map[string]string
+	raw         io.Reader
+	contentType string
+}
+
+// newTestContext - an echo context for a request, as it would be after Authenticate, and its recorded response
+func newTestContext(t *testing.T, req testRequest) (echo.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+
+	method := req.method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	body, contentType := io.Reader(bytes.NewReader(encode(t, req.body))), echo.MIMEApplicationJSON
+	if req.raw != nil {
+		body, contentType = req.raw, req.contentType
+	}
+
+	r := httptest.NewRequest(method, "/", body)
+	r.Header.Set(echo.HeaderContentType, contentType)
+	rec := httptest.NewRecorder()
+
+	c := echo.New().NewContext(r, rec)
+	names, values := []string{}, []string{}
+	for name, value := range req.params {
+		names, values = append(names, name), append(values, value)
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+
+	if req.caller != "" {
+		c.Set(callerKey, req.caller)
+	}
+
+	return c, rec
+}
+
+// serve - sends a request through e, so it passes through the routes' middleware, with credential as the bearer
+// token if set. Returns the recorded response
+func serve(t *testing.T, e *echo.Echo, method, path, credential string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(method, path, bytes.NewReader(encode(t, body)))
+	r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if credential != "" {
+		r.Header.Set(echo.HeaderAuthorization, "Bearer "+credential)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, r)
+	return rec
+}
+
+// encode - a request body as JSON, nil for no body
+func encode(t *testing.T, body interface{}) []byte {
+	t.Helper()
+
+	if body == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// expectStatus - fails the test unless the handler responded with status
+func expectStatus(t *testing.T, call string, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+
+	if rec.Code != status {
+		t.Errorf("%s: expected %d, got %d %s", call, status, rec.Code, rec.Body.String())
+	}
+}
+
+// decode - reads a handler's JSON response into out
+func decode(t *testing.T, rec *httptest.ResponseRecorder, out interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body.String(), err)
+	}
+}
+
+// newTestUser - creates a user, failing the test on error
+func newTestUser(t *testing.T, driver db.Driver, name string) *models.User {
+	t.Helper()
+
+	user, err := driver.CreateUser(&models.User{Username: name, Email: name + "@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// newTestAccount - creates a user who can log in with password, failing the test on error
+func newTestAccount(t *testing.T, driver db.Driver, name, password string) *models.User {
+	t.Helper()
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := driver.CreateAccount(&models.User{Username: name, Email: name + "@example.com"}, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// newTestGuild - creates a guild owned by owner with members joined to it, failing the test on error
+func newTestGuild(t *testing.T, driver db.Driver, owner *models.User, members ...*models.User) *models.Guild {
+	t.Helper()
+
+	guild, err := driver.CreateGuild(owner.ID, "guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, member := range members {
+		if _, err := driver.JoinGuild(guild.ID, member.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return guild
+}
+
+// publishMessage - delivers a new message to connected clients, as the bus does once it is stored
+func publishMessage(hub *realtime.Hub, msg *models.Message) {
+	hub.HandleEvent(&events.Event{Type: events.MessageCreated, Message: msg})
+}
+
+// testTokens - signs the tokens handler tests authenticate with
+var testTokens = auth.NewIssuer([]byte("test signing key"), time.Hour)
+
+// newTestToken - a token for a user, failing the test on error
+func newTestToken(t *testing.T, userID string) string {
+	t.Helper()
+
+	token, _, err := testTokens.Issue(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// newTestAPIKey - a new API key for a user with scopes, failing the test on error
+func newTestAPIKey(t *testing.T, driver db.Driver, user *models.User, scopes ...string) string {
+	t.Helper()
+
+	secret, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := driver.CreateAPIKey(&models.APIKey{UserID: user.ID, Name: "test", Scopes: scopes, Prefix: prefix}, hash); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
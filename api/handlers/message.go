@@ -2,15 +2,24 @@ package handlers
 
 import (
 	"net/http"
+	"net/url"
 
 	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/constants"
 	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/storage"
 	"github.com/radean0909/guild-chat/api/models"
 )
 
 // MessageHandler - the message handler. In a full-fledged app, this might dial into a gRPC service, for instance
 type MessageHandler struct {
 	DB db.Driver
+	// Blobs - where attached files are stored
+	Blobs storage.BlobStore
+	// MaxAttachmentSize - the largest file that can be attached to a message, in bytes
+	MaxAttachmentSize int64
+	// Commands - runs messages starting with a slash as commands
+	Commands *CommandHandler
 }
 
 // GetMessageByID - retrieve a single message by message ID
@@ -24,11 +33,237 @@ func (h *MessageHandler) GetMessageByID(c echo.Context) error {
 		return handleError(c, err)
 	}
 
+	if err := h.canRead(msg, callerID(c)); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, msg)
+
+}
+
+// PatchMessage - PATCH: edit the content of a message, only the sender can
+func (h *MessageHandler) PatchMessage(c echo.Context) error {
+	edit := &models.Message{}
+
+	if err := c.Bind(edit); err != nil {
+		return handleError(c, err)
+	}
+
+	msg, err := h.DB.GetMessage(c.Param("id"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	// members who can no longer send to a channel can't change what they sent either
+	if err := checkSend(h.DB, msg); err != nil {
+		return handleError(c, err)
+	}
+
+	msg, err = h.DB.EditMessage(msg.ID, callerID(c), edit.Content)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, msg)
+}
+
+// DeleteMessage - DELETE: delete a message for everyone, or with ?for=me hide it from the caller's own listings.
+// Senders can delete their own messages for everyone, and so can members allowed to delete messages in a channel.
+// Anyone who can read a message can hide it
+func (h *MessageHandler) DeleteMessage(c echo.Context) error {
+	msg, err := h.DB.GetMessage(c.Param("id"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	caller := callerID(c)
+	if err := h.canRead(msg, caller); err != nil {
+		return handleError(c, err)
+	}
+
+	switch c.QueryParam("for") {
+	case "me":
+		if err := h.DB.HideMessage(msg.ID, caller); err != nil {
+			return handleError(c, err)
+		}
+
+		return c.JSON(http.StatusNoContent, nil)
+
+	case "", "everyone":
+	default:
+		return handleError(c, constants.ErrBadRequest)
+	}
+
+	if err := h.canDelete(msg, caller); err != nil {
+		return handleError(c, err)
+	}
+
+	// already gone, there's nothing more to delete or tell anyone about
+	if msg.DeletedAt != nil {
+		return c.JSON(http.StatusOK, msg)
+	}
+
+	deleted, err := h.DB.DeleteMessage(msg.ID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	// the attachments are gone from the message, so their files can go too
+	h.deleteFiles(c, msg.Attachments)
+
+	return c.JSON(http.StatusOK, deleted)
+}
+
+// canDelete - forbidden unless the user sent a message, or it was sent to a channel and they are allowed to delete messages there
+func (h *MessageHandler) canDelete(msg *models.Message, userID string) error {
+	if msg.Sender == userID {
+		return nil
+	}
+
+	if msg.ChannelID == "" {
+		return constants.ErrForbidden
+	}
+
+	channel, err := h.DB.GetChannel(msg.ChannelID)
+	if err != nil {
+		return err
+	}
+
+	access, err := memberAccess(h.DB, channel.GuildID, userID)
+	if err != nil {
+		return err
+	}
+
+	if !access.Permissions.Has(models.PermDeleteMessages) {
+		return constants.ErrForbidden
+	}
+
+	return nil
+}
+
+// ListRevisions - lists what a message said before each edit, oldest first
+func (h *MessageHandler) ListRevisions(c echo.Context) error {
+	msg, err := h.DB.GetMessage(c.Param("id"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if err := h.canRead(msg, callerID(c)); err != nil {
+		return handleError(c, err)
+	}
+
+	revisions, err := h.DB.ListRevisions(msg.ID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, revisions)
+}
+
+// ListReplies - lists the replies to a message, oldest first
+func (h *MessageHandler) ListReplies(c echo.Context) error {
+	msg, err := h.DB.GetMessage(c.Param("id"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if err := h.canRead(msg, callerID(c)); err != nil {
+		return handleError(c, err)
+	}
+
+	start, err := dateParam(c, "start")
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	until, err := dateParam(c, "until")
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	limit, err := limitParam(c, 100) // set a default limit to 100
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	msgs, err := h.DB.ListReplies(msg.ID, start, until, limit)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, msgs)
+}
+
+// PutReaction - PUT: react to a message with an emoji, or a custom :short_code:. Anyone who can read a message can
+// react to it, and reacting twice with the same emoji changes nothing
+func (h *MessageHandler) PutReaction(c echo.Context) error {
+	return h.react(c, h.DB.AddReaction)
+}
+
+// DeleteReaction - DELETE: take back the caller's reaction to a message
+func (h *MessageHandler) DeleteReaction(c echo.Context) error {
+	return h.react(c, h.DB.RemoveReaction)
+}
+
+// react - adds or removes the caller's reaction named in the path, responding with the message and its reactions
+func (h *MessageHandler) react(c echo.Context, change func(messageID, userID, emoji string) (*models.Message, error)) error {
+	msg, err := h.DB.GetMessage(c.Param("id"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	caller := callerID(c)
+	if err := h.canRead(msg, caller); err != nil {
+		return handleError(c, err)
+	}
+
+	emoji, err := url.PathUnescape(c.Param("emoji"))
+	if err != nil {
+		return handleError(c, constants.ErrBadRequest)
+	}
+
+	msg, err = change(msg.ID, caller, emoji)
+	if err != nil {
+		return handleError(c, err)
+	}
+
 	return c.JSON(http.StatusOK, msg)
+}
+
+// canRead - forbidden unless the user is in the conversation, group or guild a message was sent to
+func (h *MessageHandler) canRead(msg *models.Message, userID string) error {
+	if msg.GroupID != "" {
+		group, err := h.DB.GetGroup(msg.GroupID)
+		if err != nil {
+			return err
+		}
+
+		if !isParticipant(group, userID) {
+			return constants.ErrForbidden
+		}
+
+		return nil
+	}
+
+	if msg.ChannelID != "" {
+		channel, err := h.DB.GetChannel(msg.ChannelID)
+		if err != nil {
+			return err
+		}
+
+		_, err = memberAccess(h.DB, channel.GuildID, userID)
+		return err
+	}
 
+	if msg.Sender != userID && msg.Recipient != userID {
+		return constants.ErrForbidden
+	}
+
+	return nil
 }
 
-// PostMessage - POST: create a new message
+// PostMessage - POST: create a new message. A message starting with a slash is run as a command instead, see
+// CommandHandler
 func (h *MessageHandler) PostMessage(c echo.Context) error {
 	msg := &models.Message{}
 
@@ -36,6 +271,17 @@ func (h *MessageHandler) PostMessage(c echo.Context) error {
 		return handleError(c, err)
 	}
 
+	// you can only send messages as yourself
+	msg.Sender = callerID(c)
+
+	if reply, ok, err := h.Commands.Run(msg, callerAPIKey(c)); ok {
+		return commandResponse(c, reply, err)
+	}
+
+	if err := checkSend(h.DB, msg); err != nil {
+		return handleError(c, err)
+	}
+
 	msg, err := h.DB.CreateMessage(msg)
 	if err != nil {
 		return handleError(c, err)
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// accessKey - the context key the caller's access to the guild in the path is stored under by Require
+const accessKey = "access"
+
+// guildAccess - a guild, and a member's role and permissions in it
+type guildAccess struct {
+	Guild       *models.Guild
+	Member      *models.Member
+	Permissions models.Permission
+}
+
+// Require - middleware for guild routes. Forbidden unless the caller is a member of the guild in the path, and
+// their role has every permission in perm. A perm of 0 only requires membership
+func (h *GuildHandler) Require(perm models.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			access, err := memberAccess(h.DB, c.Param("id"), callerID(c))
+			if err != nil {
+				return handleError(c, err)
+			}
+
+			if !access.Permissions.Has(perm) {
+				return handleError(c, constants.ErrForbidden)
+			}
+
+			c.Set(accessKey, access)
+			return next(c)
+		}
+	}
+}
+
+// callerAccess - the caller's access to the guild in the path, set by Require
+func callerAccess(c echo.Context) *guildAccess {
+	access, _ := c.Get(accessKey).(*guildAccess)
+	return access
+}
+
+// memberAccess - a user's access to a guild, forbidden unless they are a member
+func memberAccess(driver db.Driver, guildID, userID string) (*guildAccess, error) {
+	guild, err := driver.GetGuild(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := driver.GetMember(guild.ID, userID)
+	if err == constants.ErrNotFound {
+		return nil, constants.ErrForbidden
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	perms, err := rolePermissions(driver, guild.ID, member.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	return &guildAccess{Guild: guild, Member: member, Permissions: perms}, nil
+}
+
+// rolePermissions - what a role in a guild allows, either one of the default roles or a custom one
+func rolePermissions(driver db.Driver, guildID, role string) (models.Permission, error) {
+	if perms, ok := models.DefaultRoles[role]; ok {
+		return perms, nil
+	}
+
+	custom, err := driver.GetRole(guildID, role)
+	if err != nil {
+		return 0, err
+	}
+
+	return custom.Permissions, nil
+}
+
+// checkSend - forbidden if a message is to a guild channel the sender isn't allowed to send to. Routes
+// outside /guild, ie: POST /message and the socket, can't use Require so check here before sending
+func checkSend(driver db.Driver, msg *models.Message) error {
+	if msg.ChannelID == "" {
+		return nil
+	}
+
+	_, err := sendAccess(driver, msg)
+	return err
+}
+
+// sendAccess - the sender's access to the guild a channel message is to, forbidden unless they are allowed to send
+// to its channels and aren't muted
+func sendAccess(driver db.Driver, msg *models.Message) (*guildAccess, error) {
+	channel, err := driver.GetChannel(msg.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := memberAccess(driver, channel.GuildID, msg.Sender)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canSend(access) {
+		return nil, constants.ErrForbidden
+	}
+
+	return access, nil
+}
+
+// canSend - whether a member's role lets them send to a guild's channels, and they aren't muted
+func canSend(access *guildAccess) bool {
+	return access.Permissions.Has(models.PermSend) && !access.Member.Muted(time.Now())
+}
+
+// outranked - another member of the caller's guild, forbidden if they are the owner or their role allows
+// something the caller's doesn't
+func outranked(driver db.Driver, access *guildAccess, userID string) (*models.Member, error) {
+	target, err := driver.GetMember(access.Guild.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if target.Role == models.RoleOwner {
+		return nil, constants.ErrForbidden
+	}
+
+	perms, err := rolePermissions(driver, access.Guild.ID, target.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	if !access.Permissions.Has(perms) {
+		return nil, constants.ErrForbidden
+	}
+
+	return target, nil
+}
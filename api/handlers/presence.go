@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/presence"
+	"github.com/radean0909/guild-chat/api/internal/realtime"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// maxPresenceIDs - the most users whose presence can be asked for at once
+const maxPresenceIDs = 100
+
+// PresenceHandler - who is online and who is typing. Neither is kept in the datastore, which is only read to check
+// who can see someone typing
+type PresenceHandler struct {
+	DB        db.Driver
+	Hub       *realtime.Hub
+	Presence  *presence.Tracker
+	TypingTTL time.Duration // how long someone is typing for unless they say they still are
+}
+
+// GetPresence - returns whether each of the users in ids, a comma separated list, is online, idle or offline
+func (h *PresenceHandler) GetPresence(c echo.Context) error {
+	ids := []string{}
+	for _, id := range strings.Split(c.QueryParam("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 || len(ids) > maxPresenceIDs {
+		return handleError(c, constants.ErrBadRequest)
+	}
+
+	return c.JSON(http.StatusOK, h.Presence.Get(ids))
+}
+
+// PutPresence - PUT: sets the caller online or idle
+func (h *PresenceHandler) PutPresence(c echo.Context) error {
+	status := &models.Presence{}
+
+	if err := c.Bind(status); err != nil {
+		return handleError(c, err)
+	}
+
+	p, err := h.Presence.Set(callerID(c), status.Status)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, p)
+}
+
+// PostTyping - POST: the caller has started, or stopped, typing in a conversation, group or channel. Everyone else
+// who can read it is sent a typing event. Someone who keeps typing should post again before the last one expires
+func (h *PresenceHandler) PostTyping(c echo.Context) error {
+	typing := &models.Typing{}
+
+	if err := c.Bind(typing); err != nil {
+		return handleError(c, err)
+	}
+
+	// you can only type as yourself
+	typing.UserID = callerID(c)
+
+	recipients, err := h.typingRecipients(typing)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	typing.Expires = nil
+	if typing.Typing {
+		expires := time.Now().Add(h.TypingTTL)
+		typing.Expires = &expires
+	}
+
+	h.Hub.PublishTyping(typing, recipients)
+
+	return c.JSON(http.StatusOK, typing)
+}
+
+// typingRecipients - everyone who can read the conversation, group or channel someone is typing in, as long as
+// they can send to it themselves
+func (h *PresenceHandler) typingRecipients(typing *models.Typing) ([]string, error) {
+	named := 0
+	for _, id := range []string{typing.Recipient, typing.GroupID, typing.ChannelID} {
+		if id != "" {
+			named++
+		}
+	}
+
+	if named != 1 {
+		return nil, constants.ErrBadRequest
+	}
+
+	switch {
+	case typing.GroupID != "":
+		group, err := h.DB.GetGroup(typing.GroupID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isParticipant(group, typing.UserID) {
+			return nil, constants.ErrForbidden
+		}
+
+		return group.Participants, nil
+
+	case typing.ChannelID != "":
+		msg := &models.Message{Sender: typing.UserID, ChannelID: typing.ChannelID}
+		if err := checkSend(h.DB, msg); err != nil {
+			return nil, err
+		}
+
+		channel, err := h.DB.GetChannel(typing.ChannelID)
+		if err != nil {
+			return nil, err
+		}
+
+		members, err := h.DB.ListMembers(channel.GuildID)
+		if err != nil {
+			return nil, err
+		}
+
+		ids := make([]string, len(members))
+		for i, member := range members {
+			ids[i] = member.UserID
+		}
+		return ids, nil
+
+	default:
+		if _, err := h.DB.GetUser(typing.Recipient); err != nil {
+			return nil, err
+		}
+
+		return []string{typing.Recipient}, nil
+	}
+}
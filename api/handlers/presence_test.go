@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/db/mem"
+	"github.com/radean0909/guild-chat/api/internal/presence"
+	"github.com/radean0909/guild-chat/api/internal/realtime"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func TestPresence(t *testing.T) {
+	h := newPresenceHandler()
+	h.Presence.Connect("alice")
+	h.Presence.Set("bob", models.StatusIdle)
+
+	c, rec := newTestContext(t, testRequest{caller: "alice"})
+	c.QueryParams().Set("ids", " carol, bob ,,alice")
+	if err := h.GetPresence(c); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, "GetPresence", rec, http.StatusOK)
+
+	got := []*models.Presence{}
+	decode(t, rec, &got)
+
+	want := []string{"carol " + models.StatusOffline, "bob " + models.StatusIdle, "alice " + models.StatusOnline}
+	if len(got) != len(want) {
+		t.Fatalf("GetPresence: expected %v, got %d presences", want, len(got))
+	}
+	for i, p := range got {
+		if p.UserID+" "+p.Status != want[i] {
+			t.Errorf("GetPresence: expected %s, got %s %s", want[i], p.UserID, p.Status)
+		}
+	}
+
+	for _, ids := range []string{"", " , ", strings.Repeat("a,", maxPresenceIDs+1)} {
+		c, rec := newTestContext(t, testRequest{caller: "alice"})
+		c.QueryParams().Set("ids", ids)
+		if err := h.GetPresence(c); err != nil {
+			t.Fatal(err)
+		}
+		expectStatus(t, "GetPresence("+ids+")", rec, http.StatusBadRequest)
+	}
+}
+
+func TestPutPresence(t *testing.T) {
+	h := newPresenceHandler()
+
+	tests := []struct {
+		status string
+		code   int
+	}{
+		{models.StatusIdle, http.StatusOK},
+		{models.StatusOnline, http.StatusOK},
+		{models.StatusOffline, http.StatusBadRequest},
+		{"", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		// the status set is always the caller's
+		c, rec := newTestContext(t, testRequest{method: http.MethodPut, caller: "alice",
+			body: &models.Presence{UserID: "bob", Status: tt.status}})
+		if err := h.PutPresence(c); err != nil {
+			t.Fatal(err)
+		}
+		expectStatus(t, "PutPresence("+tt.status+")", rec, tt.code)
+
+		if tt.code != http.StatusOK {
+			continue
+		}
+
+		if got := h.Presence.Get([]string{"alice"})[0].Status; got != tt.status {
+			t.Errorf("PutPresence(%s): expected alice %s, got %s", tt.status, tt.status, got)
+		}
+	}
+
+	if got := h.Presence.Get([]string{"bob"})[0].Status; got != models.StatusOffline {
+		t.Errorf("expected bob to stay offline, got %s", got)
+	}
+}
+
+func TestPostTyping(t *testing.T) {
+	h := newPresenceHandler()
+
+	alice := newTestUser(t, h.DB, "alice")
+	bob := newTestUser(t, h.DB, "bob")
+	carol := newTestUser(t, h.DB, "carol")
+	dave := newTestUser(t, h.DB, "dave")
+
+	group, err := h.DB.CreateGroup(alice.ID, "group", []string{bob.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guild := newTestGuild(t, h.DB, alice, bob, carol)
+	channel := guild.Channels[0]
+
+	// carol is a member, but can only read the guild's channels
+	if _, err := h.DB.CreateRole(guild.ID, "readonly", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.DB.SetRole(guild.ID, carol.ID, "readonly"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		caller     *models.User
+		typing     *models.Typing
+		status     int
+		recipients []*models.User
+	}{
+		{"direct", alice, &models.Typing{Recipient: bob.ID, Typing: true}, http.StatusOK, []*models.User{bob}},
+		{"direct, stopped", alice, &models.Typing{Recipient: bob.ID}, http.StatusOK, []*models.User{bob}},
+		{"direct, unknown recipient", alice, &models.Typing{Recipient: "nobody", Typing: true}, http.StatusNotFound, nil},
+		{"group", bob, &models.Typing{GroupID: group.ID, Typing: true}, http.StatusOK, []*models.User{alice}},
+		{"group, not a participant", carol, &models.Typing{GroupID: group.ID, Typing: true}, http.StatusForbidden, nil},
+		{"group, unknown", alice, &models.Typing{GroupID: "nowhere", Typing: true}, http.StatusNotFound, nil},
+		{"channel", bob, &models.Typing{ChannelID: channel.ID, Typing: true}, http.StatusOK, []*models.User{alice, carol}},
+		{"channel, can't send", carol, &models.Typing{ChannelID: channel.ID, Typing: true}, http.StatusForbidden, nil},
+		{"channel, not a member", dave, &models.Typing{ChannelID: channel.ID, Typing: true}, http.StatusForbidden, nil},
+		{"nowhere", alice, &models.Typing{Typing: true}, http.StatusBadRequest, nil},
+		{"two places", alice, &models.Typing{Recipient: bob.ID, GroupID: group.ID, Typing: true}, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		subs := map[string]*realtime.Subscription{}
+		for _, user := range []*models.User{alice, bob, carol, dave} {
+			subs[user.ID] = h.Hub.Subscribe(user.ID, 1)
+		}
+
+		// you can only type as yourself
+		tt.typing.UserID = dave.ID
+
+		c, rec := newTestContext(t, testRequest{method: http.MethodPost, caller: tt.caller.ID, body: tt.typing})
+		if err := h.PostTyping(c); err != nil {
+			t.Fatal(err)
+		}
+		expectStatus(t, tt.name, rec, tt.status)
+
+		want := map[string]bool{}
+		for _, user := range tt.recipients {
+			want[user.ID] = true
+		}
+
+		for userID, sub := range subs {
+			sub.Close()
+
+			evt, sent := <-sub.C
+			switch {
+			case sent != want[userID]:
+				t.Errorf("%s: expected an event sent to %s to be %v", tt.name, userID, want[userID])
+			case !sent:
+			case evt.Type != realtime.EventTyping || evt.Typing.UserID != tt.caller.ID || evt.Typing.Typing != tt.typing.Typing:
+				t.Errorf("%s: expected %s typing %v, got %+v", tt.name, tt.caller.ID, tt.typing.Typing, evt.Typing)
+			case tt.typing.Typing != (evt.Typing.Expires != nil):
+				t.Errorf("%s: expected an expiry only while typing, got %v", tt.name, evt.Typing.Expires)
+			}
+		}
+	}
+}
+
+// newPresenceHandler - a presence handler with a hub and tracker of its own, and an empty datastore
+func newPresenceHandler() *PresenceHandler {
+	return &PresenceHandler{
+		DB:        mem.NewDriver(),
+		Hub:       realtime.NewHub(),
+		Presence:  presence.NewTracker(time.Minute),
+		TypingTTL: 10 * time.Second,
+	}
+}
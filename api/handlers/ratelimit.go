@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/ratelimit"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// throttle - uses up one request for each of keys, too many requests as soon as one has none left. The Retry-After
+// header says how many seconds until it does. A nil limiter doesn't limit anyone
+func throttle(c echo.Context, limiter *ratelimit.Limiter, keys ...string) error {
+	if limiter == nil {
+		return nil
+	}
+
+	for _, key := range keys {
+		if ok, wait := limiter.Allow(key); !ok {
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return constants.ErrTooManyRequests
+		}
+	}
+
+	return nil
+}
+
+// RateLimits - how often people and bots can make requests. Bots are limited separately, so an automation can be
+// given more, or less, room than a person. A nil limiter, or nil RateLimits, doesn't limit anyone
+type RateLimits struct {
+	Users *ratelimit.Limiter
+	Bots  *ratelimit.Limiter
+}
+
+// limiter - the limiter for people, or for bots
+func (l *RateLimits) limiter(bot bool) *ratelimit.Limiter {
+	if l == nil {
+		return nil
+	}
+
+	if bot {
+		return l.Bots
+	}
+	return l.Users
+}
+
+// allow - uses up one of a user's requests, false if they have none left
+func (l *RateLimits) allow(userID string, bot bool) bool {
+	limiter := l.limiter(bot)
+	if limiter == nil {
+		return true
+	}
+
+	ok, _ := limiter.Allow(userID)
+	return ok
+}
+
+// take - uses up one of the caller's requests, too many requests if they have none left. See throttle
+func (l *RateLimits) take(c echo.Context, user *models.User) error {
+	return throttle(c, l.limiter(user.Bot), user.ID)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// PutRead - PUT: marks a message, and everything before it in its conversation or group, as read by the caller.
+// Responds with how far the caller has read, which stays put when they had already read past the message. Channel
+// messages can't be marked read
+func (h *MessageHandler) PutRead(c echo.Context) error {
+	msg, err := h.DB.GetMessage(c.Param("id"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	caller := callerID(c)
+	if err := h.canRead(msg, caller); err != nil {
+		return handleError(c, err)
+	}
+
+	receipt, err := h.DB.MarkRead(caller, msg.ID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, receipt)
+}
+
+// ListReceipts - lists who has read a message, in the order they read it
+func (h *MessageHandler) ListReceipts(c echo.Context) error {
+	msg, err := h.DB.GetMessage(c.Param("id"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if err := h.canRead(msg, callerID(c)); err != nil {
+		return handleError(c, err)
+	}
+
+	receipts, err := h.DB.ListReceipts(msg.ID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, receipts)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+)
+
+// SearchHandler - full-text search over the messages a user can read: their direct messages, the groups they are
+// in and the channels of the guilds they are a member of
+type SearchHandler struct {
+	DB     db.Driver
+	Search db.Searcher
+}
+
+// GetSearch - finds the messages matching the q query param that the caller can read, newest first. See db.Search
+// for what q can hold. sender, start and until narrow the search, and limit defaults to 50
+func (h *SearchHandler) GetSearch(c echo.Context) error {
+	caller := callerID(c)
+	search := db.Search{
+		Text:   c.QueryParam("q"),
+		Viewer: caller,
+		Sender: c.QueryParam("sender"),
+	}
+
+	if strings.TrimSpace(search.Text) == "" {
+		return handleError(c, constants.ErrBadRequest)
+	}
+
+	var err error
+	if search.From, err = dateParam(c, "start"); err != nil {
+		return handleError(c, err)
+	}
+
+	if search.Until, err = dateParam(c, "until"); err != nil {
+		return handleError(c, err)
+	}
+
+	if search.Limit, err = limitParam(c, 50); err != nil {
+		return handleError(c, err)
+	}
+
+	groups, err := h.DB.ListGroups(caller, time.Time{}, time.Time{})
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	for _, group := range groups {
+		search.Groups = append(search.Groups, group.ID)
+	}
+
+	guilds, err := h.DB.ListGuilds(caller, time.Time{}, time.Time{})
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	for _, guild := range guilds {
+		for _, channel := range guild.Channels {
+			search.Channels = append(search.Channels, channel.ID)
+		}
+	}
+
+	msgs, err := h.Search.SearchMessages(search)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, msgs)
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/presence"
+	"github.com/radean0909/guild-chat/api/internal/realtime"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+const (
+	// socketWriteWait - time allowed to write a single frame to the client
+	socketWriteWait = 10 * time.Second
+	// socketPongWait - time allowed between pongs before the client is considered gone
+	socketPongWait = 60 * time.Second
+	// socketPingPeriod - how often we ping the client, must be less than socketPongWait
+	socketPingPeriod = socketPongWait * 9 / 10
+	// socketMaxMessageSize - largest frame accepted from the client
+	socketMaxMessageSize = 64 * 1024
+	// socketBuffer - events queued for a client before it is considered too slow and dropped
+	socketBuffer = 256
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// SocketHandler - realtime delivery of messages over a websocket. A connected user receives every
+// message sent to them, and can send messages over the same socket. They are online while connected.
+// Messages sent over the socket count towards the sender's rate limit, as if they were posted
+type SocketHandler struct {
+	DB       db.Driver
+	Hub      *realtime.Hub
+	Presence *presence.Tracker
+	Limits   *RateLimits
+	// Commands - runs messages starting with a slash as commands
+	Commands *CommandHandler
+}
+
+// socket - a single connected client. Only the write pump writes to conn, everything else queues
+// events for it on the subscription or replies
+type socket struct {
+	conn    *websocket.Conn
+	sub     *realtime.Subscription
+	replies chan *realtime.Event // events for this connection only, ie: errors and commands' ephemeral replies
+	done    chan struct{}        // closed when the write pump exits
+	bot     bool                 // whether the connected user is a bot, for their rate limit
+	canSend bool                 // false when connected with an API key that can only read messages
+	key     *models.APIKey       // the API key the client connected with, nil for a token from Login
+}
+
+// Connect - GET /ws upgrades to a websocket and subscribes the authenticated user to their messages.
+// Blocks until the client disconnects or the service shuts down
+func (h *SocketHandler) Connect(c echo.Context) error {
+	userID := callerID(c)
+
+	// subscribe before the handshake completes, so nothing published once the client is connected is missed
+	sub := h.Hub.Subscribe(userID, socketBuffer)
+
+	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		sub.Close()
+		// the upgrader has already replied to the client
+		return nil
+	}
+
+	s := &socket{
+		conn:    conn,
+		sub:     sub,
+		replies: make(chan *realtime.Event, 1),
+		done:    make(chan struct{}),
+		bot:     callerIsBot(c),
+		canSend: allowed(c, models.ScopeMessages, true),
+		key:     callerAPIKey(c),
+	}
+
+	h.Presence.Connect(userID)
+	defer h.Presence.Disconnect(userID)
+
+	go s.writePump()
+	h.readPump(s)
+
+	return nil
+}
+
+// readPump - reads messages sent by the client until it disconnects, then ends the subscription
+func (h *SocketHandler) readPump(s *socket) {
+	defer s.sub.Close()
+
+	s.conn.SetReadLimit(socketMaxMessageSize)
+	s.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		h.Presence.Touch(s.sub.UserID)
+		return s.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		h.Presence.Touch(s.sub.UserID)
+
+		if !s.canSend {
+			s.reply(&realtime.Event{Type: realtime.EventError, Error: constants.ErrForbidden.Error()})
+			continue
+		}
+
+		if !h.Limits.allow(s.sub.UserID, s.bot) {
+			s.reply(&realtime.Event{Type: realtime.EventError, Error: constants.ErrTooManyRequests.Error()})
+			continue
+		}
+
+		msg := &models.Message{}
+		if err := json.Unmarshal(data, msg); err != nil {
+			s.reply(&realtime.Event{Type: realtime.EventError, Error: constants.ErrBadRequest.Error()})
+			continue
+		}
+
+		// you can only send messages as yourself
+		msg.ID = ""
+		msg.Sender = s.sub.UserID
+
+		// commands' ephemeral replies are for this connection only, anything they send is delivered by the hub
+		if reply, ok, err := h.Commands.Run(msg, s.key); ok {
+			if err != nil {
+				s.reply(&realtime.Event{Type: realtime.EventError, Error: err.Error()})
+			} else if reply != nil && reply.Ephemeral {
+				s.reply(&realtime.Event{Type: realtime.EventEphemeral, Message: reply})
+			}
+			continue
+		}
+
+		if err := checkSend(h.DB, msg); err != nil {
+			s.reply(&realtime.Event{Type: realtime.EventError, Error: err.Error()})
+			continue
+		}
+
+		// the message is delivered back to us, and to the recipient, by the hub
+		if _, err := h.DB.CreateMessage(msg); err != nil {
+			s.reply(&realtime.Event{Type: realtime.EventError, Error: err.Error()})
+		}
+	}
+}
+
+// reply - queues an event for this connection only, dropping it if the write pump has gone
+func (s *socket) reply(evt *realtime.Event) {
+	select {
+	case s.replies <- evt:
+	case <-s.done:
+	}
+}
+
+// writePump - writes events and heartbeats to the client. When the subscription ends, either because
+// the client was too slow or the service is shutting down, the client is sent a close frame
+func (s *socket) writePump() {
+	ticker := time.NewTicker(socketPingPeriod)
+	defer func() {
+		ticker.Stop()
+		close(s.done)
+		s.conn.Close()
+	}()
+
+	for {
+		select {
+		case evt, ok := <-s.sub.C:
+			if !ok {
+				s.conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, "reconnect to resume"),
+					time.Now().Add(socketWriteWait))
+				return
+			}
+			if err := s.write(evt); err != nil {
+				return
+			}
+
+		case evt := <-s.replies:
+			if err := s.write(evt); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *socket) write(evt *realtime.Event) error {
+	s.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	return s.conn.WriteJSON(evt)
+}
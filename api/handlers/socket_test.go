@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/db/mem"
+	"github.com/radean0909/guild-chat/api/internal/events"
+	"github.com/radean0909/guild-chat/api/internal/presence"
+	"github.com/radean0909/guild-chat/api/internal/ratelimit"
+	"github.com/radean0909/guild-chat/api/internal/realtime"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// socketReadWait - how long a test waits for an event before failing
+const socketReadWait = 5 * time.Second
+
+func TestSocketDelivery(t *testing.T) {
+	h := newSocketHandler(mem.NewDriver())
+	srv := newSocketServer(h)
+	defer srv.Close()
+
+	alice := newTestUser(t, h.DB, "alice")
+	bob := newTestUser(t, h.DB, "bob")
+
+	conn := dialSocket(t, srv, alice.ID)
+	defer conn.Close()
+
+	msg, err := h.DB.CreateMessage(&models.Message{Sender: bob.ID, Recipient: alice.ID, Content: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishMessage(h.Hub, msg)
+
+	evt := readEvent(t, conn)
+	if evt.Type != realtime.EventMessage || evt.Message == nil || evt.Message.ID != msg.ID {
+		t.Errorf("expected the message delivered to its recipient, got %+v", evt)
+	}
+}
+
+func TestSocketSend(t *testing.T) {
+	// messages sent over the socket reach the hub through the bus, as the service wires it
+	bus := events.NewBus()
+	defer bus.Close()
+
+	h := newSocketHandler(events.NewDriver(mem.NewDriver(), bus))
+	bus.Subscribe("realtime", socketBuffer, h.Hub.HandleEvent, events.MessageCreated)
+
+	srv := newSocketServer(h)
+	defer srv.Close()
+
+	alice := newTestUser(t, h.DB, "alice")
+	bob := newTestUser(t, h.DB, "bob")
+
+	aliceConn := dialSocket(t, srv, alice.ID)
+	defer aliceConn.Close()
+	bobConn := dialSocket(t, srv, bob.ID)
+	defer bobConn.Close()
+
+	// the sender is always the connected user, whatever the client claims
+	if err := aliceConn.WriteJSON(&models.Message{Sender: bob.ID, Recipient: bob.ID, Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	received := readEvent(t, bobConn)
+	if received.Type != realtime.EventMessage || received.Message == nil ||
+		received.Message.Sender != alice.ID || received.Message.Content != "hi" {
+		t.Fatalf("expected alice's message delivered to bob, got %+v", received)
+	}
+
+	// the sender's own connections see it too
+	echoed := readEvent(t, aliceConn)
+	if echoed.Type != realtime.EventMessage || echoed.Message == nil || echoed.Message.ID != received.Message.ID {
+		t.Errorf("expected the message echoed to alice, got %+v", echoed)
+	}
+
+	if _, err := h.DB.GetMessage(received.Message.ID); err != nil {
+		t.Errorf("expected the message to be stored, got %v", err)
+	}
+
+	// failures are reported to the sending connection only, and it stays open
+	if err := aliceConn.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+	if evt := readEvent(t, aliceConn); evt.Type != realtime.EventError || evt.Error != constants.ErrBadRequest.Error() {
+		t.Errorf("expected a bad request error for malformed json, got %+v", evt)
+	}
+
+	if err := aliceConn.WriteJSON(&models.Message{Recipient: bob.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if evt := readEvent(t, aliceConn); evt.Type != realtime.EventError || evt.Error != constants.ErrBadRequest.Error() {
+		t.Errorf("expected a bad request error for an empty message, got %+v", evt)
+	}
+}
+
+func TestSocketSlowConsumer(t *testing.T) {
+	h := newSocketHandler(mem.NewDriver())
+	srv := newSocketServer(h)
+	defer srv.Close()
+
+	alice := newTestUser(t, h.DB, "alice")
+
+	conn := dialSocket(t, srv, alice.ID)
+	defer conn.Close()
+
+	// while the client isn't reading, far more is published than the socket and its buffer can hold
+	published := socketBuffer * 8
+	content := strings.Repeat("x", 16*1024)
+	for i := 0; i < published; i++ {
+		h.Hub.Publish(alice.ID, &realtime.Event{Type: realtime.EventMessage, Message: &models.Message{Content: content}})
+	}
+
+	// the client gets what was queued before it fell behind, then is told to reconnect
+	received := 0
+	conn.SetReadDeadline(time.Now().Add(socketReadWait))
+	for {
+		evt := &realtime.Event{}
+		err := conn.ReadJSON(evt)
+		if err == nil {
+			received++
+			continue
+		}
+
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Fatalf("expected a going away close frame, got %v", err)
+		}
+		break
+	}
+
+	if received == 0 || received >= published {
+		t.Errorf("expected some but not all of the %d events before the close, got %d", published, received)
+	}
+}
+
+func TestSocketHubClose(t *testing.T) {
+	h := newSocketHandler(mem.NewDriver())
+	srv := newSocketServer(h)
+	defer srv.Close()
+
+	alice := newTestUser(t, h.DB, "alice")
+
+	conn := dialSocket(t, srv, alice.ID)
+	defer conn.Close()
+
+	h.Hub.Close()
+	expectClose(t, conn)
+
+	// connecting once the service is shutting down is closed straight away
+	late := dialSocket(t, srv, alice.ID)
+	defer late.Close()
+	expectClose(t, late)
+}
+
+func TestSocketPresence(t *testing.T) {
+	h := newSocketHandler(mem.NewDriver())
+	srv := newSocketServer(h)
+	defer srv.Close()
+
+	alice := newTestUser(t, h.DB, "alice")
+
+	first := dialSocket(t, srv, alice.ID)
+	defer first.Close()
+	second := dialSocket(t, srv, alice.ID)
+	defer second.Close()
+
+	// once a socket has answered, its user is online
+	for _, conn := range []*websocket.Conn{first, second} {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+			t.Fatal(err)
+		}
+		readEvent(t, conn)
+	}
+	expectPresence(t, h.Presence, alice.ID, models.StatusOnline)
+
+	// and stays online until their last socket closes
+	first.Close()
+	time.Sleep(50 * time.Millisecond)
+	expectPresence(t, h.Presence, alice.ID, models.StatusOnline)
+
+	second.Close()
+	awaitPresence(t, h.Presence, alice.ID, models.StatusOffline)
+}
+
+func TestSocketUnauthenticated(t *testing.T) {
+	h := newSocketHandler(mem.NewDriver())
+	srv := newSocketServer(h)
+	defer srv.Close()
+
+	alice := newTestUser(t, h.DB, "alice")
+	if err := h.DB.DeleteUser(alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"no token", ""},
+		{"bad token", "not-a-token"},
+		{"deleted user", newTestToken(t, alice.ID)},
+	}
+
+	for _, tt := range tests {
+		_, resp, err := websocket.DefaultDialer.Dial(socketURL(srv, tt.token), nil)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: expected the handshake refused with a 401, got %v, %v", tt.name, resp, err)
+		}
+	}
+}
+
+func TestSocketAPIKeys(t *testing.T) {
+	h := newSocketHandler(mem.NewDriver())
+	srv := newSocketServer(h)
+	defer srv.Close()
+
+	alice := newTestUser(t, h.DB, "alice")
+	bob := newTestUser(t, h.DB, "bob")
+
+	// a key that can only read messages gets them, but can't send
+	reader := dialSocketWithKey(t, srv, newTestAPIKey(t, h.DB, alice, models.ReadScope(models.ScopeMessages)))
+	defer reader.Close()
+
+	msg, err := h.DB.CreateMessage(&models.Message{Sender: bob.ID, Recipient: alice.ID, Content: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishMessage(h.Hub, msg)
+
+	if evt := readEvent(t, reader); evt.Type != realtime.EventMessage || evt.Message == nil || evt.Message.ID != msg.ID {
+		t.Errorf("expected the message delivered to a read only key, got %+v", evt)
+	}
+
+	if err := reader.WriteJSON(&models.Message{Recipient: bob.ID, Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if evt := readEvent(t, reader); evt.Type != realtime.EventError || evt.Error != constants.ErrForbidden.Error() {
+		t.Errorf("expected a forbidden error sending with a read only key, got %+v", evt)
+	}
+
+	// one that can write gets past the check, so a malformed message is only a bad request
+	writer := dialSocketWithKey(t, srv, newTestAPIKey(t, h.DB, alice, models.ReadScope(models.ScopeMessages), models.WriteScope(models.ScopeMessages)))
+	defer writer.Close()
+
+	if err := writer.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+	if evt := readEvent(t, writer); evt.Type != realtime.EventError || evt.Error != constants.ErrBadRequest.Error() {
+		t.Errorf("expected a bad request error with a write key, got %+v", evt)
+	}
+
+	// a key for another area can't connect at all
+	other := newTestAPIKey(t, h.DB, alice, models.ReadScope(models.ScopeGuilds))
+	header := http.Header{echo.HeaderAuthorization: []string{"Bearer " + other}}
+	if _, resp, err := websocket.DefaultDialer.Dial(socketURL(srv, ""), header); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected a key for another area refused with a 403, got %v, %v", resp, err)
+	}
+
+	// and keys aren't accepted in the url
+	key := newTestAPIKey(t, h.DB, alice, models.ReadScope(models.ScopeMessages))
+	if _, resp, err := websocket.DefaultDialer.Dial(socketURL(srv, key), nil); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a key in the url refused with a 401, got %v, %v", resp, err)
+	}
+}
+
+func TestSocketRateLimit(t *testing.T) {
+	h := newSocketHandler(mem.NewDriver())
+	// one request for connecting and two messages, and none back during the test
+	h.Limits = &RateLimits{Users: ratelimit.NewLimiter(1.0/3600, 3)}
+
+	srv := newSocketServer(h)
+	defer srv.Close()
+
+	alice := newTestUser(t, h.DB, "alice")
+	conn := dialSocket(t, srv, alice.ID)
+	defer conn.Close()
+
+	// malformed messages still count, they are only read once allowed
+	for _, want := range []error{constants.ErrBadRequest, constants.ErrBadRequest, constants.ErrTooManyRequests} {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+			t.Fatal(err)
+		}
+		if evt := readEvent(t, conn); evt.Type != realtime.EventError || evt.Error != want.Error() {
+			t.Errorf("expected a %v error, got %+v", want, evt)
+		}
+	}
+
+	// the connection stays open, so events still arrive
+	msg := &models.Message{ID: "message", Sender: alice.ID, Recipient: alice.ID, Content: "hi"}
+	publishMessage(h.Hub, msg)
+	if evt := readEvent(t, conn); evt.Type != realtime.EventMessage || evt.Message == nil || evt.Message.ID != msg.ID {
+		t.Errorf("expected the message delivered once limited, got %+v", evt)
+	}
+
+	// a new connection is a request like any other
+	_, resp, err := websocket.DefaultDialer.Dial(socketURL(srv, newTestToken(t, alice.ID)), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected connecting once limited refused with a 429, got %v, %v", resp, err)
+	}
+}
+
+// newSocketHandler - a socket handler for the users in driver, with a hub and presence of its own
+func newSocketHandler(driver db.Driver) *SocketHandler {
+	return &SocketHandler{DB: driver, Hub: realtime.NewHub(), Presence: presence.NewTracker(time.Minute)}
+}
+
+// newSocketServer - the websocket endpoint on a real listener, so clients can dial it, authenticated as the service has it
+func newSocketServer(h *SocketHandler) *httptest.Server {
+	authn := &AuthHandler{DB: h.DB, Tokens: testTokens, Limits: h.Limits}
+
+	e := echo.New()
+	e.GET("/ws", h.Connect, QueryToken, authn.Authenticate, authn.RequireScope(models.ScopeMessages))
+	return httptest.NewServer(e)
+}
+
+// socketURL - the websocket url on srv, with a token as browsers send it
+func socketURL(srv *httptest.Server, token string) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?access_token=" + token
+}
+
+// dialSocket - connects to srv as a user, failing the test on error
+func dialSocket(t *testing.T, srv *httptest.Server, userID string) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial(socketURL(srv, newTestToken(t, userID)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// dialSocketWithKey - connects to srv with an API key, which is only accepted in the header, failing the test on error
+func dialSocketWithKey(t *testing.T, srv *httptest.Server, key string) *websocket.Conn {
+	t.Helper()
+
+	header := http.Header{echo.HeaderAuthorization: []string{"Bearer " + key}}
+	conn, _, err := websocket.DefaultDialer.Dial(socketURL(srv, ""), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// readEvent - reads the next event from a socket, failing the test if none arrives in time
+func readEvent(t *testing.T, conn *websocket.Conn) *realtime.Event {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(socketReadWait))
+	evt := &realtime.Event{}
+	if err := conn.ReadJSON(evt); err != nil {
+		t.Fatalf("reading event: %v", err)
+	}
+	return evt
+}
+
+// expectClose - fails the test unless the next frame from a socket closes it as going away
+func expectClose(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(socketReadWait))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected a going away close frame, got %v", err)
+	}
+}
+
+// expectPresence - fails the test unless a user's status is want
+func expectPresence(t *testing.T, tracker *presence.Tracker, userID, want string) {
+	t.Helper()
+
+	if got := tracker.Get([]string{userID})[0].Status; got != want {
+		t.Errorf("expected %s %s, got %s", userID, want, got)
+	}
+}
+
+// awaitPresence - waits for a user's status to be want, as sockets close in the background, failing the test
+// if it isn't by socketReadWait
+func awaitPresence(t *testing.T, tracker *presence.Tracker, userID, want string) {
+	t.Helper()
+
+	for deadline := time.Now().Add(socketReadWait); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if tracker.Get([]string{userID})[0].Status == want {
+			return
+		}
+	}
+	expectPresence(t, tracker, userID, want)
+}
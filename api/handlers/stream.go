@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/realtime"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+const (
+	// streamHeartbeat - how often a comment is sent to keep proxies from timing out an idle stream
+	streamHeartbeat = 15 * time.Second
+	// streamRetry - how long clients should wait before reconnecting, in milliseconds
+	streamRetry = 3000
+	// streamBuffer - events queued for a client before it is considered too slow and dropped
+	streamBuffer = 256
+)
+
+// StreamConversation - streams new messages sent from one person to another as server-sent events
+func (h *ConversationHandler) StreamConversation(c echo.Context) error {
+	return h.stream(c, c.Param("to"), c.Param("from"))
+}
+
+// StreamConversations - streams new messages sent to a particular person as server-sent events
+func (h *ConversationHandler) StreamConversations(c echo.Context) error {
+	return h.stream(c, c.Param("to"), "")
+}
+
+// stream - sends every new message to recipient (and from sender, if set) as an event, with the message id
+// as the event id. A client reconnecting with Last-Event-ID is first sent everything it missed since that message
+func (h *ConversationHandler) stream(c echo.Context, recipient, sender string) error {
+	// only the recipient, or the sender of the conversation being streamed, can follow it
+	if caller := callerID(c); caller != recipient && (sender == "" || caller != sender) {
+		return handleError(c, constants.ErrForbidden)
+	}
+
+	if _, err := h.DB.GetUser(recipient); err != nil {
+		return handleError(c, err)
+	}
+
+	if sender != "" {
+		if _, err := h.DB.GetUser(sender); err != nil {
+			return handleError(c, err)
+		}
+	}
+
+	// subscribe before catching up, so nothing sent in between is lost. Anything seen twice is skipped
+	sub := h.Hub.Subscribe(recipient, streamBuffer)
+	defer sub.Close()
+
+	missed, err := h.missed(c, recipient, sender)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no") // stop nginx buffering the stream
+	res.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(res, "retry: %d\n\n", streamRetry); err != nil {
+		return nil
+	}
+
+	sent := map[string]bool{}
+	for _, msg := range missed {
+		if err := writeEvent(res, msg); err != nil {
+			return nil
+		}
+		sent[msg.ID] = true
+	}
+	res.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case evt, ok := <-sub.C:
+			// the hub has shut down or we fell behind - the client will reconnect and catch up
+			if !ok {
+				return nil
+			}
+
+			if evt.Type != realtime.EventMessage || evt.Message.Recipient != recipient || sent[evt.Message.ID] {
+				continue
+			}
+
+			if sender != "" && evt.Message.Sender != sender {
+				continue
+			}
+
+			if err := writeEvent(res, evt.Message); err != nil {
+				return nil
+			}
+			res.Flush()
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+
+		case <-c.Request().Context().Done():
+			return nil
+		}
+	}
+}
+
+// missed - the messages sent to recipient (and from sender, if set) after the Last-Event-ID, oldest first.
+// Without a Last-Event-ID, or if it isn't a message sent to recipient, there is nothing to replay
+func (h *ConversationHandler) missed(c echo.Context, recipient, sender string) ([]*models.Message, error) {
+	lastID := c.Request().Header.Get("Last-Event-ID")
+	if lastID == "" {
+		// EventSource can't set headers on the first connection, so allow a query param too
+		lastID = c.QueryParam("last_event_id")
+	}
+
+	if lastID == "" {
+		return nil, nil
+	}
+
+	// the last event must have been one of ours
+	last, err := h.DB.GetMessage(lastID)
+	if err != nil || last.Recipient != recipient {
+		return nil, nil
+	}
+
+	msgs, err := h.DB.ListMessages(recipient, *last.Date, time.Time{}, 0, db.OldestFirst)
+	if err != nil {
+		return nil, err
+	}
+
+	// messages sent at the same time as the last event come after it only if they are listed after it
+	after := db.CursorAt(last)
+	missed := []*models.Message{}
+	for _, msg := range msgs {
+		if !after.Follows(msg) || (sender != "" && msg.Sender != sender) {
+			continue
+		}
+		missed = append(missed, msg)
+	}
+
+	return missed, nil
+}
+
+// writeEvent - writes a message as a single server-sent event
+func writeEvent(res *echo.Response, msg *models.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(res, "id: %s\nevent: %s\ndata: %s\n\n", msg.ID, realtime.EventMessage, data)
+	return err
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/db/mem"
+	"github.com/radean0909/guild-chat/api/internal/realtime"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// sameTimeDriver - stamps every message with the same date, as when several arrive within the clock's resolution
+type sameTimeDriver struct {
+	db.Driver
+	date time.Time
+}
+
+func (d *sameTimeDriver) GetMessage(id string) (*models.Message, error) {
+	msg, err := d.Driver.GetMessage(id)
+	if err != nil {
+		return nil, err
+	}
+	return d.stamp(msg), nil
+}
+
+func (d *sameTimeDriver) ListMessages(recipient string, from, until time.Time, limit int, order db.Order) ([]*models.Message, error) {
+	msgs, err := d.Driver.ListMessages(recipient, from, until, limit, order)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, msg := range msgs {
+		msgs[i] = d.stamp(msg)
+	}
+
+	// with the dates all the same, listings are ordered by id alone
+	sort.Slice(msgs, func(i, j int) bool {
+		if order == db.NewestFirst {
+			return msgs[i].ID > msgs[j].ID
+		}
+		return msgs[i].ID < msgs[j].ID
+	})
+	return msgs, nil
+}
+
+func (d *sameTimeDriver) stamp(msg *models.Message) *models.Message {
+	stamped := *msg
+	stamped.Date = &d.date
+	return &stamped
+}
+
+func TestStreamReplay(t *testing.T) {
+	tests := []struct {
+		name   string
+		lastID func(r *http.Request, id string)
+	}{
+		{"Last-Event-ID", func(r *http.Request, id string) { r.Header.Set("Last-Event-ID", id) }},
+		{"last_event_id", func(r *http.Request, id string) { r.URL.RawQuery = "last_event_id=" + id }},
+		{"none", nil},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			h := &ConversationHandler{
+				DB:  &sameTimeDriver{Driver: mem.NewDriver(), date: time.Now().Add(-time.Hour)},
+				Hub: realtime.NewHub(),
+			}
+			srv := newStreamServer(h)
+			defer srv.Close()
+
+			alice := newTestUser(t, h.DB, "alice")
+			bob := newTestUser(t, h.DB, "bob")
+
+			// all sent at once, so they are listed by id
+			sent := []*models.Message{}
+			for _, content := range []string{"one", "two", "three", "four", "five"} {
+				msg, err := h.DB.CreateMessage(&models.Message{Sender: bob.ID, Recipient: alice.ID, Content: content})
+				if err != nil {
+					t.Fatal(err)
+				}
+				sent = append(sent, msg)
+			}
+			sort.Slice(sent, func(i, j int) bool { return sent[i].ID < sent[j].ID })
+
+			// the last event seen was the second message, only the rest are still to come
+			missed, latest := sent[2:4], sent[4]
+			events, stop := openStream(t, srv, "/conversation/"+alice.ID+"/stream", alice, func(r *http.Request) {
+				if tt.lastID != nil {
+					tt.lastID(r, sent[1].ID)
+				}
+			})
+			defer stop()
+
+			if tt.lastID == nil {
+				// without a last event id, only new messages are sent
+				missed = nil
+			}
+
+			// replayed in order, then new messages as they are published, skipping any already replayed
+			for _, msg := range missed {
+				expectStreamEvent(t, events, msg)
+				publishMessage(h.Hub, msg)
+			}
+
+			publishMessage(h.Hub, latest)
+			expectStreamEvent(t, events, latest)
+		})
+	}
+}
+
+func TestStreamConversationSender(t *testing.T) {
+	h := &ConversationHandler{DB: mem.NewDriver(), Hub: realtime.NewHub()}
+	srv := newStreamServer(h)
+	defer srv.Close()
+
+	alice := newTestUser(t, h.DB, "alice")
+	bob := newTestUser(t, h.DB, "bob")
+	carol := newTestUser(t, h.DB, "carol")
+
+	send := func(sender *models.User, content string) *models.Message {
+		msg, err := h.DB.CreateMessage(&models.Message{Sender: sender.ID, Recipient: alice.ID, Content: content})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	first := send(bob, "one")
+	send(carol, "not this")
+	second := send(bob, "two")
+
+	// the pair's stream replays and delivers only what the sender sent
+	events, stop := openStream(t, srv, "/conversation/"+alice.ID+"/"+bob.ID+"/stream", alice, func(r *http.Request) {
+		r.Header.Set("Last-Event-ID", first.ID)
+	})
+	defer stop()
+
+	expectStreamEvent(t, events, second)
+
+	publishMessage(h.Hub, send(carol, "nor this"))
+	third := send(bob, "three")
+	publishMessage(h.Hub, third)
+	expectStreamEvent(t, events, third)
+}
+
+func TestStreamPermissions(t *testing.T) {
+	h := &ConversationHandler{DB: mem.NewDriver(), Hub: realtime.NewHub()}
+	srv := newStreamServer(h)
+	defer srv.Close()
+
+	alice := newTestUser(t, h.DB, "alice")
+	bob := newTestUser(t, h.DB, "bob")
+	carol := newTestUser(t, h.DB, "carol")
+
+	tests := []struct {
+		name   string
+		path   string
+		caller *models.User
+		status int
+	}{
+		{"recipient", "/conversation/" + alice.ID + "/stream", alice, http.StatusOK},
+		{"someone else's messages", "/conversation/" + alice.ID + "/stream", bob, http.StatusForbidden},
+		{"recipient of a conversation", "/conversation/" + alice.ID + "/" + bob.ID + "/stream", alice, http.StatusOK},
+		{"sender of a conversation", "/conversation/" + alice.ID + "/" + bob.ID + "/stream", bob, http.StatusOK},
+		{"third party to a conversation", "/conversation/" + alice.ID + "/" + bob.ID + "/stream", carol, http.StatusForbidden},
+		{"unknown sender", "/conversation/" + alice.ID + "/nobody/stream", alice, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+newTestToken(t, tt.caller.ID))
+
+		// an open stream only ends when the client goes, so only wait for the status
+		ctx, cancel := context.WithCancel(context.Background())
+		res, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			cancel()
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		cancel()
+
+		if res.StatusCode != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.status, res.StatusCode)
+		}
+	}
+}
+
+func TestStreamReplaysOnlyOwnMessages(t *testing.T) {
+	h := &ConversationHandler{DB: mem.NewDriver(), Hub: realtime.NewHub()}
+	srv := newStreamServer(h)
+	defer srv.Close()
+
+	alice := newTestUser(t, h.DB, "alice")
+	bob := newTestUser(t, h.DB, "bob")
+
+	// bob can't replay alice's messages by naming one of them as his last event
+	toAlice, err := h.DB.CreateMessage(&models.Message{Sender: bob.ID, Recipient: alice.ID, Content: "for alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.DB.CreateMessage(&models.Message{Sender: bob.ID, Recipient: alice.ID, Content: "also for alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, stop := openStream(t, srv, "/conversation/"+bob.ID+"/stream", bob, func(r *http.Request) {
+		r.Header.Set("Last-Event-ID", toAlice.ID)
+	})
+	defer stop()
+
+	toBob, err := h.DB.CreateMessage(&models.Message{Sender: alice.ID, Recipient: bob.ID, Content: "for bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishMessage(h.Hub, toBob)
+	expectStreamEvent(t, events, toBob)
+}
+
+// newStreamServer - the stream endpoints on a real listener, so responses are streamed as they are written,
+// authenticated as the service has them
+func newStreamServer(h *ConversationHandler) *httptest.Server {
+	authn := &AuthHandler{DB: h.DB, Tokens: testTokens}
+
+	e := echo.New()
+	e.GET("/conversation/:to/stream", h.StreamConversations, QueryToken, authn.Authenticate)
+	e.GET("/conversation/:to/:from/stream", h.StreamConversation, QueryToken, authn.Authenticate)
+	return httptest.NewServer(e)
+}
+
+// openStream - opens an event stream on srv as caller, with the request edited by setup if set. The stream is
+// closed by the returned func, or after socketReadWait so a missing event fails rather than hangs the test
+func openStream(t *testing.T, srv *httptest.Server, path string, caller *models.User, setup func(r *http.Request)) (*bufio.Reader, func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), socketReadWait)
+	req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+newTestToken(t, caller.ID))
+	if setup != nil {
+		setup(req)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		cancel()
+		t.Fatalf("GET %s: expected 200, got %d", path, res.StatusCode)
+	}
+
+	return bufio.NewReader(res.Body), func() {
+		cancel()
+		res.Body.Close()
+	}
+}
+
+// expectStreamEvent - fails the test unless the next message event on a stream is want, with its id as the event id
+func expectStreamEvent(t *testing.T, events *bufio.Reader, want *models.Message) {
+	t.Helper()
+
+	id, msg := "", &models.Message{}
+	for {
+		line, err := events.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expected the message %q, reading the stream: %v", want.Content, err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), msg); err != nil {
+				t.Fatal(err)
+			}
+		case line == "" && id != "":
+			if id != want.ID || msg.ID != want.ID {
+				t.Errorf("expected the message %q (%s), got %q (%s)", want.Content, want.ID, msg.Content, id)
+			}
+			return
+		}
+	}
+}
@@ -4,29 +4,15 @@ import (
 	"net/http"
 
 	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/constants"
 	"github.com/radean0909/guild-chat/api/internal/db"
-	"github.com/radean0909/guild-chat/api/models"
 )
 
 type UserHandler struct {
 	DB db.Driver
 }
 
-func (h *UserHandler) PostUser(c echo.Context) error {
-	user := &models.User{}
-
-	if err := c.Bind(user); err != nil {
-		return handleError(c, err)
-	}
-
-	user, err := h.DB.CreateUser(user)
-	if err != nil {
-		return handleError(c, err)
-	}
-
-	return c.JSON(http.StatusOK, user)
-}
-
+// GetUserByID - gets a user. Their email is only included for the user themselves
 func (h *UserHandler) GetUserByID(c echo.Context) error {
 	id := c.Param("id")
 
@@ -36,12 +22,28 @@ func (h *UserHandler) GetUserByID(c echo.Context) error {
 		return handleError(c, err)
 	}
 
+	if user.ID != callerID(c) {
+		user.Email = ""
+	}
+
 	return c.JSON(http.StatusOK, user)
 }
 
 func (h *UserHandler) DeleteUserbyID(c echo.Context) error {
 	id := c.Param("id")
 
+	// you can only delete yourself, or your bots
+	if caller := callerID(c); caller != id {
+		user, err := h.DB.GetUser(id)
+		if err != nil {
+			return handleError(c, err)
+		}
+
+		if !user.Bot || user.Owner != caller {
+			return handleError(c, constants.ErrForbidden)
+		}
+	}
+
 	err := h.DB.DeleteUser(id)
 
 	if err != nil {
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/radean0909/guild-chat/api/internal/db/mem"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func TestGetUserByIDHidesEmail(t *testing.T) {
+	driver := mem.NewDriver()
+	h := &UserHandler{DB: driver}
+
+	alice := newTestUser(t, driver, "alice")
+	bob := newTestUser(t, driver, "bob")
+
+	tests := []struct {
+		name   string
+		caller string
+		email  string
+	}{
+		{"self", alice.ID, alice.Email},
+		{"someone else", bob.ID, ""},
+	}
+
+	for _, test := range tests {
+		c, rec := newTestContext(t, testRequest{caller: test.caller, params: map[string]string{"id": alice.ID}})
+		if err := h.GetUserByID(c); err != nil {
+			t.Fatal(err)
+		}
+
+		expectStatus(t, test.name, rec, http.StatusOK)
+
+		user := &models.User{}
+		decode(t, rec, user)
+		if user.ID != alice.ID || user.Username != alice.Username || user.Email != test.email {
+			t.Errorf("%s: expected alice with email %q, got %+v", test.name, test.email, user)
+		}
+	}
+}
@@ -3,9 +3,13 @@ package handlers
 import (
 	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo"
 	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
 )
 
 func handleError(c echo.Context, err error) error {
@@ -15,6 +19,114 @@ func handleError(c echo.Context, err error) error {
 	if errors.Is(err, constants.ErrNotFound) {
 		return c.JSON(http.StatusNotFound, err)
 	}
+	if errors.Is(err, constants.ErrUnauthorized) {
+		return c.JSON(http.StatusUnauthorized, err)
+	}
+	if errors.Is(err, constants.ErrForbidden) {
+		return c.JSON(http.StatusForbidden, err)
+	}
+	if errors.Is(err, constants.ErrTooLarge) {
+		return c.JSON(http.StatusRequestEntityTooLarge, err)
+	}
+	if errors.Is(err, constants.ErrTooManyRequests) {
+		return c.JSON(http.StatusTooManyRequests, err)
+	}
 
 	return c.JSON(http.StatusInternalServerError, err)
 }
+
+// callerKey - the context key the authenticated user id is stored under
+const callerKey = "caller"
+
+// apiKeyKey - the context key the API key a request was authenticated with is stored under
+const apiKeyKey = "api_key"
+
+// botKey - the context key storing whether the authenticated user is a bot
+const botKey = "bot"
+
+// callerID - the id of the authenticated user making the request, empty on public routes
+func callerID(c echo.Context) string {
+	id, _ := c.Get(callerKey).(string)
+	return id
+}
+
+// callerAPIKey - the API key the request was authenticated with, nil for a token from Login
+func callerAPIKey(c echo.Context) *models.APIKey {
+	key, _ := c.Get(apiKeyKey).(*models.APIKey)
+	return key
+}
+
+// callerIsBot - whether the authenticated user making the request is a bot
+func callerIsBot(c echo.Context) bool {
+	bot, _ := c.Get(botKey).(bool)
+	return bot
+}
+
+// allowed - whether the request can read an area, or change it when write is set. Only API keys are limited
+func allowed(c echo.Context, area string, write bool) bool {
+	key := callerAPIKey(c)
+	return key == nil || key.Allows(area, write)
+}
+
+// dateParam - parses an optional YYYY-MM-DD query param, a 0 time if it isn't set
+func dateParam(c echo.Context, name string) (time.Time, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return time.Time{}, nil
+	}
+
+	date, err := time.Parse("2006-01-02", param)
+	if err != nil {
+		return time.Time{}, constants.ErrBadRequest
+	}
+
+	return date, nil
+}
+
+// limitParam - parses the optional limit query param, def if it isn't set
+func limitParam(c echo.Context, def int) (int, error) {
+	param := c.QueryParam("limit")
+	if param == "" {
+		return def, nil
+	}
+
+	limit, err := strconv.Atoi(param)
+	if err != nil || limit < 0 {
+		return 0, constants.ErrBadRequest
+	}
+
+	return limit, nil
+}
+
+// pageParams - parses the optional start, until, before, after and limit query params of a paged listing, def is
+// the default limit. before and after are cursors handed out as next_cursor by an earlier page
+func pageParams(c echo.Context, def int) (db.Page, error) {
+	page := db.Page{}
+
+	var err error
+	if page.From, err = dateParam(c, "start"); err != nil {
+		return page, err
+	}
+
+	if page.Until, err = dateParam(c, "until"); err != nil {
+		return page, err
+	}
+
+	if page.Limit, err = limitParam(c, def); err != nil {
+		return page, err
+	}
+
+	if before := c.QueryParam("before"); before != "" {
+		if page.Before, err = db.ParseCursor(before); err != nil {
+			return page, err
+		}
+	}
+
+	if after := c.QueryParam("after"); after != "" {
+		if page.After, err = db.ParseCursor(after); err != nil {
+			return page, err
+		}
+	}
+
+	return page, nil
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/webhooks"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// defaultDeliveryLimit - how many deliveries are listed unless the caller asks for a different limit
+const defaultDeliveryLimit = 50
+
+// WebhookHandler - webhooks and their delivery logs. A user's own webhooks are only theirs to see, a guild's
+// webhooks can be seen by any member whose role can manage webhooks
+type WebhookHandler struct {
+	DB         db.Driver
+	Dispatcher *webhooks.Dispatcher
+}
+
+// PostWebhook - registers a webhook owned by the caller, for the caller's events or, with a guild_id, a guild's.
+// Responds with the secret payloads are signed with, which is never returned again
+func (h *WebhookHandler) PostWebhook(c echo.Context) error {
+	hook := &models.Webhook{}
+
+	if err := c.Bind(hook); err != nil {
+		return handleError(c, err)
+	}
+
+	// the server posts to the URL, so it can't be used to reach the server itself or the network behind it
+	err := webhooks.CheckURL(hook.URL)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	for _, event := range hook.Events {
+		if !webhooks.ValidEvent(event) {
+			return handleError(c, constants.ErrBadRequest)
+		}
+	}
+
+	hook.Owner = callerID(c)
+	if hook.GuildID != "" {
+		if err := h.canManage(hook.GuildID, hook.Owner); err != nil {
+			return handleError(c, err)
+		}
+	}
+
+	if hook.Secret, err = webhooks.NewSecret(); err != nil {
+		return handleError(c, err)
+	}
+
+	hook, err = h.DB.CreateWebhook(hook)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, hook)
+}
+
+// ListWebhooks - lists the caller's own webhooks or, with a guild_id, the guild's, oldest first
+func (h *WebhookHandler) ListWebhooks(c echo.Context) error {
+	caller := callerID(c)
+	guildID := c.QueryParam("guild_id")
+
+	if guildID != "" {
+		if err := h.canManage(guildID, caller); err != nil {
+			return handleError(c, err)
+		}
+	}
+
+	hooks, err := h.DB.ListWebhooks(caller, guildID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	for _, hook := range hooks {
+		hook.Secret = ""
+	}
+
+	return c.JSON(http.StatusOK, hooks)
+}
+
+// GetWebhook - returns a webhook, without its secret
+func (h *WebhookHandler) GetWebhook(c echo.Context) error {
+	hook, err := h.webhook(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, hook)
+}
+
+// DeleteWebhook - deletes a webhook along with its delivery log. Deliveries still pending are dropped
+func (h *WebhookHandler) DeleteWebhook(c echo.Context) error {
+	hook, err := h.webhook(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if err := h.DB.DeleteWebhook(hook.ID); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// ListDeliveries - lists a webhook's deliveries, newest first, optionally only those with a status. The failed
+// deliveries are the webhook's dead-letter list
+func (h *WebhookHandler) ListDeliveries(c echo.Context) error {
+	hook, err := h.webhook(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	limit, err := limitParam(c, defaultDeliveryLimit)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	deliveries, err := h.DB.ListDeliveries(hook.ID, c.QueryParam("status"), limit)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// RetryDelivery - POST: takes a failed delivery off the dead-letter list and attempts it again, as though it was new
+func (h *WebhookHandler) RetryDelivery(c echo.Context) error {
+	hook, err := h.webhook(c)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	delivery, err := h.DB.GetDelivery(c.Param("delivery"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if delivery.WebhookID != hook.ID {
+		return handleError(c, constants.ErrNotFound)
+	}
+
+	delivery, err = h.Dispatcher.Retry(delivery)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// webhook - the webhook in the path, without its secret. Forbidden unless it is the caller's own, or a guild's the
+// caller can manage webhooks in
+func (h *WebhookHandler) webhook(c echo.Context) (*models.Webhook, error) {
+	hook, err := h.DB.GetWebhook(c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	caller := callerID(c)
+	if hook.GuildID != "" {
+		if err := h.canManage(hook.GuildID, caller); err != nil {
+			return nil, err
+		}
+	} else if hook.Owner != caller {
+		return nil, constants.ErrForbidden
+	}
+
+	hook.Secret = ""
+	return hook, nil
+}
+
+// canManage - forbidden unless the user's role in a guild can manage webhooks
+func (h *WebhookHandler) canManage(guildID, userID string) error {
+	access, err := memberAccess(h.DB, guildID, userID)
+	if err != nil {
+		return err
+	}
+
+	if !access.Permissions.Has(models.PermManageWebhooks) {
+		return constants.ErrForbidden
+	}
+
+	return nil
+}
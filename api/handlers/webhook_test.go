@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/radean0909/guild-chat/api/internal/db/mem"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func TestPostWebhookURLs(t *testing.T) {
+	driver := mem.NewDriver()
+	h := &WebhookHandler{DB: driver}
+	alice := newTestUser(t, driver, "alice")
+
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{"https://93.184.216.34/hook", http.StatusOK},
+		{"http://127.0.0.1:8080/hook", http.StatusBadRequest},
+		{"http://localhost/hook", http.StatusBadRequest},
+		{"http://169.254.169.254/latest/meta-data", http.StatusBadRequest},
+		{"http://192.168.1.10/hook", http.StatusBadRequest},
+		{"http://[::1]/hook", http.StatusBadRequest},
+		{"ftp://93.184.216.34/hook", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		c, rec := newTestContext(t, testRequest{method: http.MethodPost, caller: alice.ID, body: &models.Webhook{URL: tt.url}})
+		if err := h.PostWebhook(c); err != nil {
+			t.Fatal(err)
+		}
+		expectStatus(t, tt.url, rec, tt.status)
+	}
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+)
+
+// issuer - identifies tokens issued by this service
+const issuer = "guild-chat"
+
+// Issuer - issues and verifies signed tokens identifying a user
+type Issuer struct {
+	key []byte
+	ttl time.Duration
+}
+
+// NewIssuer - creates an issuer signing tokens with key (HMAC-SHA256), valid for ttl
+func NewIssuer(key []byte, ttl time.Duration) *Issuer {
+	return &Issuer{key: key, ttl: ttl}
+}
+
+// Issue - issues a token for a user, returning it along with when it expires
+func (i *Issuer) Issue(userID string) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(i.ttl)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
+		Subject:   userID,
+		Issuer:    issuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+
+	signed, err := token.SignedString(i.key)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return signed, expires, nil
+}
+
+// Parse - verifies a token and returns the user it was issued for. Any invalid, expired or
+// foreign token is unauthorized
+func (i *Issuer) Parse(token string) (string, error) {
+	claims := &jwt.StandardClaims{}
+
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		// only accept the method we sign with, so a token can't pick a weaker one (ie: "none")
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, constants.ErrUnauthorized
+		}
+		return i.key, nil
+	})
+	if err != nil || !parsed.Valid {
+		return "", constants.ErrUnauthorized
+	}
+
+	if claims.Issuer != issuer || claims.Subject == "" {
+		return "", constants.ErrUnauthorized
+	}
+
+	return claims.Subject, nil
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// APIKeyPrefix - starts every API key, so they can be told apart from tokens (and spotted if leaked)
+	APIKeyPrefix = "gck_"
+	// apiKeyShown - how much of a key is kept as its prefix, to tell keys apart without revealing them
+	apiKeyShown = len(APIKeyPrefix) + 8
+)
+
+// NewAPIKey - generates a random API key, returning it along with its prefix and the hash to store
+func NewAPIKey() (string, string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+
+	key := APIKeyPrefix + hex.EncodeToString(buf)
+	return key, key[:apiKeyShown], HashAPIKey(key), nil
+}
+
+// IsAPIKey - whether a bearer credential is an API key rather than a token
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// HashAPIKey - the hash an API key is stored under. Like reset tokens, keys are long and random, so a fast hash
+// is enough
+func HashAPIKey(key string) string {
+	return HashResetToken(key)
+}
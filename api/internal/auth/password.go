@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// MinPasswordLength - shortest password accepted
+	MinPasswordLength = 8
+	// MaxPasswordLength - longest password accepted, bcrypt ignores anything past 72 bytes
+	MaxPasswordLength = 72
+	// ResetTTL - how long a password reset token can be used for
+	ResetTTL = time.Hour
+)
+
+var (
+	// decoy - checked in place of a missing hash, so an unknown user takes as long to reject as a wrong password
+	decoy     []byte
+	decoyOnce sync.Once
+)
+
+// HashPassword - hashes a password with bcrypt, a password that is too short or too long is a bad request
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return "", constants.ErrBadRequest
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// CheckPassword - checks a password against a hash from HashPassword, a mismatch is unauthorized.
+// An empty hash, ie: the user doesn't exist or never set a password, is always unauthorized
+func CheckPassword(hash, password string) error {
+	if hash == "" {
+		decoyOnce.Do(func() {
+			decoy, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+		})
+		bcrypt.CompareHashAndPassword(decoy, []byte(password))
+		return constants.ErrUnauthorized
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return constants.ErrUnauthorized
+	}
+
+	return nil
+}
+
+// NewResetToken - generates a random password reset token, returning it along with the hash to store
+func NewResetToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	token := hex.EncodeToString(buf)
+	return token, HashResetToken(token), nil
+}
+
+// HashResetToken - the hash a reset token is stored under. Tokens are long and random, so a fast
+// hash is enough to keep them from being usable if the datastore leaks
+func HashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
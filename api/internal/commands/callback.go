@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/radean0909/guild-chat/api/internal/webhooks"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// EventCommand - the event type sent with every invocation posted to a bot
+const EventCommand = "command"
+
+// DefaultTimeout - how long a bot has to answer, unless the client says otherwise. The invoker waits for the answer,
+// so this is much shorter than a webhook's
+const DefaultTimeout = 5 * time.Second
+
+// maxReplySize - the most of a bot's answer that is read, in bytes
+const maxReplySize = 64 << 10
+
+type (
+	// Payload - the JSON body posted to a bot when one of its commands is invoked. Message says where it was invoked,
+	// the recipient, group or channel, and the thread if it was sent as a reply
+	Payload struct {
+		Type    string             `json:"type"`
+		Date    time.Time          `json:"date"`
+		Command string             `json:"command"`
+		Args    []string           `json:"args"`
+		Text    string             `json:"text"`
+		User    *models.PublicUser `json:"user"`
+		Message *models.Message    `json:"message"`
+	}
+
+	// Reply - what a bot answers an invocation with. Content is posted to the conversation from the bot, or when
+	// Ephemeral is set only shown to whoever invoked it. A bot with nothing to say can answer with no content
+	Reply struct {
+		Content   string `json:"content"`
+		Ephemeral bool   `json:"ephemeral"`
+	}
+
+	// Client - posts invocations to bots, signed the same way as webhook deliveries
+	Client struct {
+		HTTP *http.Client // defaults to webhooks.NewClient with a DefaultTimeout, which refuses private addresses
+	}
+)
+
+// Invoke - posts an invocation of a bot's command to its URL, and reads back the bot's reply. Anything but a 2xx is
+// an error, and so is a reply that isn't JSON. An empty body is an empty reply
+func (c *Client) Invoke(cmd *models.Command, payload *Payload) (*Reply, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, cmd.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhooks.HeaderEvent, EventCommand)
+	req.Header.Set(webhooks.HeaderDelivery, uuid.New().String())
+	req.Header.Set(webhooks.HeaderTimestamp, timestamp)
+	req.Header.Set(webhooks.HeaderSignature, webhooks.Sign(cmd.Secret, timestamp, body))
+
+	res, err := c.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxReplySize))
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	reply := &Reply{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return reply, nil
+	}
+
+	if err := json.Unmarshal(data, reply); err != nil {
+		return nil, fmt.Errorf("reading reply: %w", err)
+	}
+
+	return reply, nil
+}
+
+// client - the HTTP client to post with
+func (c *Client) client() *http.Client {
+	if c == nil || c.HTTP == nil {
+		return defaultClient
+	}
+	return c.HTTP
+}
+
+var defaultClient = webhooks.NewClient(DefaultTimeout)
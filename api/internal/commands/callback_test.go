@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/webhooks"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// newBot - a bot receiving invocations, which checks they are signed with secret and answers with status and body
+func newBot(t *testing.T, secret string, status int, body string) (*httptest.Server, *[]byte) {
+	received := &[]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		*received = data
+
+		if r.Header.Get(webhooks.HeaderEvent) != EventCommand || r.Header.Get(webhooks.HeaderDelivery) == "" {
+			t.Errorf("expected command and delivery headers, got %v", r.Header)
+		}
+		if !webhooks.Verify(secret, r.Header.Get(webhooks.HeaderTimestamp), r.Header.Get(webhooks.HeaderSignature), data, time.Minute) {
+			t.Error("expected the invocation to be signed with the command's secret")
+		}
+
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	return srv, received
+}
+
+func newPayload() *Payload {
+	user := &models.User{ID: "alice-id", Username: "alice", Email: "alice@example.com"}
+	return &Payload{
+		Type:    EventCommand,
+		Date:    time.Now(),
+		Command: "roll",
+		Args:    []string{"2", "twenty sided"},
+		Text:    "2 \"twenty sided\"",
+		User:    user.Public(),
+		Message: &models.Message{Sender: user.ID, Recipient: "bot-id", Content: "/roll 2 \"twenty sided\""},
+	}
+}
+
+func TestInvoke(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		reply  *Reply
+	}{
+		{"reply", http.StatusOK, `{"content":"rolled 23"}`, &Reply{Content: "rolled 23"}},
+		{"ephemeral", http.StatusOK, `{"content":"only you rolled 23","ephemeral":true}`, &Reply{Content: "only you rolled 23", Ephemeral: true}},
+		{"empty", http.StatusNoContent, "", &Reply{}},
+		{"error status", http.StatusInternalServerError, `{"content":"oops"}`, nil},
+		{"not json", http.StatusOK, "rolled 23", nil},
+	}
+
+	for _, tt := range tests {
+		srv, received := newBot(t, "secret", tt.status, tt.body)
+		client := &Client{HTTP: srv.Client()}
+
+		reply, err := client.Invoke(&models.Command{Name: "roll", URL: srv.URL, Secret: "secret"}, newPayload())
+		srv.Close()
+
+		if tt.reply == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if *reply != *tt.reply {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.reply, reply)
+		}
+
+		payload := &Payload{}
+		if err := json.Unmarshal(*received, payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload.Command != "roll" || len(payload.Args) != 2 || payload.Args[1] != "twenty sided" || payload.User.Username != "alice" {
+			t.Errorf("%s: unexpected payload %s", tt.name, *received)
+		}
+		if strings.Contains(string(*received), "alice@example.com") {
+			t.Errorf("%s: expected the invoker's email to be left out, got %s", tt.name, *received)
+		}
+	}
+}
+
+func TestInvokeRefusesPrivateAddresses(t *testing.T) {
+	srv, received := newBot(t, "secret", http.StatusOK, `{"content":"hi"}`)
+	defer srv.Close()
+
+	if _, err := (&Client{}).Invoke(&models.Command{Name: "roll", URL: srv.URL, Secret: "secret"}, newPayload()); err == nil {
+		t.Error("expected the default client to refuse a bot on loopback")
+	}
+	if len(*received) != 0 {
+		t.Error("expected the invocation never to reach the bot")
+	}
+}
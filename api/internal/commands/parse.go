@@ -0,0 +1,128 @@
+// Package commands parses slash commands out of messages, and posts the ones bots registered to the bots. Which
+// commands there are, and who can run them where, is up to the handlers
+package commands
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+)
+
+// Prefix - what a message starts with to invoke a command. A message starting with two is sent as it is, less one
+const Prefix = "/"
+
+// maxNameLength - the longest a command name can be
+const maxNameLength = 32
+
+// Invocation - a slash command as it was typed, ie: /roll@dicebot 2 "twenty sided"
+type Invocation struct {
+	Name string   // lower case, without the slash
+	Bot  string   // the username of the bot the command was addressed to, if it was
+	Args []string // split on spaces, quotes keep words together and backslashes escape quotes
+	Text string   // everything after the name, trimmed
+}
+
+// Parse - parses a message as a slash command, nil if it isn't one. Messages that don't start with a slash and a
+// valid name, ie: a path, are ordinary messages. Unterminated quotes are a bad request
+func Parse(content string) (*Invocation, error) {
+	if !strings.HasPrefix(content, Prefix) || strings.HasPrefix(content, Prefix+Prefix) {
+		return nil, nil
+	}
+
+	rest := content[len(Prefix):]
+	word := rest
+	if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+		word = rest[:i]
+	}
+
+	inv := &Invocation{Name: word}
+	if i := strings.Index(word, "@"); i >= 0 {
+		inv.Name, inv.Bot = word[:i], word[i+1:]
+		if inv.Bot == "" {
+			return nil, nil
+		}
+	}
+
+	inv.Name = strings.ToLower(inv.Name)
+	if !ValidName(inv.Name) {
+		return nil, nil
+	}
+
+	inv.Text = strings.TrimSpace(rest[len(word):])
+
+	args, err := split(inv.Text)
+	if err != nil {
+		return nil, err
+	}
+	inv.Args = args
+
+	return inv, nil
+}
+
+// Unescape - takes the extra slash off a message starting with two, so it can be sent as an ordinary message
+func Unescape(content string) string {
+	if strings.HasPrefix(content, Prefix+Prefix) {
+		return content[len(Prefix):]
+	}
+	return content
+}
+
+// ValidName - whether a command can be called name: up to 32 lower case letters, digits, dashes and underscores,
+// starting with a letter or digit
+func ValidName(name string) bool {
+	if name == "" || len(name) > maxNameLength {
+		return false
+	}
+
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case (r == '-' || r == '_') && i > 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// split - splits arguments on spaces. Double quotes keep words together, and inside them a backslash escapes the
+// next character
+func split(text string) ([]string, error) {
+	args := []string{}
+	var arg strings.Builder
+	inArg, quoted, escaped := false, false, false
+
+	for _, r := range text {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+			inArg = true
+		case !quoted && unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quoted || escaped {
+		return nil, constants.ErrBadRequest
+	}
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
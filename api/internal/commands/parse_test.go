@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		content string
+		inv     *Invocation
+		err     bool
+	}{
+		{content: "hello", inv: nil},
+		{content: "", inv: nil},
+		{content: "//help", inv: nil},
+		{content: "/usr/bin is a path", inv: nil},
+		{content: "/", inv: nil},
+		{content: "/@bot", inv: nil},
+		{content: "/roll@", inv: nil},
+		{content: "/help", inv: &Invocation{Name: "help", Args: []string{}}},
+		{content: "/HELP Me", inv: &Invocation{Name: "help", Args: []string{"Me"}, Text: "Me"}},
+		{content: "/me  waves  hello ", inv: &Invocation{Name: "me", Args: []string{"waves", "hello"}, Text: "waves  hello"}},
+		{content: "/roll@dicebot 2 \"twenty sided\"", inv: &Invocation{Name: "roll", Bot: "dicebot", Args: []string{"2", "twenty sided"}, Text: "2 \"twenty sided\""}},
+		{content: "/mute\tbob 5m", inv: &Invocation{Name: "mute", Args: []string{"bob", "5m"}, Text: "bob 5m"}},
+		{content: "/say \"unterminated", err: true},
+	}
+
+	for _, tt := range tests {
+		inv, err := Parse(tt.content)
+		if (err != nil) != tt.err {
+			t.Errorf("%q: expected an error to be %v, got %v", tt.content, tt.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(inv, tt.inv) {
+			t.Errorf("%q: expected %+v, got %+v", tt.content, tt.inv, inv)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		text string
+		args []string
+		err  bool
+	}{
+		{text: "", args: []string{}},
+		{text: "   ", args: []string{}},
+		{text: "one two  three", args: []string{"one", "two", "three"}},
+		{text: "\"two words\" three", args: []string{"two words", "three"}},
+		{text: "in\"side quo\"tes", args: []string{"inside quotes"}},
+		{text: "\"\" empty", args: []string{"", "empty"}},
+		{text: "\"say \\\"hi\\\"\"", args: []string{"say \"hi\""}},
+		{text: "\"back\\\\slash\"", args: []string{"back\\slash"}},
+		{text: "not\\escaped", args: []string{"not\\escaped"}},
+		{text: "\"open", err: true},
+		{text: "\"trailing\\", err: true},
+	}
+
+	for _, tt := range tests {
+		args, err := split(tt.text)
+		if (err != nil) != tt.err {
+			t.Errorf("%q: expected an error to be %v, got %v", tt.text, tt.err, err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%q: expected %q, got %q", tt.text, tt.args, args)
+		}
+	}
+}
+
+func TestValidName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"roll", true},
+		{"d20", true},
+		{"2fa", true},
+		{"set-topic", true},
+		{"set_topic", true},
+		{"-roll", false},
+		{"_roll", false},
+		{"Roll", false},
+		{"ro ll", false},
+		{"röll", false},
+		{"", false},
+		{"abcdefghijklmnopqrstuvwxyz123456", true},
+		{"abcdefghijklmnopqrstuvwxyz1234567", false},
+	}
+
+	for _, tt := range tests {
+		if valid := ValidName(tt.name); valid != tt.valid {
+			t.Errorf("%q: expected valid to be %v", tt.name, tt.valid)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := map[string]string{
+		"//help": "/help",
+		"///":    "//",
+		"/help":  "/help",
+		"hello":  "hello",
+		"a//b":   "a//b",
+		"":       "",
+	}
+
+	for content, expected := range tests {
+		if unescaped := Unescape(content); unescaped != expected {
+			t.Errorf("%q: expected %q, got %q", content, expected, unescaped)
+		}
+	}
+}
@@ -9,4 +9,12 @@ var (
 	ErrNotFound = errors.New("not found")
 	// ErrBadRequest - standard bad request error - typically due to bad data - 400
 	ErrBadRequest = errors.New("bad request")
+	// ErrUnauthorized - missing or invalid credentials - 401
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden - authenticated, but not allowed to do this - 403
+	ErrForbidden = errors.New("forbidden")
+	// ErrTooLarge - more data than is allowed, ie: an oversized upload - 413
+	ErrTooLarge = errors.New("too large")
+	// ErrTooManyRequests - the caller has used up their rate limit, and should retry later - 429
+	ErrTooManyRequests = errors.New("too many requests")
 )
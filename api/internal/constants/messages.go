@@ -0,0 +1,4 @@
+package constants
+
+// DeletedMessage - replaces the content of a message that has been deleted for everyone
+const DeletedMessage = "message deleted"
@@ -0,0 +1,4 @@
+package constants
+
+// DeletedUser - replaces the id of a soft deleted user wherever they appear as a sender
+const DeletedUser = "deleted"
@@ -8,12 +8,73 @@ import (
 
 type Driver interface {
 	GetMessage(id string) (*models.Message, error)
+	GetMessages(viewer string, ids []string) ([]*models.Message, error)
+	ScanMessages(after string, limit int) ([]*models.Message, error)
 	CreateMessage(msg *models.Message) (*models.Message, error)
-	ListMessages(recipient string, from, until time.Time, limit int) ([]*models.Message, error)
+	ListMessages(recipient string, from, until time.Time, limit int, order Order) ([]*models.Message, error)
+	PageMessages(recipient string, page Page) (*models.MessagePage, error)
+	EditMessage(id, editor, content string) (*models.Message, error)
+	ListRevisions(messageID string) ([]*models.Revision, error)
+	DeleteMessage(id string) (*models.Message, error)
+	HideMessage(id, userID string) error
+	ListReplies(parentID string, from, until time.Time, limit int) ([]*models.Message, error)
+	AddReaction(messageID, userID, emoji string) (*models.Message, error)
+	RemoveReaction(messageID, userID, emoji string) (*models.Message, error)
+	AddAttachment(uploader string, att *models.Attachment) (*models.Attachment, error)
+	GetAttachment(messageID, id string) (*models.Attachment, error)
+	MarkRead(userID, messageID string) (*models.Receipt, error)
+	ListReceipts(messageID string) ([]*models.Receipt, error)
 	GetConversation(sender, recipient string, from, until time.Time) (*models.Conversation, error)
+	PageConversation(sender, recipient string, page Page) (*models.MessagePage, error)
 	CreateConversation(sender, recipient string) (*models.Conversation, error)
 	ListConversations(recipient string, from, until time.Time) ([]*models.Conversation, error)
 	GetUser(id string) (*models.User, error)
 	CreateUser(user *models.User) (*models.User, error)
 	DeleteUser(id string) error
+	CreateAccount(user *models.User, passwordHash string) (*models.User, error)
+	GetUserByUsername(username string) (*models.User, error)
+	ListBots(owner string) ([]*models.User, error)
+	SetPassword(userID, hash string) error
+	GetPassword(userID string) (string, error)
+	CreatePasswordReset(userID, tokenHash string, expires time.Time) error
+	ConsumePasswordReset(tokenHash string) (string, error)
+	CreateAPIKey(key *models.APIKey, keyHash string) (*models.APIKey, error)
+	GetAPIKey(id string) (*models.APIKey, error)
+	GetAPIKeyByHash(keyHash string) (*models.APIKey, error)
+	ListAPIKeys(userID string) ([]*models.APIKey, error)
+	RevokeAPIKey(id string) error
+	TouchAPIKey(id string, used time.Time) error
+	CreateCommand(cmd *models.Command) (*models.Command, error)
+	ListCommands(botID string) ([]*models.Command, error)
+	FindCommands(name string) ([]*models.Command, error)
+	DeleteCommand(botID, name string) error
+	CreateGroup(owner, name string, participants []string) (*models.Conversation, error)
+	GetGroup(id string) (*models.Conversation, error)
+	ListGroups(userID string, from, until time.Time) ([]*models.Conversation, error)
+	AddParticipant(groupID, userID string) error
+	RemoveParticipant(groupID, userID string) error
+	ListGroupMessages(groupID string, from, until time.Time, limit int) ([]*models.Message, error)
+	CreateGuild(owner, name string) (*models.Guild, error)
+	GetGuild(id string) (*models.Guild, error)
+	ListGuilds(userID string, from, until time.Time) ([]*models.Guild, error)
+	JoinGuild(guildID, userID string) (*models.Member, error)
+	LeaveGuild(guildID, userID string) error
+	GetMember(guildID, userID string) (*models.Member, error)
+	ListMembers(guildID string) ([]*models.Member, error)
+	CreateChannel(guildID, name string) (*models.Channel, error)
+	GetChannel(id string) (*models.Channel, error)
+	ListChannelMessages(channelID string, from, until time.Time, limit int) ([]*models.Message, error)
+	CreateRole(guildID, name string, perms models.Permission) (*models.Role, error)
+	GetRole(guildID, name string) (*models.Role, error)
+	ListRoles(guildID string) ([]*models.Role, error)
+	SetRole(guildID, userID, role string) (*models.Member, error)
+	MuteMember(guildID, userID string, until time.Time) (*models.Member, error)
+	CreateWebhook(hook *models.Webhook) (*models.Webhook, error)
+	GetWebhook(id string) (*models.Webhook, error)
+	ListWebhooks(owner, guildID string) ([]*models.Webhook, error)
+	DeleteWebhook(id string) error
+	CreateDelivery(delivery *models.Delivery) (*models.Delivery, error)
+	GetDelivery(id string) (*models.Delivery, error)
+	UpdateDelivery(delivery *models.Delivery) (*models.Delivery, error)
+	ListDeliveries(webhookID, status string, limit int) ([]*models.Delivery, error)
 }
@@ -0,0 +1,132 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testAttachments(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	recipient := newUser(t, d, "recipient")
+
+	msg := newMessage(t, d, sender.ID, recipient.ID, "see attached")
+
+	file := func(name string) *models.Attachment {
+		return &models.Attachment{
+			ID:        uuid.New().String(),
+			MessageID: msg.ID,
+			Name:      name,
+			Size:      5,
+			MIMEType:  "text/plain; charset=utf-8",
+			Checksum:  "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		}
+	}
+
+	_, err := d.AddAttachment("", file("hello.txt"))
+	expectErr(t, "AddAttachment(empty uploader)", err, constants.ErrBadRequest)
+
+	_, err = d.AddAttachment(sender.ID, &models.Attachment{MessageID: msg.ID, Name: "hello.txt"})
+	expectErr(t, "AddAttachment(empty id)", err, constants.ErrBadRequest)
+
+	_, err = d.AddAttachment(sender.ID, file(""))
+	expectErr(t, "AddAttachment(empty name)", err, constants.ErrBadRequest)
+
+	unknown := file("hello.txt")
+	unknown.MessageID = unknownID
+	_, err = d.AddAttachment(sender.ID, unknown)
+	expectErr(t, "AddAttachment(unknown message)", err, constants.ErrNotFound)
+
+	// only the sender can attach files
+	_, err = d.AddAttachment(recipient.ID, file("hello.txt"))
+	expectErr(t, "AddAttachment(recipient)", err, constants.ErrForbidden)
+
+	first, err := d.AddAttachment(sender.ID, file("hello.txt"))
+	expectOK(t, "AddAttachment", err)
+	if first.Date == nil || first.Name != "hello.txt" || first.Size != 5 || first.MessageID != msg.ID {
+		t.Errorf("AddAttachment: expected the attachment to be dated, got %+v", first)
+	}
+
+	_, err = d.AddAttachment(sender.ID, first)
+	expectErr(t, "AddAttachment(again)", err, constants.ErrBadRequest)
+
+	second, err := d.AddAttachment(sender.ID, file("world.txt"))
+	expectOK(t, "AddAttachment(second)", err)
+
+	_, err = d.GetAttachment("", first.ID)
+	expectErr(t, "GetAttachment(empty message)", err, constants.ErrBadRequest)
+
+	_, err = d.GetAttachment(msg.ID, unknownID)
+	expectErr(t, "GetAttachment(unknown)", err, constants.ErrNotFound)
+
+	other := newMessage(t, d, sender.ID, recipient.ID, "nothing attached")
+	_, err = d.GetAttachment(other.ID, first.ID)
+	expectErr(t, "GetAttachment(other message)", err, constants.ErrNotFound)
+
+	got, err := d.GetAttachment(msg.ID, first.ID)
+	expectOK(t, "GetAttachment", err)
+	if got.ID != first.ID || got.Name != first.Name || got.Size != first.Size || got.MIMEType != first.MIMEType ||
+		got.Checksum != first.Checksum || !got.Date.Equal(*first.Date) {
+		t.Errorf("GetAttachment: expected %+v, got %+v", first, got)
+	}
+
+	// messages list their attachments in the order they were attached
+	want := []string{first.ID, second.ID}
+	fetched, err := d.GetMessage(msg.ID)
+	expectOK(t, "GetMessage", err)
+	expectAttachments(t, "GetMessage", fetched, want)
+
+	msgs, err := d.ListMessages(recipient.ID, time.Time{}, time.Time{}, 0, db.OldestFirst)
+	expectOK(t, "ListMessages", err)
+	if len(msgs) != 2 {
+		t.Fatalf("ListMessages: expected 2 messages, got %+v", msgs)
+	}
+	for _, listed := range msgs {
+		if listed.ID == msg.ID {
+			expectAttachments(t, "ListMessages", listed, want)
+		} else {
+			expectAttachments(t, "ListMessages", listed, nil)
+		}
+	}
+
+	edited, err := d.EditMessage(msg.ID, sender.ID, "see attached!")
+	expectOK(t, "EditMessage", err)
+	expectAttachments(t, "EditMessage", edited, want)
+
+	// deleting a message drops its attachments, and no more can be attached
+	deleted, err := d.DeleteMessage(msg.ID)
+	expectOK(t, "DeleteMessage", err)
+	expectAttachments(t, "DeleteMessage", deleted, nil)
+
+	_, err = d.GetAttachment(msg.ID, first.ID)
+	expectErr(t, "GetAttachment(deleted message)", err, constants.ErrNotFound)
+
+	_, err = d.AddAttachment(sender.ID, file("again.txt"))
+	expectErr(t, "AddAttachment(deleted message)", err, constants.ErrBadRequest)
+}
+
+// expectAttachments - fails unless a message has exactly the attachments wanted, by id, in order
+func expectAttachments(t *testing.T, call string, msg *models.Message, want []string) {
+	t.Helper()
+
+	got := make([]string, len(msg.Attachments))
+	for i, att := range msg.Attachments {
+		got[i] = att.ID
+	}
+
+	if len(got) != len(want) {
+		t.Errorf("%s: expected attachments %v, got %v", call, want, got)
+		return
+	}
+
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s: expected attachments %v, got %v", call, want, got)
+			return
+		}
+	}
+}
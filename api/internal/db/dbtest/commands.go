@@ -0,0 +1,105 @@
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testCommands(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "quinn")
+
+	bot, err := d.CreateUser(&models.User{Username: "quinn-bot", Bot: true, Owner: owner.ID})
+	expectOK(t, "CreateUser(bot)", err)
+
+	other, err := d.CreateUser(&models.User{Username: "quinn-other-bot", Bot: true, Owner: owner.ID})
+	expectOK(t, "CreateUser(other bot)", err)
+
+	command := func(botID, name string) *models.Command {
+		return &models.Command{BotID: botID, Name: name, URL: "http://bot.example.com/" + name, Secret: "secret"}
+	}
+
+	_, err = d.CreateCommand(nil)
+	expectErr(t, "CreateCommand(nil)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateCommand(&models.Command{BotID: bot.ID, Name: "roll", Secret: "secret"})
+	expectErr(t, "CreateCommand(no url)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateCommand(&models.Command{BotID: bot.ID, Name: "roll", URL: "http://bot.example.com"})
+	expectErr(t, "CreateCommand(no secret)", err, constants.ErrBadRequest)
+
+	bad := command(bot.ID, "roll")
+	bad.Permissions = models.PermAll + 1
+	_, err = d.CreateCommand(bad)
+	expectErr(t, "CreateCommand(bad permissions)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateCommand(command(unknownID, "roll"))
+	expectErr(t, "CreateCommand(unknown bot)", err, constants.ErrNotFound)
+
+	_, err = d.CreateCommand(command(owner.ID, "roll"))
+	expectErr(t, "CreateCommand(not a bot)", err, constants.ErrBadRequest)
+
+	roll := command(bot.ID, "roll")
+	roll.Description = "rolls a die"
+	roll.Usage = "[sides]"
+	roll.Permissions = models.PermSend
+	created, err := d.CreateCommand(roll)
+	expectOK(t, "CreateCommand", err)
+	if created.ID == "" || created.Created == nil || created.Secret != "secret" || created.Permissions != models.PermSend ||
+		created.Usage != "[sides]" || created.Description != "rolls a die" {
+		t.Errorf("CreateCommand: unexpected command %+v", created)
+	}
+
+	_, err = d.CreateCommand(command(bot.ID, "roll"))
+	expectErr(t, "CreateCommand(duplicate)", err, constants.ErrBadRequest)
+
+	// other bots can use the same name
+	otherRoll, err := d.CreateCommand(command(other.ID, "roll"))
+	expectOK(t, "CreateCommand(other bot)", err)
+
+	_, err = d.CreateCommand(command(bot.ID, "flip"))
+	expectOK(t, "CreateCommand(second)", err)
+
+	_, err = d.ListCommands("")
+	expectErr(t, "ListCommands(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.ListCommands(unknownID)
+	expectErr(t, "ListCommands(unknown)", err, constants.ErrNotFound)
+
+	cmds, err := d.ListCommands(bot.ID)
+	expectOK(t, "ListCommands", err)
+	if len(cmds) != 2 || cmds[0].Name != "flip" || cmds[1].Name != "roll" || cmds[1].Secret != "secret" {
+		t.Errorf("ListCommands: expected [flip roll], got %+v", cmds)
+	}
+
+	_, err = d.FindCommands("")
+	expectErr(t, "FindCommands(empty)", err, constants.ErrBadRequest)
+
+	cmds, err = d.FindCommands("roll")
+	expectOK(t, "FindCommands", err)
+	if len(cmds) != 2 || cmds[0].ID != created.ID || cmds[1].ID != otherRoll.ID {
+		t.Errorf("FindCommands: expected [%s %s], got %+v", created.ID, otherRoll.ID, cmds)
+	}
+
+	cmds, err = d.FindCommands("unknown")
+	expectOK(t, "FindCommands(unknown)", err)
+	if len(cmds) != 0 {
+		t.Errorf("FindCommands(unknown): expected none, got %+v", cmds)
+	}
+
+	expectErr(t, "DeleteCommand(empty)", d.DeleteCommand(bot.ID, ""), constants.ErrBadRequest)
+	expectErr(t, "DeleteCommand(unknown)", d.DeleteCommand(bot.ID, "unknown"), constants.ErrNotFound)
+	expectOK(t, "DeleteCommand", d.DeleteCommand(bot.ID, "flip"))
+	expectErr(t, "DeleteCommand(again)", d.DeleteCommand(bot.ID, "flip"), constants.ErrNotFound)
+
+	// deleted bots' commands can't be found
+	expectOK(t, "DeleteUser(other bot)", d.DeleteUser(other.ID))
+
+	cmds, err = d.FindCommands("roll")
+	expectOK(t, "FindCommands(deleted bot)", err)
+	if len(cmds) != 1 || cmds[0].ID != created.ID {
+		t.Errorf("FindCommands(deleted bot): expected [%s], got %+v", created.ID, cmds)
+	}
+}
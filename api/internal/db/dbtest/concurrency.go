@@ -0,0 +1,93 @@
+package dbtest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// writers - how many goroutines hammer the driver at once
+const writers = 20
+
+func testConcurrentMessages(t *testing.T, d db.Driver) {
+	alice := newUser(t, d, "alice")
+	bob := newUser(t, d, "bob")
+
+	// both sides racing to send the first message must still end up in a single conversation
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		sender, recipient := alice.ID, bob.ID
+		if i%2 == 1 {
+			sender, recipient = recipient, sender
+		}
+
+		wg.Add(1)
+		go func(i int, sender, recipient string) {
+			defer wg.Done()
+			_, err := d.CreateMessage(&models.Message{Sender: sender, Recipient: recipient, Content: fmt.Sprint("message ", i)})
+			errs <- err
+		}(i, sender, recipient)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		expectOK(t, "CreateMessage", err)
+	}
+
+	convos, err := d.ListConversations(alice.ID, time.Time{}, time.Time{})
+	expectOK(t, "ListConversations", err)
+
+	if len(convos) != 1 {
+		t.Fatalf("ListConversations: expected a single conversation, got %d", len(convos))
+	}
+
+	if len(convos[0].Messages) != writers {
+		t.Errorf("ListConversations: expected %d messages, got %d", writers, len(convos[0].Messages))
+	}
+
+	seen := map[string]bool{}
+	for _, msg := range convos[0].Messages {
+		if seen[msg.ID] {
+			t.Errorf("ListConversations: message %s appears twice", msg.ID)
+		}
+		seen[msg.ID] = true
+	}
+}
+
+func testConcurrentUsers(t *testing.T, d db.Driver) {
+	// exactly one of many racing signups for the same username wins
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := d.CreateUser(&models.User{Username: "popular", Email: fmt.Sprintf("user%d@example.com", i)})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, constants.ErrBadRequest):
+			t.Errorf("CreateUser: expected success or bad request, got %v", err)
+		}
+	}
+
+	if created != 1 {
+		t.Errorf("CreateUser: expected exactly one user to be created, got %d", created)
+	}
+}
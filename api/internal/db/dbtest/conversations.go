@@ -0,0 +1,224 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+)
+
+func testCreateConversation(t *testing.T, d db.Driver) {
+	alice := newUser(t, d, "alice")
+	bob := newUser(t, d, "bob")
+
+	_, err := d.CreateConversation("", bob.ID)
+	expectErr(t, "CreateConversation(no sender)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateConversation(alice.ID, "")
+	expectErr(t, "CreateConversation(no recipient)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateConversation(unknownID, bob.ID)
+	expectErr(t, "CreateConversation(unknown sender)", err, constants.ErrNotFound)
+
+	_, err = d.CreateConversation(alice.ID, unknownID)
+	expectErr(t, "CreateConversation(unknown recipient)", err, constants.ErrNotFound)
+
+	convo, err := d.CreateConversation(alice.ID, bob.ID)
+	expectOK(t, "CreateConversation", err)
+
+	if convo.ID == "" || convo.Sender != alice.ID || convo.Recipient != bob.ID || convo.Updated == nil {
+		t.Errorf("CreateConversation: unexpected conversation %+v", convo)
+	}
+
+	if len(convo.Messages) != 0 {
+		t.Errorf("CreateConversation: expected no messages, got %v", ids(convo.Messages))
+	}
+
+	// a conversation already exists, no matter which way we are looking at it
+	_, err = d.CreateConversation(alice.ID, bob.ID)
+	expectErr(t, "CreateConversation(duplicate)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateConversation(bob.ID, alice.ID)
+	expectErr(t, "CreateConversation(reversed duplicate)", err, constants.ErrBadRequest)
+
+	// messages are added to the existing conversation
+	msg := newMessage(t, d, bob.ID, alice.ID, "hello")
+	got, err := d.GetConversation(alice.ID, bob.ID, time.Time{}, time.Time{})
+	expectOK(t, "GetConversation", err)
+
+	if got.ID != convo.ID || len(got.Messages) != 1 || got.Messages[0].ID != msg.ID {
+		t.Errorf("GetConversation: expected conversation %s with message %s, got %s with %v", convo.ID, msg.ID, got.ID, ids(got.Messages))
+	}
+}
+
+func testGetConversation(t *testing.T, d db.Driver) {
+	alice := newUser(t, d, "alice")
+	bob := newUser(t, d, "bob")
+	carol := newUser(t, d, "carol")
+
+	_, err := d.GetConversation("", bob.ID, time.Time{}, time.Time{})
+	expectErr(t, "GetConversation(no sender)", err, constants.ErrBadRequest)
+
+	_, err = d.GetConversation(alice.ID, "", time.Time{}, time.Time{})
+	expectErr(t, "GetConversation(no recipient)", err, constants.ErrBadRequest)
+
+	now := time.Now()
+	_, err = d.GetConversation(alice.ID, bob.ID, now, now.Add(-time.Hour))
+	expectErr(t, "GetConversation(from after until)", err, constants.ErrBadRequest)
+
+	_, err = d.GetConversation(unknownID, bob.ID, time.Time{}, time.Time{})
+	expectErr(t, "GetConversation(unknown sender)", err, constants.ErrNotFound)
+
+	_, err = d.GetConversation(alice.ID, bob.ID, time.Time{}, time.Time{})
+	expectErr(t, "GetConversation(no conversation)", err, constants.ErrNotFound)
+
+	first := newMessage(t, d, alice.ID, bob.ID, "one")
+	second := newMessage(t, d, bob.ID, alice.ID, "two")
+	newMessage(t, d, carol.ID, bob.ID, "somebody else")
+
+	a, err := d.GetConversation(alice.ID, bob.ID, time.Time{}, time.Time{})
+	expectOK(t, "GetConversation", err)
+
+	b, err := d.GetConversation(bob.ID, alice.ID, time.Time{}, time.Time{})
+	expectOK(t, "GetConversation(reversed)", err)
+
+	if a.ID != b.ID {
+		t.Errorf("GetConversation: expected the same conversation both ways, got %s and %s", a.ID, b.ID)
+	}
+
+	// both directions, nobody else's, oldest first
+	want := []string{first.ID, second.ID}
+	if got := ids(a.Messages); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("GetConversation: expected messages %v, got %v", want, got)
+	}
+
+	// the window applies to when the conversation was last updated
+	_, err = d.GetConversation(alice.ID, bob.ID, time.Now().Add(time.Hour), time.Now().Add(2*time.Hour))
+	expectErr(t, "GetConversation(future)", err, constants.ErrNotFound)
+
+	_, err = d.GetConversation(alice.ID, bob.ID, time.Time{}, first.Date.Add(-time.Hour))
+	expectErr(t, "GetConversation(past)", err, constants.ErrNotFound)
+
+	_, err = d.GetConversation(alice.ID, bob.ID, first.Date.Add(-time.Hour), time.Time{})
+	expectOK(t, "GetConversation(open until)", err)
+}
+
+func testListConversations(t *testing.T, d db.Driver) {
+	alice := newUser(t, d, "alice")
+	bob := newUser(t, d, "bob")
+	carol := newUser(t, d, "carol")
+	dave := newUser(t, d, "dave")
+
+	_, err := d.ListConversations("", time.Time{}, time.Time{})
+	expectErr(t, "ListConversations(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.ListConversations(unknownID, time.Time{}, time.Time{})
+	expectErr(t, "ListConversations(unknown)", err, constants.ErrNotFound)
+
+	now := time.Now()
+	_, err = d.ListConversations(bob.ID, now, now.Add(-time.Hour))
+	expectErr(t, "ListConversations(from after until)", err, constants.ErrBadRequest)
+
+	// no conversations yet is not an error
+	convos, err := d.ListConversations(bob.ID, time.Time{}, time.Time{})
+	expectOK(t, "ListConversations", err)
+
+	if len(convos) != 0 {
+		t.Errorf("ListConversations: expected no conversations, got %d", len(convos))
+	}
+
+	// bob is in a conversation he started, and one started with him, but not carol and dave's
+	fromAlice := newMessage(t, d, alice.ID, bob.ID, "hi bob")
+	toCarol := newMessage(t, d, bob.ID, carol.ID, "hi carol")
+	newMessage(t, d, carol.ID, dave.ID, "hi dave")
+
+	convos, err = d.ListConversations(bob.ID, time.Time{}, time.Time{})
+	expectOK(t, "ListConversations", err)
+
+	if len(convos) != 2 {
+		t.Fatalf("ListConversations: expected 2 conversations, got %d", len(convos))
+	}
+
+	found := map[string]bool{}
+	for _, convo := range convos {
+		for _, msg := range convo.Messages {
+			found[msg.ID] = true
+		}
+	}
+
+	if len(found) != 2 || !found[fromAlice.ID] || !found[toCarol.ID] {
+		t.Errorf("ListConversations: expected messages %s and %s, got %v", fromAlice.ID, toCarol.ID, found)
+	}
+
+	// the window applies to when each conversation was last updated
+	convos, err = d.ListConversations(bob.ID, time.Now().Add(time.Hour), time.Now().Add(2*time.Hour))
+	expectOK(t, "ListConversations(future)", err)
+
+	if len(convos) != 0 {
+		t.Errorf("ListConversations(future): expected no conversations, got %d", len(convos))
+	}
+}
+
+func testDeletedSenderRedaction(t *testing.T, d db.Driver) {
+	alice := newUser(t, d, "alice")
+	bob := newUser(t, d, "bob")
+
+	fromAlice := newMessage(t, d, alice.ID, bob.ID, "bye")
+	fromBob := newMessage(t, d, bob.ID, alice.ID, "see you")
+
+	expectOK(t, "DeleteUser", d.DeleteUser(alice.ID))
+
+	// reads keep working for the remaining participant, with the deleted sender hidden
+	convo, err := d.GetConversation(bob.ID, alice.ID, time.Time{}, time.Time{})
+	expectOK(t, "GetConversation", err)
+
+	for _, msg := range convo.Messages {
+		switch msg.ID {
+		case fromAlice.ID:
+			if msg.Sender != constants.DeletedUser {
+				t.Errorf("GetConversation: expected deleted sender to be redacted, got %s", msg.Sender)
+			}
+		case fromBob.ID:
+			if msg.Sender != bob.ID {
+				t.Errorf("GetConversation: expected sender %s to be untouched, got %s", bob.ID, msg.Sender)
+			}
+		}
+	}
+
+	convos, err := d.ListConversations(bob.ID, time.Time{}, time.Time{})
+	expectOK(t, "ListConversations", err)
+
+	if len(convos) != 1 || convos[0].Sender != constants.DeletedUser {
+		t.Errorf("ListConversations: expected the conversation started by a deleted user to be redacted, got %+v", convos)
+	}
+
+	msgs, err := d.ListMessages(bob.ID, time.Time{}, time.Time{}, 0, db.OldestFirst)
+	expectOK(t, "ListMessages", err)
+
+	if len(msgs) != 1 || msgs[0].Sender != constants.DeletedUser {
+		t.Errorf("ListMessages: expected deleted sender to be redacted, got %+v", msgs)
+	}
+
+	msg, err := d.GetMessage(fromAlice.ID)
+	expectOK(t, "GetMessage", err)
+
+	if msg.Sender != constants.DeletedUser {
+		t.Errorf("GetMessage: expected deleted sender to be redacted, got %s", msg.Sender)
+	}
+
+	// the conversation is still known, from the stored pair rather than the redacted one
+	if msg.ConversationID == "" || msg.ConversationID != fromAlice.ConversationID || msg.ConversationID != fromBob.ConversationID {
+		t.Errorf("GetMessage: expected conversation %s, got %s", fromAlice.ConversationID, msg.ConversationID)
+	}
+
+	// redaction is only ever on the way out, reading twice still redacts and the recipient is intact
+	convo, err = d.GetConversation(alice.ID, bob.ID, time.Time{}, time.Time{})
+	expectOK(t, "GetConversation", err)
+
+	for _, msg := range convo.Messages {
+		if msg.ID == fromAlice.ID && (msg.Sender != constants.DeletedUser || msg.Recipient != bob.ID) {
+			t.Errorf("GetConversation: expected redacted sender and intact recipient, got %+v", msg)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testGetUserByUsername(t *testing.T, d db.Driver) {
+	_, err := d.GetUserByUsername("")
+	expectErr(t, "GetUserByUsername(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.GetUserByUsername("nobody")
+	expectErr(t, "GetUserByUsername(unknown)", err, constants.ErrNotFound)
+
+	created := newUser(t, d, "carol")
+
+	user, err := d.GetUserByUsername(created.Username)
+	expectOK(t, "GetUserByUsername", err)
+
+	if user.ID != created.ID || user.Email != created.Email {
+		t.Errorf("GetUserByUsername: expected %+v, got %+v", created, user)
+	}
+
+	// deleted users can't be looked up, so they can't log in
+	expectOK(t, "DeleteUser", d.DeleteUser(created.ID))
+
+	_, err = d.GetUserByUsername(created.Username)
+	expectErr(t, "GetUserByUsername(deleted)", err, constants.ErrNotFound)
+}
+
+func testPasswords(t *testing.T, d db.Driver) {
+	user := newUser(t, d, "dave")
+
+	expectErr(t, "SetPassword(no user)", d.SetPassword("", "hash"), constants.ErrBadRequest)
+	expectErr(t, "SetPassword(no hash)", d.SetPassword(user.ID, ""), constants.ErrBadRequest)
+	expectErr(t, "SetPassword(unknown)", d.SetPassword(unknownID, "hash"), constants.ErrNotFound)
+
+	_, err := d.GetPassword("")
+	expectErr(t, "GetPassword(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.GetPassword(user.ID)
+	expectErr(t, "GetPassword(never set)", err, constants.ErrNotFound)
+
+	expectOK(t, "SetPassword", d.SetPassword(user.ID, "first"))
+
+	hash, err := d.GetPassword(user.ID)
+	expectOK(t, "GetPassword", err)
+	if hash != "first" {
+		t.Errorf("GetPassword: expected first, got %s", hash)
+	}
+
+	// setting again replaces the old hash
+	expectOK(t, "SetPassword(again)", d.SetPassword(user.ID, "second"))
+
+	hash, err = d.GetPassword(user.ID)
+	expectOK(t, "GetPassword(again)", err)
+	if hash != "second" {
+		t.Errorf("GetPassword: expected second, got %s", hash)
+	}
+
+	expectOK(t, "DeleteUser", d.DeleteUser(user.ID))
+
+	_, err = d.GetPassword(user.ID)
+	expectErr(t, "GetPassword(deleted)", err, constants.ErrNotFound)
+
+	expectErr(t, "SetPassword(deleted)", d.SetPassword(user.ID, "third"), constants.ErrNotFound)
+}
+
+func testCreateAccount(t *testing.T, d db.Driver) {
+	_, err := d.CreateAccount(nil, "hash")
+	expectErr(t, "CreateAccount(nil)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateAccount(&models.User{Username: "frank", Email: "frank@example.com"}, "")
+	expectErr(t, "CreateAccount(no hash)", err, constants.ErrBadRequest)
+
+	user, err := d.CreateAccount(&models.User{Username: "frank", Email: "frank@example.com"}, "hash")
+	expectOK(t, "CreateAccount", err)
+
+	if user.ID == "" {
+		t.Errorf("CreateAccount: expected an id, got %+v", user)
+	}
+
+	// the password is set along with the user
+	hash, err := d.GetPassword(user.ID)
+	expectOK(t, "GetPassword", err)
+	if hash != "hash" {
+		t.Errorf("GetPassword: expected hash, got %s", hash)
+	}
+
+	// a duplicate username is refused, and leaves nothing behind
+	_, err = d.CreateAccount(&models.User{Username: "frank", Email: "other@example.com"}, "other")
+	expectErr(t, "CreateAccount(duplicate)", err, constants.ErrBadRequest)
+
+	found, err := d.GetUserByUsername("frank")
+	expectOK(t, "GetUserByUsername", err)
+	if found.ID != user.ID || found.Email != user.Email {
+		t.Errorf("GetUserByUsername: expected %+v, got %+v", user, found)
+	}
+}
+
+func testPasswordResets(t *testing.T, d db.Driver) {
+	user := newUser(t, d, "erin")
+	expires := time.Now().Add(time.Hour)
+
+	expectErr(t, "CreatePasswordReset(no user)", d.CreatePasswordReset("", "token", expires), constants.ErrBadRequest)
+	expectErr(t, "CreatePasswordReset(no token)", d.CreatePasswordReset(user.ID, "", expires), constants.ErrBadRequest)
+	expectErr(t, "CreatePasswordReset(unknown)", d.CreatePasswordReset(unknownID, "token", expires), constants.ErrNotFound)
+
+	_, err := d.ConsumePasswordReset("")
+	expectErr(t, "ConsumePasswordReset(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.ConsumePasswordReset("unknown")
+	expectErr(t, "ConsumePasswordReset(unknown)", err, constants.ErrNotFound)
+
+	expectOK(t, "CreatePasswordReset", d.CreatePasswordReset(user.ID, "token", expires))
+	expectErr(t, "CreatePasswordReset(duplicate)", d.CreatePasswordReset(user.ID, "token", expires), constants.ErrBadRequest)
+
+	userID, err := d.ConsumePasswordReset("token")
+	expectOK(t, "ConsumePasswordReset", err)
+	if userID != user.ID {
+		t.Errorf("ConsumePasswordReset: expected %s, got %s", user.ID, userID)
+	}
+
+	// a reset can only be used once
+	_, err = d.ConsumePasswordReset("token")
+	expectErr(t, "ConsumePasswordReset(used)", err, constants.ErrNotFound)
+
+	// expired resets can't be used, and are gone afterwards
+	expectOK(t, "CreatePasswordReset(expired)", d.CreatePasswordReset(user.ID, "expired", time.Now().Add(-time.Minute)))
+
+	_, err = d.ConsumePasswordReset("expired")
+	expectErr(t, "ConsumePasswordReset(expired)", err, constants.ErrNotFound)
+
+	// nor can resets for a user deleted in the meantime
+	expectOK(t, "CreatePasswordReset(deleted)", d.CreatePasswordReset(user.ID, "deleted", expires))
+	expectOK(t, "DeleteUser", d.DeleteUser(user.ID))
+
+	_, err = d.ConsumePasswordReset("deleted")
+	expectErr(t, "ConsumePasswordReset(deleted)", err, constants.ErrNotFound)
+}
@@ -0,0 +1,153 @@
+// Package dbtest is a conformance suite for db.Driver implementations. Every driver should pass it, so
+// handlers can rely on the same behaviour no matter which datastore is configured. From a driver's tests:
+//
+//	func TestDriver(t *testing.T) {
+//		dbtest.RunDriverSuite(t, func(t *testing.T) (db.Driver, func()) {
+//			return mem.NewDriver(), func() {}
+//		})
+//	}
+package dbtest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// Factory - returns a new, empty driver for a single test, and a func to tear it down afterwards
+type Factory func(t *testing.T) (db.Driver, func())
+
+// RunDriverSuite - runs every conformance test against drivers built by newDriver. Each test gets its own driver
+func RunDriverSuite(t *testing.T, newDriver Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, d db.Driver)
+	}{
+		{"CreateUser", testCreateUser},
+		{"GetUser", testGetUser},
+		{"DeleteUser", testDeleteUser},
+		{"GetUserByUsername", testGetUserByUsername},
+		{"Passwords", testPasswords},
+		{"CreateAccount", testCreateAccount},
+		{"PasswordResets", testPasswordResets},
+		{"Bots", testBots},
+		{"APIKeys", testAPIKeys},
+		{"Commands", testCommands},
+		{"CreateMessage", testCreateMessage},
+		{"GetMessage", testGetMessage},
+		{"GetMessages", testGetMessages},
+		{"ScanMessages", testScanMessages},
+		{"ListMessages", testListMessages},
+		{"ListMessageOrder", testListMessageOrder},
+		{"EditMessage", testEditMessage},
+		{"ListRevisions", testListRevisions},
+		{"DeleteMessage", testDeleteMessage},
+		{"HideMessage", testHideMessage},
+		{"Replies", testReplies},
+		{"ThreadPlacement", testThreadPlacement},
+		{"Reactions", testReactions},
+		{"ReactionListings", testReactionListings},
+		{"Attachments", testAttachments},
+		{"Receipts", testReceipts},
+		{"UnreadCounts", testUnreadCounts},
+		{"Webhooks", testWebhooks},
+		{"Deliveries", testDeliveries},
+		{"PageConversation", testPageConversation},
+		{"PageMessages", testPageMessages},
+		{"CreateConversation", testCreateConversation},
+		{"GetConversation", testGetConversation},
+		{"ListConversations", testListConversations},
+		{"DeletedSenderRedaction", testDeletedSenderRedaction},
+		{"CreateGroup", testCreateGroup},
+		{"GroupParticipants", testGroupParticipants},
+		{"GroupMessages", testGroupMessages},
+		{"ListGroups", testListGroups},
+		{"CreateGuild", testCreateGuild},
+		{"GuildMembers", testGuildMembers},
+		{"Channels", testChannels},
+		{"ChannelMessages", testChannelMessages},
+		{"ListGuilds", testListGuilds},
+		{"Roles", testRoles},
+		{"SetRole", testSetRole},
+		{"MuteMember", testMuteMember},
+		{"ConcurrentMessages", testConcurrentMessages},
+		{"ConcurrentUsers", testConcurrentUsers},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			d, teardown := newDriver(t)
+			defer teardown()
+			tt.test(t, d)
+		})
+	}
+}
+
+// unknownID - an id that no driver will have generated
+const unknownID = "00000000-0000-0000-0000-000000000000"
+
+// newUser - creates a user with a unique username, failing the test on error
+func newUser(t *testing.T, d db.Driver, name string) *models.User {
+	t.Helper()
+
+	user, err := d.CreateUser(&models.User{Username: fmt.Sprintf("%s-%d", name, time.Now().UnixNano()), Email: name + "@example.com"})
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %v", name, err)
+	}
+
+	return user
+}
+
+// newMessage - sends a message between two users, failing the test on error
+func newMessage(t *testing.T, d db.Driver, sender, recipient, content string) *models.Message {
+	t.Helper()
+
+	msg, err := d.CreateMessage(&models.Message{Sender: sender, Recipient: recipient, Content: content})
+	if err != nil {
+		t.Fatalf("CreateMessage(%s -> %s): %v", sender, recipient, err)
+	}
+
+	return msg
+}
+
+// expectErr - fails the test unless err is, or wraps, want
+func expectErr(t *testing.T, call string, err, want error) {
+	t.Helper()
+
+	if !errors.Is(err, want) {
+		t.Errorf("%s: expected error %v, got %v", call, want, err)
+	}
+}
+
+// expectOK - fails the test immediately on an unexpected error
+func expectOK(t *testing.T, call string, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("%s: unexpected error %v", call, err)
+	}
+}
+
+// ids - the ids of a list of messages, in order
+func ids(msgs []*models.Message) []string {
+	out := make([]string, len(msgs))
+	for i, msg := range msgs {
+		out[i] = msg.ID
+	}
+	return out
+}
+
+// contains - whether a list of messages includes the given id
+func contains(msgs []*models.Message, id string) bool {
+	for _, msg := range msgs {
+		if msg.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testDeleteMessage(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	recipient := newUser(t, d, "recipient")
+
+	msg := newMessage(t, d, sender.ID, recipient.ID, "helo")
+	if msg.DeletedAt != nil {
+		t.Errorf("CreateMessage: expected a new message not to be deleted, got %v", msg.DeletedAt)
+	}
+
+	_, err := d.EditMessage(msg.ID, sender.ID, "hello")
+	expectOK(t, "EditMessage", err)
+
+	_, err = d.DeleteMessage("")
+	expectErr(t, "DeleteMessage(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.DeleteMessage(unknownID)
+	expectErr(t, "DeleteMessage(unknown)", err, constants.ErrNotFound)
+
+	deleted, err := d.DeleteMessage(msg.ID)
+	expectOK(t, "DeleteMessage", err)
+	if deleted.ID != msg.ID || deleted.Content != constants.DeletedMessage || deleted.DeletedAt == nil ||
+		deleted.Sender != sender.ID || !deleted.Date.Equal(*msg.Date) {
+		t.Errorf("DeleteMessage: expected a tombstone in place of %+v, got %+v", msg, deleted)
+	}
+
+	// deleting again changes nothing
+	again, err := d.DeleteMessage(msg.ID)
+	expectOK(t, "DeleteMessage(again)", err)
+	if again.DeletedAt == nil || !again.DeletedAt.Equal(*deleted.DeletedAt) {
+		t.Errorf("DeleteMessage(again): expected deleted_at %v, got %v", deleted.DeletedAt, again.DeletedAt)
+	}
+
+	// the tombstone keeps its place wherever the message is listed
+	got, err := d.GetMessage(msg.ID)
+	expectOK(t, "GetMessage", err)
+	if got.Content != constants.DeletedMessage || got.DeletedAt == nil {
+		t.Errorf("GetMessage: expected the tombstone, got %+v", got)
+	}
+
+	msgs, err := d.ListMessages(recipient.ID, time.Time{}, time.Time{}, 0, db.OldestFirst)
+	expectOK(t, "ListMessages", err)
+	if len(msgs) != 1 || msgs[0].Content != constants.DeletedMessage {
+		t.Errorf("ListMessages: expected the tombstone, got %+v", msgs)
+	}
+
+	convo, err := d.GetConversation(sender.ID, recipient.ID, time.Time{}, time.Time{})
+	expectOK(t, "GetConversation", err)
+	if len(convo.Messages) != 1 || convo.Messages[0].Content != constants.DeletedMessage {
+		t.Errorf("GetConversation: expected the tombstone, got %+v", convo.Messages)
+	}
+
+	// nothing is left of what it used to say, and it can't be edited back
+	revisions, err := d.ListRevisions(msg.ID)
+	expectOK(t, "ListRevisions", err)
+	if len(revisions) != 0 {
+		t.Errorf("ListRevisions: expected revisions to be dropped, got %+v", revisions)
+	}
+
+	_, err = d.EditMessage(msg.ID, sender.ID, "hello again")
+	expectErr(t, "EditMessage(deleted)", err, constants.ErrBadRequest)
+
+	// group and channel messages can be deleted too
+	group, err := d.CreateGroup(sender.ID, "group", []string{recipient.ID})
+	expectOK(t, "CreateGroup", err)
+
+	groupMsg, err := d.CreateMessage(&models.Message{Sender: sender.ID, GroupID: group.ID, Content: "helo"})
+	expectOK(t, "CreateMessage(group)", err)
+
+	_, err = d.DeleteMessage(groupMsg.ID)
+	expectOK(t, "DeleteMessage(group)", err)
+
+	msgs, err = d.ListGroupMessages(group.ID, time.Time{}, time.Time{}, 0)
+	expectOK(t, "ListGroupMessages", err)
+	if len(msgs) != 1 || msgs[0].Content != constants.DeletedMessage || msgs[0].DeletedAt == nil {
+		t.Errorf("ListGroupMessages: expected the tombstone, got %+v", msgs)
+	}
+
+	guild, err := d.CreateGuild(sender.ID, "guild")
+	expectOK(t, "CreateGuild", err)
+
+	channelMsg, err := d.CreateMessage(&models.Message{Sender: sender.ID, ChannelID: guild.Channels[0].ID, Content: "helo"})
+	expectOK(t, "CreateMessage(channel)", err)
+
+	_, err = d.DeleteMessage(channelMsg.ID)
+	expectOK(t, "DeleteMessage(channel)", err)
+
+	msgs, err = d.ListChannelMessages(guild.Channels[0].ID, time.Time{}, time.Time{}, 0)
+	expectOK(t, "ListChannelMessages", err)
+	if len(msgs) != 1 || msgs[0].Content != constants.DeletedMessage || msgs[0].DeletedAt == nil {
+		t.Errorf("ListChannelMessages: expected the tombstone, got %+v", msgs)
+	}
+}
+
+func testHideMessage(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	recipient := newUser(t, d, "recipient")
+
+	hidden := newMessage(t, d, sender.ID, recipient.ID, "hidden")
+	shown := newMessage(t, d, sender.ID, recipient.ID, "shown")
+
+	expectErr(t, "HideMessage(no id)", d.HideMessage("", recipient.ID), constants.ErrBadRequest)
+	expectErr(t, "HideMessage(no user)", d.HideMessage(hidden.ID, ""), constants.ErrBadRequest)
+	expectErr(t, "HideMessage(unknown message)", d.HideMessage(unknownID, recipient.ID), constants.ErrNotFound)
+	expectErr(t, "HideMessage(unknown user)", d.HideMessage(hidden.ID, unknownID), constants.ErrNotFound)
+
+	expectOK(t, "HideMessage", d.HideMessage(hidden.ID, recipient.ID))
+	expectOK(t, "HideMessage(again)", d.HideMessage(hidden.ID, recipient.ID))
+
+	// hidden from the recipient's listings
+	msgs, err := d.ListMessages(recipient.ID, time.Time{}, time.Time{}, 0, db.OldestFirst)
+	expectOK(t, "ListMessages", err)
+	if len(msgs) != 1 || msgs[0].ID != shown.ID {
+		t.Errorf("ListMessages: expected only %s, got %v", shown.ID, ids(msgs))
+	}
+
+	// the limit counts what is left, not what was hidden
+	msgs, err = d.ListMessages(recipient.ID, time.Time{}, time.Time{}, 1, db.OldestFirst)
+	expectOK(t, "ListMessages(limit)", err)
+	if len(msgs) != 1 || msgs[0].ID != shown.ID {
+		t.Errorf("ListMessages(limit): expected only %s, got %v", shown.ID, ids(msgs))
+	}
+
+	convos, err := d.ListConversations(recipient.ID, time.Time{}, time.Time{})
+	expectOK(t, "ListConversations", err)
+	if len(convos) != 1 || contains(convos[0].Messages, hidden.ID) || !contains(convos[0].Messages, shown.ID) {
+		t.Errorf("ListConversations: expected %s to be hidden, got %+v", hidden.ID, convos)
+	}
+
+	// but nobody else's
+	convos, err = d.ListConversations(sender.ID, time.Time{}, time.Time{})
+	expectOK(t, "ListConversations(sender)", err)
+	if len(convos) != 1 || !contains(convos[0].Messages, hidden.ID) {
+		t.Errorf("ListConversations(sender): expected %s to be listed, got %+v", hidden.ID, convos)
+	}
+
+	// and the message itself is untouched
+	got, err := d.GetMessage(hidden.ID)
+	expectOK(t, "GetMessage", err)
+	if got.Content != "hidden" || got.DeletedAt != nil {
+		t.Errorf("GetMessage: expected the message to be untouched, got %+v", got)
+	}
+
+	// deleted users can't hide anything
+	expectOK(t, "DeleteUser", d.DeleteUser(recipient.ID))
+	expectErr(t, "HideMessage(deleted user)", d.HideMessage(shown.ID, recipient.ID), constants.ErrNotFound)
+}
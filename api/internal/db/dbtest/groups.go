@@ -0,0 +1,266 @@
+package dbtest
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testCreateGroup(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "owner")
+	member := newUser(t, d, "member")
+
+	_, err := d.CreateGroup("", "group", []string{member.ID})
+	expectErr(t, "CreateGroup(no owner)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateGroup(owner.ID, "group", []string{""})
+	expectErr(t, "CreateGroup(empty participant)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateGroup(owner.ID, "group", []string{unknownID})
+	expectErr(t, "CreateGroup(unknown participant)", err, constants.ErrNotFound)
+
+	// the owner is always a participant, and duplicates are ignored
+	group, err := d.CreateGroup(owner.ID, "group", []string{member.ID, member.ID, owner.ID})
+	expectOK(t, "CreateGroup", err)
+
+	if group.ID == "" || group.Name != "group" || group.Owner != owner.ID || group.Updated == nil {
+		t.Errorf("CreateGroup: unexpected group %+v", group)
+	}
+	expectParticipants(t, "CreateGroup", group, owner.ID, member.ID)
+
+	_, err = d.GetGroup("")
+	expectErr(t, "GetGroup(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.GetGroup(unknownID)
+	expectErr(t, "GetGroup(unknown)", err, constants.ErrNotFound)
+
+	got, err := d.GetGroup(group.ID)
+	expectOK(t, "GetGroup", err)
+
+	if got.ID != group.ID || got.Name != group.Name || got.Owner != owner.ID {
+		t.Errorf("GetGroup: expected %+v, got %+v", group, got)
+	}
+	expectParticipants(t, "GetGroup", got, owner.ID, member.ID)
+
+	// a group of one is allowed, ie: to add people later
+	_, err = d.CreateGroup(owner.ID, "", nil)
+	expectOK(t, "CreateGroup(alone)", err)
+}
+
+func testGroupParticipants(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "owner")
+	member := newUser(t, d, "member")
+	joiner := newUser(t, d, "joiner")
+
+	group, err := d.CreateGroup(owner.ID, "group", []string{member.ID})
+	expectOK(t, "CreateGroup", err)
+
+	expectErr(t, "AddParticipant(no group)", d.AddParticipant("", joiner.ID), constants.ErrBadRequest)
+	expectErr(t, "AddParticipant(no user)", d.AddParticipant(group.ID, ""), constants.ErrBadRequest)
+	expectErr(t, "AddParticipant(unknown group)", d.AddParticipant(unknownID, joiner.ID), constants.ErrNotFound)
+	expectErr(t, "AddParticipant(unknown user)", d.AddParticipant(group.ID, unknownID), constants.ErrNotFound)
+	expectErr(t, "AddParticipant(already in)", d.AddParticipant(group.ID, member.ID), constants.ErrBadRequest)
+
+	expectOK(t, "AddParticipant", d.AddParticipant(group.ID, joiner.ID))
+
+	got, err := d.GetGroup(group.ID)
+	expectOK(t, "GetGroup", err)
+	expectParticipants(t, "GetGroup(added)", got, owner.ID, member.ID, joiner.ID)
+
+	expectErr(t, "RemoveParticipant(no group)", d.RemoveParticipant("", member.ID), constants.ErrBadRequest)
+	expectErr(t, "RemoveParticipant(unknown group)", d.RemoveParticipant(unknownID, member.ID), constants.ErrNotFound)
+	expectErr(t, "RemoveParticipant(not in)", d.RemoveParticipant(group.ID, unknownID), constants.ErrNotFound)
+
+	expectOK(t, "RemoveParticipant", d.RemoveParticipant(group.ID, member.ID))
+	expectErr(t, "RemoveParticipant(again)", d.RemoveParticipant(group.ID, member.ID), constants.ErrNotFound)
+
+	got, err = d.GetGroup(group.ID)
+	expectOK(t, "GetGroup", err)
+	expectParticipants(t, "GetGroup(removed)", got, owner.ID, joiner.ID)
+
+	// removed participants can rejoin
+	expectOK(t, "AddParticipant(rejoin)", d.AddParticipant(group.ID, member.ID))
+
+	// deleted users drop out of the participants, and can't be added
+	expectOK(t, "DeleteUser", d.DeleteUser(joiner.ID))
+
+	got, err = d.GetGroup(group.ID)
+	expectOK(t, "GetGroup", err)
+	expectParticipants(t, "GetGroup(deleted)", got, owner.ID, member.ID)
+
+	other, err := d.CreateGroup(owner.ID, "other", nil)
+	expectOK(t, "CreateGroup(other)", err)
+	expectErr(t, "AddParticipant(deleted user)", d.AddParticipant(other.ID, joiner.ID), constants.ErrNotFound)
+
+	// a deleted owner is redacted
+	expectOK(t, "DeleteUser", d.DeleteUser(owner.ID))
+
+	got, err = d.GetGroup(group.ID)
+	expectOK(t, "GetGroup", err)
+	if got.Owner != constants.DeletedUser {
+		t.Errorf("GetGroup: expected a deleted owner to be redacted, got %s", got.Owner)
+	}
+}
+
+func testGroupMessages(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "owner")
+	member := newUser(t, d, "member")
+	outsider := newUser(t, d, "outsider")
+
+	group, err := d.CreateGroup(owner.ID, "group", []string{member.ID})
+	expectOK(t, "CreateGroup", err)
+
+	_, err = d.CreateMessage(&models.Message{Sender: owner.ID, GroupID: unknownID, Content: "hi"})
+	expectErr(t, "CreateMessage(unknown group)", err, constants.ErrNotFound)
+
+	_, err = d.CreateMessage(&models.Message{Sender: outsider.ID, GroupID: group.ID, Content: "hi"})
+	expectErr(t, "CreateMessage(outsider)", err, constants.ErrForbidden)
+
+	_, err = d.CreateMessage(&models.Message{Sender: owner.ID, GroupID: group.ID})
+	expectErr(t, "CreateMessage(no content)", err, constants.ErrBadRequest)
+
+	// a message goes to either a recipient or a group, not both
+	_, err = d.CreateMessage(&models.Message{Sender: owner.ID, Recipient: member.ID, GroupID: group.ID, Content: "hi"})
+	expectErr(t, "CreateMessage(recipient and group)", err, constants.ErrBadRequest)
+
+	sent := []*models.Message{}
+	for i, sender := range []string{owner.ID, member.ID, owner.ID} {
+		msg, err := d.CreateMessage(&models.Message{Sender: sender, GroupID: group.ID, Content: strings.Repeat("x", i+1)})
+		expectOK(t, "CreateMessage(group)", err)
+
+		if msg.ID == "" || msg.Date == nil || msg.GroupID != group.ID || msg.Recipient != "" {
+			t.Errorf("CreateMessage(group): unexpected message %+v", msg)
+		}
+		sent = append(sent, msg)
+		time.Sleep(time.Millisecond)
+	}
+
+	got, err := d.GetMessage(sent[0].ID)
+	expectOK(t, "GetMessage(group)", err)
+	if got.GroupID != group.ID || got.Recipient != "" {
+		t.Errorf("GetMessage(group): unexpected message %+v", got)
+	}
+
+	_, err = d.ListGroupMessages("", time.Time{}, time.Time{}, 0)
+	expectErr(t, "ListGroupMessages(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.ListGroupMessages(unknownID, time.Time{}, time.Time{}, 0)
+	expectErr(t, "ListGroupMessages(unknown)", err, constants.ErrNotFound)
+
+	msgs, err := d.ListGroupMessages(group.ID, time.Time{}, time.Time{}, 0)
+	expectOK(t, "ListGroupMessages", err)
+	if got, want := strings.Join(ids(msgs), ","), strings.Join(ids(sent), ","); got != want {
+		t.Errorf("ListGroupMessages: expected %s, got %s", want, got)
+	}
+
+	// the limit keeps the most recent messages
+	msgs, err = d.ListGroupMessages(group.ID, time.Time{}, time.Time{}, 2)
+	expectOK(t, "ListGroupMessages(limit)", err)
+	if got, want := strings.Join(ids(msgs), ","), strings.Join(ids(sent[1:]), ","); got != want {
+		t.Errorf("ListGroupMessages(limit): expected %s, got %s", want, got)
+	}
+
+	msgs, err = d.ListGroupMessages(group.ID, *sent[1].Date, time.Time{}, 0)
+	expectOK(t, "ListGroupMessages(from)", err)
+	if contains(msgs, sent[0].ID) || !contains(msgs, sent[1].ID) || !contains(msgs, sent[2].ID) {
+		t.Errorf("ListGroupMessages(from): unexpected messages %v", ids(msgs))
+	}
+
+	// group messages aren't sent to anyone in particular
+	direct, err := d.ListMessages(member.ID, time.Time{}, time.Time{}, 0, db.OldestFirst)
+	expectOK(t, "ListMessages", err)
+	if len(direct) != 0 {
+		t.Errorf("ListMessages: expected no direct messages, got %v", ids(direct))
+	}
+
+	// removed participants can no longer send
+	expectOK(t, "RemoveParticipant", d.RemoveParticipant(group.ID, member.ID))
+	_, err = d.CreateMessage(&models.Message{Sender: member.ID, GroupID: group.ID, Content: "hi"})
+	expectErr(t, "CreateMessage(removed)", err, constants.ErrForbidden)
+
+	// existing 1:1 conversations are unaffected
+	msg := newMessage(t, d, owner.ID, member.ID, "direct")
+	if msg.GroupID != "" {
+		t.Errorf("CreateMessage: expected no group, got %s", msg.GroupID)
+	}
+
+	_, err = d.GetConversation(owner.ID, member.ID, time.Time{}, time.Time{})
+	expectOK(t, "GetConversation", err)
+}
+
+func testListGroups(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "owner")
+	member := newUser(t, d, "member")
+
+	_, err := d.ListGroups("", time.Time{}, time.Time{})
+	expectErr(t, "ListGroups(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.ListGroups(unknownID, time.Time{}, time.Time{})
+	expectErr(t, "ListGroups(unknown)", err, constants.ErrNotFound)
+
+	groups, err := d.ListGroups(member.ID, time.Time{}, time.Time{})
+	expectOK(t, "ListGroups(none)", err)
+	if len(groups) != 0 {
+		t.Errorf("ListGroups: expected no groups, got %d", len(groups))
+	}
+
+	first, err := d.CreateGroup(owner.ID, "first", []string{member.ID})
+	expectOK(t, "CreateGroup(first)", err)
+	time.Sleep(time.Millisecond)
+
+	second, err := d.CreateGroup(owner.ID, "second", []string{member.ID})
+	expectOK(t, "CreateGroup(second)", err)
+	time.Sleep(time.Millisecond)
+
+	_, err = d.CreateGroup(owner.ID, "without member", nil)
+	expectOK(t, "CreateGroup(without member)", err)
+	time.Sleep(time.Millisecond)
+
+	// a new message moves the first group to the top
+	_, err = d.CreateMessage(&models.Message{Sender: owner.ID, GroupID: first.ID, Content: "bump"})
+	expectOK(t, "CreateMessage(group)", err)
+
+	groups, err = d.ListGroups(member.ID, time.Time{}, time.Time{})
+	expectOK(t, "ListGroups", err)
+	if len(groups) != 2 || groups[0].ID != first.ID || groups[1].ID != second.ID {
+		t.Fatalf("ListGroups: expected [%s %s], got %d groups", first.ID, second.ID, len(groups))
+	}
+	expectParticipants(t, "ListGroups", groups[0], owner.ID, member.ID)
+
+	_, err = d.ListGroups(member.ID, time.Now().Add(time.Hour), time.Time{})
+	expectErr(t, "ListGroups(from after until)", err, constants.ErrBadRequest)
+
+	groups, err = d.ListGroups(member.ID, time.Time{}, *second.Updated)
+	expectOK(t, "ListGroups(until)", err)
+	if len(groups) != 1 || groups[0].ID != second.ID {
+		t.Errorf("ListGroups(until): expected only %s, got %d groups", second.ID, len(groups))
+	}
+
+	// groups someone has left aren't listed
+	expectOK(t, "RemoveParticipant", d.RemoveParticipant(second.ID, member.ID))
+
+	groups, err = d.ListGroups(member.ID, time.Time{}, time.Time{})
+	expectOK(t, "ListGroups(left)", err)
+	if len(groups) != 1 || groups[0].ID != first.ID {
+		t.Errorf("ListGroups(left): expected only %s, got %d groups", first.ID, len(groups))
+	}
+}
+
+// expectParticipants - fails the test unless the group has exactly the given participants, in any order
+func expectParticipants(t *testing.T, call string, group *models.Conversation, want ...string) {
+	t.Helper()
+
+	got := append([]string{}, group.Participants...)
+	want = append([]string{}, want...)
+	sort.Strings(got)
+	sort.Strings(want)
+
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("%s: expected participants %v, got %v", call, want, got)
+	}
+}
@@ -0,0 +1,390 @@
+package dbtest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testCreateGuild(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "owner")
+
+	_, err := d.CreateGuild("", "guild")
+	expectErr(t, "CreateGuild(no owner)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateGuild(owner.ID, "")
+	expectErr(t, "CreateGuild(no name)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateGuild(unknownID, "guild")
+	expectErr(t, "CreateGuild(unknown owner)", err, constants.ErrNotFound)
+
+	guild, err := d.CreateGuild(owner.ID, "guild")
+	expectOK(t, "CreateGuild", err)
+
+	if guild.ID == "" || guild.Name != "guild" || guild.Owner != owner.ID || guild.Created == nil || guild.Updated == nil {
+		t.Errorf("CreateGuild: unexpected guild %+v", guild)
+	}
+
+	// every guild starts with the default channel
+	if len(guild.Channels) != 1 || guild.Channels[0].Name != models.DefaultChannel || guild.Channels[0].GuildID != guild.ID {
+		t.Errorf("CreateGuild: expected only the %s channel, got %+v", models.DefaultChannel, guild.Channels)
+	}
+
+	_, err = d.GetGuild("")
+	expectErr(t, "GetGuild(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.GetGuild(unknownID)
+	expectErr(t, "GetGuild(unknown)", err, constants.ErrNotFound)
+
+	got, err := d.GetGuild(guild.ID)
+	expectOK(t, "GetGuild", err)
+
+	if got.ID != guild.ID || got.Name != guild.Name || got.Owner != owner.ID || len(got.Channels) != 1 {
+		t.Errorf("GetGuild: expected %+v, got %+v", guild, got)
+	}
+
+	// the owner is the first member
+	member, err := d.GetMember(guild.ID, owner.ID)
+	expectOK(t, "GetMember(owner)", err)
+	if member.Role != models.RoleOwner || member.Joined == nil {
+		t.Errorf("GetMember(owner): unexpected member %+v", member)
+	}
+
+	// a deleted owner is redacted
+	expectOK(t, "DeleteUser", d.DeleteUser(owner.ID))
+
+	got, err = d.GetGuild(guild.ID)
+	expectOK(t, "GetGuild", err)
+	if got.Owner != constants.DeletedUser {
+		t.Errorf("GetGuild: expected a deleted owner to be redacted, got %s", got.Owner)
+	}
+
+	_, err = d.CreateGuild(owner.ID, "guild")
+	expectErr(t, "CreateGuild(deleted owner)", err, constants.ErrNotFound)
+}
+
+func testGuildMembers(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "owner")
+	member := newUser(t, d, "member")
+	joiner := newUser(t, d, "joiner")
+
+	guild, err := d.CreateGuild(owner.ID, "guild")
+	expectOK(t, "CreateGuild", err)
+
+	_, err = d.JoinGuild("", member.ID)
+	expectErr(t, "JoinGuild(no guild)", err, constants.ErrBadRequest)
+
+	_, err = d.JoinGuild(guild.ID, "")
+	expectErr(t, "JoinGuild(no user)", err, constants.ErrBadRequest)
+
+	_, err = d.JoinGuild(unknownID, member.ID)
+	expectErr(t, "JoinGuild(unknown guild)", err, constants.ErrNotFound)
+
+	_, err = d.JoinGuild(guild.ID, unknownID)
+	expectErr(t, "JoinGuild(unknown user)", err, constants.ErrNotFound)
+
+	joined, err := d.JoinGuild(guild.ID, member.ID)
+	expectOK(t, "JoinGuild", err)
+	if joined.GuildID != guild.ID || joined.UserID != member.ID || joined.Role != models.RoleMember || joined.Joined == nil {
+		t.Errorf("JoinGuild: unexpected member %+v", joined)
+	}
+
+	_, err = d.JoinGuild(guild.ID, member.ID)
+	expectErr(t, "JoinGuild(already in)", err, constants.ErrBadRequest)
+
+	time.Sleep(time.Millisecond)
+	_, err = d.JoinGuild(guild.ID, joiner.ID)
+	expectOK(t, "JoinGuild(joiner)", err)
+
+	_, err = d.GetMember(guild.ID, "")
+	expectErr(t, "GetMember(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.GetMember(guild.ID, unknownID)
+	expectErr(t, "GetMember(not in)", err, constants.ErrNotFound)
+
+	_, err = d.ListMembers("")
+	expectErr(t, "ListMembers(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.ListMembers(unknownID)
+	expectErr(t, "ListMembers(unknown)", err, constants.ErrNotFound)
+
+	members, err := d.ListMembers(guild.ID)
+	expectOK(t, "ListMembers", err)
+	if got, want := strings.Join(memberIDs(members), ","), strings.Join([]string{owner.ID, member.ID, joiner.ID}, ","); got != want {
+		t.Errorf("ListMembers: expected %s, got %s", want, got)
+	}
+
+	expectErr(t, "LeaveGuild(no guild)", d.LeaveGuild("", member.ID), constants.ErrBadRequest)
+	expectErr(t, "LeaveGuild(unknown guild)", d.LeaveGuild(unknownID, member.ID), constants.ErrNotFound)
+	expectErr(t, "LeaveGuild(not in)", d.LeaveGuild(guild.ID, unknownID), constants.ErrNotFound)
+
+	// the owner can't leave their own guild
+	expectErr(t, "LeaveGuild(owner)", d.LeaveGuild(guild.ID, owner.ID), constants.ErrBadRequest)
+
+	expectOK(t, "LeaveGuild", d.LeaveGuild(guild.ID, member.ID))
+	expectErr(t, "LeaveGuild(again)", d.LeaveGuild(guild.ID, member.ID), constants.ErrNotFound)
+
+	_, err = d.GetMember(guild.ID, member.ID)
+	expectErr(t, "GetMember(left)", err, constants.ErrNotFound)
+
+	// members who left can rejoin
+	_, err = d.JoinGuild(guild.ID, member.ID)
+	expectOK(t, "JoinGuild(rejoin)", err)
+
+	// deleted users drop out of the members, and can't join
+	expectOK(t, "DeleteUser", d.DeleteUser(joiner.ID))
+
+	members, err = d.ListMembers(guild.ID)
+	expectOK(t, "ListMembers(deleted)", err)
+	if got, want := strings.Join(memberIDs(members), ","), strings.Join([]string{owner.ID, member.ID}, ","); got != want {
+		t.Errorf("ListMembers(deleted): expected %s, got %s", want, got)
+	}
+
+	_, err = d.GetMember(guild.ID, joiner.ID)
+	expectErr(t, "GetMember(deleted)", err, constants.ErrNotFound)
+
+	other, err := d.CreateGuild(owner.ID, "other")
+	expectOK(t, "CreateGuild(other)", err)
+
+	_, err = d.JoinGuild(other.ID, joiner.ID)
+	expectErr(t, "JoinGuild(deleted user)", err, constants.ErrNotFound)
+}
+
+func testChannels(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "owner")
+
+	guild, err := d.CreateGuild(owner.ID, "guild")
+	expectOK(t, "CreateGuild", err)
+
+	_, err = d.CreateChannel("", "random")
+	expectErr(t, "CreateChannel(no guild)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateChannel(guild.ID, "")
+	expectErr(t, "CreateChannel(no name)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateChannel(unknownID, "random")
+	expectErr(t, "CreateChannel(unknown guild)", err, constants.ErrNotFound)
+
+	_, err = d.CreateChannel(guild.ID, models.DefaultChannel)
+	expectErr(t, "CreateChannel(duplicate)", err, constants.ErrBadRequest)
+
+	channel, err := d.CreateChannel(guild.ID, "random")
+	expectOK(t, "CreateChannel", err)
+	if channel.ID == "" || channel.GuildID != guild.ID || channel.Name != "random" || channel.Updated == nil {
+		t.Errorf("CreateChannel: unexpected channel %+v", channel)
+	}
+
+	// names only need to be unique within a guild
+	other, err := d.CreateGuild(owner.ID, "other")
+	expectOK(t, "CreateGuild(other)", err)
+
+	_, err = d.CreateChannel(other.ID, "random")
+	expectOK(t, "CreateChannel(other guild)", err)
+
+	_, err = d.GetChannel("")
+	expectErr(t, "GetChannel(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.GetChannel(unknownID)
+	expectErr(t, "GetChannel(unknown)", err, constants.ErrNotFound)
+
+	got, err := d.GetChannel(channel.ID)
+	expectOK(t, "GetChannel", err)
+	if got.ID != channel.ID || got.GuildID != guild.ID || got.Name != "random" {
+		t.Errorf("GetChannel: expected %+v, got %+v", channel, got)
+	}
+
+	// channels are listed in the order they were created
+	gotGuild, err := d.GetGuild(guild.ID)
+	expectOK(t, "GetGuild", err)
+	if len(gotGuild.Channels) != 2 || gotGuild.Channels[0].Name != models.DefaultChannel || gotGuild.Channels[1].ID != channel.ID {
+		t.Errorf("GetGuild: expected [%s random], got %+v", models.DefaultChannel, gotGuild.Channels)
+	}
+}
+
+func testChannelMessages(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "owner")
+	member := newUser(t, d, "member")
+	outsider := newUser(t, d, "outsider")
+
+	guild, err := d.CreateGuild(owner.ID, "guild")
+	expectOK(t, "CreateGuild", err)
+
+	_, err = d.JoinGuild(guild.ID, member.ID)
+	expectOK(t, "JoinGuild", err)
+
+	channel := guild.Channels[0]
+
+	_, err = d.CreateMessage(&models.Message{Sender: owner.ID, ChannelID: unknownID, Content: "hi"})
+	expectErr(t, "CreateMessage(unknown channel)", err, constants.ErrNotFound)
+
+	_, err = d.CreateMessage(&models.Message{Sender: outsider.ID, ChannelID: channel.ID, Content: "hi"})
+	expectErr(t, "CreateMessage(outsider)", err, constants.ErrForbidden)
+
+	_, err = d.CreateMessage(&models.Message{Sender: owner.ID, ChannelID: channel.ID})
+	expectErr(t, "CreateMessage(no content)", err, constants.ErrBadRequest)
+
+	// a message goes to a recipient, a group or a channel, only one of them
+	_, err = d.CreateMessage(&models.Message{Sender: owner.ID, Recipient: member.ID, ChannelID: channel.ID, Content: "hi"})
+	expectErr(t, "CreateMessage(recipient and channel)", err, constants.ErrBadRequest)
+
+	group, err := d.CreateGroup(owner.ID, "group", []string{member.ID})
+	expectOK(t, "CreateGroup", err)
+
+	_, err = d.CreateMessage(&models.Message{Sender: owner.ID, GroupID: group.ID, ChannelID: channel.ID, Content: "hi"})
+	expectErr(t, "CreateMessage(group and channel)", err, constants.ErrBadRequest)
+
+	sent := []*models.Message{}
+	for i, sender := range []string{owner.ID, member.ID, owner.ID} {
+		msg, err := d.CreateMessage(&models.Message{Sender: sender, ChannelID: channel.ID, Content: strings.Repeat("x", i+1)})
+		expectOK(t, "CreateMessage(channel)", err)
+
+		if msg.ID == "" || msg.Date == nil || msg.ChannelID != channel.ID || msg.Recipient != "" || msg.GroupID != "" {
+			t.Errorf("CreateMessage(channel): unexpected message %+v", msg)
+		}
+		sent = append(sent, msg)
+		time.Sleep(time.Millisecond)
+	}
+
+	got, err := d.GetMessage(sent[0].ID)
+	expectOK(t, "GetMessage(channel)", err)
+	if got.ChannelID != channel.ID || got.Recipient != "" || got.GroupID != "" {
+		t.Errorf("GetMessage(channel): unexpected message %+v", got)
+	}
+
+	// sending bumps the channel and the guild
+	gotChannel, err := d.GetChannel(channel.ID)
+	expectOK(t, "GetChannel", err)
+	if gotChannel.Updated.Before(*sent[2].Date) {
+		t.Errorf("GetChannel: expected updated at or after %v, got %v", sent[2].Date, gotChannel.Updated)
+	}
+
+	_, err = d.ListChannelMessages("", time.Time{}, time.Time{}, 0)
+	expectErr(t, "ListChannelMessages(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.ListChannelMessages(unknownID, time.Time{}, time.Time{}, 0)
+	expectErr(t, "ListChannelMessages(unknown)", err, constants.ErrNotFound)
+
+	msgs, err := d.ListChannelMessages(channel.ID, time.Time{}, time.Time{}, 0)
+	expectOK(t, "ListChannelMessages", err)
+	if got, want := strings.Join(ids(msgs), ","), strings.Join(ids(sent), ","); got != want {
+		t.Errorf("ListChannelMessages: expected %s, got %s", want, got)
+	}
+
+	// the limit keeps the most recent messages
+	msgs, err = d.ListChannelMessages(channel.ID, time.Time{}, time.Time{}, 2)
+	expectOK(t, "ListChannelMessages(limit)", err)
+	if got, want := strings.Join(ids(msgs), ","), strings.Join(ids(sent[1:]), ","); got != want {
+		t.Errorf("ListChannelMessages(limit): expected %s, got %s", want, got)
+	}
+
+	msgs, err = d.ListChannelMessages(channel.ID, *sent[1].Date, time.Time{}, 0)
+	expectOK(t, "ListChannelMessages(from)", err)
+	if contains(msgs, sent[0].ID) || !contains(msgs, sent[1].ID) || !contains(msgs, sent[2].ID) {
+		t.Errorf("ListChannelMessages(from): unexpected messages %v", ids(msgs))
+	}
+
+	// other channels in the guild are separate
+	random, err := d.CreateChannel(guild.ID, "random")
+	expectOK(t, "CreateChannel", err)
+
+	msgs, err = d.ListChannelMessages(random.ID, time.Time{}, time.Time{}, 0)
+	expectOK(t, "ListChannelMessages(random)", err)
+	if len(msgs) != 0 {
+		t.Errorf("ListChannelMessages(random): expected no messages, got %v", ids(msgs))
+	}
+
+	// channel messages aren't sent to anyone in particular
+	direct, err := d.ListMessages(member.ID, time.Time{}, time.Time{}, 0, db.OldestFirst)
+	expectOK(t, "ListMessages", err)
+	if len(direct) != 0 {
+		t.Errorf("ListMessages: expected no direct messages, got %v", ids(direct))
+	}
+
+	// members who left can no longer send, but their messages stay
+	expectOK(t, "LeaveGuild", d.LeaveGuild(guild.ID, member.ID))
+	_, err = d.CreateMessage(&models.Message{Sender: member.ID, ChannelID: channel.ID, Content: "hi"})
+	expectErr(t, "CreateMessage(left)", err, constants.ErrForbidden)
+
+	msgs, err = d.ListChannelMessages(channel.ID, time.Time{}, time.Time{}, 0)
+	expectOK(t, "ListChannelMessages(left)", err)
+	if !contains(msgs, sent[1].ID) {
+		t.Errorf("ListChannelMessages(left): expected %s to remain, got %v", sent[1].ID, ids(msgs))
+	}
+}
+
+func testListGuilds(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "owner")
+	member := newUser(t, d, "member")
+
+	_, err := d.ListGuilds("", time.Time{}, time.Time{})
+	expectErr(t, "ListGuilds(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.ListGuilds(unknownID, time.Time{}, time.Time{})
+	expectErr(t, "ListGuilds(unknown)", err, constants.ErrNotFound)
+
+	guilds, err := d.ListGuilds(member.ID, time.Time{}, time.Time{})
+	expectOK(t, "ListGuilds(none)", err)
+	if len(guilds) != 0 {
+		t.Errorf("ListGuilds: expected no guilds, got %d", len(guilds))
+	}
+
+	first, err := d.CreateGuild(owner.ID, "first")
+	expectOK(t, "CreateGuild(first)", err)
+	_, err = d.JoinGuild(first.ID, member.ID)
+	expectOK(t, "JoinGuild(first)", err)
+	time.Sleep(time.Millisecond)
+
+	second, err := d.CreateGuild(owner.ID, "second")
+	expectOK(t, "CreateGuild(second)", err)
+	_, err = d.JoinGuild(second.ID, member.ID)
+	expectOK(t, "JoinGuild(second)", err)
+	time.Sleep(time.Millisecond)
+
+	_, err = d.CreateGuild(owner.ID, "without member")
+	expectOK(t, "CreateGuild(without member)", err)
+	time.Sleep(time.Millisecond)
+
+	// a new message moves the first guild to the top
+	_, err = d.CreateMessage(&models.Message{Sender: owner.ID, ChannelID: first.Channels[0].ID, Content: "bump"})
+	expectOK(t, "CreateMessage(channel)", err)
+
+	guilds, err = d.ListGuilds(member.ID, time.Time{}, time.Time{})
+	expectOK(t, "ListGuilds", err)
+	if len(guilds) != 2 || guilds[0].ID != first.ID || guilds[1].ID != second.ID {
+		t.Fatalf("ListGuilds: expected [%s %s], got %d guilds", first.ID, second.ID, len(guilds))
+	}
+	if len(guilds[0].Channels) != 1 {
+		t.Errorf("ListGuilds: expected the guild's channels, got %+v", guilds[0].Channels)
+	}
+
+	_, err = d.ListGuilds(member.ID, time.Now().Add(time.Hour), time.Time{})
+	expectErr(t, "ListGuilds(from after until)", err, constants.ErrBadRequest)
+
+	guilds, err = d.ListGuilds(member.ID, time.Time{}, *second.Updated)
+	expectOK(t, "ListGuilds(until)", err)
+	if len(guilds) != 1 || guilds[0].ID != second.ID {
+		t.Errorf("ListGuilds(until): expected only %s, got %d guilds", second.ID, len(guilds))
+	}
+
+	// guilds someone has left aren't listed
+	expectOK(t, "LeaveGuild", d.LeaveGuild(second.ID, member.ID))
+
+	guilds, err = d.ListGuilds(member.ID, time.Time{}, time.Time{})
+	expectOK(t, "ListGuilds(left)", err)
+	if len(guilds) != 1 || guilds[0].ID != first.ID {
+		t.Errorf("ListGuilds(left): expected only %s, got %d guilds", first.ID, len(guilds))
+	}
+}
+
+// memberIDs - the user ids of a list of members, in order
+func memberIDs(members []*models.Member) []string {
+	out := make([]string, len(members))
+	for i, member := range members {
+		out[i] = member.UserID
+	}
+	return out
+}
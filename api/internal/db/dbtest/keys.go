@@ -0,0 +1,188 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testBots(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "oscar")
+
+	_, err := d.CreateUser(&models.User{Username: "orphan", Bot: true})
+	expectErr(t, "CreateUser(bot without owner)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateUser(&models.User{Username: "owned", Email: "owned@example.com", Owner: owner.ID})
+	expectErr(t, "CreateUser(person with owner)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateUser(&models.User{Username: "lost", Bot: true, Owner: unknownID})
+	expectErr(t, "CreateUser(unknown owner)", err, constants.ErrNotFound)
+
+	bot, err := d.CreateUser(&models.User{Username: "oscar-bot", Bot: true, Owner: owner.ID})
+	expectOK(t, "CreateUser(bot)", err)
+	if !bot.Bot || bot.Owner != owner.ID || bot.Email != "" {
+		t.Errorf("CreateUser(bot): expected a bot owned by %s, got %+v", owner.ID, bot)
+	}
+
+	// bots can't own bots
+	_, err = d.CreateUser(&models.User{Username: "oscar-bot-bot", Bot: true, Owner: bot.ID})
+	expectErr(t, "CreateUser(bot owner)", err, constants.ErrBadRequest)
+
+	got, err := d.GetUser(bot.ID)
+	expectOK(t, "GetUser(bot)", err)
+	if !got.Bot || got.Owner != owner.ID {
+		t.Errorf("GetUser(bot): expected a bot owned by %s, got %+v", owner.ID, got)
+	}
+
+	got, err = d.GetUser(owner.ID)
+	expectOK(t, "GetUser(owner)", err)
+	if got.Bot || got.Owner != "" {
+		t.Errorf("GetUser(owner): expected a person, got %+v", got)
+	}
+
+	_, err = d.ListBots("")
+	expectErr(t, "ListBots(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.ListBots(unknownID)
+	expectErr(t, "ListBots(unknown)", err, constants.ErrNotFound)
+
+	other, err := d.CreateUser(&models.User{Username: "another-bot", Bot: true, Owner: owner.ID})
+	expectOK(t, "CreateUser(another bot)", err)
+
+	bots, err := d.ListBots(owner.ID)
+	expectOK(t, "ListBots", err)
+	expectUsers(t, "ListBots", bots, other.ID, bot.ID)
+
+	// deleting a bot leaves its owner, and the owner's other bots
+	expectOK(t, "DeleteUser(bot)", d.DeleteUser(other.ID))
+
+	bots, err = d.ListBots(owner.ID)
+	expectOK(t, "ListBots(deleted bot)", err)
+	expectUsers(t, "ListBots(deleted bot)", bots, bot.ID)
+
+	// deleting the owner takes their bots with them
+	expectOK(t, "DeleteUser(owner)", d.DeleteUser(owner.ID))
+
+	_, err = d.GetUser(bot.ID)
+	expectErr(t, "GetUser(owner deleted)", err, constants.ErrNotFound)
+
+	_, err = d.CreateUser(&models.User{Username: "late-bot", Bot: true, Owner: owner.ID})
+	expectErr(t, "CreateUser(deleted owner)", err, constants.ErrNotFound)
+}
+
+func testAPIKeys(t *testing.T, d db.Driver) {
+	user := newUser(t, d, "peggy")
+	scopes := []string{models.ReadScope(models.ScopeMessages)}
+
+	_, err := d.CreateAPIKey(nil, "hash")
+	expectErr(t, "CreateAPIKey(nil)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateAPIKey(&models.APIKey{UserID: user.ID, Name: "ci", Prefix: "gck_abc", Scopes: scopes}, "")
+	expectErr(t, "CreateAPIKey(no hash)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateAPIKey(&models.APIKey{UserID: user.ID, Prefix: "gck_abc", Scopes: scopes}, "hash")
+	expectErr(t, "CreateAPIKey(no name)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateAPIKey(&models.APIKey{UserID: user.ID, Name: "ci", Prefix: "gck_abc"}, "hash")
+	expectErr(t, "CreateAPIKey(no scopes)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateAPIKey(&models.APIKey{UserID: user.ID, Name: "ci", Prefix: "gck_abc", Scopes: []string{"everything"}}, "hash")
+	expectErr(t, "CreateAPIKey(bad scope)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateAPIKey(&models.APIKey{UserID: unknownID, Name: "ci", Prefix: "gck_abc", Scopes: scopes}, "hash")
+	expectErr(t, "CreateAPIKey(unknown user)", err, constants.ErrNotFound)
+
+	key, err := d.CreateAPIKey(&models.APIKey{UserID: user.ID, Name: "ci", Prefix: "gck_abc", Scopes: scopes}, "hash")
+	expectOK(t, "CreateAPIKey", err)
+	if key.ID == "" || key.Created == nil || key.LastUsed != nil || key.Revoked != nil {
+		t.Errorf("CreateAPIKey: expected a new, unused key, got %+v", key)
+	}
+
+	_, err = d.CreateAPIKey(&models.APIKey{UserID: user.ID, Name: "copy", Prefix: "gck_abc", Scopes: scopes}, "hash")
+	expectErr(t, "CreateAPIKey(duplicate hash)", err, constants.ErrBadRequest)
+
+	got, err := d.GetAPIKeyByHash("hash")
+	expectOK(t, "GetAPIKeyByHash", err)
+	if got.ID != key.ID || got.UserID != user.ID || len(got.Scopes) != 1 || got.Scopes[0] != scopes[0] {
+		t.Errorf("GetAPIKeyByHash: expected %+v, got %+v", key, got)
+	}
+
+	_, err = d.GetAPIKeyByHash("unknown")
+	expectErr(t, "GetAPIKeyByHash(unknown)", err, constants.ErrNotFound)
+
+	_, err = d.GetAPIKey(unknownID)
+	expectErr(t, "GetAPIKey(unknown)", err, constants.ErrNotFound)
+
+	// last used only moves forward
+	used := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	expectErr(t, "TouchAPIKey(empty)", d.TouchAPIKey("", used), constants.ErrBadRequest)
+	expectErr(t, "TouchAPIKey(unknown)", d.TouchAPIKey(unknownID, used), constants.ErrNotFound)
+	expectOK(t, "TouchAPIKey", d.TouchAPIKey(key.ID, used))
+	expectOK(t, "TouchAPIKey(earlier)", d.TouchAPIKey(key.ID, used.Add(-time.Hour)))
+
+	got, err = d.GetAPIKey(key.ID)
+	expectOK(t, "GetAPIKey", err)
+	if got.LastUsed == nil || !got.LastUsed.Equal(used) {
+		t.Errorf("GetAPIKey: expected last used %v, got %v", used, got.LastUsed)
+	}
+
+	second, err := d.CreateAPIKey(&models.APIKey{UserID: user.ID, Name: "deploy", Prefix: "gck_def", Scopes: scopes}, "other")
+	expectOK(t, "CreateAPIKey(second)", err)
+
+	_, err = d.ListAPIKeys(unknownID)
+	expectErr(t, "ListAPIKeys(unknown)", err, constants.ErrNotFound)
+
+	expectErr(t, "RevokeAPIKey(unknown)", d.RevokeAPIKey(unknownID), constants.ErrNotFound)
+	expectOK(t, "RevokeAPIKey", d.RevokeAPIKey(key.ID))
+
+	got, err = d.GetAPIKey(key.ID)
+	expectOK(t, "GetAPIKey(revoked)", err)
+	if got.Revoked == nil {
+		t.Fatal("GetAPIKey(revoked): expected a revoked date")
+	}
+	revoked := *got.Revoked
+
+	// revoking again changes nothing
+	expectOK(t, "RevokeAPIKey(again)", d.RevokeAPIKey(key.ID))
+
+	got, err = d.GetAPIKey(key.ID)
+	expectOK(t, "GetAPIKey(revoked again)", err)
+	if got.Revoked == nil || !got.Revoked.Equal(revoked) {
+		t.Errorf("GetAPIKey(revoked again): expected revoked %v, got %v", revoked, got.Revoked)
+	}
+
+	// revoked keys no longer authenticate, but are still listed
+	_, err = d.GetAPIKeyByHash("hash")
+	expectErr(t, "GetAPIKeyByHash(revoked)", err, constants.ErrNotFound)
+
+	keys, err := d.ListAPIKeys(user.ID)
+	expectOK(t, "ListAPIKeys", err)
+	if len(keys) != 2 || keys[0].ID != key.ID || keys[1].ID != second.ID {
+		t.Errorf("ListAPIKeys: expected [%s %s], got %+v", key.ID, second.ID, keys)
+	}
+
+	// keys can only be made for active users
+	expectOK(t, "DeleteUser", d.DeleteUser(user.ID))
+
+	_, err = d.CreateAPIKey(&models.APIKey{UserID: user.ID, Name: "late", Prefix: "gck_ghi", Scopes: scopes}, "late")
+	expectErr(t, "CreateAPIKey(deleted user)", err, constants.ErrNotFound)
+}
+
+// expectUsers - fails the test unless users has exactly the given ids, in order
+func expectUsers(t *testing.T, call string, users []*models.User, want ...string) {
+	t.Helper()
+
+	if len(users) != len(want) {
+		t.Errorf("%s: expected %d users, got %d", call, len(want), len(users))
+		return
+	}
+
+	for i, user := range users {
+		if user.ID != want[i] {
+			t.Errorf("%s: expected user %d to be %s, got %s", call, i, want[i], user.ID)
+		}
+	}
+}
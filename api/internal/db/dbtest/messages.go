@@ -0,0 +1,309 @@
+package dbtest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testCreateMessage(t *testing.T, d db.Driver) {
+	alice := newUser(t, d, "alice")
+	bob := newUser(t, d, "bob")
+
+	bad := []*models.Message{
+		{Recipient: bob.ID, Content: "no sender"},
+		{Sender: alice.ID, Content: "no recipient"},
+		{Sender: alice.ID, Recipient: bob.ID},
+	}
+	for _, msg := range bad {
+		_, err := d.CreateMessage(msg)
+		expectErr(t, "CreateMessage(missing field)", err, constants.ErrBadRequest)
+	}
+
+	_, err := d.CreateMessage(&models.Message{Sender: unknownID, Recipient: bob.ID, Content: "hi"})
+	expectErr(t, "CreateMessage(unknown sender)", err, constants.ErrNotFound)
+
+	_, err = d.CreateMessage(&models.Message{Sender: alice.ID, Recipient: unknownID, Content: "hi"})
+	expectErr(t, "CreateMessage(unknown recipient)", err, constants.ErrNotFound)
+
+	before := time.Now()
+	msg := newMessage(t, d, alice.ID, bob.ID, "hello")
+
+	if msg.ID == "" {
+		t.Error("CreateMessage: expected an id to be generated")
+	}
+
+	if msg.Date == nil || msg.Date.Before(before.Add(-time.Second)) || msg.Date.After(time.Now().Add(time.Second)) {
+		t.Errorf("CreateMessage: expected date to be set to now, got %v", msg.Date)
+	}
+
+	// the first message creates the conversation, from either side
+	for _, pair := range [][2]string{{alice.ID, bob.ID}, {bob.ID, alice.ID}} {
+		convo, err := d.GetConversation(pair[0], pair[1], time.Time{}, time.Time{})
+		expectOK(t, "GetConversation", err)
+
+		if !contains(convo.Messages, msg.ID) {
+			t.Errorf("GetConversation: expected message %s in %v", msg.ID, ids(convo.Messages))
+		}
+	}
+
+	// replying adds to the same conversation rather than creating another
+	reply := newMessage(t, d, bob.ID, alice.ID, "hi back")
+	convo, err := d.GetConversation(alice.ID, bob.ID, time.Time{}, time.Time{})
+	expectOK(t, "GetConversation", err)
+
+	if len(convo.Messages) != 2 || !contains(convo.Messages, reply.ID) {
+		t.Errorf("GetConversation: expected both messages, got %v", ids(convo.Messages))
+	}
+
+	// both carry the conversation's id
+	if msg.ConversationID != convo.ID || reply.ConversationID != convo.ID {
+		t.Errorf("CreateMessage: expected conversation %s, got %s and %s", convo.ID, msg.ConversationID, reply.ConversationID)
+	}
+
+	// and bumps its updated time
+	if convo.Updated == nil || convo.Updated.Before(msg.Date.Add(-time.Millisecond)) {
+		t.Errorf("GetConversation: expected updated to be bumped, got %v", convo.Updated)
+	}
+}
+
+func testGetMessage(t *testing.T, d db.Driver) {
+	_, err := d.GetMessage("")
+	expectErr(t, "GetMessage(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.GetMessage(unknownID)
+	expectErr(t, "GetMessage(unknown)", err, constants.ErrNotFound)
+
+	alice := newUser(t, d, "alice")
+	bob := newUser(t, d, "bob")
+	created := newMessage(t, d, alice.ID, bob.ID, "hello")
+
+	msg, err := d.GetMessage(created.ID)
+	expectOK(t, "GetMessage", err)
+
+	if msg.ID != created.ID || msg.Sender != alice.ID || msg.Recipient != bob.ID || msg.Content != "hello" {
+		t.Errorf("GetMessage: expected %+v, got %+v", created, msg)
+	}
+
+	if msg.Date == nil || !msg.Date.Equal(*created.Date) {
+		t.Errorf("GetMessage: expected date %v, got %v", created.Date, msg.Date)
+	}
+}
+
+func testListMessages(t *testing.T, d db.Driver) {
+	alice := newUser(t, d, "alice")
+	bob := newUser(t, d, "bob")
+	carol := newUser(t, d, "carol")
+
+	_, err := d.ListMessages("", time.Time{}, time.Time{}, 0, db.OldestFirst)
+	expectErr(t, "ListMessages(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.ListMessages(unknownID, time.Time{}, time.Time{}, 0, db.OldestFirst)
+	expectErr(t, "ListMessages(unknown)", err, constants.ErrNotFound)
+
+	now := time.Now()
+	_, err = d.ListMessages(bob.ID, now, now.Add(-time.Hour), 0, db.OldestFirst)
+	expectErr(t, "ListMessages(from after until)", err, constants.ErrBadRequest)
+
+	// no messages yet is not an error
+	msgs, err := d.ListMessages(bob.ID, time.Time{}, time.Time{}, 0, db.OldestFirst)
+	expectOK(t, "ListMessages", err)
+
+	if len(msgs) != 0 {
+		t.Errorf("ListMessages: expected no messages, got %v", ids(msgs))
+	}
+
+	fromAlice := newMessage(t, d, alice.ID, bob.ID, "from alice")
+	fromCarol := newMessage(t, d, carol.ID, bob.ID, "from carol")
+	toAlice := newMessage(t, d, bob.ID, alice.ID, "to alice")
+
+	// only messages sent to the recipient, from anybody
+	msgs, err = d.ListMessages(bob.ID, time.Time{}, time.Time{}, 0, db.OldestFirst)
+	expectOK(t, "ListMessages", err)
+
+	if len(msgs) != 2 || !contains(msgs, fromAlice.ID) || !contains(msgs, fromCarol.ID) || contains(msgs, toAlice.ID) {
+		t.Errorf("ListMessages: expected [%s %s], got %v", fromAlice.ID, fromCarol.ID, ids(msgs))
+	}
+
+	// the window is inclusive at both ends
+	msgs, err = d.ListMessages(bob.ID, *fromAlice.Date, *fromCarol.Date, 0, db.OldestFirst)
+	expectOK(t, "ListMessages(inclusive window)", err)
+
+	if len(msgs) != 2 {
+		t.Errorf("ListMessages(inclusive window): expected 2 messages, got %v", ids(msgs))
+	}
+
+	// a window in the future or the past is empty
+	msgs, err = d.ListMessages(bob.ID, time.Now().Add(time.Hour), time.Now().Add(2*time.Hour), 0, db.OldestFirst)
+	expectOK(t, "ListMessages(future)", err)
+
+	if len(msgs) != 0 {
+		t.Errorf("ListMessages(future): expected no messages, got %v", ids(msgs))
+	}
+
+	msgs, err = d.ListMessages(bob.ID, time.Time{}, fromAlice.Date.Add(-time.Hour), 0, db.OldestFirst)
+	expectOK(t, "ListMessages(past)", err)
+
+	if len(msgs) != 0 {
+		t.Errorf("ListMessages(past): expected no messages, got %v", ids(msgs))
+	}
+}
+
+func testListMessageOrder(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	recipient := newUser(t, d, "recipient")
+
+	_, err := d.ListMessages(recipient.ID, time.Time{}, time.Time{}, 0, db.Order(-1))
+	expectErr(t, "ListMessages(unknown order)", err, constants.ErrBadRequest)
+
+	sent := []string{}
+	for _, content := range []string{"one", "two", "three", "four", "five"} {
+		sent = append(sent, newMessage(t, d, sender.ID, recipient.ID, content).ID)
+	}
+
+	newest := []string{sent[4], sent[3], sent[2], sent[1], sent[0]}
+
+	msgs, err := d.ListMessages(recipient.ID, time.Time{}, time.Time{}, 0, db.OldestFirst)
+	expectOK(t, "ListMessages(oldest first)", err)
+	if !reflect.DeepEqual(ids(msgs), sent) {
+		t.Errorf("ListMessages(oldest first): expected %v, got %v", sent, ids(msgs))
+	}
+
+	msgs, err = d.ListMessages(recipient.ID, time.Time{}, time.Time{}, 0, db.NewestFirst)
+	expectOK(t, "ListMessages(newest first)", err)
+	if !reflect.DeepEqual(ids(msgs), newest) {
+		t.Errorf("ListMessages(newest first): expected %v, got %v", newest, ids(msgs))
+	}
+
+	// a limit keeps the most recent messages whichever way they are listed
+	msgs, err = d.ListMessages(recipient.ID, time.Time{}, time.Time{}, 2, db.OldestFirst)
+	expectOK(t, "ListMessages(limit, oldest first)", err)
+	if !reflect.DeepEqual(ids(msgs), sent[3:]) {
+		t.Errorf("ListMessages(limit, oldest first): expected %v, got %v", sent[3:], ids(msgs))
+	}
+
+	msgs, err = d.ListMessages(recipient.ID, time.Time{}, time.Time{}, 2, db.NewestFirst)
+	expectOK(t, "ListMessages(limit, newest first)", err)
+	if !reflect.DeepEqual(ids(msgs), newest[:2]) {
+		t.Errorf("ListMessages(limit, newest first): expected %v, got %v", newest[:2], ids(msgs))
+	}
+
+	// a limit within a window keeps the most recent messages in it
+	until, err := d.GetMessage(sent[2])
+	expectOK(t, "GetMessage", err)
+
+	msgs, err = d.ListMessages(recipient.ID, time.Time{}, *until.Date, 2, db.OldestFirst)
+	expectOK(t, "ListMessages(limit, window)", err)
+	if !reflect.DeepEqual(ids(msgs), sent[1:3]) {
+		t.Errorf("ListMessages(limit, window): expected %v, got %v", sent[1:3], ids(msgs))
+	}
+
+	// hidden messages don't count towards the limit
+	expectOK(t, "HideMessage", d.HideMessage(sent[4], recipient.ID))
+
+	msgs, err = d.ListMessages(recipient.ID, time.Time{}, time.Time{}, 2, db.OldestFirst)
+	expectOK(t, "ListMessages(limit, hidden)", err)
+	if !reflect.DeepEqual(ids(msgs), sent[2:4]) {
+		t.Errorf("ListMessages(limit, hidden): expected %v, got %v", sent[2:4], ids(msgs))
+	}
+}
+
+func testGetMessages(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	recipient := newUser(t, d, "recipient")
+
+	first := newMessage(t, d, sender.ID, recipient.ID, "first")
+	second := newMessage(t, d, sender.ID, recipient.ID, "second")
+	third := newMessage(t, d, recipient.ID, sender.ID, "third")
+
+	// in the order asked for, leaving out anything that doesn't exist
+	msgs, err := d.GetMessages(recipient.ID, []string{third.ID, unknownID, first.ID, second.ID})
+	expectOK(t, "GetMessages", err)
+
+	want := []string{third.ID, first.ID, second.ID}
+	if !reflect.DeepEqual(ids(msgs), want) {
+		t.Errorf("GetMessages: expected %v, got %v", want, ids(msgs))
+	}
+
+	if len(msgs) == 3 && msgs[1].Content != first.Content {
+		t.Errorf("GetMessages: expected content %q, got %q", first.Content, msgs[1].Content)
+	}
+
+	// hidden messages are left out for the viewer who hid them only
+	expectOK(t, "HideMessage", d.HideMessage(first.ID, recipient.ID))
+
+	msgs, err = d.GetMessages(recipient.ID, []string{first.ID, second.ID})
+	expectOK(t, "GetMessages(hidden)", err)
+	if !reflect.DeepEqual(ids(msgs), []string{second.ID}) {
+		t.Errorf("GetMessages(hidden): expected [%s], got %v", second.ID, ids(msgs))
+	}
+
+	msgs, err = d.GetMessages(sender.ID, []string{first.ID, second.ID})
+	expectOK(t, "GetMessages(other viewer)", err)
+	if len(msgs) != 2 {
+		t.Errorf("GetMessages(other viewer): expected 2 messages, got %v", ids(msgs))
+	}
+
+	msgs, err = d.GetMessages(recipient.ID, nil)
+	expectOK(t, "GetMessages(none)", err)
+	if len(msgs) != 0 {
+		t.Errorf("GetMessages(none): expected no messages, got %v", ids(msgs))
+	}
+}
+
+func testScanMessages(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	recipient := newUser(t, d, "recipient")
+
+	_, err := d.ScanMessages("", -1)
+	expectErr(t, "ScanMessages(negative limit)", err, constants.ErrBadRequest)
+
+	sent := map[string]bool{}
+	for _, content := range []string{"one", "two", "three", "four", "five"} {
+		sent[newMessage(t, d, sender.ID, recipient.ID, content).ID] = true
+	}
+
+	deleted := newMessage(t, d, sender.ID, recipient.ID, "deleted")
+	_, err = d.DeleteMessage(deleted.ID)
+	expectOK(t, "DeleteMessage", err)
+	sent[deleted.ID] = true
+
+	// a batch at a time, by id, gets every message exactly once
+	seen := map[string]bool{}
+	after := ""
+	for {
+		msgs, err := d.ScanMessages(after, 2)
+		expectOK(t, "ScanMessages", err)
+
+		if len(msgs) > 2 {
+			t.Fatalf("ScanMessages: expected at most 2 messages, got %v", ids(msgs))
+		}
+
+		for _, msg := range msgs {
+			if msg.ID <= after || seen[msg.ID] {
+				t.Fatalf("ScanMessages: %s out of order after %s", msg.ID, after)
+			}
+			seen[msg.ID] = true
+			after = msg.ID
+		}
+
+		if len(msgs) < 2 {
+			break
+		}
+	}
+
+	if !reflect.DeepEqual(seen, sent) {
+		t.Errorf("ScanMessages: expected %d messages, got %d", len(sent), len(seen))
+	}
+
+	// without a limit, everything at once
+	msgs, err := d.ScanMessages("", 0)
+	expectOK(t, "ScanMessages(no limit)", err)
+	if len(msgs) != len(sent) {
+		t.Errorf("ScanMessages(no limit): expected %d messages, got %d", len(sent), len(msgs))
+	}
+}
@@ -0,0 +1,151 @@
+package dbtest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testPageConversation(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	recipient := newUser(t, d, "recipient")
+	stranger := newUser(t, d, "stranger")
+
+	sent := []string{}
+	for _, content := range []string{"one", "two", "three", "four", "five"} {
+		sent = append(sent, newMessage(t, d, sender.ID, recipient.ID, content).ID)
+		newMessage(t, d, recipient.ID, sender.ID, "reply to "+content)
+	}
+
+	_, err := d.PageConversation("", recipient.ID, db.Page{})
+	expectErr(t, "PageConversation(empty sender)", err, constants.ErrBadRequest)
+
+	_, err = d.PageConversation(sender.ID, recipient.ID, db.Page{Limit: -1})
+	expectErr(t, "PageConversation(negative limit)", err, constants.ErrBadRequest)
+
+	cursor := &db.Cursor{Date: time.Now(), ID: sent[0]}
+	_, err = d.PageConversation(sender.ID, recipient.ID, db.Page{Before: cursor, After: cursor})
+	expectErr(t, "PageConversation(both cursors)", err, constants.ErrBadRequest)
+
+	_, err = d.PageConversation(sender.ID, unknownID, db.Page{})
+	expectErr(t, "PageConversation(unknown recipient)", err, constants.ErrNotFound)
+
+	_, err = d.PageConversation(sender.ID, stranger.ID, db.Page{})
+	expectErr(t, "PageConversation(no conversation)", err, constants.ErrNotFound)
+
+	// without a limit, everything from sender to recipient, oldest first
+	page, err := d.PageConversation(sender.ID, recipient.ID, db.Page{})
+	expectOK(t, "PageConversation", err)
+	if !reflect.DeepEqual(ids(page.Messages), sent) || page.NextCursor != "" {
+		t.Errorf("PageConversation: expected %v with no next cursor, got %v %q", sent, ids(page.Messages), page.NextCursor)
+	}
+
+	// paging back from the most recent
+	want := [][]string{sent[3:5], sent[1:3], sent[0:1]}
+	expectPages(t, "PageConversation(before)", want, func(cursor *db.Cursor) (*models.MessagePage, error) {
+		return d.PageConversation(sender.ID, recipient.ID, db.Page{Before: cursor, Limit: 2})
+	})
+
+	// paging forward from the first message
+	first, err := d.GetMessage(sent[0])
+	expectOK(t, "GetMessage", err)
+
+	want = [][]string{sent[1:3], sent[3:5]}
+	expectPages(t, "PageConversation(after)", want, func(cursor *db.Cursor) (*models.MessagePage, error) {
+		if cursor == nil {
+			cursor = db.CursorAt(first)
+		}
+		return d.PageConversation(sender.ID, recipient.ID, db.Page{After: cursor, Limit: 2})
+	})
+
+	// the same conversation, the other way
+	page, err = d.PageConversation(recipient.ID, sender.ID, db.Page{Limit: 2})
+	expectOK(t, "PageConversation(reversed)", err)
+	for _, msg := range page.Messages {
+		if msg.Sender != recipient.ID || msg.Recipient != sender.ID {
+			t.Errorf("PageConversation(reversed): expected only messages from %s, got %+v", recipient.ID, msg)
+		}
+	}
+
+	// nothing past the most recent message
+	last, err := d.GetMessage(sent[4])
+	expectOK(t, "GetMessage", err)
+
+	page, err = d.PageConversation(sender.ID, recipient.ID, db.Page{After: db.CursorAt(last), Limit: 2})
+	expectOK(t, "PageConversation(after last)", err)
+	if len(page.Messages) != 0 || page.NextCursor != "" {
+		t.Errorf("PageConversation(after last): expected an empty last page, got %v %q", ids(page.Messages), page.NextCursor)
+	}
+}
+
+func testPageMessages(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	other := newUser(t, d, "other")
+	recipient := newUser(t, d, "recipient")
+
+	received := []string{}
+	for _, content := range []string{"one", "two", "three", "four"} {
+		received = append(received, newMessage(t, d, sender.ID, recipient.ID, content).ID)
+		received = append(received, newMessage(t, d, other.ID, recipient.ID, content).ID)
+		newMessage(t, d, recipient.ID, sender.ID, "reply to "+content)
+	}
+
+	_, err := d.PageMessages("", db.Page{})
+	expectErr(t, "PageMessages(empty recipient)", err, constants.ErrBadRequest)
+
+	_, err = d.PageMessages(unknownID, db.Page{})
+	expectErr(t, "PageMessages(unknown recipient)", err, constants.ErrNotFound)
+
+	_, err = d.PageMessages(recipient.ID, db.Page{From: time.Now().Add(time.Hour)})
+	expectErr(t, "PageMessages(from after until)", err, constants.ErrBadRequest)
+
+	// hidden messages are skipped over
+	expectOK(t, "HideMessage", d.HideMessage(received[2], recipient.ID))
+	visible := append(append([]string{}, received[:2]...), received[3:]...)
+
+	want := [][]string{visible[4:7], visible[1:4], visible[0:1]}
+	expectPages(t, "PageMessages(before)", want, func(cursor *db.Cursor) (*models.MessagePage, error) {
+		return d.PageMessages(recipient.ID, db.Page{Before: cursor, Limit: 3})
+	})
+
+	// a page can also be cut to a window
+	page, err := d.PageMessages(recipient.ID, db.Page{Until: time.Now().Add(-time.Hour), Limit: 3})
+	expectOK(t, "PageMessages(window)", err)
+	if len(page.Messages) != 0 || page.NextCursor != "" {
+		t.Errorf("PageMessages(window): expected nothing an hour ago, got %v %q", ids(page.Messages), page.NextCursor)
+	}
+}
+
+// expectPages - follows next cursors on from the first page, fetched with a nil cursor, and fails unless the pages
+// hold the messages wanted, by id
+func expectPages(t *testing.T, call string, want [][]string, fetch func(cursor *db.Cursor) (*models.MessagePage, error)) {
+	t.Helper()
+
+	var cursor *db.Cursor
+	for i, wantIDs := range want {
+		page, err := fetch(cursor)
+		expectOK(t, call, err)
+
+		if got := ids(page.Messages); !reflect.DeepEqual(got, wantIDs) {
+			t.Errorf("%s: expected page %d to be %v, got %v", call, i, wantIDs, got)
+			return
+		}
+
+		if i == len(want)-1 {
+			if page.NextCursor != "" {
+				t.Errorf("%s: expected no next cursor after the last page, got %q", call, page.NextCursor)
+			}
+			return
+		}
+
+		cursor, err = db.ParseCursor(page.NextCursor)
+		if err != nil {
+			t.Errorf("%s: expected a next cursor after page %d, got %q", call, i, page.NextCursor)
+			return
+		}
+	}
+}
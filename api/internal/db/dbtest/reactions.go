@@ -0,0 +1,191 @@
+package dbtest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testReactions(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	recipient := newUser(t, d, "recipient")
+
+	msg := newMessage(t, d, sender.ID, recipient.ID, "hello")
+	if len(msg.Reactions) != 0 {
+		t.Errorf("CreateMessage: expected no reactions, got %+v", msg.Reactions)
+	}
+
+	_, err := d.AddReaction("", sender.ID, "👍")
+	expectErr(t, "AddReaction(empty id)", err, constants.ErrBadRequest)
+
+	_, err = d.AddReaction(msg.ID, "", "👍")
+	expectErr(t, "AddReaction(empty user)", err, constants.ErrBadRequest)
+
+	for _, emoji := range []string{"", "a", "thumbs up", ":Upper:", "::", "👍 👍"} {
+		_, err = d.AddReaction(msg.ID, sender.ID, emoji)
+		expectErr(t, "AddReaction("+emoji+")", err, constants.ErrBadRequest)
+	}
+
+	_, err = d.AddReaction(unknownID, sender.ID, "👍")
+	expectErr(t, "AddReaction(unknown message)", err, constants.ErrNotFound)
+
+	_, err = d.AddReaction(msg.ID, unknownID, "👍")
+	expectErr(t, "AddReaction(unknown user)", err, constants.ErrNotFound)
+
+	_, err = d.AddReaction(msg.ID, recipient.ID, "👍")
+	expectOK(t, "AddReaction", err)
+
+	_, err = d.AddReaction(msg.ID, sender.ID, ":party_parrot:")
+	expectOK(t, "AddReaction(short code)", err)
+
+	// reacting twice with the same emoji changes nothing
+	_, err = d.AddReaction(msg.ID, recipient.ID, "👍")
+	expectOK(t, "AddReaction(again)", err)
+
+	reacted, err := d.AddReaction(msg.ID, sender.ID, "👍")
+	expectOK(t, "AddReaction(second user)", err)
+
+	// emoji stay in the order they were first used
+	want := []*models.Reaction{
+		{Emoji: "👍", Count: 2, Users: []string{recipient.ID, sender.ID}},
+		{Emoji: ":party_parrot:", Count: 1, Users: []string{sender.ID}},
+	}
+	expectReactions(t, "AddReaction", reacted, want)
+
+	got, err := d.GetMessage(msg.ID)
+	expectOK(t, "GetMessage", err)
+	expectReactions(t, "GetMessage", got, want)
+
+	_, err = d.RemoveReaction("", sender.ID, "👍")
+	expectErr(t, "RemoveReaction(empty id)", err, constants.ErrBadRequest)
+
+	_, err = d.RemoveReaction(unknownID, sender.ID, "👍")
+	expectErr(t, "RemoveReaction(unknown message)", err, constants.ErrNotFound)
+
+	// the order follows the reactions that are left
+	removed, err := d.RemoveReaction(msg.ID, recipient.ID, "👍")
+	expectOK(t, "RemoveReaction", err)
+	want = []*models.Reaction{
+		{Emoji: ":party_parrot:", Count: 1, Users: []string{sender.ID}},
+		{Emoji: "👍", Count: 1, Users: []string{sender.ID}},
+	}
+	expectReactions(t, "RemoveReaction", removed, want)
+
+	// removing a reaction that isn't there changes nothing
+	removed, err = d.RemoveReaction(msg.ID, recipient.ID, "👍")
+	expectOK(t, "RemoveReaction(again)", err)
+	expectReactions(t, "RemoveReaction(again)", removed, want)
+
+	removed, err = d.RemoveReaction(msg.ID, sender.ID, ":party_parrot:")
+	expectOK(t, "RemoveReaction(short code)", err)
+	want = want[1:]
+	expectReactions(t, "RemoveReaction(short code)", removed, want)
+
+	// reactions from deleted users are left out
+	_, err = d.AddReaction(msg.ID, recipient.ID, "🎉")
+	expectOK(t, "AddReaction", err)
+	expectOK(t, "DeleteUser", d.DeleteUser(recipient.ID))
+
+	got, err = d.GetMessage(msg.ID)
+	expectOK(t, "GetMessage(deleted user)", err)
+	expectReactions(t, "GetMessage(deleted user)", got, want)
+
+	// deleting a message drops its reactions, and it can't be reacted to again
+	deleted, err := d.DeleteMessage(msg.ID)
+	expectOK(t, "DeleteMessage", err)
+	expectReactions(t, "DeleteMessage", deleted, nil)
+
+	_, err = d.AddReaction(msg.ID, sender.ID, "👍")
+	expectErr(t, "AddReaction(deleted message)", err, constants.ErrBadRequest)
+
+	_, err = d.RemoveReaction(msg.ID, sender.ID, "👍")
+	expectOK(t, "RemoveReaction(deleted message)", err)
+}
+
+func testReactionListings(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	recipient := newUser(t, d, "recipient")
+
+	first := newMessage(t, d, sender.ID, recipient.ID, "first")
+	second := newMessage(t, d, recipient.ID, sender.ID, "second")
+
+	_, err := d.AddReaction(first.ID, recipient.ID, "❤️")
+	expectOK(t, "AddReaction", err)
+
+	// editing a message keeps its reactions
+	edited, err := d.EditMessage(first.ID, sender.ID, "first!")
+	expectOK(t, "EditMessage", err)
+	want := []*models.Reaction{{Emoji: "❤️", Count: 1, Users: []string{recipient.ID}}}
+	expectReactions(t, "EditMessage", edited, want)
+
+	msgs, err := d.ListMessages(recipient.ID, time.Time{}, time.Time{}, 0, db.OldestFirst)
+	expectOK(t, "ListMessages", err)
+	if len(msgs) != 1 {
+		t.Fatalf("ListMessages: expected 1 message, got %+v", msgs)
+	}
+	expectReactions(t, "ListMessages", msgs[0], want)
+
+	convo, err := d.GetConversation(sender.ID, recipient.ID, time.Time{}, time.Time{})
+	expectOK(t, "GetConversation", err)
+	if !reflect.DeepEqual(ids(convo.Messages), []string{first.ID, second.ID}) {
+		t.Fatalf("GetConversation: expected %v, got %v", []string{first.ID, second.ID}, ids(convo.Messages))
+	}
+	expectReactions(t, "GetConversation", convo.Messages[0], want)
+	expectReactions(t, "GetConversation", convo.Messages[1], nil)
+
+	// group and channel messages can be reacted to as well
+	group, err := d.CreateGroup(sender.ID, "group", []string{recipient.ID})
+	expectOK(t, "CreateGroup", err)
+
+	groupMsg, err := d.CreateMessage(&models.Message{Sender: sender.ID, GroupID: group.ID, Content: "hello"})
+	expectOK(t, "CreateMessage(group)", err)
+
+	_, err = d.AddReaction(groupMsg.ID, recipient.ID, "❤️")
+	expectOK(t, "AddReaction(group)", err)
+
+	msgs, err = d.ListGroupMessages(group.ID, time.Time{}, time.Time{}, 0)
+	expectOK(t, "ListGroupMessages", err)
+	if len(msgs) != 1 {
+		t.Fatalf("ListGroupMessages: expected 1 message, got %+v", msgs)
+	}
+	expectReactions(t, "ListGroupMessages", msgs[0], want)
+
+	guild, err := d.CreateGuild(sender.ID, "guild")
+	expectOK(t, "CreateGuild", err)
+
+	_, err = d.JoinGuild(guild.ID, recipient.ID)
+	expectOK(t, "JoinGuild", err)
+
+	channelMsg, err := d.CreateMessage(&models.Message{Sender: sender.ID, ChannelID: guild.Channels[0].ID, Content: "hello"})
+	expectOK(t, "CreateMessage(channel)", err)
+
+	_, err = d.AddReaction(channelMsg.ID, recipient.ID, "❤️")
+	expectOK(t, "AddReaction(channel)", err)
+
+	msgs, err = d.ListChannelMessages(guild.Channels[0].ID, time.Time{}, time.Time{}, 0)
+	expectOK(t, "ListChannelMessages", err)
+	if len(msgs) != 1 {
+		t.Fatalf("ListChannelMessages: expected 1 message, got %+v", msgs)
+	}
+	expectReactions(t, "ListChannelMessages", msgs[0], want)
+}
+
+// expectReactions - fails unless a message has exactly the reactions wanted, in order
+func expectReactions(t *testing.T, call string, msg *models.Message, want []*models.Reaction) {
+	t.Helper()
+
+	if len(msg.Reactions) != len(want) {
+		t.Errorf("%s: expected %d reactions, got %+v", call, len(want), msg.Reactions)
+		return
+	}
+
+	for i, reaction := range msg.Reactions {
+		if !reflect.DeepEqual(reaction, want[i]) {
+			t.Errorf("%s: expected reaction %d to be %+v, got %+v", call, i, want[i], reaction)
+		}
+	}
+}
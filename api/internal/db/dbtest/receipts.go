@@ -0,0 +1,184 @@
+package dbtest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testReceipts(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	recipient := newUser(t, d, "recipient")
+	stranger := newUser(t, d, "stranger")
+
+	first := newMessage(t, d, sender.ID, recipient.ID, "one")
+	second := newMessage(t, d, sender.ID, recipient.ID, "two")
+
+	_, err := d.MarkRead("", first.ID)
+	expectErr(t, "MarkRead(empty user)", err, constants.ErrBadRequest)
+
+	_, err = d.MarkRead(recipient.ID, "")
+	expectErr(t, "MarkRead(empty message)", err, constants.ErrBadRequest)
+
+	_, err = d.MarkRead(recipient.ID, unknownID)
+	expectErr(t, "MarkRead(unknown message)", err, constants.ErrNotFound)
+
+	_, err = d.MarkRead(unknownID, first.ID)
+	expectErr(t, "MarkRead(unknown user)", err, constants.ErrNotFound)
+
+	_, err = d.MarkRead(stranger.ID, first.ID)
+	expectErr(t, "MarkRead(stranger)", err, constants.ErrForbidden)
+
+	receipt, err := d.MarkRead(recipient.ID, second.ID)
+	expectOK(t, "MarkRead", err)
+	if receipt.UserID != recipient.ID || receipt.MessageID != second.ID || receipt.ConversationID == "" || receipt.Date == nil {
+		t.Errorf("MarkRead: expected %s to have read up to %s, got %+v", recipient.ID, second.ID, receipt)
+	}
+
+	// markers only move forward
+	again, err := d.MarkRead(recipient.ID, first.ID)
+	expectOK(t, "MarkRead(older)", err)
+	if again.MessageID != second.ID || !again.Date.Equal(*receipt.Date) {
+		t.Errorf("MarkRead(older): expected the marker to stay at %+v, got %+v", receipt, again)
+	}
+
+	// the sender can mark the conversation read too
+	_, err = d.MarkRead(sender.ID, first.ID)
+	expectOK(t, "MarkRead(sender)", err)
+
+	_, err = d.ListReceipts("")
+	expectErr(t, "ListReceipts(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.ListReceipts(unknownID)
+	expectErr(t, "ListReceipts(unknown)", err, constants.ErrNotFound)
+
+	// everyone who has read at least this far, in the order they read it
+	receipts, err := d.ListReceipts(first.ID)
+	expectOK(t, "ListReceipts", err)
+	expectReceipts(t, "ListReceipts(first)", receipts, recipient.ID, sender.ID)
+
+	receipts, err = d.ListReceipts(second.ID)
+	expectOK(t, "ListReceipts", err)
+	expectReceipts(t, "ListReceipts(second)", receipts, recipient.ID)
+
+	// deleted users are left out
+	expectOK(t, "DeleteUser", d.DeleteUser(recipient.ID))
+
+	receipts, err = d.ListReceipts(first.ID)
+	expectOK(t, "ListReceipts(deleted reader)", err)
+	expectReceipts(t, "ListReceipts(deleted reader)", receipts, sender.ID)
+
+	_, err = d.MarkRead(recipient.ID, second.ID)
+	expectErr(t, "MarkRead(deleted user)", err, constants.ErrNotFound)
+
+	// groups have their own markers, only for participants
+	group, err := d.CreateGroup(sender.ID, "group", []string{stranger.ID})
+	expectOK(t, "CreateGroup", err)
+
+	groupMsg, err := d.CreateMessage(&models.Message{Sender: sender.ID, GroupID: group.ID, Content: "hello"})
+	expectOK(t, "CreateMessage(group)", err)
+
+	receipt, err = d.MarkRead(stranger.ID, groupMsg.ID)
+	expectOK(t, "MarkRead(group)", err)
+	if receipt.ConversationID != group.ID {
+		t.Errorf("MarkRead(group): expected the marker to be in %s, got %+v", group.ID, receipt)
+	}
+
+	outsider := newUser(t, d, "outsider")
+	_, err = d.MarkRead(outsider.ID, groupMsg.ID)
+	expectErr(t, "MarkRead(not a participant)", err, constants.ErrForbidden)
+
+	// channels don't have markers
+	guild, err := d.CreateGuild(sender.ID, "guild")
+	expectOK(t, "CreateGuild", err)
+
+	channelMsg, err := d.CreateMessage(&models.Message{Sender: sender.ID, ChannelID: guild.Channels[0].ID, Content: "hello"})
+	expectOK(t, "CreateMessage(channel)", err)
+
+	_, err = d.MarkRead(sender.ID, channelMsg.ID)
+	expectErr(t, "MarkRead(channel)", err, constants.ErrBadRequest)
+
+	_, err = d.ListReceipts(channelMsg.ID)
+	expectErr(t, "ListReceipts(channel)", err, constants.ErrBadRequest)
+}
+
+func testUnreadCounts(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	recipient := newUser(t, d, "recipient")
+
+	sent := []*models.Message{}
+	for _, content := range []string{"one", "two", "three", "four"} {
+		sent = append(sent, newMessage(t, d, sender.ID, recipient.ID, content))
+	}
+
+	// the recipient's own messages are never unread
+	newMessage(t, d, recipient.ID, sender.ID, "reply")
+
+	expectUnread(t, d, "before reading", recipient.ID, 4, "")
+	expectUnread(t, d, "sender", sender.ID, 1, "")
+
+	_, err := d.MarkRead(recipient.ID, sent[1].ID)
+	expectOK(t, "MarkRead", err)
+	expectUnread(t, d, "after reading", recipient.ID, 2, sent[1].ID)
+
+	// messages deleted for everyone, or hidden, aren't counted
+	_, err = d.DeleteMessage(sent[2].ID)
+	expectOK(t, "DeleteMessage", err)
+	expectOK(t, "HideMessage", d.HideMessage(sent[3].ID, recipient.ID))
+	expectUnread(t, d, "deleted and hidden", recipient.ID, 0, sent[1].ID)
+
+	// groups count unread messages the same way
+	group, err := d.CreateGroup(sender.ID, "group", []string{recipient.ID})
+	expectOK(t, "CreateGroup", err)
+
+	groupMsgs := []*models.Message{}
+	for _, content := range []string{"one", "two", "three"} {
+		msg, err := d.CreateMessage(&models.Message{Sender: sender.ID, GroupID: group.ID, Content: content})
+		expectOK(t, "CreateMessage(group)", err)
+		groupMsgs = append(groupMsgs, msg)
+	}
+
+	_, err = d.MarkRead(recipient.ID, groupMsgs[0].ID)
+	expectOK(t, "MarkRead(group)", err)
+
+	groups, err := d.ListGroups(recipient.ID, time.Time{}, time.Time{})
+	expectOK(t, "ListGroups", err)
+	if len(groups) != 1 || groups[0].Unread != 2 || groups[0].LastRead != groupMsgs[0].ID {
+		t.Errorf("ListGroups: expected 2 unread after %s, got %+v", groupMsgs[0].ID, groups)
+	}
+
+	groups, err = d.ListGroups(sender.ID, time.Time{}, time.Time{})
+	expectOK(t, "ListGroups(sender)", err)
+	if len(groups) != 1 || groups[0].Unread != 0 || groups[0].LastRead != "" {
+		t.Errorf("ListGroups(sender): expected nothing unread, got %+v", groups)
+	}
+}
+
+// expectUnread - fails unless viewer has a single conversation, with unread messages in it after lastRead
+func expectUnread(t *testing.T, d db.Driver, call, viewer string, unread int, lastRead string) {
+	t.Helper()
+
+	convos, err := d.ListConversations(viewer, time.Time{}, time.Time{})
+	expectOK(t, "ListConversations("+call+")", err)
+	if len(convos) != 1 || convos[0].Unread != unread || convos[0].LastRead != lastRead {
+		t.Errorf("ListConversations(%s): expected %d unread after %q, got %+v", call, unread, lastRead, convos)
+	}
+}
+
+// expectReceipts - fails unless the receipts are for the users wanted, in order
+func expectReceipts(t *testing.T, call string, receipts []*models.Receipt, want ...string) {
+	t.Helper()
+
+	got := []string{}
+	for _, receipt := range receipts {
+		got = append(got, receipt.UserID)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: expected receipts from %v, got %v", call, want, got)
+	}
+}
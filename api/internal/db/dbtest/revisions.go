@@ -0,0 +1,146 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testEditMessage(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	recipient := newUser(t, d, "recipient")
+
+	msg := newMessage(t, d, sender.ID, recipient.ID, "helo")
+	if msg.EditedAt != nil {
+		t.Errorf("CreateMessage: expected a new message not to be edited, got %v", msg.EditedAt)
+	}
+
+	_, err := d.EditMessage("", sender.ID, "hello")
+	expectErr(t, "EditMessage(no id)", err, constants.ErrBadRequest)
+
+	_, err = d.EditMessage(msg.ID, sender.ID, "")
+	expectErr(t, "EditMessage(no content)", err, constants.ErrBadRequest)
+
+	_, err = d.EditMessage(unknownID, sender.ID, "hello")
+	expectErr(t, "EditMessage(unknown)", err, constants.ErrNotFound)
+
+	// only the sender can edit, not the recipient
+	_, err = d.EditMessage(msg.ID, recipient.ID, "hello")
+	expectErr(t, "EditMessage(recipient)", err, constants.ErrForbidden)
+
+	time.Sleep(time.Millisecond)
+	edited, err := d.EditMessage(msg.ID, sender.ID, "hello")
+	expectOK(t, "EditMessage", err)
+	if edited.ID != msg.ID || edited.Content != "hello" || edited.Sender != sender.ID || edited.Recipient != recipient.ID {
+		t.Errorf("EditMessage: unexpected message %+v", edited)
+	}
+	if edited.EditedAt == nil || !edited.EditedAt.After(*msg.Date) || !edited.Date.Equal(*msg.Date) {
+		t.Errorf("EditMessage: expected edited_at after the unchanged date %v, got %v", msg.Date, edited.EditedAt)
+	}
+
+	got, err := d.GetMessage(msg.ID)
+	expectOK(t, "GetMessage", err)
+	if got.Content != "hello" || got.EditedAt == nil {
+		t.Errorf("GetMessage: expected the edit, got %+v", got)
+	}
+
+	// the edit shows up wherever the message is listed
+	msgs, err := d.ListMessages(recipient.ID, time.Time{}, time.Time{}, 0, db.OldestFirst)
+	expectOK(t, "ListMessages", err)
+	if len(msgs) != 1 || msgs[0].Content != "hello" {
+		t.Errorf("ListMessages: expected the edit, got %+v", msgs)
+	}
+
+	convo, err := d.GetConversation(sender.ID, recipient.ID, time.Time{}, time.Time{})
+	expectOK(t, "GetConversation", err)
+	if len(convo.Messages) != 1 || convo.Messages[0].Content != "hello" {
+		t.Errorf("GetConversation: expected the edit, got %+v", convo.Messages)
+	}
+
+	// group and channel messages can be edited too
+	group, err := d.CreateGroup(sender.ID, "group", []string{recipient.ID})
+	expectOK(t, "CreateGroup", err)
+
+	groupMsg, err := d.CreateMessage(&models.Message{Sender: sender.ID, GroupID: group.ID, Content: "helo"})
+	expectOK(t, "CreateMessage(group)", err)
+
+	_, err = d.EditMessage(groupMsg.ID, sender.ID, "hello")
+	expectOK(t, "EditMessage(group)", err)
+
+	msgs, err = d.ListGroupMessages(group.ID, time.Time{}, time.Time{}, 0)
+	expectOK(t, "ListGroupMessages", err)
+	if len(msgs) != 1 || msgs[0].Content != "hello" || msgs[0].EditedAt == nil {
+		t.Errorf("ListGroupMessages: expected the edit, got %+v", msgs)
+	}
+
+	guild, err := d.CreateGuild(sender.ID, "guild")
+	expectOK(t, "CreateGuild", err)
+
+	channelMsg, err := d.CreateMessage(&models.Message{Sender: sender.ID, ChannelID: guild.Channels[0].ID, Content: "helo"})
+	expectOK(t, "CreateMessage(channel)", err)
+
+	_, err = d.EditMessage(channelMsg.ID, sender.ID, "hello")
+	expectOK(t, "EditMessage(channel)", err)
+
+	msgs, err = d.ListChannelMessages(guild.Channels[0].ID, time.Time{}, time.Time{}, 0)
+	expectOK(t, "ListChannelMessages", err)
+	if len(msgs) != 1 || msgs[0].Content != "hello" || msgs[0].EditedAt == nil {
+		t.Errorf("ListChannelMessages: expected the edit, got %+v", msgs)
+	}
+
+	// deleted users can't edit what they sent
+	expectOK(t, "DeleteUser", d.DeleteUser(sender.ID))
+	_, err = d.EditMessage(msg.ID, sender.ID, "goodbye")
+	expectErr(t, "EditMessage(deleted sender)", err, constants.ErrForbidden)
+}
+
+func testListRevisions(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	recipient := newUser(t, d, "recipient")
+
+	msg := newMessage(t, d, sender.ID, recipient.ID, "first")
+
+	_, err := d.ListRevisions("")
+	expectErr(t, "ListRevisions(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.ListRevisions(unknownID)
+	expectErr(t, "ListRevisions(unknown)", err, constants.ErrNotFound)
+
+	revisions, err := d.ListRevisions(msg.ID)
+	expectOK(t, "ListRevisions(unedited)", err)
+	if len(revisions) != 0 {
+		t.Errorf("ListRevisions(unedited): expected none, got %+v", revisions)
+	}
+
+	time.Sleep(time.Millisecond)
+	second, err := d.EditMessage(msg.ID, sender.ID, "second")
+	expectOK(t, "EditMessage(second)", err)
+
+	time.Sleep(time.Millisecond)
+	_, err = d.EditMessage(msg.ID, sender.ID, "third")
+	expectOK(t, "EditMessage(third)", err)
+
+	// each revision is dated when its content was written
+	revisions, err = d.ListRevisions(msg.ID)
+	expectOK(t, "ListRevisions", err)
+	if len(revisions) != 2 {
+		t.Fatalf("ListRevisions: expected 2 revisions, got %+v", revisions)
+	}
+
+	if revisions[0].MessageID != msg.ID || revisions[0].Content != "first" || !revisions[0].Date.Equal(*msg.Date) {
+		t.Errorf("ListRevisions: expected first written at %v, got %+v", msg.Date, revisions[0])
+	}
+
+	if revisions[1].Content != "second" || !revisions[1].Date.Equal(*second.EditedAt) {
+		t.Errorf("ListRevisions: expected second written at %v, got %+v", second.EditedAt, revisions[1])
+	}
+
+	got, err := d.GetMessage(msg.ID)
+	expectOK(t, "GetMessage", err)
+	if got.Content != "third" {
+		t.Errorf("GetMessage: expected the latest edit, got %s", got.Content)
+	}
+}
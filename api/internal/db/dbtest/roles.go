@@ -0,0 +1,229 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testRoles(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "owner")
+
+	guild, err := d.CreateGuild(owner.ID, "guild")
+	expectOK(t, "CreateGuild", err)
+
+	_, err = d.CreateRole("", "helper", models.PermSend)
+	expectErr(t, "CreateRole(no guild)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateRole(guild.ID, "", models.PermSend)
+	expectErr(t, "CreateRole(no name)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateRole(guild.ID, "helper", models.PermAll+1)
+	expectErr(t, "CreateRole(unknown permission)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateRole(unknownID, "helper", models.PermSend)
+	expectErr(t, "CreateRole(unknown guild)", err, constants.ErrNotFound)
+
+	// the default roles can't be redefined
+	for name := range models.DefaultRoles {
+		_, err = d.CreateRole(guild.ID, name, models.PermSend)
+		expectErr(t, "CreateRole("+name+")", err, constants.ErrBadRequest)
+	}
+
+	role, err := d.CreateRole(guild.ID, "helper", models.PermSend|models.PermManageChannels)
+	expectOK(t, "CreateRole", err)
+	if role.GuildID != guild.ID || role.Name != "helper" || role.Permissions != models.PermSend|models.PermManageChannels {
+		t.Errorf("CreateRole: unexpected role %+v", role)
+	}
+
+	_, err = d.CreateRole(guild.ID, "helper", models.PermSend)
+	expectErr(t, "CreateRole(duplicate)", err, constants.ErrBadRequest)
+
+	// a role without any permissions is allowed, ie: to mute someone
+	_, err = d.CreateRole(guild.ID, "muted", 0)
+	expectOK(t, "CreateRole(muted)", err)
+
+	// names only need to be unique within a guild
+	other, err := d.CreateGuild(owner.ID, "other")
+	expectOK(t, "CreateGuild(other)", err)
+
+	_, err = d.CreateRole(other.ID, "helper", models.PermSend)
+	expectOK(t, "CreateRole(other guild)", err)
+
+	_, err = d.GetRole(guild.ID, "")
+	expectErr(t, "GetRole(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.GetRole(guild.ID, "unknown")
+	expectErr(t, "GetRole(unknown)", err, constants.ErrNotFound)
+
+	got, err := d.GetRole(guild.ID, "helper")
+	expectOK(t, "GetRole", err)
+	if *got != *role {
+		t.Errorf("GetRole: expected %+v, got %+v", role, got)
+	}
+
+	_, err = d.ListRoles("")
+	expectErr(t, "ListRoles(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.ListRoles(unknownID)
+	expectErr(t, "ListRoles(unknown)", err, constants.ErrNotFound)
+
+	roles, err := d.ListRoles(guild.ID)
+	expectOK(t, "ListRoles", err)
+	if len(roles) != 2 || roles[0].Name != "helper" || roles[1].Name != "muted" || roles[1].Permissions != 0 {
+		t.Errorf("ListRoles: expected [helper muted], got %+v", roles)
+	}
+}
+
+func testSetRole(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "owner")
+	member := newUser(t, d, "member")
+	outsider := newUser(t, d, "outsider")
+
+	guild, err := d.CreateGuild(owner.ID, "guild")
+	expectOK(t, "CreateGuild", err)
+
+	_, err = d.JoinGuild(guild.ID, member.ID)
+	expectOK(t, "JoinGuild", err)
+
+	_, err = d.CreateRole(guild.ID, "helper", models.PermSend)
+	expectOK(t, "CreateRole", err)
+
+	_, err = d.SetRole("", member.ID, models.RoleAdmin)
+	expectErr(t, "SetRole(no guild)", err, constants.ErrBadRequest)
+
+	_, err = d.SetRole(guild.ID, member.ID, "")
+	expectErr(t, "SetRole(no role)", err, constants.ErrBadRequest)
+
+	_, err = d.SetRole(guild.ID, outsider.ID, models.RoleAdmin)
+	expectErr(t, "SetRole(not in)", err, constants.ErrNotFound)
+
+	_, err = d.SetRole(guild.ID, member.ID, "unknown")
+	expectErr(t, "SetRole(unknown role)", err, constants.ErrNotFound)
+
+	// there is only ever one owner, and they keep the role
+	_, err = d.SetRole(guild.ID, member.ID, models.RoleOwner)
+	expectErr(t, "SetRole(owner)", err, constants.ErrBadRequest)
+
+	_, err = d.SetRole(guild.ID, owner.ID, models.RoleAdmin)
+	expectErr(t, "SetRole(of owner)", err, constants.ErrBadRequest)
+
+	updated, err := d.SetRole(guild.ID, member.ID, models.RoleModerator)
+	expectOK(t, "SetRole(default)", err)
+	if updated.GuildID != guild.ID || updated.UserID != member.ID || updated.Role != models.RoleModerator {
+		t.Errorf("SetRole(default): unexpected member %+v", updated)
+	}
+
+	_, err = d.SetRole(guild.ID, member.ID, "helper")
+	expectOK(t, "SetRole(custom)", err)
+
+	got, err := d.GetMember(guild.ID, member.ID)
+	expectOK(t, "GetMember", err)
+	if got.Role != "helper" {
+		t.Errorf("GetMember: expected role helper, got %s", got.Role)
+	}
+
+	// custom roles belong to a single guild
+	other, err := d.CreateGuild(owner.ID, "other")
+	expectOK(t, "CreateGuild(other)", err)
+
+	_, err = d.JoinGuild(other.ID, member.ID)
+	expectOK(t, "JoinGuild(other)", err)
+
+	_, err = d.SetRole(other.ID, member.ID, "helper")
+	expectErr(t, "SetRole(other guild's role)", err, constants.ErrNotFound)
+}
+
+func testMuteMember(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "owner")
+	member := newUser(t, d, "member")
+	outsider := newUser(t, d, "outsider")
+
+	guild, err := d.CreateGuild(owner.ID, "guild")
+	expectOK(t, "CreateGuild", err)
+
+	_, err = d.JoinGuild(guild.ID, member.ID)
+	expectOK(t, "JoinGuild", err)
+
+	until := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+
+	_, err = d.MuteMember("", member.ID, until)
+	expectErr(t, "MuteMember(no guild)", err, constants.ErrBadRequest)
+
+	_, err = d.MuteMember(guild.ID, outsider.ID, until)
+	expectErr(t, "MuteMember(not in)", err, constants.ErrNotFound)
+
+	muted, err := d.MuteMember(guild.ID, member.ID, until)
+	expectOK(t, "MuteMember", err)
+	if muted.MutedUntil == nil || !muted.MutedUntil.Equal(until) || muted.Role != models.RoleMember {
+		t.Errorf("MuteMember: expected a member muted until %v, got %+v", until, muted)
+	}
+
+	// muting again moves the mute
+	later := until.Add(time.Hour)
+	_, err = d.MuteMember(guild.ID, member.ID, later)
+	expectOK(t, "MuteMember(again)", err)
+
+	members, err := d.ListMembers(guild.ID)
+	expectOK(t, "ListMembers", err)
+	for _, m := range members {
+		switch m.UserID {
+		case member.ID:
+			if m.MutedUntil == nil || !m.MutedUntil.Equal(later) {
+				t.Errorf("ListMembers: expected member muted until %v, got %v", later, m.MutedUntil)
+			}
+		case owner.ID:
+			if m.MutedUntil != nil {
+				t.Errorf("ListMembers: expected owner not muted, got %v", m.MutedUntil)
+			}
+		}
+	}
+
+	// the mute outlasts leaving and rejoining
+	expectOK(t, "LeaveGuild", d.LeaveGuild(guild.ID, member.ID))
+
+	rejoined, err := d.JoinGuild(guild.ID, member.ID)
+	expectOK(t, "JoinGuild(again)", err)
+	if rejoined.MutedUntil == nil || !rejoined.MutedUntil.Equal(later) {
+		t.Errorf("JoinGuild(again): expected member muted until %v, got %v", later, rejoined.MutedUntil)
+	}
+
+	// and survives a change of role
+	updated, err := d.SetRole(guild.ID, member.ID, models.RoleModerator)
+	expectOK(t, "SetRole", err)
+	if updated.MutedUntil == nil {
+		t.Error("SetRole: expected member still muted")
+	}
+
+	// a zero time lifts it
+	unmuted, err := d.MuteMember(guild.ID, member.ID, time.Time{})
+	expectOK(t, "MuteMember(zero)", err)
+	if unmuted.MutedUntil != nil {
+		t.Errorf("MuteMember(zero): expected no mute, got %v", unmuted.MutedUntil)
+	}
+
+	got, err := d.GetMember(guild.ID, member.ID)
+	expectOK(t, "GetMember", err)
+	if got.MutedUntil != nil {
+		t.Errorf("GetMember: expected no mute, got %v", got.MutedUntil)
+	}
+
+	// mutes belong to a single guild
+	other, err := d.CreateGuild(owner.ID, "other")
+	expectOK(t, "CreateGuild(other)", err)
+
+	_, err = d.JoinGuild(other.ID, member.ID)
+	expectOK(t, "JoinGuild(other)", err)
+
+	_, err = d.MuteMember(guild.ID, member.ID, until)
+	expectOK(t, "MuteMember(first guild)", err)
+
+	got, err = d.GetMember(other.ID, member.ID)
+	expectOK(t, "GetMember(other)", err)
+	if got.MutedUntil != nil {
+		t.Errorf("GetMember(other): expected no mute, got %v", got.MutedUntil)
+	}
+}
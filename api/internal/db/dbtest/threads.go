@@ -0,0 +1,145 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testReplies(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	recipient := newUser(t, d, "recipient")
+
+	parent := newMessage(t, d, sender.ID, recipient.ID, "parent")
+	if parent.ReplyCount != 0 || parent.LastReplyAt != nil {
+		t.Errorf("CreateMessage: expected no replies, got %d at %v", parent.ReplyCount, parent.LastReplyAt)
+	}
+
+	_, err := d.ListReplies("", time.Time{}, time.Time{}, 0)
+	expectErr(t, "ListReplies(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.ListReplies(unknownID, time.Time{}, time.Time{}, 0)
+	expectErr(t, "ListReplies(unknown)", err, constants.ErrNotFound)
+
+	replies, err := d.ListReplies(parent.ID, time.Time{}, time.Time{}, 0)
+	expectOK(t, "ListReplies(none)", err)
+	if len(replies) != 0 {
+		t.Errorf("ListReplies(none): expected none, got %v", ids(replies))
+	}
+
+	_, err = d.CreateMessage(&models.Message{Sender: sender.ID, Recipient: recipient.ID, ParentID: unknownID, Content: "reply"})
+	expectErr(t, "CreateMessage(unknown parent)", err, constants.ErrNotFound)
+
+	// either side of the conversation can reply, and the counts on the reply itself are ignored
+	first, err := d.CreateMessage(&models.Message{Sender: recipient.ID, Recipient: sender.ID, ParentID: parent.ID, Content: "first", ReplyCount: 5})
+	expectOK(t, "CreateMessage(reply)", err)
+	if first.ParentID != parent.ID || first.ReplyCount != 0 {
+		t.Errorf("CreateMessage(reply): unexpected reply %+v", first)
+	}
+
+	time.Sleep(time.Millisecond)
+	second, err := d.CreateMessage(&models.Message{Sender: sender.ID, Recipient: recipient.ID, ParentID: parent.ID, Content: "second"})
+	expectOK(t, "CreateMessage(second reply)", err)
+
+	// threads are only one level deep
+	_, err = d.CreateMessage(&models.Message{Sender: sender.ID, Recipient: recipient.ID, ParentID: first.ID, Content: "nested"})
+	expectErr(t, "CreateMessage(reply to a reply)", err, constants.ErrBadRequest)
+
+	got, err := d.GetMessage(parent.ID)
+	expectOK(t, "GetMessage(parent)", err)
+	if got.ReplyCount != 2 || got.LastReplyAt == nil || !got.LastReplyAt.Equal(*second.Date) {
+		t.Errorf("GetMessage(parent): expected 2 replies, the last at %v, got %d at %v", second.Date, got.ReplyCount, got.LastReplyAt)
+	}
+
+	replies, err = d.ListReplies(parent.ID, time.Time{}, time.Time{}, 0)
+	expectOK(t, "ListReplies", err)
+	if len(replies) != 2 || replies[0].ID != first.ID || replies[1].ID != second.ID {
+		t.Errorf("ListReplies: expected [%s %s], got %v", first.ID, second.ID, ids(replies))
+	}
+
+	replies, err = d.ListReplies(parent.ID, time.Time{}, time.Time{}, 1)
+	expectOK(t, "ListReplies(limit)", err)
+	if len(replies) != 1 || replies[0].ID != second.ID {
+		t.Errorf("ListReplies(limit): expected the latest reply %s, got %v", second.ID, ids(replies))
+	}
+
+	replies, err = d.ListReplies(parent.ID, *second.Date, time.Time{}, 0)
+	expectOK(t, "ListReplies(from)", err)
+	if len(replies) != 1 || replies[0].ID != second.ID {
+		t.Errorf("ListReplies(from): expected %s, got %v", second.ID, ids(replies))
+	}
+
+	// replies stay in the conversation, and the parent's counts show up wherever it is listed
+	convo, err := d.GetConversation(sender.ID, recipient.ID, time.Time{}, time.Time{})
+	expectOK(t, "GetConversation", err)
+	if len(convo.Messages) != 3 || convo.Messages[0].ReplyCount != 2 || convo.Messages[1].ParentID != parent.ID {
+		t.Errorf("GetConversation: expected the parent and both replies, got %+v", convo.Messages)
+	}
+
+	// edits and deletes keep the counts
+	_, err = d.EditMessage(parent.ID, sender.ID, "edited")
+	expectOK(t, "EditMessage(parent)", err)
+
+	_, err = d.DeleteMessage(first.ID)
+	expectOK(t, "DeleteMessage(reply)", err)
+
+	got, err = d.GetMessage(parent.ID)
+	expectOK(t, "GetMessage(edited parent)", err)
+	if got.ReplyCount != 2 {
+		t.Errorf("GetMessage(edited parent): expected 2 replies, got %d", got.ReplyCount)
+	}
+}
+
+func testThreadPlacement(t *testing.T, d db.Driver) {
+	sender := newUser(t, d, "sender")
+	recipient := newUser(t, d, "recipient")
+	other := newUser(t, d, "other")
+
+	direct := newMessage(t, d, sender.ID, recipient.ID, "direct")
+
+	// replies go to the same conversation, group or channel as their parent
+	_, err := d.CreateMessage(&models.Message{Sender: sender.ID, Recipient: other.ID, ParentID: direct.ID, Content: "elsewhere"})
+	expectErr(t, "CreateMessage(other conversation)", err, constants.ErrBadRequest)
+
+	group, err := d.CreateGroup(sender.ID, "group", []string{recipient.ID})
+	expectOK(t, "CreateGroup", err)
+
+	_, err = d.CreateMessage(&models.Message{Sender: sender.ID, GroupID: group.ID, ParentID: direct.ID, Content: "elsewhere"})
+	expectErr(t, "CreateMessage(group reply to direct)", err, constants.ErrBadRequest)
+
+	groupMsg, err := d.CreateMessage(&models.Message{Sender: sender.ID, GroupID: group.ID, Content: "group"})
+	expectOK(t, "CreateMessage(group)", err)
+
+	groupReply, err := d.CreateMessage(&models.Message{Sender: recipient.ID, GroupID: group.ID, ParentID: groupMsg.ID, Content: "reply"})
+	expectOK(t, "CreateMessage(group reply)", err)
+
+	replies, err := d.ListReplies(groupMsg.ID, time.Time{}, time.Time{}, 0)
+	expectOK(t, "ListReplies(group)", err)
+	if len(replies) != 1 || replies[0].ID != groupReply.ID || replies[0].GroupID != group.ID {
+		t.Errorf("ListReplies(group): expected %s, got %+v", groupReply.ID, replies)
+	}
+
+	guild, err := d.CreateGuild(sender.ID, "guild")
+	expectOK(t, "CreateGuild", err)
+
+	channel, err := d.CreateChannel(guild.ID, "other")
+	expectOK(t, "CreateChannel", err)
+
+	channelMsg, err := d.CreateMessage(&models.Message{Sender: sender.ID, ChannelID: guild.Channels[0].ID, Content: "channel"})
+	expectOK(t, "CreateMessage(channel)", err)
+
+	_, err = d.CreateMessage(&models.Message{Sender: sender.ID, ChannelID: channel.ID, ParentID: channelMsg.ID, Content: "elsewhere"})
+	expectErr(t, "CreateMessage(other channel)", err, constants.ErrBadRequest)
+
+	channelReply, err := d.CreateMessage(&models.Message{Sender: sender.ID, ChannelID: guild.Channels[0].ID, ParentID: channelMsg.ID, Content: "reply"})
+	expectOK(t, "CreateMessage(channel reply)", err)
+
+	msgs, err := d.ListChannelMessages(guild.Channels[0].ID, time.Time{}, time.Time{}, 0)
+	expectOK(t, "ListChannelMessages", err)
+	if len(msgs) != 2 || msgs[0].ReplyCount != 1 || msgs[0].LastReplyAt == nil || !msgs[0].LastReplyAt.Equal(*channelReply.Date) {
+		t.Errorf("ListChannelMessages: expected the parent to count its reply, got %+v", msgs)
+	}
+}
@@ -0,0 +1,75 @@
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testCreateUser(t *testing.T, d db.Driver) {
+	_, err := d.CreateUser(nil)
+	expectErr(t, "CreateUser(nil)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateUser(&models.User{Email: "missing@example.com"})
+	expectErr(t, "CreateUser(no username)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateUser(&models.User{Username: "missing"})
+	expectErr(t, "CreateUser(no email)", err, constants.ErrBadRequest)
+
+	user, err := d.CreateUser(&models.User{Username: "alice", Email: "alice@example.com"})
+	expectOK(t, "CreateUser", err)
+
+	if user.ID == "" {
+		t.Error("CreateUser: expected an id to be generated")
+	}
+
+	// usernames are unique
+	_, err = d.CreateUser(&models.User{Username: "alice", Email: "other@example.com"})
+	expectErr(t, "CreateUser(duplicate username)", err, constants.ErrBadRequest)
+
+	// emails are not
+	_, err = d.CreateUser(&models.User{Username: "alice2", Email: "alice@example.com"})
+	expectOK(t, "CreateUser(duplicate email)", err)
+}
+
+func testGetUser(t *testing.T, d db.Driver) {
+	_, err := d.GetUser("")
+	expectErr(t, "GetUser(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.GetUser(unknownID)
+	expectErr(t, "GetUser(unknown)", err, constants.ErrNotFound)
+
+	created := newUser(t, d, "bob")
+
+	user, err := d.GetUser(created.ID)
+	expectOK(t, "GetUser", err)
+
+	if user.ID != created.ID || user.Username != created.Username || user.Email != created.Email {
+		t.Errorf("GetUser: expected %+v, got %+v", created, user)
+	}
+
+	if user.ArchivedOn != nil {
+		t.Errorf("GetUser: expected no archived time, got %v", user.ArchivedOn)
+	}
+}
+
+func testDeleteUser(t *testing.T, d db.Driver) {
+	err := d.DeleteUser("")
+	expectErr(t, "DeleteUser(empty)", err, constants.ErrBadRequest)
+
+	err = d.DeleteUser(unknownID)
+	expectErr(t, "DeleteUser(unknown)", err, constants.ErrNotFound)
+
+	user := newUser(t, d, "carol")
+	expectOK(t, "DeleteUser", d.DeleteUser(user.ID))
+
+	// soft deleted users are not found
+	_, err = d.GetUser(user.ID)
+	expectErr(t, "GetUser(deleted)", err, constants.ErrNotFound)
+
+	// their username is still taken
+	_, err = d.CreateUser(&models.User{Username: user.Username, Email: user.Email})
+	expectErr(t, "CreateUser(deleted username)", err, constants.ErrBadRequest)
+}
@@ -0,0 +1,270 @@
+package dbtest
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func testWebhooks(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "owner")
+	other := newUser(t, d, "other")
+
+	guild, err := d.CreateGuild(owner.ID, "guild")
+	expectOK(t, "CreateGuild", err)
+
+	_, err = d.CreateWebhook(&models.Webhook{URL: "http://localhost/hook", Secret: "secret"})
+	expectErr(t, "CreateWebhook(no owner)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateWebhook(&models.Webhook{Owner: owner.ID, Secret: "secret"})
+	expectErr(t, "CreateWebhook(no url)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateWebhook(&models.Webhook{Owner: owner.ID, URL: "http://localhost/hook"})
+	expectErr(t, "CreateWebhook(no secret)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateWebhook(&models.Webhook{Owner: unknownID, URL: "http://localhost/hook", Secret: "secret"})
+	expectErr(t, "CreateWebhook(unknown owner)", err, constants.ErrNotFound)
+
+	_, err = d.CreateWebhook(&models.Webhook{Owner: owner.ID, GuildID: unknownID, URL: "http://localhost/hook", Secret: "secret"})
+	expectErr(t, "CreateWebhook(unknown guild)", err, constants.ErrNotFound)
+
+	personal, err := d.CreateWebhook(&models.Webhook{Owner: owner.ID, URL: "http://localhost/personal", Events: []string{"message.created", "user.archived"}, Secret: "one"})
+	expectOK(t, "CreateWebhook", err)
+	if personal.ID == "" || personal.Created == nil || personal.Owner != owner.ID || personal.GuildID != "" {
+		t.Errorf("CreateWebhook: expected a personal webhook with an id and created date, got %+v", personal)
+	}
+
+	guildHook, err := d.CreateWebhook(&models.Webhook{Owner: owner.ID, GuildID: guild.ID, URL: "http://localhost/guild", Secret: "two"})
+	expectOK(t, "CreateWebhook(guild)", err)
+
+	_, err = d.CreateWebhook(&models.Webhook{Owner: other.ID, URL: "http://localhost/other", Secret: "three"})
+	expectOK(t, "CreateWebhook(other)", err)
+
+	_, err = d.GetWebhook("")
+	expectErr(t, "GetWebhook(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.GetWebhook(unknownID)
+	expectErr(t, "GetWebhook(unknown)", err, constants.ErrNotFound)
+
+	got, err := d.GetWebhook(personal.ID)
+	expectOK(t, "GetWebhook", err)
+	if got.URL != personal.URL || got.Secret != "one" || !reflect.DeepEqual(got.Events, personal.Events) || !got.Created.Equal(*personal.Created) {
+		t.Errorf("GetWebhook: expected %+v, got %+v", personal, got)
+	}
+
+	// no filter is every event
+	got, err = d.GetWebhook(guildHook.ID)
+	expectOK(t, "GetWebhook(guild)", err)
+	if len(got.Events) != 0 || got.GuildID != guild.ID || !got.Wants("message.deleted") {
+		t.Errorf("GetWebhook(guild): expected a guild webhook wanting every event, got %+v", got)
+	}
+
+	_, err = d.ListWebhooks("", "")
+	expectErr(t, "ListWebhooks(empty)", err, constants.ErrBadRequest)
+
+	// a user's own webhooks leave out the guild's, even those they registered
+	hooks, err := d.ListWebhooks(owner.ID, "")
+	expectOK(t, "ListWebhooks(owner)", err)
+	expectWebhooks(t, "ListWebhooks(owner)", hooks, personal.ID)
+
+	hooks, err = d.ListWebhooks("", guild.ID)
+	expectOK(t, "ListWebhooks(guild)", err)
+	expectWebhooks(t, "ListWebhooks(guild)", hooks, guildHook.ID)
+
+	second, err := d.CreateWebhook(&models.Webhook{Owner: owner.ID, URL: "http://localhost/second", Secret: "four"})
+	expectOK(t, "CreateWebhook(second)", err)
+
+	hooks, err = d.ListWebhooks(owner.ID, "")
+	expectOK(t, "ListWebhooks(owner)", err)
+	expectWebhooks(t, "ListWebhooks(owner)", hooks, personal.ID, second.ID)
+
+	expectErr(t, "DeleteWebhook(empty)", d.DeleteWebhook(""), constants.ErrBadRequest)
+	expectErr(t, "DeleteWebhook(unknown)", d.DeleteWebhook(unknownID), constants.ErrNotFound)
+	expectOK(t, "DeleteWebhook", d.DeleteWebhook(personal.ID))
+	expectErr(t, "DeleteWebhook(again)", d.DeleteWebhook(personal.ID), constants.ErrNotFound)
+
+	_, err = d.GetWebhook(personal.ID)
+	expectErr(t, "GetWebhook(deleted)", err, constants.ErrNotFound)
+
+	hooks, err = d.ListWebhooks(owner.ID, "")
+	expectOK(t, "ListWebhooks(owner)", err)
+	expectWebhooks(t, "ListWebhooks(owner)", hooks, second.ID)
+
+	// deleted users can't register webhooks
+	expectOK(t, "DeleteUser", d.DeleteUser(other.ID))
+	_, err = d.CreateWebhook(&models.Webhook{Owner: other.ID, URL: "http://localhost/other", Secret: "five"})
+	expectErr(t, "CreateWebhook(deleted owner)", err, constants.ErrNotFound)
+}
+
+func testDeliveries(t *testing.T, d db.Driver) {
+	owner := newUser(t, d, "owner")
+
+	hook, err := d.CreateWebhook(&models.Webhook{Owner: owner.ID, URL: "http://localhost/hook", Secret: "secret"})
+	expectOK(t, "CreateWebhook", err)
+
+	other, err := d.CreateWebhook(&models.Webhook{Owner: owner.ID, URL: "http://localhost/other", Secret: "secret"})
+	expectOK(t, "CreateWebhook(other)", err)
+
+	payload := json.RawMessage(`{"type":"message.created"}`)
+
+	_, err = d.CreateDelivery(&models.Delivery{Event: "message.created", Payload: payload})
+	expectErr(t, "CreateDelivery(no webhook)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateDelivery(&models.Delivery{WebhookID: hook.ID, Payload: payload})
+	expectErr(t, "CreateDelivery(no event)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateDelivery(&models.Delivery{WebhookID: hook.ID, Event: "message.created"})
+	expectErr(t, "CreateDelivery(no payload)", err, constants.ErrBadRequest)
+
+	_, err = d.CreateDelivery(&models.Delivery{WebhookID: unknownID, Event: "message.created", Payload: payload})
+	expectErr(t, "CreateDelivery(unknown webhook)", err, constants.ErrNotFound)
+
+	next := time.Now()
+	first, err := d.CreateDelivery(&models.Delivery{WebhookID: hook.ID, Event: "message.created", Payload: payload, NextAttempt: &next, Status: models.DeliveryDelivered, Attempts: 3})
+	expectOK(t, "CreateDelivery", err)
+	if first.ID == "" || first.Created == nil || first.Status != models.DeliveryPending || first.Attempts != 0 || first.NextAttempt == nil {
+		t.Errorf("CreateDelivery: expected a pending delivery with no attempts, got %+v", first)
+	}
+
+	second, err := d.CreateDelivery(&models.Delivery{WebhookID: hook.ID, Event: "message.deleted", Payload: payload})
+	expectOK(t, "CreateDelivery(second)", err)
+
+	elsewhere, err := d.CreateDelivery(&models.Delivery{WebhookID: other.ID, Event: "message.created", Payload: payload})
+	expectOK(t, "CreateDelivery(other)", err)
+
+	_, err = d.GetDelivery("")
+	expectErr(t, "GetDelivery(empty)", err, constants.ErrBadRequest)
+
+	_, err = d.GetDelivery(unknownID)
+	expectErr(t, "GetDelivery(unknown)", err, constants.ErrNotFound)
+
+	got, err := d.GetDelivery(first.ID)
+	expectOK(t, "GetDelivery", err)
+	if got.WebhookID != hook.ID || got.Event != "message.created" || string(got.Payload) != string(payload) || got.Status != models.DeliveryPending {
+		t.Errorf("GetDelivery: expected %+v, got %+v", first, got)
+	}
+
+	_, err = d.UpdateDelivery(&models.Delivery{Status: models.DeliveryFailed})
+	expectErr(t, "UpdateDelivery(no id)", err, constants.ErrBadRequest)
+
+	_, err = d.UpdateDelivery(&models.Delivery{ID: first.ID, Status: "lost"})
+	expectErr(t, "UpdateDelivery(invalid status)", err, constants.ErrBadRequest)
+
+	_, err = d.UpdateDelivery(&models.Delivery{ID: first.ID, Status: models.DeliveryPending, Attempts: -1})
+	expectErr(t, "UpdateDelivery(negative attempts)", err, constants.ErrBadRequest)
+
+	_, err = d.UpdateDelivery(&models.Delivery{ID: unknownID, Status: models.DeliveryFailed})
+	expectErr(t, "UpdateDelivery(unknown)", err, constants.ErrNotFound)
+
+	// a failed attempt, to be retried
+	attempted := time.Now()
+	retry := attempted.Add(time.Minute)
+	update := *first
+	update.Attempts = 1
+	update.StatusCode = 500
+	update.Error = "unexpected status 500"
+	update.LastAttempt = &attempted
+	update.NextAttempt = &retry
+	update.Event = "user.archived"
+
+	updated, err := d.UpdateDelivery(&update)
+	expectOK(t, "UpdateDelivery", err)
+	if updated.Status != models.DeliveryPending || updated.Attempts != 1 || updated.StatusCode != 500 || updated.Error != update.Error ||
+		updated.LastAttempt == nil || updated.NextAttempt == nil || !updated.NextAttempt.Equal(retry) {
+		t.Errorf("UpdateDelivery: expected %+v, got %+v", update, updated)
+	}
+
+	// the event and payload stay as they were created
+	if updated.Event != "message.created" || string(updated.Payload) != string(payload) {
+		t.Errorf("UpdateDelivery: expected the event and payload to be unchanged, got %+v", updated)
+	}
+
+	// out of attempts
+	update = *updated
+	update.Status = models.DeliveryFailed
+	update.Attempts = 2
+	update.NextAttempt = nil
+
+	failed, err := d.UpdateDelivery(&update)
+	expectOK(t, "UpdateDelivery(failed)", err)
+	if failed.Status != models.DeliveryFailed || failed.NextAttempt != nil {
+		t.Errorf("UpdateDelivery(failed): expected a failed delivery with no next attempt, got %+v", failed)
+	}
+
+	got, err = d.GetDelivery(first.ID)
+	expectOK(t, "GetDelivery(failed)", err)
+	if got.Status != models.DeliveryFailed || got.Attempts != 2 || got.StatusCode != 500 || got.NextAttempt != nil || got.LastAttempt == nil {
+		t.Errorf("GetDelivery(failed): expected %+v, got %+v", failed, got)
+	}
+
+	_, err = d.ListDeliveries(hook.ID, "lost", 0)
+	expectErr(t, "ListDeliveries(invalid status)", err, constants.ErrBadRequest)
+
+	_, err = d.ListDeliveries(hook.ID, "", -1)
+	expectErr(t, "ListDeliveries(negative limit)", err, constants.ErrBadRequest)
+
+	_, err = d.ListDeliveries(unknownID, "", 0)
+	expectErr(t, "ListDeliveries(unknown webhook)", err, constants.ErrNotFound)
+
+	// newest first
+	deliveries, err := d.ListDeliveries(hook.ID, "", 0)
+	expectOK(t, "ListDeliveries", err)
+	expectDeliveries(t, "ListDeliveries", deliveries, second.ID, first.ID)
+
+	deliveries, err = d.ListDeliveries(hook.ID, "", 1)
+	expectOK(t, "ListDeliveries(limit)", err)
+	expectDeliveries(t, "ListDeliveries(limit)", deliveries, second.ID)
+
+	// the dead-letter list
+	deliveries, err = d.ListDeliveries(hook.ID, models.DeliveryFailed, 0)
+	expectOK(t, "ListDeliveries(failed)", err)
+	expectDeliveries(t, "ListDeliveries(failed)", deliveries, first.ID)
+
+	// every webhook's pending deliveries, to resume after a restart
+	deliveries, err = d.ListDeliveries("", models.DeliveryPending, 0)
+	expectOK(t, "ListDeliveries(pending)", err)
+	expectDeliveries(t, "ListDeliveries(pending)", deliveries, elsewhere.ID, second.ID)
+
+	// deleting a webhook drops its deliveries
+	expectOK(t, "DeleteWebhook", d.DeleteWebhook(hook.ID))
+
+	_, err = d.GetDelivery(first.ID)
+	expectErr(t, "GetDelivery(deleted webhook)", err, constants.ErrNotFound)
+
+	deliveries, err = d.ListDeliveries("", "", 0)
+	expectOK(t, "ListDeliveries(all)", err)
+	expectDeliveries(t, "ListDeliveries(all)", deliveries, elsewhere.ID)
+}
+
+// expectWebhooks - fails unless the webhooks are the ones wanted, in order
+func expectWebhooks(t *testing.T, call string, hooks []*models.Webhook, want ...string) {
+	t.Helper()
+
+	got := make([]string, len(hooks))
+	for i, hook := range hooks {
+		got[i] = hook.ID
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: expected webhooks %v, got %v", call, want, got)
+	}
+}
+
+// expectDeliveries - fails unless the deliveries are the ones wanted, in order
+func expectDeliveries(t *testing.T, call string, deliveries []*models.Delivery, want ...string) {
+	t.Helper()
+
+	got := make([]string, len(deliveries))
+	for i, delivery := range deliveries {
+		got[i] = delivery.ID
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: expected deliveries %v, got %v", call, want, got)
+	}
+}
@@ -0,0 +1,79 @@
+package mem
+
+import (
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// AddAttachment - records a file attached to a message, once it is in blob storage under att.ID. Only the sender
+// can attach files to a message, and messages deleted for everyone can't have files attached
+func (d *Driver) AddAttachment(uploader string, att *models.Attachment) (*models.Attachment, error) {
+	if uploader == "" || att.ID == "" || att.MessageID == "" || att.Name == "" || att.Size < 0 {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	msg, ok := d.msgs[att.MessageID]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	if msg.Sender != uploader || d.deleted(uploader) {
+		return nil, constants.ErrForbidden
+	}
+
+	if msg.DeletedAt != nil || d.attachment(att.MessageID, att.ID) != nil {
+		return nil, constants.ErrBadRequest
+	}
+
+	now := time.Now()
+	att.Date = &now
+
+	if err := d.commit(&record{Op: opAddAttachment, Attachment: att}); err != nil {
+		return nil, err
+	}
+
+	return att, nil
+}
+
+// GetAttachment - gets a file attached to a message
+func (d *Driver) GetAttachment(messageID, id string) (*models.Attachment, error) {
+	if messageID == "" || id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	att := d.attachment(messageID, id)
+	if att == nil {
+		return nil, constants.ErrNotFound
+	}
+
+	return att, nil
+}
+
+// attachment - a file attached to a message, nil if there isn't one with that id. Must hold the read lock
+func (d *Driver) attachment(messageID, id string) *models.Attachment {
+	for _, att := range d.files[messageID] {
+		if att.ID == id {
+			return att
+		}
+	}
+	return nil
+}
+
+// applyAttachment - adds an attachment to its message, unless it is already there or the message has since been
+// deleted. Must hold the write lock
+func (d *Driver) applyAttachment(att *models.Attachment) {
+	msg, ok := d.msgs[att.MessageID]
+	if !ok || msg.DeletedAt != nil || d.attachment(att.MessageID, att.ID) != nil {
+		return
+	}
+
+	d.files[att.MessageID] = append(d.files[att.MessageID], att)
+}
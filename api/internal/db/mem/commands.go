@@ -0,0 +1,127 @@
+package mem
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// CreateCommand - registers a slash command for an active bot. Names are unique for each bot, but different bots can
+// register the same name
+func (d *Driver) CreateCommand(cmd *models.Command) (*models.Command, error) {
+	if !validCommand(cmd) {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	bot, ok := d.users[cmd.BotID]
+	if !ok || d.deleted(cmd.BotID) {
+		return nil, constants.ErrNotFound
+	}
+
+	if !bot.Bot {
+		return nil, constants.ErrBadRequest
+	}
+
+	for _, existing := range d.commands {
+		if existing.BotID == cmd.BotID && existing.Name == cmd.Name {
+			return nil, constants.ErrBadRequest
+		}
+	}
+
+	now := time.Now()
+	created := *cmd
+	created.ID = uuid.New().String()
+	created.Created = &now
+
+	if err := d.commit(&record{Op: opCreateCommand, Command: &created}); err != nil {
+		return nil, err
+	}
+
+	copied := created
+	return &copied, nil
+}
+
+// ListCommands - lists a bot's slash commands, by name
+func (d *Driver) ListCommands(botID string) ([]*models.Command, error) {
+	if botID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	if _, ok := d.users[botID]; !ok || d.deleted(botID) {
+		return nil, constants.ErrNotFound
+	}
+
+	cmds := []*models.Command{}
+	for _, cmd := range d.commands {
+		if cmd.BotID == botID {
+			copied := *cmd
+			cmds = append(cmds, &copied)
+		}
+	}
+
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].Name < cmds[j].Name
+	})
+
+	return cmds, nil
+}
+
+// FindCommands - lists the slash commands registered under a name, by any active bot, in the order they were created
+func (d *Driver) FindCommands(name string) ([]*models.Command, error) {
+	if name == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	cmds := []*models.Command{}
+	for _, cmd := range d.commands {
+		if cmd.Name == name && !d.deleted(cmd.BotID) {
+			copied := *cmd
+			cmds = append(cmds, &copied)
+		}
+	}
+
+	sort.Slice(cmds, func(i, j int) bool {
+		if cmds[i].Created.Equal(*cmds[j].Created) {
+			return cmds[i].ID < cmds[j].ID
+		}
+		return cmds[i].Created.Before(*cmds[j].Created)
+	})
+
+	return cmds, nil
+}
+
+// DeleteCommand - removes one of a bot's slash commands
+func (d *Driver) DeleteCommand(botID, name string) error {
+	if botID == "" || name == "" {
+		return constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	for _, cmd := range d.commands {
+		if cmd.BotID == botID && cmd.Name == name {
+			return d.commit(&record{Op: opDeleteCommand, ID: cmd.ID})
+		}
+	}
+
+	return constants.ErrNotFound
+}
+
+// validCommand - whether a new slash command is complete
+func validCommand(cmd *models.Command) bool {
+	return cmd != nil && cmd.BotID != "" && cmd.Name != "" && cmd.URL != "" && cmd.Secret != "" &&
+		cmd.Permissions&^models.PermAll == 0
+}
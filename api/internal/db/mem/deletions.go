@@ -0,0 +1,75 @@
+package mem
+
+import (
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// DeleteMessage - deletes a message for everyone. It keeps its place, with its content replaced by a tombstone
+// and its revisions, reactions and attachments dropped. Deleting a message that is already deleted changes nothing
+func (d *Driver) DeleteMessage(id string) (*models.Message, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	msg, ok := d.msgs[id]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	if msg.DeletedAt == nil {
+		now := time.Now()
+		if err := d.commit(&record{Op: opDeleteMessage, ID: id, Date: &now}); err != nil {
+			return nil, err
+		}
+	}
+
+	return d.redact(d.msgs[id]), nil
+}
+
+// HideMessage - hides a message from a single user's listings, everyone else still sees it. Hiding a message twice changes nothing
+func (d *Driver) HideMessage(id, userID string) error {
+	if id == "" || userID == "" {
+		return constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if _, ok := d.msgs[id]; !ok {
+		return constants.ErrNotFound
+	}
+
+	if _, ok := d.users[userID]; !ok || d.deleted(userID) {
+		return constants.ErrNotFound
+	}
+
+	if d.hidden[userID][id] {
+		return nil
+	}
+
+	return d.commit(&record{Op: opHideMessage, ID: id, UserID: userID})
+}
+
+// applyDelete - swaps a message for a tombstoned copy everywhere it is stored, and drops its revisions, reactions and
+// attachments. Deletes already applied are skipped
+func (d *Driver) applyDelete(id string, date *time.Time) {
+	old, ok := d.msgs[id]
+	if !ok || old.DeletedAt != nil {
+		return
+	}
+
+	deleted := *old
+	deleted.Content = constants.DeletedMessage
+	deleted.DeletedAt = date
+	d.replace(old, &deleted)
+
+	delete(d.revisions, id)
+	delete(d.reactions, id)
+	delete(d.files, id)
+}
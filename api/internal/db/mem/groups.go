@@ -0,0 +1,269 @@
+package mem
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// CreateGroup - creates a group conversation owned by owner, between the owner and participants
+func (d *Driver) CreateGroup(owner, name string, participants []string) (*models.Conversation, error) {
+	ids, err := groupMembers(owner, participants)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	for _, id := range ids {
+		if _, ok := d.users[id]; !ok {
+			return nil, constants.ErrNotFound
+		}
+	}
+
+	now := time.Now()
+	group := &models.Conversation{
+		ID:           uuid.New().String(),
+		Name:         name,
+		Owner:        owner,
+		Participants: ids,
+		Updated:      &now,
+		Messages:     []*models.Message{},
+	}
+
+	if err := d.commit(&record{Op: opCreateGroup, Conversation: group}); err != nil {
+		return nil, err
+	}
+
+	return d.redactGroup(group), nil
+}
+
+// GetGroup - gets a group conversation and its participants, without its messages
+func (d *Driver) GetGroup(id string) (*models.Conversation, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	group, ok := d.groups[id]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	return d.redactGroup(group), nil
+}
+
+// ListGroups - lists the group conversations a user is a participant in, most recently updated first. Each counts
+// the messages the user hasn't read.
+// from and until times can be passed to further narrow results to groups that have been updated in the timeframe
+// if a 0 time is passed for either of these values, that filtering parameter is ignored
+func (d *Driver) ListGroups(userID string, from, until time.Time) ([]*models.Conversation, error) {
+	if userID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	// if until is 0 time, set to now
+	if until.Equal(time.Time{}) {
+		until = time.Now()
+	}
+
+	if from.After(until) {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	if _, ok := d.users[userID]; !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	groups := []*models.Conversation{}
+	for _, group := range d.groups {
+		if contains(group.Participants, userID) &&
+			(group.Updated.After(from) || group.Updated.Equal(from)) &&
+			(group.Updated.Before(until) || group.Updated.Equal(until)) {
+			redacted := d.redactGroup(group)
+			redacted.Unread, redacted.LastRead = d.unread(group.ID, userID, group.Messages)
+			groups = append(groups, redacted)
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Updated.After(*groups[j].Updated)
+	})
+
+	return groups, nil
+}
+
+// AddParticipant - adds a user to a group conversation
+func (d *Driver) AddParticipant(groupID, userID string) error {
+	if groupID == "" || userID == "" {
+		return constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	group, ok := d.groups[groupID]
+	if !ok {
+		return constants.ErrNotFound
+	}
+
+	if _, ok := d.users[userID]; !ok || d.deleted(userID) {
+		return constants.ErrNotFound
+	}
+
+	if contains(group.Participants, userID) {
+		return constants.ErrBadRequest
+	}
+
+	return d.commit(&record{Op: opAddParticipant, ID: groupID, UserID: userID})
+}
+
+// RemoveParticipant - removes a user from a group conversation, their messages stay in the group
+func (d *Driver) RemoveParticipant(groupID, userID string) error {
+	if groupID == "" || userID == "" {
+		return constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	group, ok := d.groups[groupID]
+	if !ok || !contains(group.Participants, userID) {
+		return constants.ErrNotFound
+	}
+
+	return d.commit(&record{Op: opRemoveParticipant, ID: groupID, UserID: userID})
+}
+
+// ListGroupMessages - lists the messages sent to a group conversation, oldest first
+// from and until times can be passed to further narrow results to messages sent in the timeframe
+// if a 0 time is passed for either of these values, that filtering parameter is ignored
+// if limit is 0, it is ignored, otherwise only the most recent messages, up to a count of limit, are returned
+func (d *Driver) ListGroupMessages(groupID string, from, until time.Time, limit int) ([]*models.Message, error) {
+	if groupID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	// if until is 0 time, set to now
+	if until.Equal(time.Time{}) {
+		until = time.Now()
+	}
+
+	if from.After(until) {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	group, ok := d.groups[groupID]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	// messages are appended as they are sent, so they are already oldest first
+	msgs := []*models.Message{}
+	for _, msg := range group.Messages {
+		if (msg.Date.After(from) || msg.Date.Equal(from)) &&
+			(msg.Date.Before(until) || msg.Date.Equal(until)) {
+			msgs = append(msgs, d.redact(msg))
+		}
+	}
+
+	if limit > 0 && len(msgs) > limit {
+		msgs = msgs[len(msgs)-limit:]
+	}
+
+	return msgs, nil
+}
+
+// createGroupMessage - creates a new message in a group conversation, only participants can send them
+func (d *Driver) createGroupMessage(msg *models.Message) (*models.Message, error) {
+	if msg.Sender == "" || msg.Content == "" || msg.Recipient != "" || msg.ChannelID != "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	group, ok := d.groups[msg.GroupID]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	if !contains(group.Participants, msg.Sender) || d.deleted(msg.Sender) {
+		return nil, constants.ErrForbidden
+	}
+
+	if err := d.checkParent(msg); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	msg.Date = &now
+	msg.ID = uuid.New().String()
+
+	if err := d.commit(&record{Op: opCreateMessage, Message: msg}); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// redactGroup - copies a group conversation without its messages. Deleted users are left out of the
+// participants, and a deleted owner is replaced. Must hold the read lock
+func (d *Driver) redactGroup(group *models.Conversation) *models.Conversation {
+	redacted := *group
+	redacted.Messages = nil
+
+	if d.deleted(group.Owner) {
+		redacted.Owner = constants.DeletedUser
+	}
+
+	redacted.Participants = []string{}
+	for _, id := range group.Participants {
+		if !d.deleted(id) {
+			redacted.Participants = append(redacted.Participants, id)
+		}
+	}
+
+	return &redacted
+}
+
+// groupMembers - the owner and participants of a new group, without duplicates
+func groupMembers(owner string, participants []string) ([]string, error) {
+	if owner == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	ids := []string{owner}
+	for _, id := range participants {
+		if id == "" {
+			return nil, constants.ErrBadRequest
+		}
+		if !contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// contains - whether a list of ids includes id
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,368 @@
+package mem
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// CreateGuild - creates a guild owned by owner, with the default channel. The owner is its first member
+func (d *Driver) CreateGuild(owner, name string) (*models.Guild, error) {
+	if owner == "" || name == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if _, ok := d.users[owner]; !ok || d.deleted(owner) {
+		return nil, constants.ErrNotFound
+	}
+
+	now := time.Now()
+	guild := &models.Guild{
+		ID:      uuid.New().String(),
+		Name:    name,
+		Owner:   owner,
+		Created: &now,
+		Updated: &now,
+	}
+
+	guild.Channels = []*models.Channel{newChannel(guild.ID, models.DefaultChannel, now)}
+
+	if err := d.commit(&record{Op: opCreateGuild, Guild: guild}); err != nil {
+		return nil, err
+	}
+
+	return d.copyGuild(guild), nil
+}
+
+// newChannel - builds an empty channel in a guild
+func newChannel(guildID, name string, now time.Time) *models.Channel {
+	return &models.Channel{
+		ID:       uuid.New().String(),
+		GuildID:  guildID,
+		Name:     name,
+		Updated:  &now,
+		Messages: []*models.Message{},
+	}
+}
+
+// GetGuild - gets a guild and its channels
+func (d *Driver) GetGuild(id string) (*models.Guild, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	guild, ok := d.guilds[id]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	return d.copyGuild(guild), nil
+}
+
+// ListGuilds - lists the guilds a user is a member of, most recently updated first.
+// from and until times can be passed to further narrow results to guilds that have been updated in the timeframe
+// if a 0 time is passed for either of these values, that filtering parameter is ignored
+func (d *Driver) ListGuilds(userID string, from, until time.Time) ([]*models.Guild, error) {
+	if userID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	// if until is 0 time, set to now
+	if until.Equal(time.Time{}) {
+		until = time.Now()
+	}
+
+	if from.After(until) {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	if _, ok := d.users[userID]; !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	guilds := []*models.Guild{}
+	for id, guild := range d.guilds {
+		if _, ok := d.members[id][userID]; ok &&
+			(guild.Updated.After(from) || guild.Updated.Equal(from)) &&
+			(guild.Updated.Before(until) || guild.Updated.Equal(until)) {
+			guilds = append(guilds, d.copyGuild(guild))
+		}
+	}
+
+	sort.Slice(guilds, func(i, j int) bool {
+		return guilds[i].Updated.After(*guilds[j].Updated)
+	})
+
+	return guilds, nil
+}
+
+// JoinGuild - makes a user a member of a guild
+func (d *Driver) JoinGuild(guildID, userID string) (*models.Member, error) {
+	if guildID == "" || userID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if _, ok := d.guilds[guildID]; !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	if _, ok := d.users[userID]; !ok || d.deleted(userID) {
+		return nil, constants.ErrNotFound
+	}
+
+	if _, ok := d.members[guildID][userID]; ok {
+		return nil, constants.ErrBadRequest
+	}
+
+	now := time.Now()
+	member := &models.Member{GuildID: guildID, UserID: userID, Role: models.RoleMember, Joined: &now}
+	if err := d.commit(&record{Op: opAddMember, Member: member}); err != nil {
+		return nil, err
+	}
+
+	// a muted member who left and rejoined is still muted
+	return d.copyMember(member), nil
+}
+
+// LeaveGuild - removes a user from a guild, their messages stay in its channels. The owner can't leave
+func (d *Driver) LeaveGuild(guildID, userID string) error {
+	if guildID == "" || userID == "" {
+		return constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	member, ok := d.members[guildID][userID]
+	if !ok {
+		return constants.ErrNotFound
+	}
+
+	if member.Role == models.RoleOwner {
+		return constants.ErrBadRequest
+	}
+
+	return d.commit(&record{Op: opRemoveMember, ID: guildID, UserID: userID})
+}
+
+// GetMember - gets a user's membership of a guild, not found if they aren't a member
+func (d *Driver) GetMember(guildID, userID string) (*models.Member, error) {
+	if guildID == "" || userID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	member, ok := d.members[guildID][userID]
+	if !ok || d.deleted(userID) {
+		return nil, constants.ErrNotFound
+	}
+
+	return d.copyMember(member), nil
+}
+
+// ListMembers - lists the members of a guild, in the order they joined. Deleted users are left out
+func (d *Driver) ListMembers(guildID string) ([]*models.Member, error) {
+	if guildID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	if _, ok := d.guilds[guildID]; !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	members := []*models.Member{}
+	for userID, member := range d.members[guildID] {
+		if !d.deleted(userID) {
+			members = append(members, d.copyMember(member))
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Joined.Equal(*members[j].Joined) {
+			return members[i].UserID < members[j].UserID
+		}
+		return members[i].Joined.Before(*members[j].Joined)
+	})
+
+	return members, nil
+}
+
+// CreateChannel - creates a named channel in a guild, names are unique within a guild
+func (d *Driver) CreateChannel(guildID, name string) (*models.Channel, error) {
+	if guildID == "" || name == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	guild, ok := d.guilds[guildID]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	for _, channel := range guild.Channels {
+		if channel.Name == name {
+			return nil, constants.ErrBadRequest
+		}
+	}
+
+	channel := newChannel(guildID, name, time.Now())
+	if err := d.commit(&record{Op: opCreateChannel, Channel: channel}); err != nil {
+		return nil, err
+	}
+
+	return copyChannel(channel), nil
+}
+
+// GetChannel - gets a single channel, without its messages
+func (d *Driver) GetChannel(id string) (*models.Channel, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	channel, ok := d.channels[id]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	return copyChannel(channel), nil
+}
+
+// ListChannelMessages - lists the messages sent to a channel, oldest first
+// from and until times can be passed to further narrow results to messages sent in the timeframe
+// if a 0 time is passed for either of these values, that filtering parameter is ignored
+// if limit is 0, it is ignored, otherwise only the most recent messages, up to a count of limit, are returned
+func (d *Driver) ListChannelMessages(channelID string, from, until time.Time, limit int) ([]*models.Message, error) {
+	if channelID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	// if until is 0 time, set to now
+	if until.Equal(time.Time{}) {
+		until = time.Now()
+	}
+
+	if from.After(until) {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	channel, ok := d.channels[channelID]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	// messages are appended as they are sent, so they are already oldest first
+	msgs := []*models.Message{}
+	for _, msg := range channel.Messages {
+		if (msg.Date.After(from) || msg.Date.Equal(from)) &&
+			(msg.Date.Before(until) || msg.Date.Equal(until)) {
+			msgs = append(msgs, d.redact(msg))
+		}
+	}
+
+	if limit > 0 && len(msgs) > limit {
+		msgs = msgs[len(msgs)-limit:]
+	}
+
+	return msgs, nil
+}
+
+// createChannelMessage - creates a new message in a guild channel, only members of the guild can send them
+func (d *Driver) createChannelMessage(msg *models.Message) (*models.Message, error) {
+	if msg.Sender == "" || msg.Content == "" || msg.Recipient != "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	channel, ok := d.channels[msg.ChannelID]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	if _, ok := d.members[channel.GuildID][msg.Sender]; !ok || d.deleted(msg.Sender) {
+		return nil, constants.ErrForbidden
+	}
+
+	if err := d.checkParent(msg); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	msg.Date = &now
+	msg.ID = uuid.New().String()
+
+	if err := d.commit(&record{Op: opCreateMessage, Message: msg}); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// addChannel - indexes a channel by id, making sure it has a message list. Must hold the write lock
+func (d *Driver) addChannel(channel *models.Channel) {
+	if channel.Messages == nil {
+		channel.Messages = []*models.Message{}
+	}
+	d.channels[channel.ID] = channel
+}
+
+// copyGuild - copies a guild and its channels, without their messages, replacing a deleted owner. Must hold the read lock
+func (d *Driver) copyGuild(guild *models.Guild) *models.Guild {
+	copied := *guild
+	if d.deleted(guild.Owner) {
+		copied.Owner = constants.DeletedUser
+	}
+
+	copied.Channels = make([]*models.Channel, len(guild.Channels))
+	for i, channel := range guild.Channels {
+		copied.Channels[i] = copyChannel(channel)
+	}
+
+	return &copied
+}
+
+// copyMember - copies a member, with when they are muted until. Must hold the read lock
+func (d *Driver) copyMember(member *models.Member) *models.Member {
+	copied := *member
+	copied.MutedUntil = nil
+	if until, ok := d.mutes[member.GuildID][member.UserID]; ok {
+		copied.MutedUntil = &until
+	}
+	return &copied
+}
+
+// copyChannel - copies a channel without its messages
+func copyChannel(channel *models.Channel) *models.Channel {
+	copied := *channel
+	copied.Messages = nil
+	return &copied
+}
@@ -0,0 +1,69 @@
+package mem
+
+import (
+	"sort"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// direct - whether a message was sent straight to a recipient, rather than to a group or channel
+func direct(msg *models.Message) bool {
+	return msg.Recipient != "" && msg.GroupID == "" && msg.ChannelID == ""
+}
+
+// index - adds a direct message to its recipient's inbox, keeping the inbox ordered by date, then id.
+// Messages are nearly always the newest, so this is usually an append. Must hold the write lock
+func (d *Driver) index(msg *models.Message) {
+	if !direct(msg) {
+		return
+	}
+
+	inbox := d.inbox[msg.Recipient]
+	i := sort.Search(len(inbox), func(i int) bool {
+		return db.Less(msg, inbox[i])
+	})
+
+	inbox = append(inbox, nil)
+	copy(inbox[i+1:], inbox[i:])
+	inbox[i] = msg
+	d.inbox[msg.Recipient] = inbox
+}
+
+// reindex - swaps a changed message into its recipient's inbox in place of the old one. Changes never move a
+// message's date, so it keeps its position. Must hold the write lock
+func (d *Driver) reindex(old, changed *models.Message) {
+	if !direct(old) {
+		return
+	}
+
+	inbox := d.inbox[old.Recipient]
+	i := sort.Search(len(inbox), func(i int) bool {
+		return !db.Less(inbox[i], old)
+	})
+
+	if i < len(inbox) && inbox[i] == old {
+		inbox[i] = changed
+	}
+}
+
+// received - the messages in a recipient's inbox sent from from until until, oldest first. The slice is the inbox
+// itself, so must not be modified. Must hold the read lock
+func (d *Driver) received(recipient string, from, until time.Time) []*models.Message {
+	inbox := d.inbox[recipient]
+
+	start := sort.Search(len(inbox), func(i int) bool {
+		return !inbox[i].Date.Before(from)
+	})
+
+	end := sort.Search(len(inbox), func(i int) bool {
+		return inbox[i].Date.After(until)
+	})
+
+	if start >= end {
+		return nil
+	}
+
+	return inbox[start:end]
+}
@@ -0,0 +1,177 @@
+package mem
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// CreateAPIKey - stores a new API key for an active user under the hash of the key. The key needs a name, a prefix
+// and at least one valid scope
+func (d *Driver) CreateAPIKey(key *models.APIKey, keyHash string) (*models.APIKey, error) {
+	if !validAPIKey(key) || keyHash == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if _, ok := d.users[key.UserID]; !ok || d.deleted(key.UserID) {
+		return nil, constants.ErrNotFound
+	}
+
+	if _, ok := d.keyHashes[keyHash]; ok {
+		return nil, constants.ErrBadRequest
+	}
+
+	now := time.Now()
+	created := &APIKey{
+		APIKey: models.APIKey{
+			ID:      uuid.New().String(),
+			UserID:  key.UserID,
+			Name:    key.Name,
+			Scopes:  append([]string{}, key.Scopes...),
+			Prefix:  key.Prefix,
+			Created: &now,
+		},
+		Hash: keyHash,
+	}
+
+	if err := d.commit(&record{Op: opCreateAPIKey, APIKey: created}); err != nil {
+		return nil, err
+	}
+
+	return copyAPIKey(created), nil
+}
+
+// GetAPIKey - gets a single API key by id, revoked or not
+func (d *Driver) GetAPIKey(id string) (*models.APIKey, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	key, ok := d.keys[id]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	return copyAPIKey(key), nil
+}
+
+// GetAPIKeyByHash - gets the API key stored under a hash, to authenticate with. Revoked keys aren't found
+func (d *Driver) GetAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	if keyHash == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	key, ok := d.keys[d.keyHashes[keyHash]]
+	if !ok || key.Revoked != nil {
+		return nil, constants.ErrNotFound
+	}
+
+	return copyAPIKey(key), nil
+}
+
+// ListAPIKeys - lists a user's API keys, revoked ones included, in the order they were created
+func (d *Driver) ListAPIKeys(userID string) ([]*models.APIKey, error) {
+	if userID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	if _, ok := d.users[userID]; !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	keys := []*models.APIKey{}
+	for _, key := range d.keys {
+		if key.UserID == userID {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Created.Equal(*keys[j].Created) {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].Created.Before(*keys[j].Created)
+	})
+
+	return keys, nil
+}
+
+// RevokeAPIKey - stops an API key from working. Revoking a key twice changes nothing
+func (d *Driver) RevokeAPIKey(id string) error {
+	if id == "" {
+		return constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	key, ok := d.keys[id]
+	if !ok {
+		return constants.ErrNotFound
+	}
+
+	if key.Revoked != nil {
+		return nil
+	}
+
+	now := time.Now()
+	return d.commit(&record{Op: opRevokeAPIKey, ID: id, Date: &now})
+}
+
+// TouchAPIKey - records that an API key was used. The last used time only moves forward
+func (d *Driver) TouchAPIKey(id string, used time.Time) error {
+	if id == "" || used.IsZero() {
+		return constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	key, ok := d.keys[id]
+	if !ok {
+		return constants.ErrNotFound
+	}
+
+	if key.LastUsed != nil && !key.LastUsed.Before(used) {
+		return nil
+	}
+
+	return d.commit(&record{Op: opTouchAPIKey, ID: id, Date: &used})
+}
+
+// validAPIKey - whether a new API key is complete, with at least one scope and only valid ones
+func validAPIKey(key *models.APIKey) bool {
+	if key == nil || key.UserID == "" || key.Name == "" || key.Prefix == "" || len(key.Scopes) == 0 {
+		return false
+	}
+
+	for _, scope := range key.Scopes {
+		if !models.ValidScope(scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// copyAPIKey - a copy of a stored key, without its hash
+func copyAPIKey(key *APIKey) *models.APIKey {
+	copied := key.APIKey
+	copied.Scopes = append([]string{}, key.Scopes...)
+	return &copied
+}
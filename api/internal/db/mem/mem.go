@@ -1,6 +1,7 @@
 package mem
 
 import (
+	"sort"
 	"sync"
 	"time"
 
@@ -16,10 +17,50 @@ type (
 	}
 
 	Driver struct {
-		mux    sync.RWMutex
-		msgs   map[string]*models.Message   // primary key is linked to a single id
-		convos map[Key]*models.Conversation // complex primary key
-		users  map[string]*models.User      //primary key is a single id
+		mux        sync.RWMutex
+		msgs       map[string]*models.Message            // primary key is linked to a single id
+		inbox      map[string][]*models.Message          // direct messages keyed by recipient, ordered by date then id
+		convos     map[Key]*models.Conversation          // complex primary key
+		users      map[string]*models.User               //primary key is a single id
+		groups     map[string]*models.Conversation       // group conversations keyed by id
+		guilds     map[string]*models.Guild              // guilds keyed by id, channels (and their messages) are stored inside
+		channels   map[string]*models.Channel            // guild channels keyed by id
+		members    map[string]map[string]*models.Member  // guild members keyed by guild id, then user id
+		roles      map[string]map[string]*models.Role    // custom guild roles keyed by guild id, then name
+		mutes      map[string]map[string]time.Time       // when guild members are muted until keyed by guild id, then user id
+		revisions  map[string][]*models.Revision         // earlier content of edited messages keyed by message id, oldest first
+		hidden     map[string]map[string]bool            // messages a user has hidden for themselves keyed by user id, then message id
+		reactions  map[string][]*Reaction                // reactions keyed by message id, in the order they were added
+		files      map[string][]*models.Attachment       // attachments keyed by message id, in the order they were added
+		reads      map[string]map[string]*models.Receipt // read markers keyed by conversation or group id, then user id
+		keys       map[string]*APIKey                    // API keys keyed by id
+		keyHashes  map[string]string                     // the same keys' ids keyed by hash
+		commands   map[string]*models.Command            // bots' slash commands keyed by id
+		hooks      map[string]*models.Webhook            // webhooks keyed by id
+		logs       map[string][]*models.Delivery         // webhook deliveries keyed by webhook id, in the order they were created
+		deliveries map[string]*models.Delivery           // the same deliveries keyed by id
+		passwords  map[string]string                     // password hashes keyed by user id, kept apart from users so they are never returned
+		resets     map[string]*Reset                     // outstanding password resets keyed by token hash
+		wal        *wal                                  // optional write-ahead log, nil when purely in memory
+	}
+
+	// Reset - an outstanding password reset for a user
+	Reset struct {
+		UserID  string    `json:"user_id"`
+		Expires time.Time `json:"expires"`
+	}
+
+	// APIKey - an API key, and the hash it is looked up by
+	APIKey struct {
+		models.APIKey
+		Hash string `json:"hash"`
+	}
+
+	// Reaction - a single user's reaction to a message
+	Reaction struct {
+		UserID string    `json:"user_id"`
+		Emoji  string    `json:"emoji"`
+		Date   time.Time `json:"date"`
 	}
 )
 
@@ -30,10 +71,30 @@ var (
 // NewDriver - creates a in-memory database driver
 func NewDriver() *Driver {
 	return &Driver{
-		mux:    sync.RWMutex{},
-		msgs:   map[string]*models.Message{},
-		convos: map[Key]*models.Conversation{},
-		users:  map[string]*models.User{},
+		mux:        sync.RWMutex{},
+		msgs:       map[string]*models.Message{},
+		inbox:      map[string][]*models.Message{},
+		convos:     map[Key]*models.Conversation{},
+		users:      map[string]*models.User{},
+		groups:     map[string]*models.Conversation{},
+		guilds:     map[string]*models.Guild{},
+		channels:   map[string]*models.Channel{},
+		members:    map[string]map[string]*models.Member{},
+		roles:      map[string]map[string]*models.Role{},
+		mutes:      map[string]map[string]time.Time{},
+		revisions:  map[string][]*models.Revision{},
+		hidden:     map[string]map[string]bool{},
+		reactions:  map[string][]*Reaction{},
+		files:      map[string][]*models.Attachment{},
+		reads:      map[string]map[string]*models.Receipt{},
+		keys:       map[string]*APIKey{},
+		keyHashes:  map[string]string{},
+		commands:   map[string]*models.Command{},
+		hooks:      map[string]*models.Webhook{},
+		logs:       map[string][]*models.Delivery{},
+		deliveries: map[string]*models.Delivery{},
+		passwords:  map[string]string{},
+		resets:     map[string]*Reset{},
 	}
 }
 
@@ -52,18 +113,77 @@ func (d *Driver) GetMessage(id string) (*models.Message, error) {
 		return nil, constants.ErrNotFound
 	}
 
-	return msg, nil
+	return d.redact(msg), nil
 }
 
-// CreateMessage - creates a new message
-func (d *Driver) CreateMessage(msg *models.Message) (*models.Message, error) {
-	if msg.Recipient == "" || msg.Sender == "" || msg.Content == "" {
+// GetMessages - gets several messages by id, in the order asked for. Messages that don't exist, or that viewer has
+// hidden, are left out. An empty viewer sees every message
+func (d *Driver) GetMessages(viewer string, ids []string) ([]*models.Message, error) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	msgs := make([]*models.Message, 0, len(ids))
+	for _, id := range ids {
+		if msg, ok := d.msgs[id]; ok && !d.hidden[viewer][id] {
+			msgs = append(msgs, d.redact(msg))
+		}
+	}
+
+	return msgs, nil
+}
+
+// ScanMessages - lists every message, deleted or hidden, ordered by id and starting after the given id, for
+// rebuilding indexes a batch at a time. An empty after starts from the beginning. if limit is 0, it is ignored
+func (d *Driver) ScanMessages(after string, limit int) ([]*models.Message, error) {
+	if limit < 0 {
 		return nil, constants.ErrBadRequest
 	}
 
 	d.mux.RLock()
 	defer d.mux.RUnlock()
 
+	ids := []string{}
+	for id := range d.msgs {
+		if id > after {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	msgs := make([]*models.Message, 0, len(ids))
+	for _, id := range ids {
+		msgs = append(msgs, d.redact(d.msgs[id]))
+	}
+
+	return msgs, nil
+}
+
+// CreateMessage - creates a new message, either to a recipient, a group conversation or a guild channel.
+// A reply is sent to the same place as its parent
+func (d *Driver) CreateMessage(msg *models.Message) (*models.Message, error) {
+	// these are kept up to date by the driver, never set by the sender
+	msg.EditedAt, msg.DeletedAt, msg.ReplyCount, msg.LastReplyAt = nil, nil, 0, nil
+	msg.Reactions, msg.Attachments = nil, nil
+
+	if msg.GroupID != "" {
+		return d.createGroupMessage(msg)
+	}
+
+	if msg.ChannelID != "" {
+		return d.createChannelMessage(msg)
+	}
+
+	if msg.Recipient == "" || msg.Sender == "" || msg.Content == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
 	// if the user or sender id are invalid, throw error - in this case a not found, so as not to tip off malicious attacks of a bad user id
 	if _, ok := d.users[msg.Sender]; !ok {
 		return nil, constants.ErrNotFound
@@ -73,35 +193,43 @@ func (d *Driver) CreateMessage(msg *models.Message) (*models.Message, error) {
 		return nil, constants.ErrNotFound
 	}
 
+	if err := d.checkParent(msg); err != nil {
+		return nil, err
+	}
+
 	now := time.Now()
 	msg.Date = &now
 	msg.ID = uuid.New().String()
-	d.msgs[msg.ID] = msg
-
-	// now add to the existing conversation, or create a new one
-	if convo, ok := d.convos[Key{msg.Sender, msg.Recipient}]; ok {
-		convo.Messages = append(convo.Messages, msg)
-		convo.Updated = &now
-	} else {
-		convo, err := d.CreateConversation(msg.Sender, msg.Recipient)
-		if err != nil {
+
+	// create the conversation if this is the first message, applying the message adds it to the conversation
+	if _, ok := d.convos[Key{msg.Sender, msg.Recipient}]; !ok {
+		if err := d.commit(&record{Op: opCreateConversation, Conversation: newConversation(msg.Sender, msg.Recipient, now)}); err != nil {
 			return nil, err
 		}
-		convo.Messages = append(convo.Messages, msg)
+	}
+	msg.ConversationID = d.convos[Key{msg.Sender, msg.Recipient}].ID
+
+	if err := d.commit(&record{Op: opCreateMessage, Message: msg}); err != nil {
+		return nil, err
 	}
 
 	return msg, nil
 }
 
-// ListMessages - lists messages all messages for a recipient
-// from and until times can be passed to further narrow results to conversations that have been updated in the timeframe
+// ListMessages - lists messages all messages for a recipient, leaving out any they have hidden, in the given order
+// from and until times can be passed to further narrow results to messages sent in the timeframe
 // if a 0 time is passed for either of these values, that filtering parameter is ignored
 // if limit is 0, it is ignored, otherwise only the most recent messages, up to a count of limit, are returned
-func (d *Driver) ListMessages(recipient string, from, until time.Time, limit int) ([]*models.Message, error) {
-	if recipient == "" {
+func (d *Driver) ListMessages(recipient string, from, until time.Time, limit int, order db.Order) ([]*models.Message, error) {
+	if recipient == "" || !order.Valid() {
 		return nil, constants.ErrBadRequest
 	}
 
+	// if until is 0 time, set to now
+	if until.Equal(time.Time{}) {
+		until = time.Now()
+	}
+
 	if from.After(until) {
 		return nil, constants.ErrBadRequest
 	}
@@ -113,26 +241,18 @@ func (d *Driver) ListMessages(recipient string, from, until time.Time, limit int
 		return nil, constants.ErrNotFound
 	}
 
+	// the inbox is ordered, so walk back from the newest message in the timeframe until there are enough
+	received := d.received(recipient, from, until)
 	msgs := []*models.Message{}
-	count := 0
-	// only return conversations that match the filters
-	// don't need to do anything to 0 time from param to "ignore" it
-
-	// if until is 0 time, set to now
-	if until.Equal(time.Time{}) {
-		until = time.Now()
-	}
-
-	for _, msg := range d.msgs {
-		if limit > 0 && count > limit {
-			break
+	for i := len(received) - 1; i >= 0 && (limit <= 0 || len(msgs) < limit); i-- {
+		if !d.hidden[recipient][received[i].ID] {
+			msgs = append(msgs, d.redact(received[i]))
 		}
+	}
 
-		if msg.Recipient == recipient &&
-			(msg.Date.After(from) || msg.Date.Equal(from)) &&
-			(msg.Date.Before(until) || msg.Date.Equal(until)) {
-			msgs = append(msgs, msg)
-			count++
+	if order == db.OldestFirst {
+		for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+			msgs[i], msgs[j] = msgs[j], msgs[i]
 		}
 	}
 
@@ -147,6 +267,11 @@ func (d *Driver) GetConversation(sender, recipient string, from, until time.Time
 		return nil, constants.ErrBadRequest
 	}
 
+	// if until is 0 time, set to now
+	if until.Equal(time.Time{}) {
+		until = time.Now()
+	}
+
 	if from.After(until) {
 		return nil, constants.ErrBadRequest
 	}
@@ -171,21 +296,10 @@ func (d *Driver) GetConversation(sender, recipient string, from, until time.Time
 	// only return conversations that match the filters
 	// don't need to do anything to 0 time from param to "ignore" it
 
-	// if until is 0 time, set to now
-	if until.Equal(time.Time{}) {
-		until = time.Now()
-	}
-
 	if (convo.Updated.After(from) || convo.Updated.Equal(from)) &&
 		(convo.Updated.Before(until) || convo.Updated.Equal(until)) {
 		// redact deleted users
-		modifiedConvo := *convo
-		for i, msg := range modifiedConvo.Messages {
-			if d.users[msg.Sender].ArchivedOn == nil && (d.users[msg.Sender].ArchivedOn.Before(time.Now()) && !d.users[msg.Sender].ArchivedOn.Equal(time.Time{})) {
-				modifiedConvo.Messages[i].Sender = "deleted"
-			}
-		}
-		return &modifiedConvo, nil
+		return d.redactConversation(convo, ""), nil
 	}
 
 	return nil, constants.ErrNotFound
@@ -197,8 +311,8 @@ func (d *Driver) CreateConversation(sender, recipient string) (*models.Conversat
 		return nil, constants.ErrBadRequest
 	}
 
-	d.mux.RLock()
-	defer d.mux.RUnlock()
+	d.mux.Lock()
+	defer d.mux.Unlock()
 
 	// if the user or sender id are invalid, throw error - in this case a not found, so as not to tip off malicious attacks of a bad user id
 	if _, ok := d.users[sender]; !ok {
@@ -218,24 +332,27 @@ func (d *Driver) CreateConversation(sender, recipient string) (*models.Conversat
 		return nil, constants.ErrBadRequest
 	}
 
-	now := time.Now()
+	convo := newConversation(sender, recipient, time.Now())
+	if err := d.commit(&record{Op: opCreateConversation, Conversation: convo}); err != nil {
+		return nil, err
+	}
 
-	convo := &models.Conversation{
+	return convo, nil
+}
+
+// newConversation - builds an empty conversation between a sender and recipient
+func newConversation(sender, recipient string, now time.Time) *models.Conversation {
+	return &models.Conversation{
 		ID:        uuid.New().String(),
 		Sender:    sender,
 		Recipient: recipient,
 		Updated:   &now,
 		Messages:  []*models.Message{},
 	}
-
-	// the same conversation should exist, no matter which way we are looking at it
-	d.convos[Key{sender, recipient}] = convo
-	d.convos[Key{recipient, sender}] = convo
-
-	return convo, nil
 }
 
-// ListConversations - lists all conversations between recipient and others.
+// ListConversations - lists all conversations between recipient and others, most recently updated first, leaving out
+// messages they have hidden. Each counts the messages recipient hasn't read.
 // from and until times can be passed to further narrow results to conversations that have been updated in the timeframe
 // if a 0 time is passed for either of these values, that filtering parameter is ignored
 func (d *Driver) ListConversations(recipient string, from, until time.Time) ([]*models.Conversation, error) {
@@ -243,6 +360,11 @@ func (d *Driver) ListConversations(recipient string, from, until time.Time) ([]*
 		return nil, constants.ErrBadRequest
 	}
 
+	// if until is 0 time, set to now
+	if until.Equal(time.Time{}) {
+		until = time.Now()
+	}
+
 	if from.After(until) {
 		return nil, constants.ErrBadRequest
 	}
@@ -262,24 +384,20 @@ func (d *Driver) ListConversations(recipient string, from, until time.Time) ([]*
 		// only return conversations that match the filters
 		// don't need to do anything to 0 time from param to "ignore" it
 
-		// if until is 0 time, set to now
-		if until.Equal(time.Time{}) {
-			until = time.Now()
-		}
-
 		if key.Recipient == recipient &&
 			(convo.Updated.After(from) || convo.Updated.Equal(from)) &&
 			(convo.Updated.Before(until) || convo.Updated.Equal(until)) {
-			modified := *convo
 			// here we look up to see if the user is deleted, if so, change their user id to hide it
-			sender := modified.Sender
-			if d.users[sender].ArchivedOn != nil && (d.users[sender].ArchivedOn.Before(time.Now()) && !d.users[sender].ArchivedOn.Equal(time.Time{})) {
-				modified.Sender = "deleted"
-			}
-			conversations = append(conversations, &modified)
+			redacted := d.redactConversation(convo, recipient)
+			redacted.Unread, redacted.LastRead = d.unread(convo.ID, recipient, convo.Messages)
+			conversations = append(conversations, redacted)
 		}
 	}
 
+	sort.Slice(conversations, func(i, j int) bool {
+		return conversations[i].Updated.After(*conversations[j].Updated)
+	})
+
 	return conversations, nil
 }
 
@@ -298,26 +416,100 @@ func (d *Driver) GetUser(id string) (*models.User, error) {
 		return nil, constants.ErrNotFound
 	}
 
-	archived := *user.ArchivedOn
-
 	// if the user has been soft deleted, don't return it
-	// note: golang doesn't have null time, so look for 0 time
-	if archived.Before(time.Now()) || archived.Equal(time.Time{}) {
-		return user, nil
+	if d.deleted(id) {
+		return nil, constants.ErrNotFound
 	}
 
-	return nil, constants.ErrNotFound
+	return user, nil
+}
+
+// deleted - whether a user has been soft deleted. Must hold the read lock
+func (d *Driver) deleted(id string) bool {
+	user, ok := d.users[id]
+	return ok && user.ArchivedOn != nil && !user.ArchivedOn.After(time.Now())
+}
+
+// redact - copies a message, replacing the sender if they have been deleted, and fills in its reactions and
+// attachments, leaving out reactions from deleted users. The stored message is never modified, so redaction doesn't
+// leak into later reads or snapshots. Must hold the read lock
+func (d *Driver) redact(msg *models.Message) *models.Message {
+	redacted := *msg
+
+	// messages logged before they carried their conversation get it from the stored pair
+	if redacted.ConversationID == "" {
+		if convo, ok := d.convos[Key{msg.Sender, msg.Recipient}]; ok {
+			redacted.ConversationID = convo.ID
+		}
+	}
+
+	if d.deleted(msg.Sender) {
+		redacted.Sender = constants.DeletedUser
+	}
+
+	for _, reaction := range d.reactions[msg.ID] {
+		if !d.deleted(reaction.UserID) {
+			redacted.Reactions = models.Tally(redacted.Reactions, reaction.Emoji, reaction.UserID)
+		}
+	}
+
+	redacted.Attachments = d.files[msg.ID]
+
+	return &redacted
 }
 
-// CreateUser - creates a new user
+// redactConversation - copies a conversation and its messages, replacing any deleted senders and leaving out
+// messages the viewer has hidden. An empty viewer sees every message. Must hold the read lock
+func (d *Driver) redactConversation(convo *models.Conversation, viewer string) *models.Conversation {
+	redacted := *convo
+	if d.deleted(convo.Sender) {
+		redacted.Sender = constants.DeletedUser
+	}
+
+	redacted.Messages = make([]*models.Message, 0, len(convo.Messages))
+	for _, msg := range convo.Messages {
+		if !d.hidden[viewer][msg.ID] {
+			redacted.Messages = append(redacted.Messages, d.redact(msg))
+		}
+	}
+
+	return &redacted
+}
+
+// CreateUser - creates a new user. People need an email, bots need an owner instead: an active user who isn't a
+// bot themselves
 func (d *Driver) CreateUser(user *models.User) (*models.User, error) {
+	return d.createUser(user, "")
+}
 
-	if user == nil || user.Email == "" || user.Username == "" {
+// CreateAccount - creates a new person along with their password hash, in a single record so there is never a user
+// without a password. Bots can't have a password, they use API keys
+func (d *Driver) CreateAccount(user *models.User, passwordHash string) (*models.User, error) {
+	if user == nil || user.Bot || passwordHash == "" {
 		return nil, constants.ErrBadRequest
 	}
 
-	d.mux.RLock()
-	defer d.mux.RUnlock()
+	return d.createUser(user, passwordHash)
+}
+
+// createUser - creates a new user, and sets their password hash if one is given
+func (d *Driver) createUser(user *models.User, passwordHash string) (*models.User, error) {
+	if !validUser(user) {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if user.Bot {
+		owner, ok := d.users[user.Owner]
+		if !ok || d.deleted(owner.ID) {
+			return nil, constants.ErrNotFound
+		}
+		if owner.Bot {
+			return nil, constants.ErrBadRequest
+		}
+	}
 
 	for _, usr := range d.users {
 		if usr.Username == user.Username {
@@ -326,26 +518,165 @@ func (d *Driver) CreateUser(user *models.User) (*models.User, error) {
 	}
 
 	user.ID = uuid.New().String()
-	d.users[user.ID] = user
+	if err := d.commit(&record{Op: opCreateUser, User: user, Hash: passwordHash}); err != nil {
+		return nil, err
+	}
+
 	return user, nil
 }
 
-// DeleteUser - soft deletes a user
+// DeleteUser - soft deletes a user, along with any bots they own
 func (d *Driver) DeleteUser(id string) error {
 	if id == "" {
 		return constants.ErrBadRequest
 	}
 
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if _, ok := d.users[id]; !ok {
+		return constants.ErrNotFound
+	}
+
+	archived := time.Now()
+	return d.commit(&record{Op: opDeleteUser, ID: id, Date: &archived})
+}
+
+// GetUserByUsername - gets a single user by username
+func (d *Driver) GetUserByUsername(username string) (*models.User, error) {
+	if username == "" {
+		return nil, constants.ErrBadRequest
+	}
+
 	d.mux.RLock()
 	defer d.mux.RUnlock()
 
-	user, ok := d.users[id]
-	if !ok {
+	for _, user := range d.users {
+		if user.Username == username && !d.deleted(user.ID) {
+			return user, nil
+		}
+	}
+
+	return nil, constants.ErrNotFound
+}
+
+// ListBots - lists the active bots a user owns, by username
+func (d *Driver) ListBots(owner string) ([]*models.User, error) {
+	if owner == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	if _, ok := d.users[owner]; !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	bots := []*models.User{}
+	for _, user := range d.users {
+		if user.Bot && user.Owner == owner && !d.deleted(user.ID) {
+			bots = append(bots, user)
+		}
+	}
+
+	sort.Slice(bots, func(i, j int) bool {
+		return bots[i].Username < bots[j].Username
+	})
+
+	return bots, nil
+}
+
+// validUser - whether a new user is complete. People need an email and no owner, bots need an owner
+func validUser(user *models.User) bool {
+	if user == nil || user.Username == "" {
+		return false
+	}
+
+	if user.Bot {
+		return user.Owner != ""
+	}
+
+	return user.Email != "" && user.Owner == ""
+}
+
+// SetPassword - sets, or replaces, the password hash for a user
+func (d *Driver) SetPassword(userID, hash string) error {
+	if userID == "" || hash == "" {
+		return constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if _, ok := d.users[userID]; !ok || d.deleted(userID) {
 		return constants.ErrNotFound
 	}
 
-	archived := time.Now()
-	user.ArchivedOn = &archived
+	return d.commit(&record{Op: opSetPassword, ID: userID, Hash: hash})
+}
+
+// GetPassword - gets the password hash for a user, not found if they have never set one
+func (d *Driver) GetPassword(userID string) (string, error) {
+	if userID == "" {
+		return "", constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	hash, ok := d.passwords[userID]
+	if !ok || d.deleted(userID) {
+		return "", constants.ErrNotFound
+	}
+
+	return hash, nil
+}
+
+// CreatePasswordReset - stores a password reset for a user, valid until expires. Only a hash of the
+// reset token is stored, so the token itself can't be recovered from the datastore
+func (d *Driver) CreatePasswordReset(userID, tokenHash string, expires time.Time) error {
+	if userID == "" || tokenHash == "" {
+		return constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if _, ok := d.users[userID]; !ok || d.deleted(userID) {
+		return constants.ErrNotFound
+	}
+
+	if _, ok := d.resets[tokenHash]; ok {
+		return constants.ErrBadRequest
+	}
+
+	return d.commit(&record{Op: opCreateReset, ID: userID, Hash: tokenHash, Date: &expires})
+}
+
+// ConsumePasswordReset - uses up a password reset, returning the id of the user it was for.
+// A reset can only be used once, and expired resets are not found
+func (d *Driver) ConsumePasswordReset(tokenHash string) (string, error) {
+	if tokenHash == "" {
+		return "", constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	reset, ok := d.resets[tokenHash]
+	if !ok {
+		return "", constants.ErrNotFound
+	}
+
+	// an expired reset is cleared out all the same
+	if err := d.commit(&record{Op: opConsumeReset, Hash: tokenHash}); err != nil {
+		return "", err
+	}
+
+	if reset.Expires.Before(time.Now()) || d.deleted(reset.UserID) {
+		return "", constants.ErrNotFound
+	}
 
-	return nil
+	return reset.UserID, nil
 }
@@ -0,0 +1,37 @@
+package mem
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/db/dbtest"
+)
+
+func TestDriver(t *testing.T) {
+	dbtest.RunDriverSuite(t, func(t *testing.T) (db.Driver, func()) {
+		return NewDriver(), func() {}
+	})
+}
+
+// TestPersistentDriver - the same suite with every write going through the write-ahead log
+func TestPersistentDriver(t *testing.T) {
+	dbtest.RunDriverSuite(t, func(t *testing.T) (db.Driver, func()) {
+		dir, err := ioutil.TempDir("", "guild-mem")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := NewPersistentDriver(Config{Dir: dir})
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+
+		return d, func() {
+			d.Close()
+			os.RemoveAll(dir)
+		}
+	})
+}
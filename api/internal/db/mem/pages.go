@@ -0,0 +1,105 @@
+package mem
+
+import (
+	"sort"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// PageMessages - lists a page of the messages sent to a recipient, leaving out any they have hidden. See db.Page
+func (d *Driver) PageMessages(recipient string, page db.Page) (*models.MessagePage, error) {
+	if recipient == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	if err := page.Check(); err != nil {
+		return nil, err
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	if _, ok := d.users[recipient]; !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	msgs := []*models.Message{}
+	for _, msg := range d.received(recipient, page.From, page.Until) {
+		if !d.hidden[recipient][msg.ID] {
+			msgs = append(msgs, msg)
+		}
+	}
+
+	return d.page(msgs, page), nil
+}
+
+// PageConversation - lists a page of the messages sent from sender to recipient. See db.Page
+func (d *Driver) PageConversation(sender, recipient string, page db.Page) (*models.MessagePage, error) {
+	if sender == "" || recipient == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	if err := page.Check(); err != nil {
+		return nil, err
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	if _, ok := d.users[sender]; !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	if _, ok := d.users[recipient]; !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	convo, ok := d.convos[Key{sender, recipient}]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	// the conversation holds the messages sent both ways
+	msgs := []*models.Message{}
+	for _, msg := range convo.Messages {
+		if msg.Sender == sender && msg.Recipient == recipient {
+			msgs = append(msgs, msg)
+		}
+	}
+
+	return d.page(msgs, page), nil
+}
+
+// page - cuts a page out of messages, in any order, and redacts what is on it. Must hold the read lock
+func (d *Driver) page(msgs []*models.Message, page db.Page) *models.MessagePage {
+	matched := []*models.Message{}
+	for _, msg := range msgs {
+		if msg.Date.Before(page.From) || msg.Date.After(page.Until) ||
+			(page.Before != nil && !page.Before.Precedes(msg)) ||
+			(page.After != nil && !page.After.Follows(msg)) {
+			continue
+		}
+		matched = append(matched, msg)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return db.Less(matched[i], matched[j])
+	})
+
+	// keep one more than the limit, furthest from the cursor, so Trim can tell whether there is more to come
+	if page.Limit > 0 && len(matched) > page.Limit+1 {
+		if page.After != nil {
+			matched = matched[:page.Limit+1]
+		} else {
+			matched = matched[len(matched)-page.Limit-1:]
+		}
+	}
+
+	for i, msg := range matched {
+		matched[i] = d.redact(msg)
+	}
+
+	return page.Trim(matched)
+}
@@ -0,0 +1,107 @@
+package mem
+
+import (
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// AddReaction - reacts to a message as a user, returning the message with its reactions. A user can react with
+// several emoji, but only once with each. Messages deleted for everyone can't be reacted to
+func (d *Driver) AddReaction(messageID, userID, emoji string) (*models.Message, error) {
+	if messageID == "" || userID == "" || !models.ValidEmoji(emoji) {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	msg, err := d.reactable(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.DeletedAt != nil {
+		return nil, constants.ErrBadRequest
+	}
+
+	if d.reacted(messageID, userID, emoji) < 0 {
+		now := time.Now()
+		if err := d.commit(&record{Op: opAddReaction, ID: messageID, UserID: userID, Emoji: emoji, Date: &now}); err != nil {
+			return nil, err
+		}
+	}
+
+	return d.redact(msg), nil
+}
+
+// RemoveReaction - takes back a user's reaction to a message, returning the message with its remaining reactions.
+// Removing a reaction that isn't there changes nothing
+func (d *Driver) RemoveReaction(messageID, userID, emoji string) (*models.Message, error) {
+	if messageID == "" || userID == "" || emoji == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	msg, err := d.reactable(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.reacted(messageID, userID, emoji) >= 0 {
+		if err := d.commit(&record{Op: opRemoveReaction, ID: messageID, UserID: userID, Emoji: emoji}); err != nil {
+			return nil, err
+		}
+	}
+
+	return d.redact(msg), nil
+}
+
+// reactable - the message being reacted to, not found unless both it and the reacting user exist. Must hold the read lock
+func (d *Driver) reactable(messageID, userID string) (*models.Message, error) {
+	msg, ok := d.msgs[messageID]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	if _, ok := d.users[userID]; !ok || d.deleted(userID) {
+		return nil, constants.ErrNotFound
+	}
+
+	return msg, nil
+}
+
+// reacted - the index of a user's reaction to a message with emoji, -1 if they haven't. Must hold the read lock
+func (d *Driver) reacted(messageID, userID, emoji string) int {
+	for i, reaction := range d.reactions[messageID] {
+		if reaction.UserID == userID && reaction.Emoji == emoji {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyReaction - adds a reaction to a message, unless it is already there or the message has since been deleted.
+// Must hold the write lock
+func (d *Driver) applyReaction(messageID string, reaction *Reaction) {
+	msg, ok := d.msgs[messageID]
+	if !ok || msg.DeletedAt != nil || d.reacted(messageID, reaction.UserID, reaction.Emoji) >= 0 {
+		return
+	}
+
+	d.reactions[messageID] = append(d.reactions[messageID], reaction)
+}
+
+// removeReaction - takes a reaction off a message, if it is there. Must hold the write lock
+func (d *Driver) removeReaction(messageID, userID, emoji string) {
+	i := d.reacted(messageID, userID, emoji)
+	if i < 0 {
+		return
+	}
+
+	reactions := d.reactions[messageID]
+	d.reactions[messageID] = append(reactions[:i:i], reactions[i+1:]...)
+}
@@ -0,0 +1,174 @@
+package mem
+
+import (
+	"sort"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// MarkRead - marks a message, and everything before it in its conversation or group, as read by a user, returning
+// how far they have read. Markers only move forward, so marking an older message changes nothing. Only the two
+// people in a conversation, or a group's participants, can mark its messages read. Channels don't have markers
+func (d *Driver) MarkRead(userID, messageID string) (*models.Receipt, error) {
+	if userID == "" || messageID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	msg, ok := d.msgs[messageID]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	if _, ok := d.users[userID]; !ok || d.deleted(userID) {
+		return nil, constants.ErrNotFound
+	}
+
+	convoID, err := d.readConversation(msg, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if current := d.reads[convoID][userID]; current != nil && !d.advances(current, msg) {
+		receipt := *current
+		return &receipt, nil
+	}
+
+	now := time.Now()
+	receipt := &models.Receipt{ConversationID: convoID, UserID: userID, MessageID: msg.ID, Date: &now}
+	if err := d.commit(&record{Op: opMarkRead, Receipt: receipt}); err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+// ListReceipts - lists who has read a message: the markers in its conversation or group that are at or past it,
+// in the order they were read. Deleted users are left out
+func (d *Driver) ListReceipts(messageID string) ([]*models.Receipt, error) {
+	if messageID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	msg, ok := d.msgs[messageID]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	convoID := d.conversationID(msg)
+	if convoID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	receipts := []*models.Receipt{}
+	for _, receipt := range d.reads[convoID] {
+		if d.deleted(receipt.UserID) || d.advances(receipt, msg) {
+			continue
+		}
+
+		copied := *receipt
+		receipts = append(receipts, &copied)
+	}
+
+	sort.Slice(receipts, func(i, j int) bool {
+		if receipts[i].Date.Equal(*receipts[j].Date) {
+			return receipts[i].UserID < receipts[j].UserID
+		}
+		return receipts[i].Date.Before(*receipts[j].Date)
+	})
+
+	return receipts, nil
+}
+
+// conversationID - the id of the conversation or group a message was sent to, empty for a channel message. Must
+// hold the read lock
+func (d *Driver) conversationID(msg *models.Message) string {
+	if msg.ChannelID != "" {
+		return ""
+	}
+
+	if msg.GroupID != "" {
+		return msg.GroupID
+	}
+
+	if convo, ok := d.convos[Key{msg.Sender, msg.Recipient}]; ok {
+		return convo.ID
+	}
+
+	return ""
+}
+
+// readConversation - the id of the conversation or group a message was sent to, forbidden unless the user is in it.
+// Must hold the read lock
+func (d *Driver) readConversation(msg *models.Message, userID string) (string, error) {
+	convoID := d.conversationID(msg)
+	if convoID == "" {
+		return "", constants.ErrBadRequest
+	}
+
+	if msg.GroupID != "" {
+		if group, ok := d.groups[msg.GroupID]; !ok || !contains(group.Participants, userID) {
+			return "", constants.ErrForbidden
+		}
+	} else if msg.Sender != userID && msg.Recipient != userID {
+		return "", constants.ErrForbidden
+	}
+
+	return convoID, nil
+}
+
+// advances - whether msg comes after the message a receipt was read up to. Must hold the read lock
+func (d *Driver) advances(receipt *models.Receipt, msg *models.Message) bool {
+	read, ok := d.msgs[receipt.MessageID]
+	return !ok || db.Less(read, msg)
+}
+
+// unread - how many of a conversation's or group's messages, oldest first, others sent after the last one viewer
+// read, and the id of that one. Messages deleted for everyone, or that the viewer has hidden, aren't counted. Must
+// hold the read lock
+func (d *Driver) unread(convoID, viewer string, msgs []*models.Message) (int, string) {
+	receipt := d.reads[convoID][viewer]
+
+	count := 0
+	for _, msg := range msgs {
+		if receipt != nil && !d.advances(receipt, msg) {
+			continue
+		}
+
+		if msg.Sender != viewer && msg.DeletedAt == nil && !d.hidden[viewer][msg.ID] {
+			count++
+		}
+	}
+
+	if receipt == nil {
+		return count, ""
+	}
+
+	return count, receipt.MessageID
+}
+
+// applyRead - moves a user's marker forward to a receipt, unless it is already there or further. Must hold the
+// write lock
+func (d *Driver) applyRead(receipt *models.Receipt) {
+	msg, ok := d.msgs[receipt.MessageID]
+	if !ok {
+		return
+	}
+
+	if current := d.reads[receipt.ConversationID][receipt.UserID]; current != nil && !d.advances(current, msg) {
+		return
+	}
+
+	if d.reads[receipt.ConversationID] == nil {
+		d.reads[receipt.ConversationID] = map[string]*models.Receipt{}
+	}
+	d.reads[receipt.ConversationID][receipt.UserID] = receipt
+}
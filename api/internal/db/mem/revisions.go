@@ -0,0 +1,119 @@
+package mem
+
+import (
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// EditMessage - replaces the content of a message, keeping what it said before as a revision. Only the sender can edit,
+// and messages deleted for everyone can't be
+func (d *Driver) EditMessage(id, editor, content string) (*models.Message, error) {
+	if id == "" || editor == "" || content == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	msg, ok := d.msgs[id]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	if msg.Sender != editor || d.deleted(editor) {
+		return nil, constants.ErrForbidden
+	}
+
+	if msg.DeletedAt != nil {
+		return nil, constants.ErrBadRequest
+	}
+
+	now := time.Now()
+	edit := &models.Message{ID: id, Content: content, EditedAt: &now}
+	if err := d.commit(&record{Op: opEditMessage, Message: edit}); err != nil {
+		return nil, err
+	}
+
+	return d.redact(d.msgs[id]), nil
+}
+
+// ListRevisions - lists the earlier content of a message, oldest first. A message that has never been edited has none
+func (d *Driver) ListRevisions(messageID string) ([]*models.Revision, error) {
+	if messageID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	if _, ok := d.msgs[messageID]; !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	revisions := make([]*models.Revision, len(d.revisions[messageID]))
+	for i, revision := range d.revisions[messageID] {
+		copied := *revision
+		revisions[i] = &copied
+	}
+
+	return revisions, nil
+}
+
+// applyEdit - swaps a message for an edited copy everywhere it is stored, and records its old content.
+// Stored messages are never modified, as they may have been handed out. Edits already applied are skipped
+func (d *Driver) applyEdit(edit *models.Message) {
+	old, ok := d.msgs[edit.ID]
+	if !ok || old.DeletedAt != nil || (old.EditedAt != nil && !old.EditedAt.Before(*edit.EditedAt)) {
+		return
+	}
+
+	written := old.Date
+	if old.EditedAt != nil {
+		written = old.EditedAt
+	}
+	d.revisions[old.ID] = append(d.revisions[old.ID], &models.Revision{MessageID: old.ID, Content: old.Content, Date: written})
+
+	edited := *old
+	edited.Content = edit.Content
+	edited.EditedAt = edit.EditedAt
+	d.replace(old, &edited)
+}
+
+// replace - swaps a stored message for a changed copy, in the message index, the recipient's inbox and in the
+// conversation, group or channel it was sent to. Must hold the write lock
+func (d *Driver) replace(old, changed *models.Message) {
+	d.msgs[old.ID] = changed
+	d.reindex(old, changed)
+
+	msgs := d.siblings(old)
+
+	// changes are usually to recent messages, so look from the end
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i] == old {
+			msgs[i] = changed
+			return
+		}
+	}
+}
+
+// siblings - the messages in the conversation, group or channel a message was sent to, oldest first. Must hold the read lock
+func (d *Driver) siblings(msg *models.Message) []*models.Message {
+	switch {
+	case msg.ChannelID != "":
+		if channel, ok := d.channels[msg.ChannelID]; ok {
+			return channel.Messages
+		}
+	case msg.GroupID != "":
+		if group, ok := d.groups[msg.GroupID]; ok {
+			return group.Messages
+		}
+	default:
+		if convo, ok := d.convos[Key{msg.Sender, msg.Recipient}]; ok {
+			return convo.Messages
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package mem
+
+import (
+	"sort"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// CreateRole - creates a custom role in a guild. Names are unique within a guild, and can't be one of the default roles
+func (d *Driver) CreateRole(guildID, name string, perms models.Permission) (*models.Role, error) {
+	if guildID == "" || name == "" || perms&^models.PermAll != 0 {
+		return nil, constants.ErrBadRequest
+	}
+
+	if _, ok := models.DefaultRoles[name]; ok {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if _, ok := d.guilds[guildID]; !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	if _, ok := d.roles[guildID][name]; ok {
+		return nil, constants.ErrBadRequest
+	}
+
+	role := &models.Role{GuildID: guildID, Name: name, Permissions: perms}
+	if err := d.commit(&record{Op: opCreateRole, Role: role}); err != nil {
+		return nil, err
+	}
+
+	copied := *role
+	return &copied, nil
+}
+
+// GetRole - gets a custom role in a guild, the default roles aren't stored
+func (d *Driver) GetRole(guildID, name string) (*models.Role, error) {
+	if guildID == "" || name == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	role, ok := d.roles[guildID][name]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	copied := *role
+	return &copied, nil
+}
+
+// ListRoles - lists the custom roles in a guild by name
+func (d *Driver) ListRoles(guildID string) ([]*models.Role, error) {
+	if guildID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	if _, ok := d.guilds[guildID]; !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	roles := []*models.Role{}
+	for _, role := range d.roles[guildID] {
+		copied := *role
+		roles = append(roles, &copied)
+	}
+
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+
+	return roles, nil
+}
+
+// SetRole - gives a member of a guild another role, either a default or custom one. The owner's role can't
+// change, and no one else can be made owner
+func (d *Driver) SetRole(guildID, userID, role string) (*models.Member, error) {
+	if guildID == "" || userID == "" || role == "" || role == models.RoleOwner {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	member, ok := d.members[guildID][userID]
+	if !ok || d.deleted(userID) {
+		return nil, constants.ErrNotFound
+	}
+
+	if member.Role == models.RoleOwner {
+		return nil, constants.ErrBadRequest
+	}
+
+	if _, ok := models.DefaultRoles[role]; !ok {
+		if _, ok := d.roles[guildID][role]; !ok {
+			return nil, constants.ErrNotFound
+		}
+	}
+
+	updated := *member
+	updated.Role = role
+	if err := d.commit(&record{Op: opSetRole, Member: &updated}); err != nil {
+		return nil, err
+	}
+
+	return d.copyMember(&updated), nil
+}
+
+// MuteMember - stops a member of a guild sending to its channels until a time, a zero time lets them again. Mutes
+// are kept when a member leaves, so leaving and rejoining doesn't get around one
+func (d *Driver) MuteMember(guildID, userID string, until time.Time) (*models.Member, error) {
+	if guildID == "" || userID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	member, ok := d.members[guildID][userID]
+	if !ok || d.deleted(userID) {
+		return nil, constants.ErrNotFound
+	}
+
+	rec := &record{Op: opMuteMember, ID: guildID, UserID: userID}
+	if !until.IsZero() {
+		rec.Date = &until
+	}
+
+	if err := d.commit(rec); err != nil {
+		return nil, err
+	}
+
+	return d.copyMember(member), nil
+}
+
+// applyMute - records when a member is muted until, a nil until lifts the mute. Must hold the write lock
+func (d *Driver) applyMute(guildID, userID string, until *time.Time) {
+	if until == nil {
+		delete(d.mutes[guildID], userID)
+		return
+	}
+
+	if d.mutes[guildID] == nil {
+		d.mutes[guildID] = map[string]time.Time{}
+	}
+	d.mutes[guildID][userID] = *until
+}
+
+// addRole - indexes a custom role by guild and name. Must hold the write lock
+func (d *Driver) addRole(role *models.Role) {
+	if d.roles[role.GuildID] == nil {
+		d.roles[role.GuildID] = map[string]*models.Role{}
+	}
+	d.roles[role.GuildID][role.Name] = role
+}
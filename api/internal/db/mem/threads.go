@@ -0,0 +1,96 @@
+package mem
+
+import (
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// ListReplies - lists the replies to a message, oldest first
+// from and until times can be passed to further narrow results to replies sent in the timeframe
+// if a 0 time is passed for either of these values, that filtering parameter is ignored
+// if limit is 0, it is ignored, otherwise only the most recent replies, up to a count of limit, are returned
+func (d *Driver) ListReplies(parentID string, from, until time.Time, limit int) ([]*models.Message, error) {
+	if parentID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	// if until is 0 time, set to now
+	if until.Equal(time.Time{}) {
+		until = time.Now()
+	}
+
+	if from.After(until) {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	parent, ok := d.msgs[parentID]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	// replies are sent to the same place as their parent, which is already oldest first
+	msgs := []*models.Message{}
+	for _, msg := range d.siblings(parent) {
+		if msg.ParentID == parentID &&
+			(msg.Date.After(from) || msg.Date.Equal(from)) &&
+			(msg.Date.Before(until) || msg.Date.Equal(until)) {
+			msgs = append(msgs, d.redact(msg))
+		}
+	}
+
+	if limit > 0 && len(msgs) > limit {
+		msgs = msgs[len(msgs)-limit:]
+	}
+
+	return msgs, nil
+}
+
+// checkParent - for a reply, not found unless its parent exists, and a bad request unless the parent was sent to
+// the same place and isn't a reply itself. Threads are only one level deep. Must hold the read lock
+func (d *Driver) checkParent(msg *models.Message) error {
+	if msg.ParentID == "" {
+		return nil
+	}
+
+	parent, ok := d.msgs[msg.ParentID]
+	if !ok {
+		return constants.ErrNotFound
+	}
+
+	if parent.ParentID != "" || parent.GroupID != msg.GroupID || parent.ChannelID != msg.ChannelID {
+		return constants.ErrBadRequest
+	}
+
+	// a message to a single recipient can reply to a message sent either way between the pair
+	if msg.GroupID == "" && msg.ChannelID == "" &&
+		!(parent.Sender == msg.Sender && parent.Recipient == msg.Recipient) &&
+		!(parent.Sender == msg.Recipient && parent.Recipient == msg.Sender) {
+		return constants.ErrBadRequest
+	}
+
+	return nil
+}
+
+// applyReply - counts a new reply on its parent, swapping the parent for an updated copy. Must hold the write lock
+func (d *Driver) applyReply(msg *models.Message) {
+	if msg.ParentID == "" {
+		return
+	}
+
+	parent, ok := d.msgs[msg.ParentID]
+	if !ok {
+		return
+	}
+
+	updated := *parent
+	updated.ReplyCount++
+	if updated.LastReplyAt == nil || msg.Date.After(*updated.LastReplyAt) {
+		updated.LastReplyAt = msg.Date
+	}
+	d.replace(parent, &updated)
+}
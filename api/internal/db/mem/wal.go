@@ -0,0 +1,687 @@
+package mem
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// Persistence for the in-memory driver. Every mutation is appended to a write-ahead log before it is
+// applied to the maps, and the log is periodically compacted into a snapshot of the whole datastore.
+// On boot the snapshot is loaded and the log replayed on top of it. This is meant for durable dev and
+// test servers, anything larger should use a real database driver
+
+const (
+	snapshotFile = "snapshot.json"
+	walFile      = "wal.log"
+)
+
+// operations recorded in the write-ahead log
+const (
+	opCreateUser         = "create_user"
+	opDeleteUser         = "delete_user"
+	opCreateConversation = "create_conversation"
+	opCreateMessage      = "create_message"
+	opSetPassword        = "set_password"
+	opCreateReset        = "create_reset"
+	opConsumeReset       = "consume_reset"
+	opCreateGroup        = "create_group"
+	opAddParticipant     = "add_participant"
+	opRemoveParticipant  = "remove_participant"
+	opCreateGuild        = "create_guild"
+	opAddMember          = "add_member"
+	opRemoveMember       = "remove_member"
+	opCreateChannel      = "create_channel"
+	opCreateRole         = "create_role"
+	opSetRole            = "set_role"
+	opEditMessage        = "edit_message"
+	opDeleteMessage      = "delete_message"
+	opHideMessage        = "hide_message"
+	opAddReaction        = "add_reaction"
+	opRemoveReaction     = "remove_reaction"
+	opAddAttachment      = "add_attachment"
+	opMarkRead           = "mark_read"
+	opCreateWebhook      = "create_webhook"
+	opDeleteWebhook      = "delete_webhook"
+	opCreateDelivery     = "create_delivery"
+	opUpdateDelivery     = "update_delivery"
+	opCreateAPIKey       = "create_api_key"
+	opRevokeAPIKey       = "revoke_api_key"
+	opTouchAPIKey        = "touch_api_key"
+	opMuteMember         = "mute_member"
+	opCreateCommand      = "create_command"
+	opDeleteCommand      = "delete_command"
+)
+
+type (
+	// Config - settings for a persistent in-memory driver
+	Config struct {
+		Dir              string        // directory holding the snapshot and write-ahead log, created if it doesn't exist
+		SnapshotInterval time.Duration // how often the log is compacted into a snapshot, 0 only snapshots on Close
+	}
+
+	// record - a single mutation in the write-ahead log. Records carry generated ids and times, so
+	// replaying them rebuilds exactly the same state
+	record struct {
+		Op           string               `json:"op"`
+		User         *models.User         `json:"user,omitempty"`
+		Message      *models.Message      `json:"message,omitempty"`
+		Conversation *models.Conversation `json:"conversation,omitempty"`
+		Guild        *models.Guild        `json:"guild,omitempty"`
+		Channel      *models.Channel      `json:"channel,omitempty"`
+		Member       *models.Member       `json:"member,omitempty"`
+		Role         *models.Role         `json:"role,omitempty"`
+		Attachment   *models.Attachment   `json:"attachment,omitempty"`
+		Receipt      *models.Receipt      `json:"receipt,omitempty"`
+		Webhook      *models.Webhook      `json:"webhook,omitempty"`
+		Delivery     *models.Delivery     `json:"delivery,omitempty"`
+		APIKey       *APIKey              `json:"api_key,omitempty"`
+		Command      *models.Command      `json:"command,omitempty"`
+		ID           string               `json:"id,omitempty"`
+		UserID       string               `json:"user_id,omitempty"`
+		Hash         string               `json:"hash,omitempty"`
+		Emoji        string               `json:"emoji,omitempty"`
+		Date         *time.Time           `json:"date,omitempty"`
+	}
+
+	// snapshot - the whole datastore. Messages are stored inside their conversation, group or channel,
+	// and channels inside their guild
+	snapshot struct {
+		Users         []*models.User                        `json:"users"`
+		Conversations []*models.Conversation                `json:"conversations"`
+		Groups        []*models.Conversation                `json:"groups"`
+		Guilds        []*models.Guild                       `json:"guilds"`
+		Members       []*models.Member                      `json:"members"`
+		Roles         []*models.Role                        `json:"roles"`
+		Mutes         map[string]map[string]time.Time       `json:"mutes"`
+		Revisions     map[string][]*models.Revision         `json:"revisions"`
+		Hidden        map[string]map[string]bool            `json:"hidden"`
+		Reactions     map[string][]*Reaction                `json:"reactions"`
+		Attachments   map[string][]*models.Attachment       `json:"attachments"`
+		Receipts      map[string]map[string]*models.Receipt `json:"receipts"`
+		Webhooks      []*models.Webhook                     `json:"webhooks"`
+		Deliveries    map[string][]*models.Delivery         `json:"deliveries"`
+		APIKeys       []*APIKey                             `json:"api_keys"`
+		Commands      []*models.Command                     `json:"commands"`
+		Passwords     map[string]string                     `json:"passwords"`
+		Resets        map[string]*Reset                     `json:"resets"`
+	}
+
+	wal struct {
+		dir  string
+		file *os.File
+		stop chan struct{}
+		done chan struct{}
+	}
+)
+
+// NewPersistentDriver - creates an in-memory database driver backed by a write-ahead log and snapshots
+// in cfg.Dir, replaying any existing snapshot and log into memory first
+func NewPersistentDriver(cfg Config) (*Driver, error) {
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	d := NewDriver()
+
+	if err := d.loadSnapshot(filepath.Join(cfg.Dir, snapshotFile)); err != nil {
+		return nil, err
+	}
+
+	if err := d.replay(filepath.Join(cfg.Dir, walFile)); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(cfg.Dir, walFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	d.wal = &wal{
+		dir:  cfg.Dir,
+		file: file,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go d.snapshotEvery(cfg.SnapshotInterval)
+
+	return d, nil
+}
+
+// Close - takes a final snapshot and closes the write-ahead log. A purely in-memory driver has nothing to close
+func (d *Driver) Close() error {
+	if d.wal == nil {
+		return nil
+	}
+
+	close(d.wal.stop)
+	<-d.wal.done
+
+	if err := d.Snapshot(); err != nil {
+		return err
+	}
+
+	return d.wal.file.Close()
+}
+
+// Snapshot - writes the whole datastore to the snapshot file and truncates the write-ahead log
+func (d *Driver) Snapshot() error {
+	if d.wal == nil {
+		return nil
+	}
+
+	// writers are blocked for the duration so the snapshot and log can't drift apart
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	snap := snapshot{
+		Users:         make([]*models.User, 0, len(d.users)),
+		Conversations: []*models.Conversation{},
+		Groups:        make([]*models.Conversation, 0, len(d.groups)),
+		Guilds:        make([]*models.Guild, 0, len(d.guilds)),
+		Members:       []*models.Member{},
+		Roles:         []*models.Role{},
+		Mutes:         d.mutes,
+		Revisions:     d.revisions,
+		Hidden:        d.hidden,
+		Reactions:     d.reactions,
+		Attachments:   d.files,
+		Receipts:      d.reads,
+		Webhooks:      make([]*models.Webhook, 0, len(d.hooks)),
+		Deliveries:    d.logs,
+		APIKeys:       make([]*APIKey, 0, len(d.keys)),
+		Commands:      make([]*models.Command, 0, len(d.commands)),
+		Passwords:     d.passwords,
+		Resets:        d.resets,
+	}
+
+	for _, user := range d.users {
+		snap.Users = append(snap.Users, user)
+	}
+
+	// conversations are stored under both keys, only keep one
+	for key, convo := range d.convos {
+		if key.Sender == convo.Sender && key.Recipient == convo.Recipient {
+			snap.Conversations = append(snap.Conversations, convo)
+		}
+	}
+
+	for _, group := range d.groups {
+		snap.Groups = append(snap.Groups, group)
+	}
+
+	for _, guild := range d.guilds {
+		snap.Guilds = append(snap.Guilds, guild)
+	}
+
+	for _, members := range d.members {
+		for _, member := range members {
+			snap.Members = append(snap.Members, member)
+		}
+	}
+
+	for _, roles := range d.roles {
+		for _, role := range roles {
+			snap.Roles = append(snap.Roles, role)
+		}
+	}
+
+	for _, hook := range d.hooks {
+		snap.Webhooks = append(snap.Webhooks, hook)
+	}
+
+	for _, key := range d.keys {
+		snap.APIKeys = append(snap.APIKeys, key)
+	}
+
+	for _, cmd := range d.commands {
+		snap.Commands = append(snap.Commands, cmd)
+	}
+
+	// write to a temporary file and rename it over the old snapshot, so a crash never leaves a partial snapshot
+	path := filepath.Join(d.wal.dir, snapshotFile)
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(tmp).Encode(snap); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	// everything in the log is now in the snapshot. If we crash before truncating, replaying the
+	// log again is harmless as applying a record is idempotent
+	return d.wal.file.Truncate(0)
+}
+
+// snapshotEvery - compacts the log on an interval until the driver is closed
+func (d *Driver) snapshotEvery(interval time.Duration) {
+	defer close(d.wal.done)
+
+	if interval <= 0 {
+		<-d.wal.stop
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// a failed snapshot leaves the log intact, so nothing is lost - try again next tick
+			d.Snapshot()
+		case <-d.wal.stop:
+			return
+		}
+	}
+}
+
+// commit - appends a record to the write-ahead log, if there is one, then applies it. Must hold the write lock
+func (d *Driver) commit(rec *record) error {
+	if d.wal != nil {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+
+		if _, err := d.wal.file.Write(append(line, '\n')); err != nil {
+			return err
+		}
+
+		if err := d.wal.file.Sync(); err != nil {
+			return err
+		}
+	}
+
+	d.apply(rec)
+	return nil
+}
+
+// apply - applies a single record to the maps. Applying a record twice has no further effect
+func (d *Driver) apply(rec *record) {
+	switch rec.Op {
+	case opCreateUser:
+		d.users[rec.User.ID] = rec.User
+		if rec.Hash != "" {
+			d.passwords[rec.User.ID] = rec.Hash
+		}
+
+	case opDeleteUser:
+		if user, ok := d.users[rec.ID]; ok {
+			user.ArchivedOn = rec.Date
+		}
+
+		// their bots go with them
+		for _, user := range d.users {
+			if user.Bot && user.Owner == rec.ID && user.ArchivedOn == nil {
+				user.ArchivedOn = rec.Date
+			}
+		}
+
+	case opCreateConversation:
+		convo := rec.Conversation
+		if _, ok := d.convos[Key{convo.Sender, convo.Recipient}]; ok {
+			return
+		}
+
+		if convo.Messages == nil {
+			convo.Messages = []*models.Message{}
+		}
+
+		// the same conversation should exist, no matter which way we are looking at it
+		d.convos[Key{convo.Sender, convo.Recipient}] = convo
+		d.convos[Key{convo.Recipient, convo.Sender}] = convo
+
+	case opCreateMessage:
+		msg := rec.Message
+		if _, ok := d.msgs[msg.ID]; ok {
+			return
+		}
+
+		d.msgs[msg.ID] = msg
+		d.index(msg)
+		d.applyReply(msg)
+
+		if msg.ChannelID != "" {
+			if channel, ok := d.channels[msg.ChannelID]; ok {
+				channel.Messages = append(channel.Messages, msg)
+				channel.Updated = msg.Date
+				if guild, ok := d.guilds[channel.GuildID]; ok {
+					guild.Updated = msg.Date
+				}
+			}
+			return
+		}
+
+		if msg.GroupID != "" {
+			if group, ok := d.groups[msg.GroupID]; ok {
+				group.Messages = append(group.Messages, msg)
+				group.Updated = msg.Date
+			}
+			return
+		}
+
+		if convo, ok := d.convos[Key{msg.Sender, msg.Recipient}]; ok {
+			convo.Messages = append(convo.Messages, msg)
+			convo.Updated = msg.Date
+		}
+
+	case opSetPassword:
+		d.passwords[rec.ID] = rec.Hash
+
+	case opCreateReset:
+		d.resets[rec.Hash] = &Reset{UserID: rec.ID, Expires: *rec.Date}
+
+	case opConsumeReset:
+		delete(d.resets, rec.Hash)
+
+	case opCreateGroup:
+		group := rec.Conversation
+		if _, ok := d.groups[group.ID]; ok {
+			return
+		}
+
+		if group.Messages == nil {
+			group.Messages = []*models.Message{}
+		}
+
+		d.groups[group.ID] = group
+
+	case opAddParticipant:
+		if group, ok := d.groups[rec.ID]; ok && !contains(group.Participants, rec.UserID) {
+			group.Participants = append(group.Participants, rec.UserID)
+		}
+
+	case opRemoveParticipant:
+		if group, ok := d.groups[rec.ID]; ok {
+			participants := []string{}
+			for _, id := range group.Participants {
+				if id != rec.UserID {
+					participants = append(participants, id)
+				}
+			}
+			group.Participants = participants
+		}
+
+	case opCreateGuild:
+		guild := rec.Guild
+		if _, ok := d.guilds[guild.ID]; ok {
+			return
+		}
+
+		d.guilds[guild.ID] = guild
+		for _, channel := range guild.Channels {
+			d.addChannel(channel)
+		}
+
+		// the owner joins as the guild is created
+		d.members[guild.ID] = map[string]*models.Member{
+			guild.Owner: {GuildID: guild.ID, UserID: guild.Owner, Role: models.RoleOwner, Joined: guild.Created},
+		}
+
+	case opAddMember:
+		member := rec.Member
+		if members, ok := d.members[member.GuildID]; ok {
+			if _, ok := members[member.UserID]; !ok {
+				members[member.UserID] = member
+			}
+		}
+
+	case opRemoveMember:
+		if members, ok := d.members[rec.ID]; ok {
+			delete(members, rec.UserID)
+		}
+
+	case opCreateChannel:
+		channel := rec.Channel
+		if _, ok := d.channels[channel.ID]; ok {
+			return
+		}
+
+		if guild, ok := d.guilds[channel.GuildID]; ok {
+			guild.Channels = append(guild.Channels, channel)
+			d.addChannel(channel)
+		}
+
+	case opCreateRole:
+		d.addRole(rec.Role)
+
+	case opEditMessage:
+		d.applyEdit(rec.Message)
+
+	case opDeleteMessage:
+		d.applyDelete(rec.ID, rec.Date)
+
+	case opHideMessage:
+		if d.hidden[rec.UserID] == nil {
+			d.hidden[rec.UserID] = map[string]bool{}
+		}
+		d.hidden[rec.UserID][rec.ID] = true
+
+	case opAddReaction:
+		d.applyReaction(rec.ID, &Reaction{UserID: rec.UserID, Emoji: rec.Emoji, Date: *rec.Date})
+
+	case opRemoveReaction:
+		d.removeReaction(rec.ID, rec.UserID, rec.Emoji)
+
+	case opAddAttachment:
+		d.applyAttachment(rec.Attachment)
+
+	case opMarkRead:
+		d.applyRead(rec.Receipt)
+
+	case opCreateWebhook:
+		if _, ok := d.hooks[rec.Webhook.ID]; !ok {
+			d.hooks[rec.Webhook.ID] = rec.Webhook
+		}
+
+	case opDeleteWebhook:
+		d.applyDeleteWebhook(rec.ID)
+
+	case opCreateDelivery, opUpdateDelivery:
+		d.applyDelivery(rec.Delivery)
+
+	case opCreateAPIKey:
+		if _, ok := d.keys[rec.APIKey.ID]; !ok {
+			d.keys[rec.APIKey.ID] = rec.APIKey
+			d.keyHashes[rec.APIKey.Hash] = rec.APIKey.ID
+		}
+
+	case opRevokeAPIKey:
+		if key, ok := d.keys[rec.ID]; ok && key.Revoked == nil {
+			key.Revoked = rec.Date
+		}
+
+	case opTouchAPIKey:
+		if key, ok := d.keys[rec.ID]; ok && (key.LastUsed == nil || key.LastUsed.Before(*rec.Date)) {
+			key.LastUsed = rec.Date
+		}
+
+	case opSetRole:
+		if member, ok := d.members[rec.Member.GuildID][rec.Member.UserID]; ok {
+			member.Role = rec.Member.Role
+		}
+
+	case opMuteMember:
+		d.applyMute(rec.ID, rec.UserID, rec.Date)
+
+	case opCreateCommand:
+		if _, ok := d.commands[rec.Command.ID]; !ok {
+			d.commands[rec.Command.ID] = rec.Command
+		}
+
+	case opDeleteCommand:
+		delete(d.commands, rec.ID)
+	}
+}
+
+// loadSnapshot - loads a snapshot into the maps, a missing snapshot is an empty datastore
+func (d *Driver) loadSnapshot(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	snap := snapshot{}
+	if err := json.NewDecoder(file).Decode(&snap); err != nil {
+		return fmt.Errorf("reading snapshot %s: %w", path, err)
+	}
+
+	for _, user := range snap.Users {
+		d.users[user.ID] = user
+	}
+
+	for _, convo := range snap.Conversations {
+		d.convos[Key{convo.Sender, convo.Recipient}] = convo
+		d.convos[Key{convo.Recipient, convo.Sender}] = convo
+		for _, msg := range convo.Messages {
+			d.msgs[msg.ID] = msg
+			d.index(msg)
+		}
+	}
+
+	for _, group := range snap.Groups {
+		d.groups[group.ID] = group
+		for _, msg := range group.Messages {
+			d.msgs[msg.ID] = msg
+		}
+	}
+
+	for _, guild := range snap.Guilds {
+		d.guilds[guild.ID] = guild
+		d.members[guild.ID] = map[string]*models.Member{}
+		for _, channel := range guild.Channels {
+			d.addChannel(channel)
+			for _, msg := range channel.Messages {
+				d.msgs[msg.ID] = msg
+			}
+		}
+	}
+
+	for _, member := range snap.Members {
+		if members, ok := d.members[member.GuildID]; ok {
+			members[member.UserID] = member
+		}
+	}
+
+	for _, role := range snap.Roles {
+		d.addRole(role)
+	}
+
+	for guildID, mutes := range snap.Mutes {
+		d.mutes[guildID] = mutes
+	}
+
+	for id, revisions := range snap.Revisions {
+		d.revisions[id] = revisions
+	}
+
+	for userID, hidden := range snap.Hidden {
+		d.hidden[userID] = hidden
+	}
+
+	for id, reactions := range snap.Reactions {
+		d.reactions[id] = reactions
+	}
+
+	for id, files := range snap.Attachments {
+		d.files[id] = files
+	}
+
+	for id, reads := range snap.Receipts {
+		d.reads[id] = reads
+	}
+
+	for _, hook := range snap.Webhooks {
+		d.hooks[hook.ID] = hook
+	}
+
+	for id, log := range snap.Deliveries {
+		d.logs[id] = log
+		for _, delivery := range log {
+			d.deliveries[delivery.ID] = delivery
+		}
+	}
+
+	for _, key := range snap.APIKeys {
+		d.keys[key.ID] = key
+		d.keyHashes[key.Hash] = key.ID
+	}
+
+	for _, cmd := range snap.Commands {
+		d.commands[cmd.ID] = cmd
+	}
+
+	for id, hash := range snap.Passwords {
+		d.passwords[id] = hash
+	}
+
+	for hash, reset := range snap.Resets {
+		d.resets[hash] = reset
+	}
+
+	return nil
+}
+
+// replay - applies every record in the write-ahead log, a missing log has nothing to replay.
+// A final record without a trailing newline was torn by a crash mid-write, it is dropped and
+// cut from the log so new records aren't appended onto it
+func (d *Driver) replay(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var good int64
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				return os.Truncate(path, good)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rec := &record{}
+		if err := json.Unmarshal(line, rec); err != nil {
+			return fmt.Errorf("reading %s line %d: %w", path, lineNum, err)
+		}
+
+		d.apply(rec)
+		good += int64(len(line))
+	}
+}
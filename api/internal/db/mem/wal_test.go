@@ -0,0 +1,213 @@
+package mem
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func TestPersistence(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(t *testing.T, d *Driver, dir string)
+	}{
+		{
+			name: "Close",
+			stop: func(t *testing.T, d *Driver, dir string) {
+				if err := d.Close(); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "CrashWithoutSnapshot",
+			stop: func(t *testing.T, d *Driver, dir string) {
+				crash(d)
+			},
+		},
+		{
+			name: "CrashAfterSnapshot",
+			stop: func(t *testing.T, d *Driver, dir string) {
+				if err := d.Snapshot(); err != nil {
+					t.Fatal(err)
+				}
+
+				// writes after the snapshot only exist in the log
+				populate(t, d, "dave", "erin")
+				crash(d)
+			},
+		},
+		{
+			name: "TornFinalLine",
+			stop: func(t *testing.T, d *Driver, dir string) {
+				crash(d)
+				appendFile(t, filepath.Join(dir, walFile), `{"op":"create_user","user":{"id":"torn`)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "guild-mem")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			d := openDriver(t, dir)
+			populate(t, d, "alice", "bob")
+			tt.stop(t, d, dir)
+
+			want := dump(t, d)
+
+			reopened := openDriver(t, dir)
+			if got := dump(t, reopened); got != want {
+				t.Fatalf("reopened state differs\nexpected %s\ngot      %s", want, got)
+			}
+
+			// the reopened log takes new writes, and they survive another crash - a torn line left in the log would corrupt them
+			populate(t, reopened, "frank", "grace")
+			crash(reopened)
+			want = dump(t, reopened)
+
+			again := openDriver(t, dir)
+			defer again.Close()
+
+			if got := dump(t, again); got != want {
+				t.Fatalf("state after writing to the reopened log differs\nexpected %s\ngot      %s", want, got)
+			}
+		})
+	}
+}
+
+func TestPersistenceCorruptLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "guild-mem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := openDriver(t, dir)
+	populate(t, d, "alice", "bob")
+	crash(d)
+
+	// only a final line without a newline can be a torn write, anything else is refused
+	appendFile(t, filepath.Join(dir, walFile), "not json\n")
+
+	if _, err := NewPersistentDriver(Config{Dir: dir}); err == nil {
+		t.Fatal("expected an error replaying a corrupt log")
+	}
+}
+
+// openDriver - opens a persistent driver on dir, failing the test on error
+func openDriver(t *testing.T, dir string) *Driver {
+	t.Helper()
+
+	d, err := NewPersistentDriver(Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// populate - two users with a conversation, messages both ways and a deleted third user who sent one
+func populate(t *testing.T, d *Driver, sender, recipient string) {
+	t.Helper()
+
+	a, err := d.CreateUser(&models.User{Username: sender, Email: sender + "@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.CreateUser(&models.User{Username: recipient, Email: recipient + "@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gone, err := d.CreateUser(&models.User{Username: sender + "-gone", Email: sender + "-gone@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.CreateConversation(a.ID, b.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := []*models.Message{
+		{Sender: a.ID, Recipient: b.ID, Content: "hi"},
+		{Sender: b.ID, Recipient: a.ID, Content: "hello"},
+		{Sender: gone.ID, Recipient: a.ID, Content: "bye"},
+	}
+	for _, msg := range msgs {
+		if _, err := d.CreateMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := d.DeleteUser(gone.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// crash - stops the driver without a final snapshot, leaving the files as a killed process would
+func crash(d *Driver) {
+	close(d.wal.stop)
+	<-d.wal.done
+	d.wal.file.Close()
+}
+
+// appendFile - appends raw bytes to a file, failing the test on error
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dump - the whole datastore as JSON in a stable order, times are compared as they are serialised
+func dump(t *testing.T, d *Driver) string {
+	t.Helper()
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	state := struct {
+		Users         []*models.User
+		Messages      []*models.Message
+		Conversations []*models.Conversation
+	}{}
+
+	for _, user := range d.users {
+		state.Users = append(state.Users, user)
+	}
+	sort.Slice(state.Users, func(i, j int) bool { return state.Users[i].ID < state.Users[j].ID })
+
+	for _, msg := range d.msgs {
+		state.Messages = append(state.Messages, msg)
+	}
+	sort.Slice(state.Messages, func(i, j int) bool { return state.Messages[i].ID < state.Messages[j].ID })
+
+	for key, convo := range d.convos {
+		if key.Sender == convo.Sender && key.Recipient == convo.Recipient {
+			state.Conversations = append(state.Conversations, convo)
+		}
+	}
+	sort.Slice(state.Conversations, func(i, j int) bool { return state.Conversations[i].ID < state.Conversations[j].ID })
+
+	out, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
@@ -0,0 +1,263 @@
+package mem
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// CreateWebhook - registers a webhook for its owner, or for a guild when it has a GuildID. The owner has to be an
+// active user, and the guild has to exist
+func (d *Driver) CreateWebhook(hook *models.Webhook) (*models.Webhook, error) {
+	if hook.Owner == "" || hook.URL == "" || hook.Secret == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if _, ok := d.users[hook.Owner]; !ok || d.deleted(hook.Owner) {
+		return nil, constants.ErrNotFound
+	}
+
+	if hook.GuildID != "" {
+		if _, ok := d.guilds[hook.GuildID]; !ok {
+			return nil, constants.ErrNotFound
+		}
+	}
+
+	now := time.Now()
+	created := *hook
+	created.ID = uuid.New().String()
+	created.Events = append([]string{}, hook.Events...)
+	created.Created = &now
+
+	if err := d.commit(&record{Op: opCreateWebhook, Webhook: &created}); err != nil {
+		return nil, err
+	}
+
+	return copyWebhook(&created), nil
+}
+
+// GetWebhook - gets a single webhook by id, with its secret
+func (d *Driver) GetWebhook(id string) (*models.Webhook, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	hook, ok := d.hooks[id]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	return copyWebhook(hook), nil
+}
+
+// ListWebhooks - lists a guild's webhooks, or when guildID is empty the owner's own webhooks, in the order they
+// were created
+func (d *Driver) ListWebhooks(owner, guildID string) ([]*models.Webhook, error) {
+	if owner == "" && guildID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	hooks := []*models.Webhook{}
+	for _, hook := range d.hooks {
+		if (guildID != "" && hook.GuildID == guildID) || (guildID == "" && hook.GuildID == "" && hook.Owner == owner) {
+			hooks = append(hooks, copyWebhook(hook))
+		}
+	}
+
+	sort.Slice(hooks, func(i, j int) bool {
+		if hooks[i].Created.Equal(*hooks[j].Created) {
+			return hooks[i].ID < hooks[j].ID
+		}
+		return hooks[i].Created.Before(*hooks[j].Created)
+	})
+
+	return hooks, nil
+}
+
+// DeleteWebhook - deletes a webhook, and its deliveries with it
+func (d *Driver) DeleteWebhook(id string) error {
+	if id == "" {
+		return constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if _, ok := d.hooks[id]; !ok {
+		return constants.ErrNotFound
+	}
+
+	return d.commit(&record{Op: opDeleteWebhook, ID: id})
+}
+
+// CreateDelivery - records an event about to be posted to a webhook, as pending
+func (d *Driver) CreateDelivery(delivery *models.Delivery) (*models.Delivery, error) {
+	if delivery.WebhookID == "" || delivery.Event == "" || len(delivery.Payload) == 0 {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if _, ok := d.hooks[delivery.WebhookID]; !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	now := time.Now()
+	created := *delivery
+	created.ID = uuid.New().String()
+	created.Status = models.DeliveryPending
+	created.Attempts = 0
+	created.Created = &now
+
+	if err := d.commit(&record{Op: opCreateDelivery, Delivery: &created}); err != nil {
+		return nil, err
+	}
+
+	copied := created
+	return &copied, nil
+}
+
+// GetDelivery - gets a single delivery by id
+func (d *Driver) GetDelivery(id string) (*models.Delivery, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	delivery, ok := d.deliveries[id]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	copied := *delivery
+	return &copied, nil
+}
+
+// UpdateDelivery - records how an attempt at a delivery went: its status, attempts, the last response and when
+// the next attempt is due. Only those change, the event and payload stay as they were created
+func (d *Driver) UpdateDelivery(delivery *models.Delivery) (*models.Delivery, error) {
+	if delivery.ID == "" || !validDeliveryStatus(delivery.Status) || delivery.Attempts < 0 {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	current, ok := d.deliveries[delivery.ID]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	updated := *current
+	updated.Status = delivery.Status
+	updated.Attempts = delivery.Attempts
+	updated.StatusCode = delivery.StatusCode
+	updated.Error = delivery.Error
+	updated.LastAttempt = delivery.LastAttempt
+	updated.NextAttempt = delivery.NextAttempt
+
+	if err := d.commit(&record{Op: opUpdateDelivery, Delivery: &updated}); err != nil {
+		return nil, err
+	}
+
+	copied := updated
+	return &copied, nil
+}
+
+// ListDeliveries - lists a webhook's deliveries, or every webhook's when webhookID is empty, the most recent first.
+// Passing a status only lists deliveries with it, ie: models.DeliveryFailed for the dead-letter list. A limit of 0
+// lists them all
+func (d *Driver) ListDeliveries(webhookID, status string, limit int) ([]*models.Delivery, error) {
+	if (status != "" && !validDeliveryStatus(status)) || limit < 0 {
+		return nil, constants.ErrBadRequest
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	logs := [][]*models.Delivery{}
+	if webhookID != "" {
+		if _, ok := d.hooks[webhookID]; !ok {
+			return nil, constants.ErrNotFound
+		}
+		logs = append(logs, d.logs[webhookID])
+	} else {
+		for _, log := range d.logs {
+			logs = append(logs, log)
+		}
+	}
+
+	deliveries := []*models.Delivery{}
+	for _, log := range logs {
+		for _, delivery := range log {
+			if status == "" || delivery.Status == status {
+				copied := *delivery
+				deliveries = append(deliveries, &copied)
+			}
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		if deliveries[i].Created.Equal(*deliveries[j].Created) {
+			return deliveries[i].ID > deliveries[j].ID
+		}
+		return deliveries[i].Created.After(*deliveries[j].Created)
+	})
+
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+// applyDeleteWebhook - drops a webhook and its deliveries. Must hold the write lock
+func (d *Driver) applyDeleteWebhook(id string) {
+	for _, delivery := range d.logs[id] {
+		delete(d.deliveries, delivery.ID)
+	}
+
+	delete(d.logs, id)
+	delete(d.hooks, id)
+}
+
+// applyDelivery - adds a delivery to its webhook's log, or replaces it if it is already there. Deliveries for a
+// webhook that has since been deleted are dropped. Must hold the write lock
+func (d *Driver) applyDelivery(delivery *models.Delivery) {
+	if _, ok := d.hooks[delivery.WebhookID]; !ok {
+		return
+	}
+
+	if current, ok := d.deliveries[delivery.ID]; ok {
+		*current = *delivery
+		return
+	}
+
+	d.deliveries[delivery.ID] = delivery
+	d.logs[delivery.WebhookID] = append(d.logs[delivery.WebhookID], delivery)
+}
+
+func validDeliveryStatus(status string) bool {
+	return status == models.DeliveryPending || status == models.DeliveryDelivered || status == models.DeliveryFailed
+}
+
+func copyWebhook(hook *models.Webhook) *models.Webhook {
+	copied := *hook
+	copied.Events = append([]string{}, hook.Events...)
+	return &copied
+}
@@ -0,0 +1,17 @@
+package db
+
+// Order - the direction a listing is returned in. Listings are ordered by date, then id to break ties, and a limit
+// always keeps the most recent messages whichever way they are returned
+type Order int
+
+const (
+	// OldestFirst - ascending by date, then id
+	OldestFirst Order = iota
+	// NewestFirst - descending by date, then id
+	NewestFirst
+)
+
+// Valid - whether the order is one of the known directions
+func (o Order) Valid() bool {
+	return o == OldestFirst || o == NewestFirst
+}
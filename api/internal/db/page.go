@@ -0,0 +1,108 @@
+package db
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+type (
+	// Page - which page of a message listing to fetch. Listings are ordered by date, then id to break ties.
+	// Without a cursor the most recent messages are fetched, Before pages back through older messages and After
+	// pages forward through newer ones. Only one of the cursors can be set
+	Page struct {
+		From   time.Time // only messages sent at or after From, ignored if 0
+		Until  time.Time // only messages sent at or before Until, defaults to now if 0
+		Before *Cursor   // only messages older than the cursor
+		After  *Cursor   // only messages newer than the cursor
+		Limit  int       // the most messages on a page, 0 is no limit
+	}
+
+	// Cursor - a position in a message listing, just after (or before) the message it was taken from
+	Cursor struct {
+		Date time.Time
+		ID   string
+	}
+)
+
+// CursorAt - the position of a message in a listing
+func CursorAt(msg *models.Message) *Cursor {
+	return &Cursor{Date: *msg.Date, ID: msg.ID}
+}
+
+// ParseCursor - reads a cursor back from its opaque form, a bad request if it isn't one
+func ParseCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, constants.ErrBadRequest
+	}
+
+	parts := strings.SplitN(string(data), ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, constants.ErrBadRequest
+	}
+
+	return &Cursor{Date: time.Unix(0, nanos), ID: parts[1]}, nil
+}
+
+// String - the cursor's opaque form, safe to use in a url. Clients should only hand it back, never build one
+func (c *Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.Date.UnixNano(), 10) + "." + c.ID))
+}
+
+// Follows - whether a message comes after the cursor in a listing
+func (c *Cursor) Follows(msg *models.Message) bool {
+	return msg.Date.After(c.Date) || (msg.Date.Equal(c.Date) && msg.ID > c.ID)
+}
+
+// Precedes - whether a message comes before the cursor in a listing
+func (c *Cursor) Precedes(msg *models.Message) bool {
+	return msg.Date.Before(c.Date) || (msg.Date.Equal(c.Date) && msg.ID < c.ID)
+}
+
+// Less - whether message a comes before message b in a listing, by date and then id
+func Less(a, b *models.Message) bool {
+	return a.Date.Before(*b.Date) || (a.Date.Equal(*b.Date) && a.ID < b.ID)
+}
+
+// Check - fills in a 0 Until with now, and is a bad request if the page can't be fetched
+func (p *Page) Check() error {
+	if p.Until.Equal(time.Time{}) {
+		p.Until = time.Now()
+	}
+
+	if p.From.After(p.Until) || p.Limit < 0 || (p.Before != nil && p.After != nil) {
+		return constants.ErrBadRequest
+	}
+
+	return nil
+}
+
+// Trim - cuts a page of messages, fetched oldest first with one more than the limit, down to the limit. The extra
+// message is furthest from the cursor, and only there if there is more to come, in which case the page's
+// NextCursor continues from the last message kept
+func (p *Page) Trim(msgs []*models.Message) *models.MessagePage {
+	page := &models.MessagePage{Messages: msgs}
+	if p.Limit == 0 || len(msgs) <= p.Limit {
+		return page
+	}
+
+	if p.After != nil {
+		page.Messages = msgs[:p.Limit]
+		page.NextCursor = CursorAt(page.Messages[p.Limit-1]).String()
+	} else {
+		page.Messages = msgs[len(msgs)-p.Limit:]
+		page.NextCursor = CursorAt(page.Messages[0]).String()
+	}
+
+	return page
+}
@@ -0,0 +1,110 @@
+package pg
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// selectAttachment - attachment columns
+const selectAttachment = `SELECT id, message_id, name, size, mime_type, checksum, date FROM attachments`
+
+// AddAttachment - records a file attached to a message, once it is in blob storage under att.ID. Only the sender
+// can attach files to a message, and messages deleted for everyone can't have files attached
+func (d *Driver) AddAttachment(uploader string, att *models.Attachment) (*models.Attachment, error) {
+	if uploader == "" || att.ID == "" || att.MessageID == "" || att.Name == "" || att.Size < 0 {
+		return nil, constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// the share lock holds off a delete until the attachment is in, or the delete would miss it
+	msg, err := scanMessage(tx.QueryRow(selectMessage+` WHERE m.id = $1 FOR SHARE OF m`, att.MessageID))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// a deleted sender is redacted, so can't match
+	if msg.Sender != uploader {
+		return nil, constants.ErrForbidden
+	}
+
+	if msg.DeletedAt != nil {
+		return nil, constants.ErrBadRequest
+	}
+
+	now := timestamp()
+	if _, err := tx.Exec(`
+		INSERT INTO attachments (id, message_id, name, size, mime_type, checksum, date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		att.ID, att.MessageID, att.Name, att.Size, att.MIMEType, att.Checksum, now); err != nil {
+		return nil, translate(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	att.Date = &now
+
+	return att, nil
+}
+
+// GetAttachment - gets a file attached to a message
+func (d *Driver) GetAttachment(messageID, id string) (*models.Attachment, error) {
+	if messageID == "" || id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	att, err := scanAttachment(d.db.QueryRow(selectAttachment+` WHERE message_id = $1 AND id = $2`, messageID, id))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return att, nil
+}
+
+// loadAttachments - fills in the files attached to messages, by id, in the order they were attached
+func loadAttachments(q querier, byID map[string]*models.Message, ids []string) error {
+	rows, err := q.Query(selectAttachment+` WHERE message_id = ANY($1) ORDER BY date, id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		att, err := scanAttachment(rows)
+		if err != nil {
+			return err
+		}
+
+		msg := byID[att.MessageID]
+		msg.Attachments = append(msg.Attachments, att)
+	}
+
+	return rows.Err()
+}
+
+func scanAttachment(row scanner) (*models.Attachment, error) {
+	att := &models.Attachment{}
+	var date time.Time
+	if err := row.Scan(&att.ID, &att.MessageID, &att.Name, &att.Size, &att.MIMEType, &att.Checksum, &date); err != nil {
+		return nil, err
+	}
+	att.Date = &date
+
+	return att, nil
+}
@@ -0,0 +1,101 @@
+package pg
+
+import (
+	"database/sql"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// DeleteMessage - deletes a message for everyone. It keeps its place, with its content replaced by a tombstone
+// and its revisions, reactions and attachments dropped. Deleting a message that is already deleted changes nothing
+func (d *Driver) DeleteMessage(id string) (*models.Message, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE messages SET content = $2, deleted_at = $3 WHERE id = $1 AND deleted_at IS NULL`,
+		id, constants.DeletedMessage, timestamp())
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing is left of what it used to say
+	if affected > 0 {
+		if _, err := tx.Exec(`DELETE FROM message_revisions WHERE message_id = $1`, id); err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.Exec(`DELETE FROM reactions WHERE message_id = $1`, id); err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.Exec(`DELETE FROM attachments WHERE message_id = $1`, id); err != nil {
+			return nil, err
+		}
+	}
+
+	msg, err := scanMessage(tx.QueryRow(selectMessage+` WHERE m.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// HideMessage - hides a message from a single user's listings, everyone else still sees it. Hiding a message twice changes nothing
+func (d *Driver) HideMessage(id, userID string) error {
+	if id == "" || userID == "" {
+		return constants.ErrBadRequest
+	}
+
+	// nothing is inserted unless both the message and the user exist
+	res, err := d.db.Exec(`
+		INSERT INTO hidden_messages (user_id, message_id)
+		SELECT u.id, m.id FROM users u, messages m
+		WHERE u.id = $1 AND m.id = $2 AND u.archived_on IS NULL
+		ON CONFLICT DO NOTHING`,
+		userID, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected > 0 {
+		return nil
+	}
+
+	var hidden bool
+	if err := d.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM hidden_messages WHERE user_id = $1 AND message_id = $2)`,
+		userID, id).Scan(&hidden); err != nil {
+		return err
+	}
+
+	if !hidden {
+		return constants.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,346 @@
+package pg
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// selectGroup - group conversation columns, with the owner redacted if they have been deleted. Expects
+// groups aliased as g and the owning user as o
+const selectGroup = `
+	SELECT g.id, g.name, CASE WHEN o.archived_on IS NULL THEN g.owner ELSE 'deleted' END, g.updated
+	FROM group_conversations g
+	JOIN users o ON o.id = g.owner`
+
+// CreateGroup - creates a group conversation owned by owner, between the owner and participants
+func (d *Driver) CreateGroup(owner, name string, participants []string) (*models.Conversation, error) {
+	ids, err := groupMembers(owner, participants)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := usersExist(tx, ids...); err != nil {
+		return nil, err
+	}
+
+	id := uuid.New().String()
+	now := timestamp()
+
+	if _, err := tx.Exec(`INSERT INTO group_conversations (id, name, owner, updated) VALUES ($1, $2, $3, $4)`,
+		id, name, owner, now); err != nil {
+		return nil, err
+	}
+
+	for _, userID := range ids {
+		if _, err := tx.Exec(`INSERT INTO group_participants (group_id, user_id, joined) VALUES ($1, $2, $3)`,
+			id, userID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return d.GetGroup(id)
+}
+
+// GetGroup - gets a group conversation and its participants, without its messages
+func (d *Driver) GetGroup(id string) (*models.Conversation, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	group, err := scanGroup(d.db.QueryRow(selectGroup+` WHERE g.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.loadParticipants(group); err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// ListGroups - lists the group conversations a user is a participant in, most recently updated first. Each counts
+// the messages the user hasn't read.
+// from and until times can be passed to further narrow results to groups that have been updated in the timeframe
+// if a 0 time is passed for either of these values, that filtering parameter is ignored
+func (d *Driver) ListGroups(userID string, from, until time.Time) ([]*models.Conversation, error) {
+	if userID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	from, until, err := window(from, until)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := usersExist(d.db, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(selectGroup+`
+		JOIN group_participants p ON p.group_id = g.id
+		WHERE p.user_id = $1 AND g.updated BETWEEN $2 AND $3
+		ORDER BY g.updated DESC`,
+		userID, from, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []*models.Conversation{}
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, group := range groups {
+		if err := d.loadParticipants(group); err != nil {
+			return nil, err
+		}
+
+		if err := loadUnread(d.db, group, "group_id", userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return groups, nil
+}
+
+// AddParticipant - adds a user to a group conversation
+func (d *Driver) AddParticipant(groupID, userID string) error {
+	if groupID == "" || userID == "" {
+		return constants.ErrBadRequest
+	}
+
+	// nothing is inserted unless both the group and the user exist, an existing participant breaks the primary key
+	res, err := d.db.Exec(`
+		INSERT INTO group_participants (group_id, user_id, joined)
+		SELECT g.id, u.id, $3 FROM group_conversations g, users u
+		WHERE g.id = $1 AND u.id = $2 AND u.archived_on IS NULL`,
+		groupID, userID, timestamp())
+	if err != nil {
+		return translate(err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return constants.ErrNotFound
+	}
+
+	return nil
+}
+
+// RemoveParticipant - removes a user from a group conversation, their messages stay in the group
+func (d *Driver) RemoveParticipant(groupID, userID string) error {
+	if groupID == "" || userID == "" {
+		return constants.ErrBadRequest
+	}
+
+	res, err := d.db.Exec(`DELETE FROM group_participants WHERE group_id = $1 AND user_id = $2`, groupID, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return constants.ErrNotFound
+	}
+
+	return nil
+}
+
+// ListGroupMessages - lists the messages sent to a group conversation, oldest first
+// from and until times can be passed to further narrow results to messages sent in the timeframe
+// if a 0 time is passed for either of these values, that filtering parameter is ignored
+// if limit is 0, it is ignored, otherwise only the most recent messages, up to a count of limit, are returned
+func (d *Driver) ListGroupMessages(groupID string, from, until time.Time, limit int) ([]*models.Message, error) {
+	if groupID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	from, until, err := window(from, until)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := groupExists(d.db, groupID); err != nil {
+		return nil, err
+	}
+
+	// a NULL limit is no limit at all
+	var max sql.NullInt64
+	if limit > 0 {
+		max = sql.NullInt64{Int64: int64(limit), Valid: true}
+	}
+
+	return queryMessages(d.db, `
+		SELECT * FROM (`+selectMessage+`
+			WHERE m.group_id = $1 AND m.date BETWEEN $2 AND $3
+			ORDER BY m.date DESC, m.id DESC
+			LIMIT $4
+		) recent ORDER BY date, id`,
+		groupID, from, until, max)
+}
+
+// createGroupMessage - creates a new message in a group conversation, only participants can send them
+func (d *Driver) createGroupMessage(msg *models.Message) (*models.Message, error) {
+	if msg.Sender == "" || msg.Content == "" || msg.Recipient != "" || msg.ChannelID != "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := timestamp()
+
+	// bumping the group first locks its row, so messages to a group are written one at a time
+	res, err := tx.Exec(`UPDATE group_conversations SET updated = $2 WHERE id = $1`, msg.GroupID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if affected == 0 {
+		return nil, constants.ErrNotFound
+	}
+
+	var participant bool
+	if err := tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM group_participants p
+			JOIN users u ON u.id = p.user_id
+			WHERE p.group_id = $1 AND p.user_id = $2 AND u.archived_on IS NULL
+		)`, msg.GroupID, msg.Sender).Scan(&participant); err != nil {
+		return nil, err
+	}
+
+	if !participant {
+		return nil, constants.ErrForbidden
+	}
+
+	if err := replyTo(tx, msg, now); err != nil {
+		return nil, err
+	}
+
+	msg.ID = uuid.New().String()
+	msg.Date = &now
+
+	if _, err := tx.Exec(`INSERT INTO messages (id, group_id, sender, content, date, parent_id) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))`,
+		msg.ID, msg.GroupID, msg.Sender, msg.Content, now, msg.ParentID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// loadParticipants - fills in the participants of a group, in the order they joined. Deleted users are left out
+func (d *Driver) loadParticipants(group *models.Conversation) error {
+	rows, err := d.db.Query(`
+		SELECT p.user_id FROM group_participants p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.group_id = $1 AND u.archived_on IS NULL
+		ORDER BY p.joined, p.user_id`, group.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	group.Participants = []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		group.Participants = append(group.Participants, id)
+	}
+
+	return rows.Err()
+}
+
+// groupExists - returns not found unless the group exists
+func groupExists(q querier, id string) error {
+	var exists bool
+	if err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM group_conversations WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+
+	if !exists {
+		return constants.ErrNotFound
+	}
+
+	return nil
+}
+
+func scanGroup(row scanner) (*models.Conversation, error) {
+	group := &models.Conversation{}
+	var updated time.Time
+	if err := row.Scan(&group.ID, &group.Name, &group.Owner, &updated); err != nil {
+		return nil, err
+	}
+
+	group.Updated = &updated
+	return group, nil
+}
+
+// groupMembers - the owner and participants of a new group, without duplicates
+func groupMembers(owner string, participants []string) ([]string, error) {
+	if owner == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	ids := []string{owner}
+	seen := map[string]bool{owner: true}
+	for _, id := range participants {
+		if id == "" {
+			return nil, constants.ErrBadRequest
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,345 @@
+package pg
+
+import (
+	"database/sql"
+	"time"
+)
+
+// migrations - ordered schema changes. A migration's version is its index + 1, so never reorder
+// or edit a migration that has shipped, only append new ones
+var migrations = []string{
+	// 1 - users, conversations and messages
+	`
+	CREATE TABLE users (
+		id          TEXT PRIMARY KEY,
+		username    TEXT NOT NULL UNIQUE,
+		email       TEXT NOT NULL,
+		archived_on TIMESTAMPTZ
+	);
+
+	CREATE TABLE conversations (
+		id        TEXT PRIMARY KEY,
+		sender    TEXT NOT NULL REFERENCES users (id),
+		recipient TEXT NOT NULL REFERENCES users (id),
+		updated   TIMESTAMPTZ NOT NULL
+	);
+
+	-- a conversation is the same no matter which way we are looking at it
+	CREATE UNIQUE INDEX conversations_pair_idx ON conversations (LEAST(sender, recipient), GREATEST(sender, recipient));
+	CREATE INDEX conversations_recipient_updated_idx ON conversations (recipient, updated);
+	CREATE INDEX conversations_sender_updated_idx ON conversations (sender, updated);
+
+	CREATE TABLE messages (
+		id              TEXT PRIMARY KEY,
+		conversation_id TEXT NOT NULL REFERENCES conversations (id),
+		sender          TEXT NOT NULL REFERENCES users (id),
+		recipient       TEXT NOT NULL REFERENCES users (id),
+		content         TEXT NOT NULL,
+		date            TIMESTAMPTZ NOT NULL
+	);
+
+	CREATE INDEX messages_recipient_date_idx ON messages (recipient, date);
+	CREATE INDEX messages_conversation_date_idx ON messages (conversation_id, date);
+	`,
+
+	// 2 - password credentials and resets, kept apart from users so they are never selected with them
+	`
+	CREATE TABLE credentials (
+		user_id       TEXT PRIMARY KEY REFERENCES users (id),
+		password_hash TEXT NOT NULL,
+		updated       TIMESTAMPTZ NOT NULL
+	);
+
+	CREATE TABLE password_resets (
+		token_hash TEXT PRIMARY KEY,
+		user_id    TEXT NOT NULL REFERENCES users (id),
+		expires    TIMESTAMPTZ NOT NULL
+	);
+
+	CREATE INDEX password_resets_user_idx ON password_resets (user_id);
+	`,
+
+	// 3 - group conversations. Group messages belong to a group instead of a conversation and recipient
+	`
+	CREATE TABLE group_conversations (
+		id      TEXT PRIMARY KEY,
+		name    TEXT NOT NULL,
+		owner   TEXT NOT NULL REFERENCES users (id),
+		updated TIMESTAMPTZ NOT NULL
+	);
+
+	CREATE TABLE group_participants (
+		group_id TEXT NOT NULL REFERENCES group_conversations (id),
+		user_id  TEXT NOT NULL REFERENCES users (id),
+		joined   TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (group_id, user_id)
+	);
+
+	CREATE INDEX group_participants_user_idx ON group_participants (user_id);
+
+	ALTER TABLE messages ALTER COLUMN conversation_id DROP NOT NULL;
+	ALTER TABLE messages ALTER COLUMN recipient DROP NOT NULL;
+	ALTER TABLE messages ADD COLUMN group_id TEXT REFERENCES group_conversations (id);
+
+	CREATE INDEX messages_group_date_idx ON messages (group_id, date);
+	`,
+
+	// 4 - guilds, their members and channels. Channel messages belong to a channel instead of a conversation and recipient
+	`
+	CREATE TABLE guilds (
+		id      TEXT PRIMARY KEY,
+		name    TEXT NOT NULL,
+		owner   TEXT NOT NULL REFERENCES users (id),
+		created TIMESTAMPTZ NOT NULL,
+		updated TIMESTAMPTZ NOT NULL
+	);
+
+	CREATE TABLE guild_members (
+		guild_id TEXT NOT NULL REFERENCES guilds (id),
+		user_id  TEXT NOT NULL REFERENCES users (id),
+		role     TEXT NOT NULL,
+		joined   TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (guild_id, user_id)
+	);
+
+	CREATE INDEX guild_members_user_idx ON guild_members (user_id);
+
+	CREATE TABLE channels (
+		id       TEXT PRIMARY KEY,
+		guild_id TEXT NOT NULL REFERENCES guilds (id),
+		name     TEXT NOT NULL,
+		created  TIMESTAMPTZ NOT NULL,
+		updated  TIMESTAMPTZ NOT NULL,
+		UNIQUE (guild_id, name)
+	);
+
+	ALTER TABLE messages ADD COLUMN channel_id TEXT REFERENCES channels (id);
+
+	CREATE INDEX messages_channel_date_idx ON messages (channel_id, date);
+	`,
+
+	// 5 - custom guild roles. The default roles aren't stored, so members' roles aren't a foreign key
+	`
+	CREATE TABLE guild_roles (
+		guild_id    TEXT NOT NULL REFERENCES guilds (id),
+		name        TEXT NOT NULL,
+		permissions BIGINT NOT NULL,
+		PRIMARY KEY (guild_id, name)
+	);
+	`,
+
+	// 6 - message edits. Earlier content is kept as revisions, oldest first
+	`
+	ALTER TABLE messages ADD COLUMN edited_at TIMESTAMPTZ;
+
+	CREATE TABLE message_revisions (
+		id         BIGSERIAL PRIMARY KEY,
+		message_id TEXT NOT NULL REFERENCES messages (id),
+		content    TEXT NOT NULL,
+		date       TIMESTAMPTZ NOT NULL
+	);
+
+	CREATE INDEX message_revisions_message_idx ON message_revisions (message_id, date);
+	`,
+
+	// 7 - message deletion. Messages deleted for everyone keep their row, messages hidden by a single user are listed apart
+	`
+	ALTER TABLE messages ADD COLUMN deleted_at TIMESTAMPTZ;
+
+	CREATE TABLE hidden_messages (
+		user_id    TEXT NOT NULL REFERENCES users (id),
+		message_id TEXT NOT NULL REFERENCES messages (id),
+		PRIMARY KEY (user_id, message_id)
+	);
+	`,
+
+	// 8 - threaded replies. A parent counts its replies, and when the latest was sent, so threads can be shown collapsed
+	`
+	ALTER TABLE messages ADD COLUMN parent_id TEXT REFERENCES messages (id);
+	ALTER TABLE messages ADD COLUMN reply_count INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE messages ADD COLUMN last_reply_at TIMESTAMPTZ;
+
+	CREATE INDEX messages_parent_date_idx ON messages (parent_id, date);
+	`,
+
+	// 9 - reactions. A user can react to a message with several emoji, but only once with each
+	`
+	CREATE TABLE reactions (
+		message_id TEXT NOT NULL REFERENCES messages (id),
+		user_id    TEXT NOT NULL REFERENCES users (id),
+		emoji      TEXT NOT NULL,
+		date       TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (message_id, user_id, emoji)
+	);
+	`,
+
+	// 10 - attachments. The files themselves are in blob storage under the attachment id
+	`
+	CREATE TABLE attachments (
+		id         TEXT PRIMARY KEY,
+		message_id TEXT NOT NULL REFERENCES messages (id),
+		name       TEXT NOT NULL,
+		size       BIGINT NOT NULL,
+		mime_type  TEXT NOT NULL,
+		checksum   TEXT NOT NULL,
+		date       TIMESTAMPTZ NOT NULL
+	);
+
+	CREATE INDEX attachments_message_date_idx ON attachments (message_id, date);
+	`,
+
+	// 11 - cursor pagination. Listings are ordered by date then id, so pages can pick up exactly where the last left off
+	`
+	DROP INDEX messages_recipient_date_idx;
+	DROP INDEX messages_conversation_date_idx;
+
+	CREATE INDEX messages_recipient_date_idx ON messages (recipient, date, id);
+	CREATE INDEX messages_conversation_date_idx ON messages (conversation_id, date, id);
+	`,
+
+	// 12 - read receipts. Each user has one marker per conversation or group, at the last message they have read
+	`
+	CREATE TABLE read_receipts (
+		conversation_id TEXT NOT NULL,
+		user_id         TEXT NOT NULL REFERENCES users (id),
+		message_id      TEXT NOT NULL REFERENCES messages (id),
+		date            TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (conversation_id, user_id)
+	);
+	`,
+
+	// 13 - outbound webhooks, owned by a user or a guild, and a log of every event posted to them
+	`
+	CREATE TABLE webhooks (
+		id       TEXT PRIMARY KEY,
+		owner    TEXT NOT NULL REFERENCES users (id),
+		guild_id TEXT REFERENCES guilds (id),
+		url      TEXT NOT NULL,
+		events   TEXT[] NOT NULL,
+		secret   TEXT NOT NULL,
+		created  TIMESTAMPTZ NOT NULL
+	);
+
+	CREATE INDEX webhooks_owner_idx ON webhooks (owner);
+	CREATE INDEX webhooks_guild_idx ON webhooks (guild_id);
+
+	-- the payload is kept as text, exactly as it was signed
+	CREATE TABLE webhook_deliveries (
+		id           TEXT PRIMARY KEY,
+		webhook_id   TEXT NOT NULL REFERENCES webhooks (id),
+		event        TEXT NOT NULL,
+		payload      TEXT NOT NULL,
+		status       TEXT NOT NULL,
+		attempts     INTEGER NOT NULL,
+		status_code  INTEGER NOT NULL,
+		error        TEXT NOT NULL,
+		created      TIMESTAMPTZ NOT NULL,
+		last_attempt TIMESTAMPTZ,
+		next_attempt TIMESTAMPTZ
+	);
+
+	CREATE INDEX webhook_deliveries_webhook_created_idx ON webhook_deliveries (webhook_id, created, id);
+	CREATE INDEX webhook_deliveries_status_created_idx ON webhook_deliveries (status, created, id);
+	`,
+
+	// 14 - bot accounts, owned by the user who created them, and API keys. Only a hash of each key is kept
+	`
+	ALTER TABLE users ADD COLUMN bot BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE users ADD COLUMN owner TEXT REFERENCES users (id);
+
+	CREATE INDEX users_owner_idx ON users (owner);
+
+	CREATE TABLE api_keys (
+		id        TEXT PRIMARY KEY,
+		user_id   TEXT NOT NULL REFERENCES users (id),
+		name      TEXT NOT NULL,
+		scopes    TEXT[] NOT NULL,
+		prefix    TEXT NOT NULL,
+		key_hash  TEXT NOT NULL UNIQUE,
+		created   TIMESTAMPTZ NOT NULL,
+		last_used TIMESTAMPTZ,
+		revoked   TIMESTAMPTZ
+	);
+
+	CREATE INDEX api_keys_user_created_idx ON api_keys (user_id, created, id);
+	`,
+	// 15 - slash commands registered by bots, and guild mutes. Mutes are kept apart from membership so that they
+	// outlast leaving and rejoining
+	`
+	CREATE TABLE commands (
+		id          TEXT PRIMARY KEY,
+		bot_id      TEXT NOT NULL REFERENCES users (id),
+		name        TEXT NOT NULL,
+		description TEXT NOT NULL,
+		usage       TEXT NOT NULL,
+		url         TEXT NOT NULL,
+		permissions BIGINT NOT NULL,
+		secret      TEXT NOT NULL,
+		created     TIMESTAMPTZ NOT NULL,
+		UNIQUE (bot_id, name)
+	);
+
+	CREATE INDEX commands_name_idx ON commands (name);
+
+	CREATE TABLE guild_mutes (
+		guild_id TEXT NOT NULL REFERENCES guilds (id),
+		user_id  TEXT NOT NULL REFERENCES users (id),
+		until    TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (guild_id, user_id)
+	);
+	`,
+}
+
+// migrationLock - arbitrary key for the advisory lock held while migrating, so that several
+// instances booting at once don't race each other
+const migrationLock = 7266092
+
+// migrate - brings the schema up to date, applying each outstanding migration in its own transaction
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			applied_on TIMESTAMPTZ NOT NULL
+		)`); err != nil {
+		return err
+	}
+
+	for i, migration := range migrations {
+		if err := applyMigration(db, i+1, migration); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(db *sql.DB, version int, migration string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationLock); err != nil {
+		return err
+	}
+
+	var applied bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied); err != nil {
+		return err
+	}
+
+	if applied {
+		return nil
+	}
+
+	if _, err := tx.Exec(migration); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, applied_on) VALUES ($1, $2)`, version, time.Now()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
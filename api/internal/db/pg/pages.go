@@ -0,0 +1,100 @@
+package pg
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// PageMessages - lists a page of the messages sent to a recipient, leaving out any they have hidden. See db.Page
+func (d *Driver) PageMessages(recipient string, page db.Page) (*models.MessagePage, error) {
+	if recipient == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	if err := page.Check(); err != nil {
+		return nil, err
+	}
+
+	if err := usersExist(d.db, recipient); err != nil {
+		return nil, err
+	}
+
+	// served by messages_recipient_date_idx
+	return pageMessages(d.db, `m.recipient = $1
+		AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.user_id = $1 AND h.message_id = m.id)`,
+		page, recipient)
+}
+
+// PageConversation - lists a page of the messages sent from sender to recipient. See db.Page
+func (d *Driver) PageConversation(sender, recipient string, page db.Page) (*models.MessagePage, error) {
+	if sender == "" || recipient == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	if err := page.Check(); err != nil {
+		return nil, err
+	}
+
+	if err := usersExist(d.db, sender, recipient); err != nil {
+		return nil, err
+	}
+
+	var convoID string
+	err := d.db.QueryRow(`
+		SELECT id FROM conversations
+		WHERE LEAST(sender, recipient) = LEAST($1, $2) AND GREATEST(sender, recipient) = GREATEST($1, $2)`,
+		sender, recipient).Scan(&convoID)
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// served by messages_conversation_date_idx
+	return pageMessages(d.db, `m.conversation_id = $1 AND m.sender = $2`, page, convoID, sender)
+}
+
+// pageMessages - fetches a page of the messages matching where, which refers to args as $1 onwards
+func pageMessages(q querier, where string, page db.Page, args ...interface{}) (*models.MessagePage, error) {
+	param := func(arg interface{}) string {
+		args = append(args, arg)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where += ` AND m.date BETWEEN ` + param(page.From) + ` AND ` + param(page.Until)
+
+	// the page is fetched moving away from the cursor, with one more than the limit so db.Page.Trim can tell
+	// whether there is more to come
+	order := `DESC`
+	switch {
+	case page.After != nil:
+		where += ` AND (m.date, m.id) > (` + param(page.After.Date) + `, ` + param(page.After.ID) + `)`
+		order = `ASC`
+	case page.Before != nil:
+		where += ` AND (m.date, m.id) < (` + param(page.Before.Date) + `, ` + param(page.Before.ID) + `)`
+	}
+
+	// a NULL limit is no limit at all
+	var max sql.NullInt64
+	if page.Limit > 0 {
+		max = sql.NullInt64{Int64: int64(page.Limit) + 1, Valid: true}
+	}
+
+	msgs, err := queryMessages(q, `
+		SELECT * FROM (`+selectMessage+`
+			WHERE `+where+`
+			ORDER BY m.date `+order+`, m.id `+order+`
+			LIMIT `+param(max)+`
+		) page ORDER BY date, id`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return page.Trim(msgs), nil
+}
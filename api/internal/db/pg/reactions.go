@@ -0,0 +1,128 @@
+package pg
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// AddReaction - reacts to a message as a user, returning the message with its reactions. A user can react with
+// several emoji, but only once with each. Messages deleted for everyone can't be reacted to
+func (d *Driver) AddReaction(messageID, userID, emoji string) (*models.Message, error) {
+	if messageID == "" || userID == "" || !models.ValidEmoji(emoji) {
+		return nil, constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// the share lock holds off a delete until the reaction is in, or the delete would miss it
+	msg, err := reactable(tx, messageID, userID, ` FOR SHARE OF m`)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.DeletedAt != nil {
+		return nil, constants.ErrBadRequest
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO reactions (message_id, user_id, emoji, date) VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`,
+		messageID, userID, emoji, timestamp()); err != nil {
+		return nil, err
+	}
+
+	if err := loadDetails(tx, msg); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// RemoveReaction - takes back a user's reaction to a message, returning the message with its remaining reactions.
+// Removing a reaction that isn't there changes nothing
+func (d *Driver) RemoveReaction(messageID, userID, emoji string) (*models.Message, error) {
+	if messageID == "" || userID == "" || emoji == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	msg, err := reactable(tx, messageID, userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3`,
+		messageID, userID, emoji); err != nil {
+		return nil, err
+	}
+
+	if err := loadDetails(tx, msg); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// reactable - the message being reacted to, not found unless both it and the reacting user exist. lock is
+// appended to the query for the message
+func reactable(q querier, messageID, userID, lock string) (*models.Message, error) {
+	msg, err := scanMessage(q.QueryRow(selectMessage+` WHERE m.id = $1`+lock, messageID))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := activeUser(q, userID); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// loadReactions - fills in the reactions to messages, by id, in the order each emoji was first used. Reactions
+// from deleted users are left out
+func loadReactions(q querier, byID map[string]*models.Message, ids []string) error {
+	rows, err := q.Query(`
+		SELECT r.message_id, r.emoji, r.user_id FROM reactions r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.message_id = ANY($1) AND u.archived_on IS NULL
+		ORDER BY r.date, r.user_id, r.emoji`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID, emoji, userID string
+		if err := rows.Scan(&messageID, &emoji, &userID); err != nil {
+			return err
+		}
+
+		msg := byID[messageID]
+		msg.Reactions = models.Tally(msg.Reactions, emoji, userID)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,163 @@
+package pg
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// selectReceipt - read receipt columns
+const selectReceipt = `SELECT r.conversation_id, r.user_id, r.message_id, r.date FROM read_receipts r`
+
+// MarkRead - marks a message, and everything before it in its conversation or group, as read by a user, returning
+// how far they have read. Markers only move forward, so marking an older message changes nothing. Only the two
+// people in a conversation, or a group's participants, can mark its messages read. Channels don't have markers
+func (d *Driver) MarkRead(userID, messageID string) (*models.Receipt, error) {
+	if userID == "" || messageID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// the sender is read as is, not redacted, to compare against the user
+	var sender, recipient, conversationID, groupID, channelID string
+	var date time.Time
+	err = tx.QueryRow(`
+		SELECT sender, COALESCE(recipient, ''), COALESCE(conversation_id, ''), COALESCE(group_id, ''),
+			COALESCE(channel_id, ''), date
+		FROM messages WHERE id = $1`, messageID).
+		Scan(&sender, &recipient, &conversationID, &groupID, &channelID, &date)
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := activeUser(tx, userID); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case channelID != "":
+		return nil, constants.ErrBadRequest
+
+	case groupID != "":
+		conversationID = groupID
+
+		var participant bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM group_participants WHERE group_id = $1 AND user_id = $2)`,
+			groupID, userID).Scan(&participant); err != nil {
+			return nil, err
+		}
+
+		if !participant {
+			return nil, constants.ErrForbidden
+		}
+
+	case sender != userID && recipient != userID:
+		return nil, constants.ErrForbidden
+	}
+
+	// an existing marker is only moved if this message comes after the one it is at
+	if _, err := tx.Exec(`
+		INSERT INTO read_receipts (conversation_id, user_id, message_id, date) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (conversation_id, user_id) DO UPDATE SET message_id = EXCLUDED.message_id, date = EXCLUDED.date
+		WHERE EXISTS (
+			SELECT 1 FROM messages l WHERE l.id = read_receipts.message_id AND (l.date, l.id) < ($5::timestamptz, $3)
+		)`,
+		conversationID, userID, messageID, timestamp(), date); err != nil {
+		return nil, translate(err)
+	}
+
+	receipt, err := scanReceipt(tx.QueryRow(selectReceipt+` WHERE r.conversation_id = $1 AND r.user_id = $2`,
+		conversationID, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+// ListReceipts - lists who has read a message: the markers in its conversation or group that are at or past it,
+// in the order they were read. Deleted users are left out
+func (d *Driver) ListReceipts(messageID string) ([]*models.Receipt, error) {
+	if messageID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	var conversationID, channelID string
+	err := d.db.QueryRow(`
+		SELECT COALESCE(conversation_id, group_id, ''), COALESCE(channel_id, '') FROM messages WHERE id = $1`,
+		messageID).Scan(&conversationID, &channelID)
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if channelID != "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	rows, err := d.db.Query(selectReceipt+`
+		JOIN messages l ON l.id = r.message_id
+		JOIN messages m ON m.id = $2
+		JOIN users u ON u.id = r.user_id
+		WHERE r.conversation_id = $1 AND u.archived_on IS NULL AND (l.date, l.id) >= (m.date, m.id)
+		ORDER BY r.date, r.user_id`,
+		conversationID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	receipts := []*models.Receipt{}
+	for rows.Next() {
+		receipt, err := scanReceipt(rows)
+		if err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, rows.Err()
+}
+
+// loadUnread - fills in how many of a conversation's or group's messages others sent after the last one viewer
+// read, and the id of that one. column is the messages column the conversation's id is in. Messages deleted for
+// everyone, or that the viewer has hidden, aren't counted
+func loadUnread(q querier, convo *models.Conversation, column, viewer string) error {
+	return q.QueryRow(`
+		SELECT COALESCE((SELECT message_id FROM read_receipts WHERE conversation_id = $1 AND user_id = $2), ''),
+			(SELECT COUNT(*) FROM messages m
+			WHERE m.`+column+` = $1 AND m.sender <> $2 AND m.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.user_id = $2 AND h.message_id = m.id)
+			AND NOT EXISTS (
+				SELECT 1 FROM read_receipts r JOIN messages l ON l.id = r.message_id
+				WHERE r.conversation_id = $1 AND r.user_id = $2 AND (m.date, m.id) <= (l.date, l.id)
+			))`,
+		convo.ID, viewer).Scan(&convo.LastRead, &convo.Unread)
+}
+
+func scanReceipt(row scanner) (*models.Receipt, error) {
+	receipt := &models.Receipt{}
+	var date time.Time
+	if err := row.Scan(&receipt.ConversationID, &receipt.UserID, &receipt.MessageID, &date); err != nil {
+		return nil, err
+	}
+	receipt.Date = &date
+
+	return receipt, nil
+}
@@ -0,0 +1,158 @@
+package pg
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// CreateRole - creates a custom role in a guild. Names are unique within a guild, and can't be one of the default roles
+func (d *Driver) CreateRole(guildID, name string, perms models.Permission) (*models.Role, error) {
+	if guildID == "" || name == "" || perms&^models.PermAll != 0 {
+		return nil, constants.ErrBadRequest
+	}
+
+	if _, ok := models.DefaultRoles[name]; ok {
+		return nil, constants.ErrBadRequest
+	}
+
+	if err := guildExists(d.db, guildID); err != nil {
+		return nil, err
+	}
+
+	// a duplicate name breaks the primary key
+	if _, err := d.db.Exec(`INSERT INTO guild_roles (guild_id, name, permissions) VALUES ($1, $2, $3)`,
+		guildID, name, int64(perms)); err != nil {
+		return nil, translate(err)
+	}
+
+	return &models.Role{GuildID: guildID, Name: name, Permissions: perms}, nil
+}
+
+// GetRole - gets a custom role in a guild, the default roles aren't stored
+func (d *Driver) GetRole(guildID, name string) (*models.Role, error) {
+	if guildID == "" || name == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	role, err := scanRole(d.db.QueryRow(`SELECT guild_id, name, permissions FROM guild_roles WHERE guild_id = $1 AND name = $2`, guildID, name))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+
+	return role, err
+}
+
+// ListRoles - lists the custom roles in a guild by name
+func (d *Driver) ListRoles(guildID string) ([]*models.Role, error) {
+	if guildID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	if err := guildExists(d.db, guildID); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(`SELECT guild_id, name, permissions FROM guild_roles WHERE guild_id = $1 ORDER BY name`, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*models.Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// SetRole - gives a member of a guild another role, either a default or custom one. The owner's role can't
+// change, and no one else can be made owner
+func (d *Driver) SetRole(guildID, userID, role string) (*models.Member, error) {
+	if guildID == "" || userID == "" || role == "" || role == models.RoleOwner {
+		return nil, constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	member, err := scanMember(tx.QueryRow(selectMember+` WHERE gm.guild_id = $1 AND gm.user_id = $2 FOR UPDATE OF gm`, guildID, userID))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if member.Role == models.RoleOwner {
+		return nil, constants.ErrBadRequest
+	}
+
+	if _, ok := models.DefaultRoles[role]; !ok {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM guild_roles WHERE guild_id = $1 AND name = $2)`, guildID, role).Scan(&exists); err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			return nil, constants.ErrNotFound
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE guild_members SET role = $1 WHERE guild_id = $2 AND user_id = $3`, role, guildID, userID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	member.Role = role
+	return member, nil
+}
+
+// MuteMember - stops a member of a guild sending to its channels until a time, a zero time lets them again. Mutes
+// are kept when a member leaves, so leaving and rejoining doesn't get around one
+func (d *Driver) MuteMember(guildID, userID string, until time.Time) (*models.Member, error) {
+	if guildID == "" || userID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	if _, err := d.GetMember(guildID, userID); err != nil {
+		return nil, err
+	}
+
+	if until.IsZero() {
+		if _, err := d.db.Exec(`DELETE FROM guild_mutes WHERE guild_id = $1 AND user_id = $2`, guildID, userID); err != nil {
+			return nil, err
+		}
+	} else if _, err := d.db.Exec(`
+		INSERT INTO guild_mutes (guild_id, user_id, until) VALUES ($1, $2, $3)
+		ON CONFLICT (guild_id, user_id) DO UPDATE SET until = EXCLUDED.until`,
+		guildID, userID, until); err != nil {
+		return nil, err
+	}
+
+	return d.GetMember(guildID, userID)
+}
+
+func scanRole(row scanner) (*models.Role, error) {
+	role := &models.Role{}
+	var perms int64
+	if err := row.Scan(&role.GuildID, &role.Name, &perms); err != nil {
+		return nil, err
+	}
+
+	role.Permissions = models.Permission(perms)
+	return role, nil
+}
@@ -0,0 +1,92 @@
+package pg
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// ListReplies - lists the replies to a message, oldest first
+// from and until times can be passed to further narrow results to replies sent in the timeframe
+// if a 0 time is passed for either of these values, that filtering parameter is ignored
+// if limit is 0, it is ignored, otherwise only the most recent replies, up to a count of limit, are returned
+func (d *Driver) ListReplies(parentID string, from, until time.Time, limit int) ([]*models.Message, error) {
+	if parentID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	from, until, err := window(from, until)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := messageExists(d.db, parentID); err != nil {
+		return nil, err
+	}
+
+	// a NULL limit is no limit at all
+	var max sql.NullInt64
+	if limit > 0 {
+		max = sql.NullInt64{Int64: int64(limit), Valid: true}
+	}
+
+	// served by messages_parent_date_idx
+	return queryMessages(d.db, `
+		SELECT * FROM (`+selectMessage+`
+			WHERE m.parent_id = $1 AND m.date BETWEEN $2 AND $3
+			ORDER BY m.date DESC, m.id DESC
+			LIMIT $4
+		) recent ORDER BY date, id`,
+		parentID, from, until, max)
+}
+
+// replyTo - for a reply, counts it on its parent. Not found unless the parent exists, and a bad request unless the
+// parent was sent to the same place and isn't a reply itself. Threads are only one level deep
+func replyTo(q querier, msg *models.Message, now time.Time) error {
+	if msg.ParentID == "" {
+		return nil
+	}
+
+	// locks the parent, so concurrent replies are counted one at a time
+	var parentID, groupID, channelID, sender, recipient string
+	err := q.QueryRow(`
+		SELECT COALESCE(parent_id, ''), COALESCE(group_id, ''), COALESCE(channel_id, ''), sender, COALESCE(recipient, '')
+		FROM messages WHERE id = $1 FOR UPDATE`, msg.ParentID).Scan(&parentID, &groupID, &channelID, &sender, &recipient)
+	if err == sql.ErrNoRows {
+		return constants.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if parentID != "" || groupID != msg.GroupID || channelID != msg.ChannelID {
+		return constants.ErrBadRequest
+	}
+
+	// a message to a single recipient can reply to a message sent either way between the pair
+	if msg.GroupID == "" && msg.ChannelID == "" &&
+		!(sender == msg.Sender && recipient == msg.Recipient) && !(sender == msg.Recipient && recipient == msg.Sender) {
+		return constants.ErrBadRequest
+	}
+
+	_, err = q.Exec(`
+		UPDATE messages SET reply_count = reply_count + 1, last_reply_at = GREATEST(last_reply_at, $2)
+		WHERE id = $1`, msg.ParentID, now)
+	return err
+}
+
+// messageExists - returns not found unless the message exists
+func messageExists(q querier, id string) error {
+	var exists bool
+	if err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM messages WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+
+	if !exists {
+		return constants.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,279 @@
+package pg
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// selectWebhook - webhook columns
+const selectWebhook = `SELECT id, owner, COALESCE(guild_id, '') AS guild_id, url, events, secret, created FROM webhooks`
+
+// deliveryColumns - webhook delivery columns, in the order scanDelivery expects
+const deliveryColumns = `id, webhook_id, event, payload, status, attempts, status_code, error, created, last_attempt, next_attempt`
+
+// CreateWebhook - registers a webhook for its owner, or for a guild when it has a GuildID. The owner has to be an
+// active user, and the guild has to exist
+func (d *Driver) CreateWebhook(hook *models.Webhook) (*models.Webhook, error) {
+	if hook.Owner == "" || hook.URL == "" || hook.Secret == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	if err := activeUser(d.db, hook.Owner); err != nil {
+		return nil, err
+	}
+
+	var guildID interface{}
+	if hook.GuildID != "" {
+		if err := guildExists(d.db, hook.GuildID); err != nil {
+			return nil, err
+		}
+		guildID = hook.GuildID
+	}
+
+	now := timestamp()
+	created := *hook
+	created.ID = uuid.New().String()
+	created.Events = append([]string{}, hook.Events...)
+	created.Created = &now
+
+	if _, err := d.db.Exec(`
+		INSERT INTO webhooks (id, owner, guild_id, url, events, secret, created) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		created.ID, created.Owner, guildID, created.URL, pq.Array(created.Events), created.Secret, now); err != nil {
+		return nil, translate(err)
+	}
+
+	return &created, nil
+}
+
+// GetWebhook - gets a single webhook by id, with its secret
+func (d *Driver) GetWebhook(id string) (*models.Webhook, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	hook, err := scanWebhook(d.db.QueryRow(selectWebhook+` WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return hook, nil
+}
+
+// ListWebhooks - lists a guild's webhooks, or when guildID is empty the owner's own webhooks, in the order they
+// were created
+func (d *Driver) ListWebhooks(owner, guildID string) ([]*models.Webhook, error) {
+	if owner == "" && guildID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	query, arg := selectWebhook+` WHERE guild_id = $1 ORDER BY created, id`, guildID
+	if guildID == "" {
+		query, arg = selectWebhook+` WHERE owner = $1 AND guild_id IS NULL ORDER BY created, id`, owner
+	}
+
+	rows, err := d.db.Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []*models.Webhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+
+	return hooks, rows.Err()
+}
+
+// DeleteWebhook - deletes a webhook, and its deliveries with it
+func (d *Driver) DeleteWebhook(id string) error {
+	if id == "" {
+		return constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = $1`, id); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return constants.ErrNotFound
+	}
+
+	return tx.Commit()
+}
+
+// CreateDelivery - records an event about to be posted to a webhook, as pending
+func (d *Driver) CreateDelivery(delivery *models.Delivery) (*models.Delivery, error) {
+	if delivery.WebhookID == "" || delivery.Event == "" || len(delivery.Payload) == 0 {
+		return nil, constants.ErrBadRequest
+	}
+
+	// nothing is inserted unless the webhook exists
+	created, err := scanDelivery(d.db.QueryRow(`
+		INSERT INTO webhook_deliveries (id, webhook_id, event, payload, status, attempts, status_code, error, created, next_attempt)
+		SELECT $1, w.id, $3, $4, $5, 0, 0, '', $6, $7 FROM webhooks w WHERE w.id = $2
+		RETURNING `+deliveryColumns,
+		uuid.New().String(), delivery.WebhookID, delivery.Event, string(delivery.Payload), models.DeliveryPending,
+		timestamp(), delivery.NextAttempt))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// GetDelivery - gets a single delivery by id
+func (d *Driver) GetDelivery(id string) (*models.Delivery, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	delivery, err := scanDelivery(d.db.QueryRow(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// UpdateDelivery - records how an attempt at a delivery went: its status, attempts, the last response and when
+// the next attempt is due. Only those change, the event and payload stay as they were created
+func (d *Driver) UpdateDelivery(delivery *models.Delivery) (*models.Delivery, error) {
+	if delivery.ID == "" || !validDeliveryStatus(delivery.Status) || delivery.Attempts < 0 {
+		return nil, constants.ErrBadRequest
+	}
+
+	updated, err := scanDelivery(d.db.QueryRow(`
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, status_code = $4, error = $5, last_attempt = $6, next_attempt = $7
+		WHERE id = $1
+		RETURNING `+deliveryColumns,
+		delivery.ID, delivery.Status, delivery.Attempts, delivery.StatusCode, delivery.Error,
+		delivery.LastAttempt, delivery.NextAttempt))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// ListDeliveries - lists a webhook's deliveries, or every webhook's when webhookID is empty, the most recent first.
+// Passing a status only lists deliveries with it, ie: models.DeliveryFailed for the dead-letter list. A limit of 0
+// lists them all
+func (d *Driver) ListDeliveries(webhookID, status string, limit int) ([]*models.Delivery, error) {
+	if (status != "" && !validDeliveryStatus(status)) || limit < 0 {
+		return nil, constants.ErrBadRequest
+	}
+
+	if webhookID != "" {
+		var exists bool
+		if err := d.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM webhooks WHERE id = $1)`, webhookID).Scan(&exists); err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			return nil, constants.ErrNotFound
+		}
+	}
+
+	var max interface{}
+	if limit > 0 {
+		max = limit
+	}
+
+	rows, err := d.db.Query(`
+		SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE ($1 = '' OR webhook_id = $1) AND ($2 = '' OR status = $2)
+		ORDER BY created DESC, id DESC
+		LIMIT $3`,
+		webhookID, status, max)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*models.Delivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func validDeliveryStatus(status string) bool {
+	return status == models.DeliveryPending || status == models.DeliveryDelivered || status == models.DeliveryFailed
+}
+
+func scanWebhook(row scanner) (*models.Webhook, error) {
+	hook := &models.Webhook{}
+	var created time.Time
+	if err := row.Scan(&hook.ID, &hook.Owner, &hook.GuildID, &hook.URL, pq.Array(&hook.Events), &hook.Secret, &created); err != nil {
+		return nil, err
+	}
+	hook.Created = &created
+
+	return hook, nil
+}
+
+func scanDelivery(row scanner) (*models.Delivery, error) {
+	delivery := &models.Delivery{}
+	var payload string
+	var created time.Time
+	var lastAttempt, nextAttempt sql.NullTime
+	if err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &payload, &delivery.Status, &delivery.Attempts,
+		&delivery.StatusCode, &delivery.Error, &created, &lastAttempt, &nextAttempt); err != nil {
+		return nil, err
+	}
+
+	delivery.Payload = []byte(payload)
+	delivery.Created = &created
+	if lastAttempt.Valid {
+		delivery.LastAttempt = &lastAttempt.Time
+	}
+	if nextAttempt.Valid {
+		delivery.NextAttempt = &nextAttempt.Time
+	}
+
+	return delivery, nil
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+type (
+	// Search - a full-text search of the messages a user can read. Text is made up of words, every one of which
+	// must be in a message, and "quoted phrases", which must be in it as written. Words also match other forms of
+	// themselves, ie: "meeting" matches "meetings". Messages deleted for everyone are never found
+	Search struct {
+		Text     string
+		Viewer   string    // direct messages to or from the viewer are searched, leaving out any they have hidden
+		Groups   []string  // as well as these group conversations
+		Channels []string  // and these guild channels
+		Sender   string    // only messages from this sender, ignored if empty
+		From     time.Time // only messages sent at or after From, ignored if 0
+		Until    time.Time // only messages sent at or before Until, defaults to now if 0
+		Limit    int       // the most messages found, 0 is no limit
+	}
+
+	// Searcher - finds messages, newest first. Drivers with a full-text search of their own, ie: postgres, can
+	// implement it to be searched natively, otherwise messages are indexed in process (see search.Index)
+	Searcher interface {
+		SearchMessages(query Search) ([]*models.Message, error)
+	}
+)
+
+// Check - fills in a 0 Until with now, and is a bad request if the search can't be run
+func (s *Search) Check() error {
+	if s.Until.Equal(time.Time{}) {
+		s.Until = time.Now()
+	}
+
+	if s.Viewer == "" || s.From.After(s.Until) || s.Limit < 0 {
+		return constants.ErrBadRequest
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// selectCommand - slash command columns. Expects commands aliased as c
+const selectCommand = `SELECT c.id, c.bot_id, c.name, c.description, c.usage, c.url, c.permissions, c.secret, c.created FROM commands c`
+
+// CreateCommand - registers a slash command for an active bot. Names are unique for each bot, but different bots can
+// register the same name
+func (d *Driver) CreateCommand(cmd *models.Command) (*models.Command, error) {
+	if !validCommand(cmd) {
+		return nil, constants.ErrBadRequest
+	}
+
+	bot, err := d.GetUser(cmd.BotID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bot.Bot {
+		return nil, constants.ErrBadRequest
+	}
+
+	now := time.Now()
+	created := *cmd
+	created.ID = uuid.New().String()
+	created.Created = &now
+
+	// names are unique for each bot, a duplicate is a bad request
+	if _, err := d.db.Exec(`
+		INSERT INTO commands (id, bot_id, name, description, usage, url, permissions, secret, created)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		created.ID, created.BotID, created.Name, created.Description, created.Usage, created.URL,
+		int64(created.Permissions), created.Secret, now.UnixNano()); err != nil {
+		return nil, translate(err)
+	}
+
+	return &created, nil
+}
+
+// ListCommands - lists a bot's slash commands, by name
+func (d *Driver) ListCommands(botID string) ([]*models.Command, error) {
+	if botID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	if _, err := d.GetUser(botID); err != nil {
+		return nil, err
+	}
+
+	return d.queryCommands(selectCommand+` WHERE c.bot_id = ? ORDER BY c.name`, botID)
+}
+
+// FindCommands - lists the slash commands registered under a name, by any active bot, in the order they were created
+func (d *Driver) FindCommands(name string) ([]*models.Command, error) {
+	if name == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	return d.queryCommands(selectCommand+`
+		JOIN users u ON u.id = c.bot_id AND u.archived_on IS NULL
+		WHERE c.name = ?
+		ORDER BY c.created, c.id`, name)
+}
+
+// DeleteCommand - removes one of a bot's slash commands
+func (d *Driver) DeleteCommand(botID, name string) error {
+	if botID == "" || name == "" {
+		return constants.ErrBadRequest
+	}
+
+	res, err := d.db.Exec(`DELETE FROM commands WHERE bot_id = ? AND name = ?`, botID, name)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return constants.ErrNotFound
+	}
+
+	return nil
+}
+
+// queryCommands - runs a query for slash commands, see selectCommand
+func (d *Driver) queryCommands(query string, args ...interface{}) ([]*models.Command, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cmds := []*models.Command{}
+	for rows.Next() {
+		cmd, err := scanCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	return cmds, rows.Err()
+}
+
+// validCommand - whether a new slash command is complete
+func validCommand(cmd *models.Command) bool {
+	return cmd != nil && cmd.BotID != "" && cmd.Name != "" && cmd.URL != "" && cmd.Secret != "" &&
+		cmd.Permissions&^models.PermAll == 0
+}
+
+func scanCommand(row scanner) (*models.Command, error) {
+	cmd := &models.Command{}
+	var perms int64
+	var created int64
+	if err := row.Scan(&cmd.ID, &cmd.BotID, &cmd.Name, &cmd.Description, &cmd.Usage, &cmd.URL, &perms, &cmd.Secret, &created); err != nil {
+		return nil, err
+	}
+
+	cmd.Permissions = models.Permission(perms)
+	cmd.Created = fromNanos(created)
+	return cmd, nil
+}
@@ -0,0 +1,452 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// selectGuild - guild columns, with the owner redacted if they have been deleted. Expects guilds
+// aliased as g and the owning user as o
+const selectGuild = `
+	SELECT g.id, g.name, CASE WHEN o.archived_on IS NULL THEN g.owner ELSE 'deleted' END, g.created, g.updated
+	FROM guilds g
+	JOIN users o ON o.id = g.owner`
+
+// selectMember - guild member columns and when they are muted until, leaving out deleted users. Expects guild
+// members aliased as gm
+const selectMember = `
+	SELECT gm.guild_id, gm.user_id, gm.role, gm.joined, mu.until
+	FROM guild_members gm
+	JOIN users u ON u.id = gm.user_id AND u.archived_on IS NULL
+	LEFT JOIN guild_mutes mu ON mu.guild_id = gm.guild_id AND mu.user_id = gm.user_id`
+
+// CreateGuild - creates a guild owned by owner, with the default channel. The owner is its first member
+func (d *Driver) CreateGuild(owner, name string) (*models.Guild, error) {
+	if owner == "" || name == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := activeUser(tx, owner); err != nil {
+		return nil, err
+	}
+
+	id := uuid.New().String()
+	now := time.Now().UnixNano()
+
+	if _, err := tx.Exec(`INSERT INTO guilds (id, name, owner, created, updated) VALUES (?1, ?2, ?3, ?4, ?4)`,
+		id, name, owner, now); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO guild_members (guild_id, user_id, role, joined) VALUES (?, ?, ?, ?)`,
+		id, owner, models.RoleOwner, now); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO channels (id, guild_id, name, updated) VALUES (?, ?, ?, ?)`,
+		uuid.New().String(), id, models.DefaultChannel, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return d.GetGuild(id)
+}
+
+// GetGuild - gets a guild and its channels
+func (d *Driver) GetGuild(id string) (*models.Guild, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	guild, err := scanGuild(d.db.QueryRow(selectGuild+` WHERE g.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.loadChannels(guild); err != nil {
+		return nil, err
+	}
+
+	return guild, nil
+}
+
+// ListGuilds - lists the guilds a user is a member of, most recently updated first.
+// from and until times can be passed to further narrow results to guilds that have been updated in the timeframe
+// if a 0 time is passed for either of these values, that filtering parameter is ignored
+func (d *Driver) ListGuilds(userID string, from, until time.Time) ([]*models.Guild, error) {
+	if userID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	start, end, err := window(from, until)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := usersExist(d.db, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(selectGuild+`
+		JOIN guild_members gm ON gm.guild_id = g.id
+		WHERE gm.user_id = ? AND g.updated BETWEEN ? AND ?
+		ORDER BY g.updated DESC`,
+		userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	guilds := []*models.Guild{}
+	for rows.Next() {
+		guild, err := scanGuild(rows)
+		if err != nil {
+			return nil, err
+		}
+		guilds = append(guilds, guild)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, guild := range guilds {
+		if err := d.loadChannels(guild); err != nil {
+			return nil, err
+		}
+	}
+
+	return guilds, nil
+}
+
+// JoinGuild - makes a user a member of a guild
+func (d *Driver) JoinGuild(guildID, userID string) (*models.Member, error) {
+	if guildID == "" || userID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	now := time.Now()
+
+	// nothing is inserted unless both the guild and the user exist, an existing member breaks the primary key
+	res, err := d.db.Exec(`
+		INSERT INTO guild_members (guild_id, user_id, role, joined)
+		SELECT g.id, u.id, ?3, ?4 FROM guilds g, users u
+		WHERE g.id = ?1 AND u.id = ?2 AND u.archived_on IS NULL`,
+		guildID, userID, models.RoleMember, now.UnixNano())
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if affected == 0 {
+		return nil, constants.ErrNotFound
+	}
+
+	// a muted member who left and rejoined is still muted
+	return d.GetMember(guildID, userID)
+}
+
+// LeaveGuild - removes a user from a guild, their messages stay in its channels. The owner can't leave
+func (d *Driver) LeaveGuild(guildID, userID string) error {
+	if guildID == "" || userID == "" {
+		return constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var role string
+	err = tx.QueryRow(`SELECT role FROM guild_members WHERE guild_id = ? AND user_id = ?`, guildID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return constants.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if role == models.RoleOwner {
+		return constants.ErrBadRequest
+	}
+
+	if _, err := tx.Exec(`DELETE FROM guild_members WHERE guild_id = ? AND user_id = ?`, guildID, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetMember - gets a user's membership of a guild, not found if they aren't a member
+func (d *Driver) GetMember(guildID, userID string) (*models.Member, error) {
+	if guildID == "" || userID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	member, err := scanMember(d.db.QueryRow(selectMember+` WHERE gm.guild_id = ? AND gm.user_id = ?`, guildID, userID))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+
+	return member, err
+}
+
+// ListMembers - lists the members of a guild, in the order they joined. Deleted users are left out
+func (d *Driver) ListMembers(guildID string) ([]*models.Member, error) {
+	if guildID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	if err := guildExists(d.db, guildID); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(selectMember+` WHERE gm.guild_id = ? ORDER BY gm.joined, gm.rowid`, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*models.Member{}
+	for rows.Next() {
+		member, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// CreateChannel - creates a named channel in a guild, names are unique within a guild
+func (d *Driver) CreateChannel(guildID, name string) (*models.Channel, error) {
+	if guildID == "" || name == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	if err := guildExists(d.db, guildID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	channel := &models.Channel{ID: uuid.New().String(), GuildID: guildID, Name: name, Updated: &now}
+
+	// a duplicate name breaks the unique constraint
+	if _, err := d.db.Exec(`INSERT INTO channels (id, guild_id, name, updated) VALUES (?, ?, ?, ?)`,
+		channel.ID, guildID, name, now.UnixNano()); err != nil {
+		return nil, translate(err)
+	}
+
+	return channel, nil
+}
+
+// GetChannel - gets a single channel, without its messages
+func (d *Driver) GetChannel(id string) (*models.Channel, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	channel, err := scanChannel(d.db.QueryRow(`SELECT id, guild_id, name, updated FROM channels WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+
+	return channel, err
+}
+
+// ListChannelMessages - lists the messages sent to a channel, oldest first
+// from and until times can be passed to further narrow results to messages sent in the timeframe
+// if a 0 time is passed for either of these values, that filtering parameter is ignored
+// if limit is 0, it is ignored, otherwise only the most recent messages, up to a count of limit, are returned
+func (d *Driver) ListChannelMessages(channelID string, from, until time.Time, limit int) ([]*models.Message, error) {
+	if channelID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	start, end, err := window(from, until)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := d.GetChannel(channelID); err != nil {
+		return nil, err
+	}
+
+	// a negative limit is no limit at all
+	if limit <= 0 {
+		limit = -1
+	}
+
+	// served by messages_channel_date_idx
+	return queryMessages(d.db, `
+		SELECT * FROM (`+selectMessage+`
+			WHERE m.channel_id = ? AND m.date BETWEEN ? AND ?
+			ORDER BY m.date DESC, m.id DESC
+			LIMIT ?
+		) ORDER BY date, id`,
+		channelID, start, end, limit)
+}
+
+// createChannelMessage - creates a new message in a guild channel, only members of the guild can send them
+func (d *Driver) createChannelMessage(msg *models.Message) (*models.Message, error) {
+	if msg.Sender == "" || msg.Content == "" || msg.Recipient != "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	var guildID string
+	err = tx.QueryRow(`SELECT guild_id FROM channels WHERE id = ?`, msg.ChannelID).Scan(&guildID)
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := scanMember(tx.QueryRow(selectMember+` WHERE gm.guild_id = ? AND gm.user_id = ?`, guildID, msg.Sender)); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, constants.ErrForbidden
+		}
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`UPDATE channels SET updated = ? WHERE id = ?`, now.UnixNano(), msg.ChannelID); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`UPDATE guilds SET updated = MAX(updated, ?2) WHERE id = ?1`, guildID, now.UnixNano()); err != nil {
+		return nil, err
+	}
+
+	if err := replyTo(tx, msg, now); err != nil {
+		return nil, err
+	}
+
+	msg.ID = uuid.New().String()
+	msg.Date = &now
+
+	if _, err := tx.Exec(`INSERT INTO messages (id, channel_id, sender, content, date, parent_id) VALUES (?, ?, ?, ?, ?, NULLIF(?, ''))`,
+		msg.ID, msg.ChannelID, msg.Sender, msg.Content, now.UnixNano(), msg.ParentID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// loadChannels - fills in the channels of a guild, in the order they were created
+func (d *Driver) loadChannels(guild *models.Guild) error {
+	rows, err := d.db.Query(`SELECT id, guild_id, name, updated FROM channels WHERE guild_id = ? ORDER BY rowid`, guild.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	guild.Channels = []*models.Channel{}
+	for rows.Next() {
+		channel, err := scanChannel(rows)
+		if err != nil {
+			return err
+		}
+		guild.Channels = append(guild.Channels, channel)
+	}
+
+	return rows.Err()
+}
+
+// activeUser - returns not found unless the id belongs to a user that hasn't been deleted
+func activeUser(q querier, id string) error {
+	var exists bool
+	if err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE id = ? AND archived_on IS NULL)`, id).Scan(&exists); err != nil {
+		return err
+	}
+
+	if !exists {
+		return constants.ErrNotFound
+	}
+
+	return nil
+}
+
+// guildExists - returns not found unless the guild exists
+func guildExists(q querier, id string) error {
+	var exists bool
+	if err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM guilds WHERE id = ?)`, id).Scan(&exists); err != nil {
+		return err
+	}
+
+	if !exists {
+		return constants.ErrNotFound
+	}
+
+	return nil
+}
+
+func scanGuild(row scanner) (*models.Guild, error) {
+	guild := &models.Guild{}
+	var created, updated int64
+	if err := row.Scan(&guild.ID, &guild.Name, &guild.Owner, &created, &updated); err != nil {
+		return nil, err
+	}
+
+	guild.Created = fromNanos(created)
+	guild.Updated = fromNanos(updated)
+	return guild, nil
+}
+
+func scanChannel(row scanner) (*models.Channel, error) {
+	channel := &models.Channel{}
+	var updated int64
+	if err := row.Scan(&channel.ID, &channel.GuildID, &channel.Name, &updated); err != nil {
+		return nil, err
+	}
+
+	channel.Updated = fromNanos(updated)
+	return channel, nil
+}
+
+func scanMember(row scanner) (*models.Member, error) {
+	member := &models.Member{}
+	var joined int64
+	var mutedUntil sql.NullInt64
+	if err := row.Scan(&member.GuildID, &member.UserID, &member.Role, &joined, &mutedUntil); err != nil {
+		return nil, err
+	}
+
+	member.Joined = fromNanos(joined)
+	if mutedUntil.Valid {
+		member.MutedUntil = fromNanos(mutedUntil.Int64)
+	}
+	return member, nil
+}
@@ -0,0 +1,189 @@
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// selectAPIKey - API key columns, never the hash
+const selectAPIKey = `SELECT id, user_id, name, scopes, prefix, created, last_used, revoked FROM api_keys`
+
+// CreateAPIKey - stores a new API key for an active user under the hash of the key. The key needs a name, a prefix
+// and at least one valid scope
+func (d *Driver) CreateAPIKey(key *models.APIKey, keyHash string) (*models.APIKey, error) {
+	if !validAPIKey(key) || keyHash == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	if err := activeUser(d.db, key.UserID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	created := &models.APIKey{
+		ID:      uuid.New().String(),
+		UserID:  key.UserID,
+		Name:    key.Name,
+		Scopes:  append([]string{}, key.Scopes...),
+		Prefix:  key.Prefix,
+		Created: &now,
+	}
+
+	// hashes are unique, a duplicate is a bad request
+	if _, err := d.db.Exec(`
+		INSERT INTO api_keys (id, user_id, name, scopes, prefix, key_hash, created) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		created.ID, created.UserID, created.Name, strings.Join(created.Scopes, ","), created.Prefix, keyHash, now.UnixNano()); err != nil {
+		return nil, translate(err)
+	}
+
+	return created, nil
+}
+
+// GetAPIKey - gets a single API key by id, revoked or not
+func (d *Driver) GetAPIKey(id string) (*models.APIKey, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	key, err := scanAPIKey(d.db.QueryRow(selectAPIKey+` WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// GetAPIKeyByHash - gets the API key stored under a hash, to authenticate with. Revoked keys aren't found
+func (d *Driver) GetAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	if keyHash == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	key, err := scanAPIKey(d.db.QueryRow(selectAPIKey+` WHERE key_hash = ? AND revoked IS NULL`, keyHash))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys - lists a user's API keys, revoked ones included, in the order they were created
+func (d *Driver) ListAPIKeys(userID string) ([]*models.APIKey, error) {
+	if userID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	if err := usersExist(d.db, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(selectAPIKey+` WHERE user_id = ? ORDER BY created, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey - stops an API key from working. Revoking a key twice changes nothing
+func (d *Driver) RevokeAPIKey(id string) error {
+	if id == "" {
+		return constants.ErrBadRequest
+	}
+
+	res, err := d.db.Exec(`UPDATE api_keys SET revoked = COALESCE(revoked, ?2) WHERE id = ?1`, id, time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return constants.ErrNotFound
+	}
+
+	return nil
+}
+
+// TouchAPIKey - records that an API key was used. The last used time only moves forward
+func (d *Driver) TouchAPIKey(id string, used time.Time) error {
+	if id == "" || used.IsZero() {
+		return constants.ErrBadRequest
+	}
+
+	res, err := d.db.Exec(`UPDATE api_keys SET last_used = MAX(COALESCE(last_used, 0), ?2) WHERE id = ?1`, id, used.UnixNano())
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return constants.ErrNotFound
+	}
+
+	return nil
+}
+
+// validAPIKey - whether a new API key is complete, with at least one scope and only valid ones
+func validAPIKey(key *models.APIKey) bool {
+	if key == nil || key.UserID == "" || key.Name == "" || key.Prefix == "" || len(key.Scopes) == 0 {
+		return false
+	}
+
+	for _, scope := range key.Scopes {
+		if !models.ValidScope(scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func scanAPIKey(row scanner) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	var scopes string
+	var created int64
+	var lastUsed, revoked sql.NullInt64
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &scopes, &key.Prefix, &created, &lastUsed, &revoked); err != nil {
+		return nil, err
+	}
+
+	key.Scopes = strings.Split(scopes, ",")
+	key.Created = fromNanos(created)
+	if lastUsed.Valid {
+		key.LastUsed = fromNanos(lastUsed.Int64)
+	}
+	if revoked.Valid {
+		key.Revoked = fromNanos(revoked.Int64)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// AddReaction - reacts to a message as a user, returning the message with its reactions. A user can react with
+// several emoji, but only once with each. Messages deleted for everyone can't be reacted to
+func (d *Driver) AddReaction(messageID, userID, emoji string) (*models.Message, error) {
+	if messageID == "" || userID == "" || !models.ValidEmoji(emoji) {
+		return nil, constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	msg, err := reactable(tx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.DeletedAt != nil {
+		return nil, constants.ErrBadRequest
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO reactions (message_id, user_id, emoji, date) VALUES (?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`,
+		messageID, userID, emoji, time.Now().UnixNano()); err != nil {
+		return nil, err
+	}
+
+	if err := loadDetails(tx, msg); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// RemoveReaction - takes back a user's reaction to a message, returning the message with its remaining reactions.
+// Removing a reaction that isn't there changes nothing
+func (d *Driver) RemoveReaction(messageID, userID, emoji string) (*models.Message, error) {
+	if messageID == "" || userID == "" || emoji == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	msg, err := reactable(tx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM reactions WHERE message_id = ? AND user_id = ? AND emoji = ?`,
+		messageID, userID, emoji); err != nil {
+		return nil, err
+	}
+
+	if err := loadDetails(tx, msg); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// reactable - the message being reacted to, not found unless both it and the reacting user exist
+func reactable(q querier, messageID, userID string) (*models.Message, error) {
+	msg, err := scanMessage(q.QueryRow(selectMessage+` WHERE m.id = ?`, messageID))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := activeUser(q, userID); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// loadReactions - fills in the reactions to a batch of messages, by id, in the order each emoji was first used.
+// Reactions from deleted users are left out
+func loadReactions(q querier, byID map[string]*models.Message, ids []interface{}) error {
+	rows, err := q.Query(`
+		SELECT r.message_id, r.emoji, r.user_id FROM reactions r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.message_id IN (`+placeholders(len(ids))+`) AND u.archived_on IS NULL
+		ORDER BY r.date, r.rowid`, ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID, emoji, userID string
+		if err := rows.Scan(&messageID, &emoji, &userID); err != nil {
+			return err
+		}
+
+		msg := byID[messageID]
+		msg.Reactions = models.Tally(msg.Reactions, emoji, userID)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// EditMessage - replaces the content of a message, keeping what it said before as a revision. Only the sender can edit,
+// and messages deleted for everyone can't be
+func (d *Driver) EditMessage(id, editor, content string) (*models.Message, error) {
+	if id == "" || editor == "" || content == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var sender string
+	var archived, deleted bool
+	err = tx.QueryRow(`
+		SELECT m.sender, s.archived_on IS NOT NULL, m.deleted_at IS NOT NULL
+		FROM messages m
+		JOIN users s ON s.id = m.sender
+		WHERE m.id = ?`, id).Scan(&sender, &archived, &deleted)
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if sender != editor || archived {
+		return nil, constants.ErrForbidden
+	}
+
+	if deleted {
+		return nil, constants.ErrBadRequest
+	}
+
+	// the content being replaced was written when the message was sent, or last edited
+	if _, err := tx.Exec(`
+		INSERT INTO message_revisions (message_id, content, date)
+		SELECT id, content, COALESCE(edited_at, date) FROM messages WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`UPDATE messages SET content = ?, edited_at = ? WHERE id = ?`, content, time.Now().UnixNano(), id); err != nil {
+		return nil, err
+	}
+
+	msg, err := scanMessage(tx.QueryRow(selectMessage+` WHERE m.id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadDetails(tx, msg); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// ListRevisions - lists the earlier content of a message, oldest first. A message that has never been edited has none
+func (d *Driver) ListRevisions(messageID string) ([]*models.Revision, error) {
+	if messageID == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	if err := messageExists(d.db, messageID); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(`SELECT message_id, content, date FROM message_revisions WHERE message_id = ? ORDER BY date, rowid`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*models.Revision{}
+	for rows.Next() {
+		revision := &models.Revision{}
+		var date int64
+		if err := rows.Scan(&revision.MessageID, &revision.Content, &date); err != nil {
+			return nil, err
+		}
+
+		revision.Date = fromNanos(date)
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
@@ -0,0 +1,908 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+type (
+	// Config - settings for the embedded sqlite driver
+	Config struct {
+		Path        string        // path to the database file, created if it doesn't exist
+		BusyTimeout time.Duration // how long a writer waits on the database lock before giving up
+	}
+
+	Driver struct {
+		db *sql.DB
+	}
+
+	// querier - the subset of sql.DB and sql.Tx the driver needs, so reads can happen in or out of a transaction
+	querier interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+		Query(query string, args ...interface{}) (*sql.Rows, error)
+		QueryRow(query string, args ...interface{}) *sql.Row
+	}
+)
+
+var (
+	_ db.Driver = new(Driver)
+)
+
+// selectMessage - message columns, with the sender redacted if they have been deleted. Expects messages
+// aliased as m and the sending user as s
+const selectMessage = `
+	SELECT m.id AS id, CASE WHEN s.archived_on IS NULL THEN m.sender ELSE 'deleted' END AS sender,
+		COALESCE(m.recipient, '') AS recipient, COALESCE(m.group_id, '') AS group_id, COALESCE(m.channel_id, '') AS channel_id,
+		m.content AS content, m.date AS date, m.edited_at AS edited_at, m.deleted_at AS deleted_at,
+		COALESCE(m.parent_id, '') AS parent_id, m.reply_count AS reply_count, m.last_reply_at AS last_reply_at,
+		COALESCE(m.conversation_id, '') AS conversation_id
+	FROM messages m
+	JOIN users s ON s.id = m.sender`
+
+// selectUser - user columns. Only bots have an owner
+const selectUser = `SELECT id, username, email, bot, COALESCE(owner, '') AS owner FROM users`
+
+// selectConversation - conversation columns, with the sender redacted if they have been deleted. Expects
+// conversations aliased as c and the sending user as s
+const selectConversation = `
+	SELECT c.id, CASE WHEN s.archived_on IS NULL THEN c.sender ELSE 'deleted' END, c.recipient, c.updated
+	FROM conversations c
+	JOIN users s ON s.id = c.sender`
+
+// NewDriver - opens (or creates) the database file in WAL mode and migrates the schema
+func NewDriver(cfg Config) (*Driver, error) {
+	if cfg.Path == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	busy := cfg.BusyTimeout
+	if busy == 0 {
+		busy = 5 * time.Second
+	}
+
+	// WAL lets readers carry on while a write is in progress, and immediate transactions take the
+	// write lock up front so two writers can't deadlock upgrading from a read lock
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_synchronous", "NORMAL")
+	params.Set("_foreign_keys", "on")
+	params.Set("_txlock", "immediate")
+	params.Set("_busy_timeout", fmt.Sprint(busy.Milliseconds()))
+
+	conn, err := sql.Open("sqlite3", "file:"+cfg.Path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := migrate(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Driver{db: conn}, nil
+}
+
+// Close - closes the database file
+func (d *Driver) Close() error {
+	return d.db.Close()
+}
+
+// GetMessage - gets a single message by id
+func (d *Driver) GetMessage(id string) (*models.Message, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	msg, err := scanMessage(d.db.QueryRow(selectMessage+` WHERE m.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadDetails(d.db, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// GetMessages - gets several messages by id, in the order asked for. Messages that don't exist, or that viewer has
+// hidden, are left out. An empty viewer sees every message
+func (d *Driver) GetMessages(viewer string, ids []string) ([]*models.Message, error) {
+	msgs := []*models.Message{}
+	for start := 0; start < len(ids); start += detailBatch {
+		end := start + detailBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		args := make([]interface{}, 0, end-start+1)
+		for _, id := range ids[start:end] {
+			args = append(args, id)
+		}
+		args = append(args, viewer)
+
+		batch, err := queryMessages(d.db, selectMessage+`
+			WHERE m.id IN (`+placeholders(end-start)+`)
+			AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.user_id = ? AND h.message_id = m.id)`,
+			args...)
+		if err != nil {
+			return nil, err
+		}
+
+		msgs = append(msgs, batch...)
+	}
+
+	return inOrder(msgs, ids), nil
+}
+
+// ScanMessages - lists every message, deleted or hidden, ordered by id and starting after the given id, for
+// rebuilding indexes a batch at a time. An empty after starts from the beginning. if limit is 0, it is ignored
+func (d *Driver) ScanMessages(after string, limit int) ([]*models.Message, error) {
+	if limit < 0 {
+		return nil, constants.ErrBadRequest
+	}
+
+	// a negative limit is no limit at all
+	if limit == 0 {
+		limit = -1
+	}
+
+	return queryMessages(d.db, selectMessage+` WHERE m.id > ? ORDER BY m.id LIMIT ?`, after, limit)
+}
+
+// CreateMessage - creates a new message, and the conversation it belongs to if this is the first message
+// between the two users. Both happen in a single transaction. Messages to a group or channel are added to it instead.
+// A reply is sent to the same place as its parent
+func (d *Driver) CreateMessage(msg *models.Message) (*models.Message, error) {
+	// these are kept up to date by the driver, never set by the sender
+	msg.EditedAt, msg.DeletedAt, msg.ReplyCount, msg.LastReplyAt = nil, nil, 0, nil
+	msg.Reactions, msg.Attachments = nil, nil
+
+	if msg.GroupID != "" {
+		return d.createGroupMessage(msg)
+	}
+
+	if msg.ChannelID != "" {
+		return d.createChannelMessage(msg)
+	}
+
+	if msg.Recipient == "" || msg.Sender == "" || msg.Content == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// if the user or sender id are invalid, throw error - in this case a not found, so as not to tip off malicious attacks of a bad user id
+	if err := usersExist(tx, msg.Sender, msg.Recipient); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	// now add to the existing conversation, or create a new one - the transaction holds the write lock
+	// so nobody else can create the same conversation in between
+	var convoID string
+	err = tx.QueryRow(`SELECT id FROM conversations WHERE min(sender, recipient) = min(?1, ?2) AND max(sender, recipient) = max(?1, ?2)`,
+		msg.Sender, msg.Recipient).Scan(&convoID)
+	switch {
+	case err == sql.ErrNoRows:
+		convoID = uuid.New().String()
+		if _, err := tx.Exec(`INSERT INTO conversations (id, sender, recipient, updated) VALUES (?, ?, ?, ?)`,
+			convoID, msg.Sender, msg.Recipient, now.UnixNano()); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		if _, err := tx.Exec(`UPDATE conversations SET updated = ? WHERE id = ?`, now.UnixNano(), convoID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := replyTo(tx, msg, now); err != nil {
+		return nil, err
+	}
+
+	msg.ID = uuid.New().String()
+	msg.Date = &now
+
+	if _, err := tx.Exec(`INSERT INTO messages (id, conversation_id, sender, recipient, content, date, parent_id) VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''))`,
+		msg.ID, convoID, msg.Sender, msg.Recipient, msg.Content, now.UnixNano(), msg.ParentID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	msg.ConversationID = convoID
+	return msg, nil
+}
+
+// ListMessages - lists messages all messages for a recipient, leaving out any they have hidden, in the given order
+// from and until times can be passed to further narrow results to messages sent in the timeframe
+// if a 0 time is passed for either of these values, that filtering parameter is ignored
+// if limit is 0, it is ignored, otherwise only the most recent messages, up to a count of limit, are returned
+func (d *Driver) ListMessages(recipient string, from, until time.Time, limit int, order db.Order) ([]*models.Message, error) {
+	if recipient == "" || !order.Valid() {
+		return nil, constants.ErrBadRequest
+	}
+
+	start, end, err := window(from, until)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := usersExist(d.db, recipient); err != nil {
+		return nil, err
+	}
+
+	// a negative limit is no limit at all
+	if limit <= 0 {
+		limit = -1
+	}
+
+	// served by messages_recipient_date_idx
+	return queryMessages(d.db, `
+		SELECT * FROM (`+selectMessage+`
+			WHERE m.recipient = ?1 AND m.date BETWEEN ?2 AND ?3
+			AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.user_id = ?1 AND h.message_id = m.id)
+			ORDER BY m.date DESC, m.id DESC
+			LIMIT ?4
+		) ORDER BY date `+direction(order)+`, id `+direction(order),
+		recipient, start, end, limit)
+}
+
+// GetConversation - gets a conversation between a sender and recipient.
+// from and until times can be passed to further narrow results to conversations that have been updated in the timeframe
+// if a 0 time is passed for either of these values, that filtering parameter is ignored
+func (d *Driver) GetConversation(sender, recipient string, from, until time.Time) (*models.Conversation, error) {
+	if sender == "" || recipient == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	start, end, err := window(from, until)
+	if err != nil {
+		return nil, err
+	}
+
+	// if the user or sender id are invalid, throw error - in this case a not found, so as not to tip off malicious attacks of a bad user id
+	if err := usersExist(d.db, sender, recipient); err != nil {
+		return nil, err
+	}
+
+	convo, err := scanConversation(d.db.QueryRow(selectConversation+`
+		WHERE min(c.sender, c.recipient) = min(?1, ?2) AND max(c.sender, c.recipient) = max(?1, ?2)
+		AND c.updated BETWEEN ?3 AND ?4`,
+		sender, recipient, start, end))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.loadMessages(convo, ""); err != nil {
+		return nil, err
+	}
+
+	return convo, nil
+}
+
+// CreateConversation - creates a conversation between a sender and recipient
+func (d *Driver) CreateConversation(sender, recipient string) (*models.Conversation, error) {
+	if sender == "" || recipient == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	// if the user or sender id are invalid, throw error - in this case a not found, so as not to tip off malicious attacks of a bad user id
+	if err := usersExist(d.db, sender, recipient); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	convo := &models.Conversation{
+		ID:        uuid.New().String(),
+		Sender:    sender,
+		Recipient: recipient,
+		Updated:   &now,
+		Messages:  []*models.Message{},
+	}
+
+	// If a conversation already exists, in either direction, the pair index rejects it
+	_, err := d.db.Exec(`INSERT INTO conversations (id, sender, recipient, updated) VALUES (?, ?, ?, ?)`,
+		convo.ID, convo.Sender, convo.Recipient, now.UnixNano())
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	return convo, nil
+}
+
+// ListConversations - lists all conversations between recipient and others, most recently updated first, leaving out
+// messages they have hidden. Each counts the messages recipient hasn't read.
+// from and until times can be passed to further narrow results to conversations that have been updated in the timeframe
+// if a 0 time is passed for either of these values, that filtering parameter is ignored
+func (d *Driver) ListConversations(recipient string, from, until time.Time) ([]*models.Conversation, error) {
+	if recipient == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	start, end, err := window(from, until)
+	if err != nil {
+		return nil, err
+	}
+
+	// if the receipient id is invalid, throw error
+	if err := usersExist(d.db, recipient); err != nil {
+		return nil, err
+	}
+
+	// served by the conversations (sender|recipient, updated) indices
+	rows, err := d.db.Query(selectConversation+`
+		WHERE (c.sender = ?1 OR c.recipient = ?1) AND c.updated BETWEEN ?2 AND ?3
+		ORDER BY c.updated DESC`,
+		recipient, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []*models.Conversation{}
+	for rows.Next() {
+		convo, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, convo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, convo := range conversations {
+		if err := d.loadMessages(convo, recipient); err != nil {
+			return nil, err
+		}
+
+		if err := loadUnread(d.db, convo, "conversation_id", recipient); err != nil {
+			return nil, err
+		}
+	}
+
+	return conversations, nil
+}
+
+// GetUser - gets a single user by id, soft deleted users are not found
+func (d *Driver) GetUser(id string) (*models.User, error) {
+	if id == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	user, err := scanUser(d.db.QueryRow(selectUser+` WHERE id = ?1 AND archived_on IS NULL`, id))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// CreateUser - creates a new user. People need an email, bots need an owner instead: an active user who isn't a
+// bot themselves
+func (d *Driver) CreateUser(user *models.User) (*models.User, error) {
+	if !validUser(user) {
+		return nil, constants.ErrBadRequest
+	}
+
+	var owner interface{}
+	if user.Bot {
+		var ownerIsBot bool
+		err := d.db.QueryRow(`SELECT bot FROM users WHERE id = ?1 AND archived_on IS NULL`, user.Owner).Scan(&ownerIsBot)
+		if err == sql.ErrNoRows {
+			return nil, constants.ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ownerIsBot {
+			return nil, constants.ErrBadRequest
+		}
+		owner = user.Owner
+	}
+
+	user.ID = uuid.New().String()
+
+	// usernames are unique, a duplicate is a bad request
+	_, err := d.db.Exec(`INSERT INTO users (id, username, email, bot, owner) VALUES (?1, ?2, ?3, ?4, ?5)`,
+		user.ID, user.Username, user.Email, user.Bot, owner)
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	return user, nil
+}
+
+// CreateAccount - creates a new person along with their password hash. Both happen in a single transaction, so
+// there is never a user without a password. Bots can't have a password, they use API keys
+func (d *Driver) CreateAccount(user *models.User, passwordHash string) (*models.User, error) {
+	if !validUser(user) || user.Bot || passwordHash == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	user.ID = uuid.New().String()
+
+	// usernames are unique, a duplicate is a bad request
+	if _, err := tx.Exec(`INSERT INTO users (id, username, email) VALUES (?, ?, ?)`, user.ID, user.Username, user.Email); err != nil {
+		return nil, translate(err)
+	}
+
+	if _, err := tx.Exec(`INSERT INTO credentials (user_id, password_hash, updated) VALUES (?, ?, ?)`,
+		user.ID, passwordHash, time.Now().UnixNano()); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// DeleteUser - soft deletes a user, along with any bots they own
+func (d *Driver) DeleteUser(id string) error {
+	if id == "" {
+		return constants.ErrBadRequest
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	archived := time.Now().UnixNano()
+	res, err := tx.Exec(`UPDATE users SET archived_on = ?2 WHERE id = ?1`, id, archived)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return constants.ErrNotFound
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET archived_on = ?2 WHERE owner = ?1 AND bot AND archived_on IS NULL`, id, archived); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetUserByUsername - gets a single user by username
+func (d *Driver) GetUserByUsername(username string) (*models.User, error) {
+	if username == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	user, err := scanUser(d.db.QueryRow(selectUser+` WHERE username = ?1 AND archived_on IS NULL`, username))
+	if err == sql.ErrNoRows {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ListBots - lists the active bots a user owns, by username
+func (d *Driver) ListBots(owner string) ([]*models.User, error) {
+	if owner == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	if err := usersExist(d.db, owner); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(selectUser+` WHERE owner = ?1 AND bot AND archived_on IS NULL ORDER BY username`, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bots := []*models.User{}
+	for rows.Next() {
+		bot, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		bots = append(bots, bot)
+	}
+
+	return bots, rows.Err()
+}
+
+// SetPassword - sets, or replaces, the password hash for a user
+func (d *Driver) SetPassword(userID, hash string) error {
+	if userID == "" || hash == "" {
+		return constants.ErrBadRequest
+	}
+
+	// the WHERE is required for sqlite to parse the upsert after a SELECT
+	res, err := d.db.Exec(`
+		INSERT INTO credentials (user_id, password_hash, updated)
+		SELECT id, ?2, ?3 FROM users WHERE id = ?1 AND archived_on IS NULL
+		ON CONFLICT (user_id) DO UPDATE SET password_hash = excluded.password_hash, updated = excluded.updated`,
+		userID, hash, time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return constants.ErrNotFound
+	}
+
+	return nil
+}
+
+// GetPassword - gets the password hash for a user, not found if they have never set one
+func (d *Driver) GetPassword(userID string) (string, error) {
+	if userID == "" {
+		return "", constants.ErrBadRequest
+	}
+
+	var hash string
+	err := d.db.QueryRow(`
+		SELECT c.password_hash FROM credentials c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.user_id = ? AND u.archived_on IS NULL`, userID).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", constants.ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return hash, nil
+}
+
+// CreatePasswordReset - stores a password reset for a user, valid until expires. Only a hash of the
+// reset token is stored, so the token itself can't be recovered from the datastore
+func (d *Driver) CreatePasswordReset(userID, tokenHash string, expires time.Time) error {
+	if userID == "" || tokenHash == "" {
+		return constants.ErrBadRequest
+	}
+
+	res, err := d.db.Exec(`
+		INSERT INTO password_resets (token_hash, user_id, expires)
+		SELECT ?2, id, ?3 FROM users WHERE id = ?1 AND archived_on IS NULL`,
+		userID, tokenHash, expires.UnixNano())
+	if err != nil {
+		return translate(err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return constants.ErrNotFound
+	}
+
+	return nil
+}
+
+// ConsumePasswordReset - uses up a password reset, returning the id of the user it was for.
+// A reset can only be used once, and expired resets are not found
+func (d *Driver) ConsumePasswordReset(tokenHash string) (string, error) {
+	if tokenHash == "" {
+		return "", constants.ErrBadRequest
+	}
+
+	// the transaction holds the write lock, so two requests can't both use the same reset
+	tx, err := d.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	var expires int64
+	err = tx.QueryRow(`
+		SELECT r.user_id, r.expires FROM password_resets r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.token_hash = ? AND u.archived_on IS NULL`, tokenHash).Scan(&userID, &expires)
+	if err == sql.ErrNoRows {
+		return "", constants.ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// an expired reset is cleared out all the same
+	if _, err := tx.Exec(`DELETE FROM password_resets WHERE token_hash = ?`, tokenHash); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	if expires < time.Now().UnixNano() {
+		return "", constants.ErrNotFound
+	}
+
+	return userID, nil
+}
+
+// loadMessages - fills in the messages in a conversation, oldest first, leaving out any the viewer has hidden.
+// An empty viewer sees every message
+func (d *Driver) loadMessages(convo *models.Conversation, viewer string) error {
+	msgs, err := queryMessages(d.db, selectMessage+`
+		WHERE m.conversation_id = ?
+		AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.user_id = ? AND h.message_id = m.id)
+		ORDER BY m.date, m.id`,
+		convo.ID, viewer)
+	if err != nil {
+		return err
+	}
+
+	convo.Messages = msgs
+	return nil
+}
+
+// usersExist - returns not found unless every id belongs to a user, deleted or not
+func usersExist(q querier, ids ...string) error {
+	// the same user may be passed twice, ie: messaging yourself
+	unique := map[string]bool{}
+	args := []interface{}{}
+	for _, id := range ids {
+		if !unique[id] {
+			unique[id] = true
+			args = append(args, id)
+		}
+	}
+
+	var count int
+	query := `SELECT COUNT(*) FROM users WHERE id IN (?` + strings.Repeat(`, ?`, len(args)-1) + `)`
+	if err := q.QueryRow(query, args...).Scan(&count); err != nil {
+		return err
+	}
+
+	if count != len(args) {
+		return constants.ErrNotFound
+	}
+
+	return nil
+}
+
+// queryMessages - runs a query selecting messages, and fills in their reactions and attachments
+func queryMessages(q querier, query string, args ...interface{}) ([]*models.Message, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := []*models.Message{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// a transaction can only run one query at a time, so finish this one first
+	rows.Close()
+
+	if err := loadDetails(q, msgs...); err != nil {
+		return nil, err
+	}
+
+	return msgs, nil
+}
+
+// detailBatch - how many messages' reactions and attachments are looked up at once, well under sqlite's limit on
+// query parameters
+const detailBatch = 500
+
+// loadDetails - fills in the reactions and attachments of each message, a batch of messages at a time
+func loadDetails(q querier, msgs ...*models.Message) error {
+	byID := make(map[string]*models.Message, len(msgs))
+	for _, msg := range msgs {
+		byID[msg.ID] = msg
+	}
+
+	for start := 0; start < len(msgs); start += detailBatch {
+		end := start + detailBatch
+		if end > len(msgs) {
+			end = len(msgs)
+		}
+
+		ids := make([]interface{}, 0, end-start)
+		for _, msg := range msgs[start:end] {
+			ids = append(ids, msg.ID)
+		}
+
+		if err := loadReactions(q, byID, ids); err != nil {
+			return err
+		}
+
+		if err := loadAttachments(q, byID, ids); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// placeholders - n comma separated query parameters
+func placeholders(n int) string {
+	return "?" + strings.Repeat(", ?", n-1)
+}
+
+// scanner - either a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMessage(row scanner) (*models.Message, error) {
+	msg := &models.Message{}
+	var date int64
+	var edited, deleted, lastReply sql.NullInt64
+	if err := row.Scan(&msg.ID, &msg.Sender, &msg.Recipient, &msg.GroupID, &msg.ChannelID, &msg.Content, &date, &edited, &deleted,
+		&msg.ParentID, &msg.ReplyCount, &lastReply, &msg.ConversationID); err != nil {
+		return nil, err
+	}
+
+	msg.Date = fromNanos(date)
+	if edited.Valid {
+		msg.EditedAt = fromNanos(edited.Int64)
+	}
+	if deleted.Valid {
+		msg.DeletedAt = fromNanos(deleted.Int64)
+	}
+	if lastReply.Valid {
+		msg.LastReplyAt = fromNanos(lastReply.Int64)
+	}
+	return msg, nil
+}
+
+func scanConversation(row scanner) (*models.Conversation, error) {
+	convo := &models.Conversation{}
+	var updated int64
+	if err := row.Scan(&convo.ID, &convo.Sender, &convo.Recipient, &updated); err != nil {
+		return nil, err
+	}
+
+	convo.Updated = fromNanos(updated)
+	return convo, nil
+}
+
+// window - validates a from/until filter and converts it to unix nanoseconds. A 0 from time is the
+// start of time, and a 0 until time is now
+func window(from, until time.Time) (int64, int64, error) {
+	if until.Equal(time.Time{}) {
+		until = time.Now()
+	}
+
+	if from.After(until) {
+		return 0, 0, constants.ErrBadRequest
+	}
+
+	start := int64(math.MinInt64)
+	if !from.Equal(time.Time{}) {
+		start = from.UnixNano()
+	}
+
+	return start, until.UnixNano(), nil
+}
+
+func fromNanos(nanos int64) *time.Time {
+	t := time.Unix(0, nanos)
+	return &t
+}
+
+// inOrder - puts messages back in the order of their ids, leaving out any ids that weren't found
+func inOrder(msgs []*models.Message, ids []string) []*models.Message {
+	byID := make(map[string]*models.Message, len(msgs))
+	for _, msg := range msgs {
+		byID[msg.ID] = msg
+	}
+
+	ordered := make([]*models.Message, 0, len(msgs))
+	for _, id := range ids {
+		if msg, ok := byID[id]; ok {
+			ordered = append(ordered, msg)
+		}
+	}
+
+	return ordered
+}
+
+// direction - the sql sort direction for an order
+func direction(order db.Order) string {
+	if order == db.NewestFirst {
+		return "DESC"
+	}
+
+	return "ASC"
+}
+
+// translate - maps sqlite errors onto the standard errors, unique and primary key violations are bad data
+func translate(err error) error {
+	if sqliteErr, ok := err.(sqlite3.Error); ok &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey) {
+		return constants.ErrBadRequest
+	}
+
+	return err
+}
+
+// validUser - whether a new user is complete. People need an email and no owner, bots need an owner
+func validUser(user *models.User) bool {
+	if user == nil || user.Username == "" {
+		return false
+	}
+
+	if user.Bot {
+		return user.Owner != ""
+	}
+
+	return user.Email != "" && user.Owner == ""
+}
+
+func scanUser(row scanner) (*models.User, error) {
+	user := &models.User{}
+	if err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Bot, &user.Owner); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,31 @@
+package sqlite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/db/dbtest"
+)
+
+func TestDriver(t *testing.T) {
+	dbtest.RunDriverSuite(t, func(t *testing.T) (db.Driver, func()) {
+		dir, err := ioutil.TempDir("", "guild-sqlite")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := NewDriver(Config{Path: filepath.Join(dir, "guild.db")})
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+
+		return d, func() {
+			d.Close()
+			os.RemoveAll(dir)
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// Event types published on the bus
+const (
+	MessageCreated      = "message.created"
+	MessageEdited       = "message.edited"
+	MessageDeleted      = "message.deleted"
+	MessageReacted      = "message.reacted"
+	MessageAttached     = "message.attached"
+	MessageRead         = "message.read"
+	ConversationCreated = "conversation.created"
+	UserCreated         = "user.created"
+	UserArchived        = "user.archived"
+	ParticipantAdded    = "participant.added"
+	ParticipantRemoved  = "participant.removed"
+	GuildCreated        = "guild.created"
+	MemberJoined        = "member.joined"
+	MemberLeft          = "member.left"
+	ChannelCreated      = "channel.created"
+	RoleCreated         = "role.created"
+	MemberUpdated       = "member.updated"
+)
+
+type (
+	// Event - something that happened after a successful write to the datastore. Only the field
+	// matching the type is set, except participant and member events which carry both the group or
+	// guild and the user (or membership), channel and role events which carry the guild too, and read events which
+	// carry the message read up to and the receipt. Recipients lists the participants of a group, or members of a
+	// guild, a message was sent to, edited or deleted in
+	Event struct {
+		Type         string               `json:"type"`
+		Date         time.Time            `json:"date"`
+		Message      *models.Message      `json:"message,omitempty"`
+		Conversation *models.Conversation `json:"conversation,omitempty"`
+		Guild        *models.Guild        `json:"guild,omitempty"`
+		Channel      *models.Channel      `json:"channel,omitempty"`
+		Role         *models.Role         `json:"role,omitempty"`
+		Member       *models.Member       `json:"member,omitempty"`
+		User         *models.User         `json:"user,omitempty"`
+		Receipt      *models.Receipt      `json:"receipt,omitempty"`
+		Recipients   []string             `json:"recipients,omitempty"`
+	}
+
+	// Handler - receives events for a subscription, one at a time and in the order they were published
+	Handler func(evt *Event)
+
+	// Bus - an in-process publish/subscribe bus. Each subscription has its own bounded buffer and
+	// goroutine, so a slow subscriber never holds up publishers or other subscribers. Events for a
+	// single conversation are published in order (see Driver), and each subscriber sees them in that order
+	Bus struct {
+		mux    sync.RWMutex
+		subs   map[*Subscription]bool
+		closed bool
+	}
+
+	// Subscription - a registered handler and the events it is waiting to handle
+	Subscription struct {
+		Name string
+
+		bus     *Bus
+		types   map[string]bool // empty for every type
+		handler Handler
+		c       chan *Event
+		done    chan struct{}
+		once    sync.Once
+		dropped uint64
+	}
+)
+
+// NewBus - creates a bus with no subscribers
+func NewBus() *Bus {
+	return &Bus{
+		subs: map[*Subscription]bool{},
+	}
+}
+
+// Subscribe - registers handler for the given event types, or every type if none are given. Up to
+// buffer events are queued for the handler, anything published while the buffer is full is dropped
+func (b *Bus) Subscribe(name string, buffer int, handler Handler, types ...string) *Subscription {
+	sub := &Subscription{
+		Name:    name,
+		bus:     b,
+		types:   map[string]bool{},
+		handler: handler,
+		c:       make(chan *Event, buffer),
+		done:    make(chan struct{}),
+	}
+
+	for _, t := range types {
+		sub.types[t] = true
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.closed {
+		sub.once.Do(func() { close(sub.c) })
+	} else {
+		b.subs[sub] = true
+	}
+
+	go sub.run()
+
+	return sub
+}
+
+// Publish - queues an event for every interested subscriber. Never blocks
+func (b *Bus) Publish(evt *Event) {
+	if evt.Date.IsZero() {
+		evt.Date = time.Now()
+	}
+
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+
+	for sub := range b.subs {
+		if len(sub.types) > 0 && !sub.types[evt.Type] {
+			continue
+		}
+
+		select {
+		case sub.c <- evt:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+}
+
+// Close - stops accepting events and waits for every subscriber to handle what it has queued
+func (b *Bus) Close() {
+	b.mux.Lock()
+	b.closed = true
+	subs := b.subs
+	b.subs = map[*Subscription]bool{}
+	b.mux.Unlock()
+
+	for sub := range subs {
+		sub.once.Do(func() { close(sub.c) })
+		<-sub.done
+	}
+}
+
+// Close - unsubscribes, the handler finishes whatever is already queued
+func (s *Subscription) Close() {
+	s.bus.mux.Lock()
+	delete(s.bus.subs, s)
+	s.bus.mux.Unlock()
+
+	s.once.Do(func() { close(s.c) })
+}
+
+// Dropped - how many events were dropped because the subscription's buffer was full
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *Subscription) run() {
+	defer close(s.done)
+
+	for evt := range s.c {
+		s.handler(evt)
+	}
+}
@@ -0,0 +1,133 @@
+package events
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBusDeliversInOrder(t *testing.T) {
+	bus := NewBus()
+
+	var got []string
+	bus.Subscribe("test", 100, func(evt *Event) {
+		got = append(got, evt.Type)
+	})
+
+	want := []string{UserCreated, ConversationCreated, MessageCreated}
+	for _, eventType := range want {
+		bus.Publish(&Event{Type: eventType})
+	}
+
+	// closing waits for the subscriber to handle everything queued
+	bus.Close()
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestBusFiltersTypes(t *testing.T) {
+	bus := NewBus()
+
+	var got []string
+	bus.Subscribe("test", 10, func(evt *Event) {
+		got = append(got, evt.Type)
+	}, ConversationCreated)
+
+	bus.Publish(&Event{Type: MessageCreated})
+	bus.Publish(&Event{Type: ConversationCreated})
+	bus.Close()
+
+	if len(got) != 1 || got[0] != ConversationCreated {
+		t.Errorf("expected only %s, got %v", ConversationCreated, got)
+	}
+}
+
+func TestBusDropsWhenFull(t *testing.T) {
+	bus := NewBus()
+
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	var mux sync.Mutex
+	handled := 0
+
+	sub := bus.Subscribe("slow", 1, func(evt *Event) {
+		mux.Lock()
+		handled++
+		first := handled == 1
+		mux.Unlock()
+
+		if first {
+			close(handling)
+			<-release
+		}
+	})
+
+	// the first event is taken off the buffer and held by the handler
+	bus.Publish(&Event{Type: MessageCreated})
+	select {
+	case <-handling:
+	case <-time.After(time.Second):
+		t.Fatal("expected the handler to be called")
+	}
+
+	// one more fits in the buffer, the rest are dropped without blocking
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 4; i++ {
+			bus.Publish(&Event{Type: MessageCreated})
+		}
+		close(published)
+	}()
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("expected Publish not to block on a full subscriber")
+	}
+
+	if dropped := sub.Dropped(); dropped != 3 {
+		t.Errorf("expected 3 dropped, got %d", dropped)
+	}
+
+	close(release)
+	bus.Close()
+
+	if handled != 2 {
+		t.Errorf("expected 2 handled, got %d", handled)
+	}
+}
+
+func TestBusSlowSubscriberDoesntHoldUpOthers(t *testing.T) {
+	bus := NewBus()
+	defer bus.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	bus.Subscribe("slow", 1, func(evt *Event) {
+		<-release
+	})
+
+	fast := make(chan *Event, 10)
+	bus.Subscribe("fast", 10, func(evt *Event) {
+		fast <- evt
+	})
+
+	for i := 0; i < 5; i++ {
+		bus.Publish(&Event{Type: MessageCreated})
+	}
+
+	for i := 0; i < 5; i++ {
+		select {
+		case <-fast:
+		case <-time.After(time.Second):
+			t.Fatalf("expected 5 events for the fast subscriber, got %d", i)
+		}
+	}
+}
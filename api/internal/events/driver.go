@@ -0,0 +1,573 @@
+package events
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// stripes - number of locks conversations are spread over
+const stripes = 64
+
+// Driver - wraps a db.Driver, publishing an event to the bus after every successful write. Handlers
+// use it in place of the underlying driver, so nothing that writes can forget to publish
+type Driver struct {
+	db.Driver
+	bus *Bus
+
+	// writes to the same conversation hold the same lock while writing and publishing, so their
+	// events are published in the order they were written
+	locks [stripes]sync.Mutex
+
+	// messages between a pair hold the pair's lock, then their conversation's once it exists. A pair's first message
+	// creates the conversation, so until then nothing else can be written to it. Pair locks are always taken first
+	pairs [stripes]sync.Mutex
+
+	// conversations known to exist, by pair, so we only look for a new conversation on a pair's first message
+	mux   sync.RWMutex
+	known map[string]string
+}
+
+var (
+	_ db.Driver = new(Driver)
+)
+
+// NewDriver - wraps driver to publish to bus
+func NewDriver(driver db.Driver, bus *Bus) *Driver {
+	return &Driver{
+		Driver: driver,
+		bus:    bus,
+		known:  map[string]string{},
+	}
+}
+
+// Close - closes the underlying driver, if it needs closing
+func (d *Driver) Close() error {
+	if closer, ok := d.Driver.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// CreateMessage - creates a message and publishes MessageCreated, preceded by ConversationCreated if
+// it was the first message between the pair
+func (d *Driver) CreateMessage(msg *models.Message) (*models.Message, error) {
+	if msg.GroupID != "" {
+		return d.createGroupMessage(msg)
+	}
+
+	if msg.ChannelID != "" {
+		return d.createChannelMessage(msg)
+	}
+
+	key := pairKey(msg.Sender, msg.Recipient)
+	pair := d.pairLock(key)
+	pair.Lock()
+	defer pair.Unlock()
+
+	convoID := d.conversation(key)
+	if convoID == "" && msg.Sender != "" && msg.Recipient != "" {
+		if convo, err := d.Driver.GetConversation(msg.Sender, msg.Recipient, time.Time{}, time.Time{}); err == nil {
+			convoID = convo.ID
+		}
+	}
+
+	if convoID != "" {
+		lock := d.lock(conversationKey(convoID))
+		lock.Lock()
+		defer lock.Unlock()
+	}
+
+	msg, err := d.Driver.CreateMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if convoID == "" {
+		if convo, err := d.Driver.GetConversation(msg.Sender, msg.Recipient, time.Time{}, time.Time{}); err == nil {
+			d.bus.Publish(&Event{Type: ConversationCreated, Conversation: convo})
+		}
+	}
+	d.setKnown(key, msg.ConversationID)
+
+	d.bus.Publish(&Event{Type: MessageCreated, Message: msg})
+
+	return msg, nil
+}
+
+// EditMessage - edits a message and publishes MessageEdited
+func (d *Driver) EditMessage(id, editor, content string) (*models.Message, error) {
+	// the lock depends on where the message was sent, so look it up first. Where never changes
+	msg, err := d.Driver.GetMessage(id)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := d.lock(messageKey(msg))
+	lock.Lock()
+	defer lock.Unlock()
+
+	msg, err = d.Driver.EditMessage(id, editor, content)
+	if err != nil {
+		return nil, err
+	}
+
+	d.bus.Publish(&Event{Type: MessageEdited, Message: msg, Recipients: d.recipients(msg)})
+
+	return msg, nil
+}
+
+// DeleteMessage - deletes a message for everyone and publishes MessageDeleted
+func (d *Driver) DeleteMessage(id string) (*models.Message, error) {
+	msg, err := d.Driver.GetMessage(id)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := d.lock(messageKey(msg))
+	lock.Lock()
+	defer lock.Unlock()
+
+	msg, err = d.Driver.DeleteMessage(id)
+	if err != nil {
+		return nil, err
+	}
+
+	d.bus.Publish(&Event{Type: MessageDeleted, Message: msg, Recipients: d.recipients(msg)})
+
+	return msg, nil
+}
+
+// AddReaction - reacts to a message and publishes MessageReacted
+func (d *Driver) AddReaction(messageID, userID, emoji string) (*models.Message, error) {
+	msg, err := d.Driver.GetMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := d.lock(messageKey(msg))
+	lock.Lock()
+	defer lock.Unlock()
+
+	msg, err = d.Driver.AddReaction(messageID, userID, emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	d.bus.Publish(&Event{Type: MessageReacted, Message: msg, Recipients: d.recipients(msg)})
+
+	return msg, nil
+}
+
+// RemoveReaction - takes back a reaction to a message and publishes MessageReacted
+func (d *Driver) RemoveReaction(messageID, userID, emoji string) (*models.Message, error) {
+	msg, err := d.Driver.GetMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := d.lock(messageKey(msg))
+	lock.Lock()
+	defer lock.Unlock()
+
+	msg, err = d.Driver.RemoveReaction(messageID, userID, emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	d.bus.Publish(&Event{Type: MessageReacted, Message: msg, Recipients: d.recipients(msg)})
+
+	return msg, nil
+}
+
+// AddAttachment - attaches a file to a message and publishes MessageAttached, with the message and all of its attachments
+func (d *Driver) AddAttachment(uploader string, att *models.Attachment) (*models.Attachment, error) {
+	msg, err := d.Driver.GetMessage(att.MessageID)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := d.lock(messageKey(msg))
+	lock.Lock()
+	defer lock.Unlock()
+
+	att, err = d.Driver.AddAttachment(uploader, att)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg, err = d.Driver.GetMessage(att.MessageID); err == nil {
+		d.bus.Publish(&Event{Type: MessageAttached, Message: msg, Recipients: d.recipients(msg)})
+	}
+
+	return att, nil
+}
+
+// MarkRead - marks a message read and publishes MessageRead, unless the user had already read past it
+func (d *Driver) MarkRead(userID, messageID string) (*models.Receipt, error) {
+	msg, err := d.Driver.GetMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := d.lock(messageKey(msg))
+	lock.Lock()
+	defer lock.Unlock()
+
+	receipt, err := d.Driver.MarkRead(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if receipt.MessageID == messageID {
+		d.bus.Publish(&Event{Type: MessageRead, Message: msg, Receipt: receipt, Recipients: d.recipients(msg)})
+	}
+
+	return receipt, nil
+}
+
+// recipients - everyone a group or channel message is delivered to, nil for a message to a single recipient
+func (d *Driver) recipients(msg *models.Message) []string {
+	if msg.GroupID != "" {
+		if group, err := d.Driver.GetGroup(msg.GroupID); err == nil {
+			return group.Participants
+		}
+	}
+
+	if msg.ChannelID != "" {
+		if channel, err := d.Driver.GetChannel(msg.ChannelID); err == nil {
+			if members, err := d.Driver.ListMembers(channel.GuildID); err == nil {
+				ids := make([]string, len(members))
+				for i, member := range members {
+					ids[i] = member.UserID
+				}
+				return ids
+			}
+		}
+	}
+
+	return nil
+}
+
+// CreateConversation - creates a conversation and publishes ConversationCreated
+func (d *Driver) CreateConversation(sender, recipient string) (*models.Conversation, error) {
+	key := pairKey(sender, recipient)
+	pair := d.pairLock(key)
+	pair.Lock()
+	defer pair.Unlock()
+
+	convo, err := d.Driver.CreateConversation(sender, recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	d.setKnown(key, convo.ID)
+	d.bus.Publish(&Event{Type: ConversationCreated, Conversation: convo})
+
+	return convo, nil
+}
+
+// createGroupMessage - creates a message in a group and publishes MessageCreated to its participants
+func (d *Driver) createGroupMessage(msg *models.Message) (*models.Message, error) {
+	lock := d.lock(groupKey(msg.GroupID))
+	lock.Lock()
+	defer lock.Unlock()
+
+	msg, err := d.Driver.CreateMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	d.bus.Publish(&Event{Type: MessageCreated, Message: msg, Recipients: d.recipients(msg)})
+
+	return msg, nil
+}
+
+// CreateGroup - creates a group conversation and publishes ConversationCreated
+func (d *Driver) CreateGroup(owner, name string, participants []string) (*models.Conversation, error) {
+	group, err := d.Driver.CreateGroup(owner, name, participants)
+	if err != nil {
+		return nil, err
+	}
+
+	d.bus.Publish(&Event{Type: ConversationCreated, Conversation: group})
+
+	return group, nil
+}
+
+// AddParticipant - adds a user to a group and publishes ParticipantAdded
+func (d *Driver) AddParticipant(groupID, userID string) error {
+	lock := d.lock(groupKey(groupID))
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := d.Driver.AddParticipant(groupID, userID); err != nil {
+		return err
+	}
+
+	d.publishParticipant(ParticipantAdded, groupID, userID)
+
+	return nil
+}
+
+// RemoveParticipant - removes a user from a group and publishes ParticipantRemoved
+func (d *Driver) RemoveParticipant(groupID, userID string) error {
+	lock := d.lock(groupKey(groupID))
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := d.Driver.RemoveParticipant(groupID, userID); err != nil {
+		return err
+	}
+
+	d.publishParticipant(ParticipantRemoved, groupID, userID)
+
+	return nil
+}
+
+// publishParticipant - publishes a participant event with the group as it is after the change
+func (d *Driver) publishParticipant(eventType, groupID, userID string) {
+	group, err := d.Driver.GetGroup(groupID)
+	if err != nil {
+		group = &models.Conversation{ID: groupID}
+	}
+
+	d.bus.Publish(&Event{Type: eventType, Conversation: group, User: &models.User{ID: userID}})
+}
+
+// createChannelMessage - creates a message in a guild channel and publishes MessageCreated to the guild's members
+func (d *Driver) createChannelMessage(msg *models.Message) (*models.Message, error) {
+	lock := d.lock(channelKey(msg.ChannelID))
+	lock.Lock()
+	defer lock.Unlock()
+
+	msg, err := d.Driver.CreateMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	d.bus.Publish(&Event{Type: MessageCreated, Message: msg, Recipients: d.recipients(msg)})
+
+	return msg, nil
+}
+
+// CreateGuild - creates a guild and publishes GuildCreated
+func (d *Driver) CreateGuild(owner, name string) (*models.Guild, error) {
+	guild, err := d.Driver.CreateGuild(owner, name)
+	if err != nil {
+		return nil, err
+	}
+
+	d.bus.Publish(&Event{Type: GuildCreated, Guild: guild})
+
+	return guild, nil
+}
+
+// JoinGuild - adds a member to a guild and publishes MemberJoined
+func (d *Driver) JoinGuild(guildID, userID string) (*models.Member, error) {
+	member, err := d.Driver.JoinGuild(guildID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	d.publishMember(MemberJoined, guildID, userID)
+
+	return member, nil
+}
+
+// LeaveGuild - removes a member from a guild and publishes MemberLeft
+func (d *Driver) LeaveGuild(guildID, userID string) error {
+	if err := d.Driver.LeaveGuild(guildID, userID); err != nil {
+		return err
+	}
+
+	d.publishMember(MemberLeft, guildID, userID)
+
+	return nil
+}
+
+// CreateChannel - creates a channel in a guild and publishes ChannelCreated
+func (d *Driver) CreateChannel(guildID, name string) (*models.Channel, error) {
+	channel, err := d.Driver.CreateChannel(guildID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	guild, err := d.Driver.GetGuild(guildID)
+	if err != nil {
+		guild = &models.Guild{ID: guildID}
+	}
+
+	d.bus.Publish(&Event{Type: ChannelCreated, Guild: guild, Channel: channel})
+
+	return channel, nil
+}
+
+// CreateRole - creates a custom role in a guild and publishes RoleCreated
+func (d *Driver) CreateRole(guildID, name string, perms models.Permission) (*models.Role, error) {
+	role, err := d.Driver.CreateRole(guildID, name, perms)
+	if err != nil {
+		return nil, err
+	}
+
+	d.bus.Publish(&Event{Type: RoleCreated, Guild: &models.Guild{ID: guildID}, Role: role})
+
+	return role, nil
+}
+
+// SetRole - gives a member another role and publishes MemberUpdated
+func (d *Driver) SetRole(guildID, userID, role string) (*models.Member, error) {
+	member, err := d.Driver.SetRole(guildID, userID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	d.bus.Publish(&Event{Type: MemberUpdated, Guild: &models.Guild{ID: guildID}, Member: member})
+
+	return member, nil
+}
+
+// MuteMember - mutes or unmutes a member and publishes MemberUpdated
+func (d *Driver) MuteMember(guildID, userID string, until time.Time) (*models.Member, error) {
+	member, err := d.Driver.MuteMember(guildID, userID, until)
+	if err != nil {
+		return nil, err
+	}
+
+	d.bus.Publish(&Event{Type: MemberUpdated, Guild: &models.Guild{ID: guildID}, Member: member})
+
+	return member, nil
+}
+
+// publishMember - publishes a member event with the guild as it is after the change
+func (d *Driver) publishMember(eventType, guildID, userID string) {
+	guild, err := d.Driver.GetGuild(guildID)
+	if err != nil {
+		guild = &models.Guild{ID: guildID}
+	}
+
+	d.bus.Publish(&Event{Type: eventType, Guild: guild, User: &models.User{ID: userID}})
+}
+
+// CreateUser - creates a user and publishes UserCreated
+func (d *Driver) CreateUser(user *models.User) (*models.User, error) {
+	user, err := d.Driver.CreateUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	d.bus.Publish(&Event{Type: UserCreated, User: user})
+
+	return user, nil
+}
+
+// CreateAccount - creates a user with their password and publishes UserCreated
+func (d *Driver) CreateAccount(user *models.User, passwordHash string) (*models.User, error) {
+	user, err := d.Driver.CreateAccount(user, passwordHash)
+	if err != nil {
+		return nil, err
+	}
+
+	d.bus.Publish(&Event{Type: UserCreated, User: user})
+
+	return user, nil
+}
+
+// DeleteUser - soft deletes a user and publishes UserArchived, for them and for each of the bots deleted with them
+func (d *Driver) DeleteUser(id string) error {
+	// look the user and their bots up first, once deleted they can't be found
+	user, err := d.Driver.GetUser(id)
+	if err != nil {
+		user = &models.User{ID: id}
+	}
+
+	bots, _ := d.Driver.ListBots(id)
+
+	if err := d.Driver.DeleteUser(id); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, archived := range append([]*models.User{user}, bots...) {
+		archived := *archived
+		archived.ArchivedOn = &now
+		d.bus.Publish(&Event{Type: UserArchived, User: &archived, Date: now})
+	}
+
+	return nil
+}
+
+// lock - the lock for a conversation
+func (d *Driver) lock(key string) *sync.Mutex {
+	return &d.locks[stripe(key)]
+}
+
+// pairLock - the lock for messages between a pair, see pairs
+func (d *Driver) pairLock(key string) *sync.Mutex {
+	return &d.pairs[stripe(key)]
+}
+
+// conversation - the id of the conversation between a pair, empty if it isn't known to exist yet
+func (d *Driver) conversation(key string) string {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.known[key]
+}
+
+func (d *Driver) setKnown(key, convoID string) {
+	if convoID == "" {
+		return
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.known[key] = convoID
+}
+
+// stripe - spreads keys over the locks
+func stripe(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32() % stripes
+}
+
+// conversationKey - identifies a conversation between two users by its id, so it is the same after either of them
+// is deleted and redacted
+func conversationKey(id string) string {
+	return "conversation|" + id
+}
+
+// groupKey - identifies a group conversation, apart from any pair
+func groupKey(id string) string {
+	return "group|" + id
+}
+
+// channelKey - identifies a guild channel, apart from any pair or group
+func channelKey(id string) string {
+	return "channel|" + id
+}
+
+// messageKey - identifies whichever conversation, group or channel a message was sent to
+func messageKey(msg *models.Message) string {
+	if msg.GroupID != "" {
+		return groupKey(msg.GroupID)
+	}
+
+	if msg.ChannelID != "" {
+		return channelKey(msg.ChannelID)
+	}
+
+	// the sender may have been redacted, so never key on the pair
+	return conversationKey(msg.ConversationID)
+}
+
+// pairKey - identifies a pair of users, regardless of direction
+func pairKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + "|" + b
+}
@@ -0,0 +1,144 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/radean0909/guild-chat/api/internal/db/mem"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+func newTestDriver(t *testing.T) (*Driver, *Bus) {
+	bus := NewBus()
+	return NewDriver(mem.NewDriver(), bus), bus
+}
+
+func newTestUser(t *testing.T, d *Driver, name string) *models.User {
+	user, err := d.CreateUser(&models.User{Username: name, Email: name + "@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// TestDriverPublishesConversationsInOrder - concurrent writers to several conversations, each conversation's events
+// have to come out in the order they were written
+func TestDriverPublishesConversationsInOrder(t *testing.T) {
+	d, bus := newTestDriver(t)
+
+	users := make([]*models.User, 4)
+	for i := range users {
+		users[i] = newTestUser(t, d, fmt.Sprintf("user%d", i))
+	}
+
+	// who sent what, in the order it was published, by conversation
+	var mux sync.Mutex
+	published := map[string][]*models.Message{}
+	bus.Subscribe("test", 10000, func(evt *Event) {
+		mux.Lock()
+		defer mux.Unlock()
+		published[evt.Message.ConversationID] = append(published[evt.Message.ConversationID], evt.Message)
+	}, MessageCreated, MessageEdited)
+
+	var wg sync.WaitGroup
+	for i := range users {
+		for j := range users {
+			if i == j {
+				continue
+			}
+
+			wg.Add(1)
+			go func(sender, recipient *models.User) {
+				defer wg.Done()
+				for n := 0; n < 25; n++ {
+					msg, err := d.CreateMessage(&models.Message{Sender: sender.ID, Recipient: recipient.ID, Content: "hi"})
+					if err != nil {
+						t.Error(err)
+						return
+					}
+
+					if _, err := d.EditMessage(msg.ID, sender.ID, "edited"); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}(users[i], users[j])
+		}
+	}
+	wg.Wait()
+	bus.Close()
+
+	if len(published) != 6 {
+		t.Fatalf("expected 6 conversations, got %d", len(published))
+	}
+
+	for convoID, msgs := range published {
+		created := map[string]bool{}
+		for i, msg := range msgs {
+			// a message is created before it is edited
+			if msg.EditedAt == nil {
+				created[msg.ID] = true
+			} else if !created[msg.ID] {
+				t.Errorf("conversation %s: message %s edited before it was created", convoID, msg.ID)
+			}
+
+			// and messages are created in the order they are dated
+			if i > 0 && msg.EditedAt == nil {
+				for j := i - 1; j >= 0; j-- {
+					if msgs[j].EditedAt == nil {
+						if msg.Date.Before(*msgs[j].Date) {
+							t.Errorf("conversation %s: message %s published after a later one", convoID, msg.ID)
+						}
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestDriverLocksRedactedConversations - once a sender is deleted their messages are read back redacted, and writes
+// to them still have to be ordered with the rest of the conversation
+func TestDriverLocksRedactedConversations(t *testing.T) {
+	d, bus := newTestDriver(t)
+	defer bus.Close()
+
+	alice := newTestUser(t, d, "alice")
+	bob := newTestUser(t, d, "bob")
+
+	fromAlice, err := d.CreateMessage(&models.Message{Sender: alice.ID, Recipient: bob.ID, Content: "bye"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromBob, err := d.CreateMessage(&models.Message{Sender: bob.ID, Recipient: alice.ID, Content: "see you"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.DeleteUser(alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	redacted, err := d.GetMessage(fromAlice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if redacted.Sender == alice.ID {
+		t.Fatal("expected the deleted sender to be redacted")
+	}
+
+	want := conversationKey(fromAlice.ConversationID)
+	for _, msg := range []*models.Message{fromAlice, redacted, fromBob} {
+		if key := messageKey(msg); key != want {
+			t.Errorf("messageKey(%s): expected %s, got %s", msg.ID, want, key)
+		}
+	}
+
+	// and it is the same lock the next message takes
+	if d.conversation(pairKey(alice.ID, bob.ID)) != fromAlice.ConversationID {
+		t.Errorf("expected conversation %s to be known", fromAlice.ConversationID)
+	}
+}
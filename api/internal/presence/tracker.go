@@ -0,0 +1,142 @@
+// Package presence tracks who is online. It is held in memory only, so it starts empty and everyone is offline
+// until they connect. With several replicas this would sit on a shared store with the same expiry
+package presence
+
+import (
+	"sync"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+type (
+	// Tracker - the presence of every user heard from. A user stays online, or idle if they said so, for a TTL after
+	// they were last heard from, then they are offline. Open sockets keep their user online (see Connect and Touch),
+	// and a user goes offline as soon as their last one closes
+	Tracker struct {
+		ttl time.Duration
+		now func() time.Time
+
+		mux   sync.Mutex
+		users map[string]*entry // keyed by user id
+	}
+
+	// entry - what is known of a single user's presence
+	entry struct {
+		status   string    // online or idle, as last set
+		lastSeen time.Time // when they were last heard from
+		expires  time.Time // when they go offline, unless heard from again
+		conns    int       // open connections
+	}
+)
+
+// NewTracker - creates an empty tracker, users go offline ttl after they were last heard from
+func NewTracker(ttl time.Duration) *Tracker {
+	return &Tracker{
+		ttl:   ttl,
+		now:   time.Now,
+		users: map[string]*entry{},
+	}
+}
+
+// Connect - a user opened a connection, they are online at least until it closes
+func (t *Tracker) Connect(userID string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	e := t.touch(userID)
+	e.status = models.StatusOnline
+	e.conns++
+}
+
+// Disconnect - a user closed a connection. Once their last one is closed they are offline
+func (t *Tracker) Disconnect(userID string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	e, ok := t.users[userID]
+	if !ok || e.conns == 0 {
+		return
+	}
+
+	e.conns--
+	if e.conns == 0 {
+		e.lastSeen = t.now()
+		e.expires = e.lastSeen
+	}
+}
+
+// Touch - a user was just heard from, ie: a socket answered a ping. They keep their status for another TTL
+func (t *Tracker) Touch(userID string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.touch(userID)
+}
+
+// Set - a user says they are online or idle, any other status is a bad request
+func (t *Tracker) Set(userID, status string) (*models.Presence, error) {
+	if status != models.StatusOnline && status != models.StatusIdle {
+		return nil, constants.ErrBadRequest
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	e := t.touch(userID)
+	e.status = status
+
+	return t.presence(userID, t.now()), nil
+}
+
+// Get - the presence of each user, in the order asked for
+func (t *Tracker) Get(userIDs []string) []*models.Presence {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	now := t.now()
+	out := make([]*models.Presence, len(userIDs))
+	for i, userID := range userIDs {
+		out[i] = t.presence(userID, now)
+	}
+
+	return out
+}
+
+// touch - refreshes a user's expiry, adding them as online if they haven't been heard from, or had gone offline.
+// Must hold the lock
+func (t *Tracker) touch(userID string) *entry {
+	now := t.now()
+
+	e, ok := t.users[userID]
+	if !ok {
+		e = &entry{}
+		t.users[userID] = e
+	}
+
+	if !now.Before(e.expires) {
+		e.status = models.StatusOnline
+	}
+
+	e.lastSeen = now
+	e.expires = now.Add(t.ttl)
+
+	return e
+}
+
+// presence - a user's presence at now. Must hold the lock
+func (t *Tracker) presence(userID string, now time.Time) *models.Presence {
+	e, ok := t.users[userID]
+	if !ok {
+		return &models.Presence{UserID: userID, Status: models.StatusOffline}
+	}
+
+	lastSeen := e.lastSeen
+	p := &models.Presence{UserID: userID, Status: e.status, LastSeen: &lastSeen}
+	if !now.Before(e.expires) {
+		p.Status = models.StatusOffline
+	}
+
+	return p
+}
@@ -0,0 +1,154 @@
+package presence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// clock - a time that only moves when told to
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestTracker(ttl time.Duration) (*Tracker, *clock) {
+	c := &clock{now: time.Date(2020, 4, 14, 12, 0, 0, 0, time.UTC)}
+	tr := NewTracker(ttl)
+	tr.now = c.Now
+	return tr, c
+}
+
+func TestTrackerTTL(t *testing.T) {
+	tr, c := newTestTracker(time.Minute)
+
+	// never heard from
+	expectStatus(t, "unknown", tr, "alice", models.StatusOffline)
+	if p := tr.Get([]string{"alice"})[0]; p.LastSeen != nil {
+		t.Errorf("expected no last seen for a user never heard from, got %v", p.LastSeen)
+	}
+
+	seen := c.now
+	tr.Touch("alice")
+	expectStatus(t, "touched", tr, "alice", models.StatusOnline)
+
+	// online until the TTL is up, then offline, still last seen when they were touched
+	c.now = seen.Add(time.Minute - time.Nanosecond)
+	expectStatus(t, "just before the TTL", tr, "alice", models.StatusOnline)
+
+	c.now = seen.Add(time.Minute)
+	expectStatus(t, "at the TTL", tr, "alice", models.StatusOffline)
+	if p := tr.Get([]string{"alice"})[0]; p.LastSeen == nil || !p.LastSeen.Equal(seen) {
+		t.Errorf("expected last seen %v, got %v", seen, p.LastSeen)
+	}
+
+	// touching again extends it from then
+	tr.Touch("alice")
+	c.now = c.now.Add(time.Minute - time.Nanosecond)
+	expectStatus(t, "touched again", tr, "alice", models.StatusOnline)
+}
+
+func TestTrackerSet(t *testing.T) {
+	tr, c := newTestTracker(time.Minute)
+
+	p, err := tr.Set("alice", models.StatusIdle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.UserID != "alice" || p.Status != models.StatusIdle || p.LastSeen == nil || !p.LastSeen.Equal(c.now) {
+		t.Errorf("expected alice idle, last seen now, got %+v", p)
+	}
+
+	for _, status := range []string{"", models.StatusOffline, "away"} {
+		if _, err := tr.Set("alice", status); err != constants.ErrBadRequest {
+			t.Errorf("Set(%q): expected %v, got %v", status, constants.ErrBadRequest, err)
+		}
+	}
+
+	// being heard from keeps them idle, until they expire
+	c.now = c.now.Add(30 * time.Second)
+	tr.Touch("alice")
+	expectStatus(t, "idle, touched", tr, "alice", models.StatusIdle)
+
+	c.now = c.now.Add(time.Minute)
+	expectStatus(t, "idle, expired", tr, "alice", models.StatusOffline)
+
+	// coming back after going offline is online again
+	tr.Touch("alice")
+	expectStatus(t, "back", tr, "alice", models.StatusOnline)
+
+	// as is connecting, whatever they had said
+	tr.Set("alice", models.StatusIdle)
+	tr.Connect("alice")
+	expectStatus(t, "connected", tr, "alice", models.StatusOnline)
+}
+
+func TestTrackerConnections(t *testing.T) {
+	tr, c := newTestTracker(time.Minute)
+
+	tr.Connect("alice")
+	tr.Connect("alice")
+
+	// closing one of two connections leaves them online
+	tr.Disconnect("alice")
+	expectStatus(t, "one of two closed", tr, "alice", models.StatusOnline)
+
+	// open connections only keep them online while they answer
+	c.now = c.now.Add(time.Minute)
+	expectStatus(t, "connected, not heard from", tr, "alice", models.StatusOffline)
+
+	tr.Touch("alice")
+	expectStatus(t, "connected, heard from", tr, "alice", models.StatusOnline)
+
+	// closing the last one is offline straight away, last seen as it closed
+	c.now = c.now.Add(time.Second)
+	tr.Disconnect("alice")
+	expectStatus(t, "all closed", tr, "alice", models.StatusOffline)
+	if p := tr.Get([]string{"alice"})[0]; p.LastSeen == nil || !p.LastSeen.Equal(c.now) {
+		t.Errorf("expected last seen %v, got %v", c.now, p.LastSeen)
+	}
+
+	// closing more than were opened doesn't count below none, so the next close is still the last
+	tr.Disconnect("alice")
+	tr.Disconnect("bob")
+	tr.Connect("alice")
+	expectStatus(t, "reconnected", tr, "alice", models.StatusOnline)
+
+	tr.Disconnect("alice")
+	expectStatus(t, "closed again", tr, "alice", models.StatusOffline)
+	expectStatus(t, "never connected", tr, "bob", models.StatusOffline)
+}
+
+func TestTrackerGet(t *testing.T) {
+	tr, _ := newTestTracker(time.Minute)
+
+	tr.Connect("alice")
+	tr.Set("bob", models.StatusIdle)
+
+	got := tr.Get([]string{"carol", "bob", "alice"})
+	want := []string{models.StatusOffline, models.StatusIdle, models.StatusOnline}
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %d presences, got %d", len(want), len(got))
+	}
+
+	for i, id := range []string{"carol", "bob", "alice"} {
+		if got[i].UserID != id || got[i].Status != want[i] {
+			t.Errorf("expected %s %s, got %+v", id, want[i], got[i])
+		}
+	}
+}
+
+// expectStatus - fails the test unless a user's status is want
+func expectStatus(t *testing.T, name string, tr *Tracker, userID, want string) {
+	t.Helper()
+
+	if got := tr.Get([]string{userID})[0].Status; got != want {
+		t.Errorf("%s: expected %s %s, got %s", name, userID, want, got)
+	}
+}
@@ -0,0 +1,84 @@
+// Package ratelimit limits how often each caller can make requests, with a token bucket per caller. Buckets are held
+// in memory, so limits are per instance and start over on a restart
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval - how often buckets that have filled back up are dropped, so idle callers don't take up memory
+const sweepInterval = time.Minute
+
+type (
+	// Limiter - lets each key make Burst requests at once, refilling at Rate requests a second
+	Limiter struct {
+		rate  float64
+		burst float64
+		now   func() time.Time
+
+		mux     sync.Mutex
+		buckets map[string]*bucket
+		swept   time.Time
+	}
+
+	// bucket - the requests a key has left, as of updated
+	bucket struct {
+		tokens  float64
+		updated time.Time
+	}
+)
+
+// NewLimiter - creates a limiter allowing rate requests a second, and bursts of up to burst requests
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+		swept:   time.Now(),
+	}
+}
+
+// Allow - uses up one of key's requests if it has any left. Otherwise it returns false, with how long until it
+// has another
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	now := l.now()
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// sweep - drops the buckets that will have filled back up by now, every sweepInterval. Must hold the lock
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepInterval {
+		return
+	}
+	l.swept = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
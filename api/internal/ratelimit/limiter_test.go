@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// clock - a time that only moves when told to
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestLimiter(rate float64, burst int) (*Limiter, *clock) {
+	c := &clock{now: time.Date(2020, 4, 14, 12, 0, 0, 0, time.UTC)}
+	l := NewLimiter(rate, burst)
+	l.now = c.Now
+	l.swept = c.now
+	return l, c
+}
+
+func TestLimiterBurst(t *testing.T) {
+	l, _ := newTestLimiter(1, 3)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("alice"); !ok {
+			t.Fatalf("request %d: expected to be allowed within the burst", i+1)
+		}
+	}
+
+	ok, wait := l.Allow("alice")
+	if ok {
+		t.Fatal("expected the request after the burst to be limited")
+	}
+	if wait != time.Second {
+		t.Errorf("expected to wait 1s for the next request, got %v", wait)
+	}
+
+	// other keys have buckets of their own
+	if ok, _ := l.Allow("bob"); !ok {
+		t.Error("expected another key to be allowed")
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	l, c := newTestLimiter(2, 2)
+
+	l.Allow("alice")
+	l.Allow("alice")
+	if ok, _ := l.Allow("alice"); ok {
+		t.Fatal("expected to be limited once the burst is used up")
+	}
+
+	// half a second at 2 a second is one more request
+	c.now = c.now.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow("alice"); !ok {
+		t.Fatal("expected a request once a token refilled")
+	}
+
+	ok, wait := l.Allow("alice")
+	if ok {
+		t.Fatal("expected only one token to have refilled")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("expected to wait 500ms, got %v", wait)
+	}
+
+	// the bucket never holds more than the burst, however long it is left
+	c.now = c.now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("alice"); !ok {
+			t.Fatalf("request %d: expected a full bucket", i+1)
+		}
+	}
+	if ok, _ := l.Allow("alice"); ok {
+		t.Error("expected the bucket to refill no further than the burst")
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	// a request every 20s, so a minute refills three
+	l, c := newTestLimiter(0.05, 5)
+
+	l.Allow("idle")
+	for i := 0; i < 5; i++ {
+		l.Allow("busy")
+	}
+
+	c.now = c.now.Add(sweepInterval - time.Second)
+	l.Allow("other")
+	if len(l.buckets) != 3 {
+		t.Fatalf("expected no sweep before the interval, got %d buckets", len(l.buckets))
+	}
+
+	// the idle bucket has filled back up by now, the busy one hasn't
+	c.now = c.now.Add(time.Second)
+	l.Allow("busy")
+
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("expected the idle bucket to be swept")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("expected the busy bucket to be kept")
+	}
+}
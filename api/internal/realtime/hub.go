@@ -0,0 +1,177 @@
+package realtime
+
+import (
+	"sync"
+
+	"github.com/radean0909/guild-chat/api/internal/events"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// Event types sent to subscribers
+const (
+	EventMessage    = "message"
+	EventEdit       = "edit"
+	EventDelete     = "delete"
+	EventReaction   = "reaction"
+	EventAttachment = "attachment"
+	EventRead       = "read"
+	EventTyping     = "typing"
+	EventEphemeral  = "ephemeral"
+	EventError      = "error"
+)
+
+type (
+	// Event - a single realtime event, as it is sent over the wire
+	Event struct {
+		Type    string          `json:"type"`
+		Message *models.Message `json:"message,omitempty"`
+		Receipt *models.Receipt `json:"receipt,omitempty"`
+		Typing  *models.Typing  `json:"typing,omitempty"`
+		Error   string          `json:"error,omitempty"`
+	}
+
+	// Hub - fans events out to every subscription a user has open, ie: one per connected device.
+	// A subscriber that can't keep up is dropped rather than allowed to block delivery to everyone else
+	Hub struct {
+		mux    sync.RWMutex
+		subs   map[string]map[*Subscription]bool // subscriptions keyed by user id
+		closed bool
+	}
+
+	// Subscription - a stream of events for a single user. C is closed when the subscription ends,
+	// either because it was closed, it fell too far behind, or the hub shut down
+	Subscription struct {
+		UserID string
+		C      <-chan *Event
+
+		hub  *Hub
+		c    chan *Event
+		once sync.Once
+	}
+)
+
+// NewHub - creates an empty hub
+func NewHub() *Hub {
+	return &Hub{
+		subs: map[string]map[*Subscription]bool{},
+	}
+}
+
+// Subscribe - opens a subscription for a user, buffering up to buffer undelivered events. If the hub
+// has shut down, the subscription is already closed
+func (h *Hub) Subscribe(userID string, buffer int) *Subscription {
+	c := make(chan *Event, buffer)
+	sub := &Subscription{UserID: userID, C: c, hub: h, c: c}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if h.closed {
+		sub.once.Do(func() { close(c) })
+		return sub
+	}
+
+	if h.subs[userID] == nil {
+		h.subs[userID] = map[*Subscription]bool{}
+	}
+	h.subs[userID][sub] = true
+
+	return sub
+}
+
+// Publish - sends an event to every subscription the user has open. Never blocks; subscriptions
+// with a full buffer are closed so the client can reconnect and catch up from the datastore
+func (h *Hub) Publish(userID string, evt *Event) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	for sub := range h.subs[userID] {
+		select {
+		case sub.c <- evt:
+		default:
+			h.remove(sub)
+		}
+	}
+}
+
+// PublishTyping - sends a user starting or stopping typing to everyone else in the conversation, group or channel
+func (h *Hub) PublishTyping(typing *models.Typing, recipients []string) {
+	evt := &Event{Type: EventTyping, Typing: typing}
+	for _, userID := range recipients {
+		if userID != typing.UserID {
+			h.Publish(userID, evt)
+		}
+	}
+}
+
+// HandleEvent - delivers events from the bus to connected clients
+func (h *Hub) HandleEvent(evt *events.Event) {
+	switch evt.Type {
+	case events.MessageCreated:
+		h.publishMessage(EventMessage, evt.Message, evt.Recipients)
+	case events.MessageEdited:
+		h.publishMessage(EventEdit, evt.Message, evt.Recipients)
+	case events.MessageDeleted:
+		h.publishMessage(EventDelete, evt.Message, evt.Recipients)
+	case events.MessageReacted:
+		h.publishMessage(EventReaction, evt.Message, evt.Recipients)
+	case events.MessageAttached:
+		h.publishMessage(EventAttachment, evt.Message, evt.Recipients)
+	case events.MessageRead:
+		h.deliver(&Event{Type: EventRead, Receipt: evt.Receipt}, evt.Message, evt.Recipients)
+	}
+}
+
+// publishMessage - sends an event about a message to everyone who can see it. Group and channel messages go to
+// each of the participants, anything else goes to its recipient and the sender's other connections
+func (h *Hub) publishMessage(evtType string, msg *models.Message, participants []string) {
+	h.deliver(&Event{Type: evtType, Message: msg}, msg, participants)
+}
+
+// deliver - sends an event to everyone who can see a message, see publishMessage
+func (h *Hub) deliver(evt *Event, msg *models.Message, participants []string) {
+	if msg.GroupID != "" || msg.ChannelID != "" {
+		for _, userID := range participants {
+			h.Publish(userID, evt)
+		}
+		return
+	}
+
+	h.Publish(msg.Recipient, evt)
+	if msg.Sender != msg.Recipient {
+		h.Publish(msg.Sender, evt)
+	}
+}
+
+// Close - closes every subscription, and any opened afterwards
+func (h *Hub) Close() {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	h.closed = true
+	for _, subs := range h.subs {
+		for sub := range subs {
+			h.remove(sub)
+		}
+	}
+}
+
+// Close - ends the subscription
+func (s *Subscription) Close() {
+	s.hub.mux.Lock()
+	defer s.hub.mux.Unlock()
+
+	s.hub.remove(s)
+}
+
+// remove - drops a subscription from the hub and closes its channel. Must hold the lock
+func (h *Hub) remove(sub *Subscription) {
+	if subs, ok := h.subs[sub.UserID]; ok {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(h.subs, sub.UserID)
+		}
+	}
+
+	sub.once.Do(func() { close(sub.c) })
+}
@@ -0,0 +1,243 @@
+package search
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/events"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// rebuildBatch - how many messages are read from the datastore at a time while rebuilding
+const rebuildBatch = 1000
+
+type (
+	// Index - an in-process inverted index of message content, for drivers that can't search messages themselves.
+	// It only lives in memory, so it is rebuilt from the datastore on start (see Rebuild), then kept up to date from
+	// the event bus (see HandleEvent). Matches are read back through the driver, so they are always current
+	Index struct {
+		driver db.Driver
+
+		mux      sync.RWMutex
+		docs     map[string]*doc                // indexed messages keyed by id
+		postings map[string]map[string]struct{} // the ids of the messages each term is in, keyed by term
+	}
+
+	// doc - what the index keeps of a message, enough to filter it without going to the datastore
+	doc struct {
+		id, sender, recipient, groupID, channelID string
+		date                                      time.Time
+		terms                                     []string // the message's terms in order, for matching phrases
+	}
+)
+
+var (
+	_ db.Searcher = new(Index)
+)
+
+// NewIndex - creates an empty index of the messages in driver
+func NewIndex(driver db.Driver) *Index {
+	return &Index{
+		driver:   driver,
+		docs:     map[string]*doc{},
+		postings: map[string]map[string]struct{}{},
+	}
+}
+
+// Rebuild - indexes every message in the datastore, a batch at a time
+func (i *Index) Rebuild() error {
+	after := ""
+	for {
+		msgs, err := i.driver.ScanMessages(after, rebuildBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range msgs {
+			i.Add(msg)
+		}
+
+		if len(msgs) < rebuildBatch {
+			return nil
+		}
+
+		after = msgs[len(msgs)-1].ID
+	}
+}
+
+// HandleEvent - keeps the index up to date with messages from the bus
+func (i *Index) HandleEvent(evt *events.Event) {
+	switch evt.Type {
+	case events.MessageCreated, events.MessageEdited:
+		i.Add(evt.Message)
+	case events.MessageDeleted:
+		i.Remove(evt.Message.ID)
+	}
+}
+
+// Add - indexes a message, replacing whatever was indexed for it before. Messages deleted for everyone are removed
+func (i *Index) Add(msg *models.Message) {
+	if msg.DeletedAt != nil {
+		i.Remove(msg.ID)
+		return
+	}
+
+	d := &doc{
+		id:        msg.ID,
+		sender:    msg.Sender,
+		recipient: msg.Recipient,
+		groupID:   msg.GroupID,
+		channelID: msg.ChannelID,
+		date:      *msg.Date,
+		terms:     Tokenize(msg.Content),
+	}
+
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	i.remove(msg.ID)
+
+	i.docs[d.id] = d
+	for _, term := range d.terms {
+		ids, ok := i.postings[term]
+		if !ok {
+			ids = map[string]struct{}{}
+			i.postings[term] = ids
+		}
+		ids[d.id] = struct{}{}
+	}
+}
+
+// Remove - drops a message from the index, if it is there
+func (i *Index) Remove(id string) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	i.remove(id)
+}
+
+// remove - drops a message and its postings. Must hold the write lock
+func (i *Index) remove(id string) {
+	d, ok := i.docs[id]
+	if !ok {
+		return
+	}
+
+	for _, term := range d.terms {
+		delete(i.postings[term], id)
+		if len(i.postings[term]) == 0 {
+			delete(i.postings, term)
+		}
+	}
+
+	delete(i.docs, id)
+}
+
+// SearchMessages - finds the messages matching a search, newest first. See db.Search
+func (i *Index) SearchMessages(search db.Search) ([]*models.Message, error) {
+	if err := search.Check(); err != nil {
+		return nil, err
+	}
+
+	query := Parse(search.Text)
+	if query.Empty() {
+		return nil, constants.ErrBadRequest
+	}
+
+	ids := i.match(query, &search)
+
+	// the index can be a moment behind, so anything deleted since is skipped as it is read back. The index doesn't
+	// know what the viewer has hidden either, the driver leaves those out, so read back in batches until there are enough
+	msgs := []*models.Message{}
+	for len(ids) > 0 && (search.Limit == 0 || len(msgs) < search.Limit) {
+		batch := ids
+		if search.Limit > 0 && len(batch) > search.Limit-len(msgs) {
+			batch = batch[:search.Limit-len(msgs)]
+		}
+		ids = ids[len(batch):]
+
+		found, err := i.driver.GetMessages(search.Viewer, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range found {
+			if msg.DeletedAt == nil {
+				msgs = append(msgs, msg)
+			}
+		}
+	}
+
+	return msgs, nil
+}
+
+// match - the ids of the indexed messages matching a query that the search can see, newest first
+func (i *Index) match(query Query, search *db.Search) []string {
+	groups := set(search.Groups)
+	channels := set(search.Channels)
+
+	i.mux.RLock()
+	defer i.mux.RUnlock()
+
+	// every term has to be there, so only the messages with the rarest term need checking
+	terms := query.Terms()
+	candidates := i.postings[terms[0]]
+	for _, term := range terms[1:] {
+		if len(i.postings[term]) < len(candidates) {
+			candidates = i.postings[term]
+		}
+	}
+
+	matched := []*doc{}
+	for id := range candidates {
+		d := i.docs[id]
+
+		switch {
+		case d.groupID != "":
+			if !groups[d.groupID] {
+				continue
+			}
+		case d.channelID != "":
+			if !channels[d.channelID] {
+				continue
+			}
+		default:
+			if d.sender != search.Viewer && d.recipient != search.Viewer {
+				continue
+			}
+		}
+
+		if (search.Sender != "" && d.sender != search.Sender) || d.date.Before(search.From) || d.date.After(search.Until) {
+			continue
+		}
+
+		if query.Matches(d.terms) {
+			matched = append(matched, d)
+		}
+	}
+
+	sort.Slice(matched, func(a, b int) bool {
+		if matched[a].date.Equal(matched[b].date) {
+			return matched[a].id > matched[b].id
+		}
+		return matched[a].date.After(matched[b].date)
+	})
+
+	ids := make([]string, len(matched))
+	for n, d := range matched {
+		ids[n] = d.id
+	}
+
+	return ids
+}
+
+func set(values []string) map[string]bool {
+	out := make(map[string]bool, len(values))
+	for _, value := range values {
+		out[value] = true
+	}
+	return out
+}
@@ -0,0 +1,292 @@
+package search
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/db/mem"
+	"github.com/radean0909/guild-chat/api/internal/events"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// scanDriver - records where each batch of a rebuild started
+type scanDriver struct {
+	db.Driver
+	afters []string
+}
+
+func (d *scanDriver) ScanMessages(after string, limit int) ([]*models.Message, error) {
+	d.afters = append(d.afters, after)
+	return d.Driver.ScanMessages(after, limit)
+}
+
+func TestIndexVisibility(t *testing.T) {
+	d := mem.NewDriver()
+	alice := newTestUser(t, d, "alice")
+	bob := newTestUser(t, d, "bob")
+	carol := newTestUser(t, d, "carol")
+
+	group, err := d.CreateGroup(alice.ID, "lunch club", []string{carol.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guild, err := d.CreateGuild(bob.ID, "guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel, err := d.CreateChannel(guild.ID, "food")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	direct := newTestMessage(t, d, &models.Message{Sender: alice.ID, Recipient: bob.ID, Content: "lunch?"})
+	grouped := newTestMessage(t, d, &models.Message{Sender: carol.ID, GroupID: group.ID, Content: "lunch at noon"})
+	channelled := newTestMessage(t, d, &models.Message{Sender: bob.ID, ChannelID: channel.ID, Content: "lunch is served"})
+
+	index := newTestIndex(t, d)
+
+	tests := []struct {
+		name   string
+		search db.Search
+		want   []*models.Message
+	}{
+		{"sender", db.Search{Text: "lunch", Viewer: alice.ID}, []*models.Message{direct}},
+		{"recipient", db.Search{Text: "lunch", Viewer: bob.ID}, []*models.Message{direct}},
+		{"third party", db.Search{Text: "lunch", Viewer: carol.ID}, nil},
+		{"group", db.Search{Text: "lunch", Viewer: carol.ID, Groups: []string{group.ID}}, []*models.Message{grouped}},
+		{"channel", db.Search{Text: "lunch", Viewer: carol.ID, Channels: []string{channel.ID}}, []*models.Message{channelled}},
+		{
+			"everything",
+			db.Search{Text: "lunch", Viewer: alice.ID, Groups: []string{group.ID}, Channels: []string{channel.ID}},
+			[]*models.Message{channelled, grouped, direct},
+		},
+	}
+
+	for _, tt := range tests {
+		expectSearch(t, tt.name, index, tt.search, tt.want)
+	}
+
+	// hidden messages are left out for whoever hid them only
+	if err := d.HideMessage(direct.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	expectSearch(t, "hidden", index, db.Search{Text: "lunch", Viewer: bob.ID}, nil)
+	expectSearch(t, "hidden by someone else", index, db.Search{Text: "lunch", Viewer: alice.ID}, []*models.Message{direct})
+}
+
+func TestIndexSearch(t *testing.T) {
+	d := mem.NewDriver()
+	alice := newTestUser(t, d, "alice")
+	bob := newTestUser(t, d, "bob")
+
+	send := func(sender, recipient *models.User, content string) *models.Message {
+		return newTestMessage(t, d, &models.Message{Sender: sender.ID, Recipient: recipient.ID, Content: content})
+	}
+
+	first := send(alice, bob, "team meetings on monday")
+	second := send(bob, alice, "the meeting with the team")
+	third := send(alice, bob, "Team meeting moved")
+	send(bob, alice, "no match here")
+
+	index := newTestIndex(t, d)
+
+	tests := []struct {
+		name   string
+		search db.Search
+		want   []*models.Message
+	}{
+		{"newest first", db.Search{Text: "meeting team"}, []*models.Message{third, second, first}},
+		{"phrase", db.Search{Text: `"team meeting"`}, []*models.Message{third, first}},
+		{"unclosed phrase", db.Search{Text: `monday "team meetings`}, []*models.Message{first}},
+		{"no match", db.Search{Text: "lunch"}, nil},
+		{"sender", db.Search{Text: "team", Sender: alice.ID}, []*models.Message{third, first}},
+		{"from", db.Search{Text: "team", From: *second.Date}, []*models.Message{third, second}},
+		{"until", db.Search{Text: "team", Until: *second.Date}, []*models.Message{second, first}},
+		{"between", db.Search{Text: "team", From: *second.Date, Until: *second.Date}, []*models.Message{second}},
+		{"limit", db.Search{Text: "team", Limit: 2}, []*models.Message{third, second}},
+	}
+
+	for _, tt := range tests {
+		tt.search.Viewer = alice.ID
+		expectSearch(t, tt.name, index, tt.search, tt.want)
+	}
+
+	bad := []db.Search{
+		{Text: "team"},
+		{Text: "", Viewer: alice.ID},
+		{Text: `" , "`, Viewer: alice.ID},
+		{Text: "team", Viewer: alice.ID, From: *third.Date, Until: *first.Date},
+		{Text: "team", Viewer: alice.ID, Limit: -1},
+	}
+
+	for _, search := range bad {
+		if _, err := index.SearchMessages(search); err != constants.ErrBadRequest {
+			t.Errorf("SearchMessages(%+v): expected %v, got %v", search, constants.ErrBadRequest, err)
+		}
+	}
+}
+
+func TestIndexHandleEvent(t *testing.T) {
+	d := mem.NewDriver()
+	alice := newTestUser(t, d, "alice")
+	bob := newTestUser(t, d, "bob")
+
+	index := NewIndex(d)
+	search := func(text string) db.Search {
+		return db.Search{Text: text, Viewer: alice.ID}
+	}
+
+	msg := newTestMessage(t, d, &models.Message{Sender: alice.ID, Recipient: bob.ID, Content: "see you at lunch"})
+	expectSearch(t, "before it is published", index, search("lunch"), nil)
+
+	index.HandleEvent(&events.Event{Type: events.MessageCreated, Message: msg})
+	expectSearch(t, "created", index, search("lunch"), []*models.Message{msg})
+
+	// an edit replaces what was indexed for the message
+	edited, err := d.EditMessage(msg.ID, alice.ID, "see you at dinner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.HandleEvent(&events.Event{Type: events.MessageEdited, Message: edited})
+
+	expectSearch(t, "edited, old content", index, search("lunch"), nil)
+	expectSearch(t, "edited, new content", index, search("dinner"), []*models.Message{edited})
+	expectSearch(t, "edited, unchanged content", index, search(`"see you"`), []*models.Message{edited})
+
+	// a message deleted before the index hears of it isn't read back
+	deleted, err := d.DeleteMessage(msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectSearch(t, "deleted, not yet removed", index, search("dinner"), nil)
+
+	index.HandleEvent(&events.Event{Type: events.MessageDeleted, Message: deleted})
+	if len(index.docs) != 0 || len(index.postings) != 0 {
+		t.Errorf("expected the deleted message removed from the index, got %d docs and %d terms", len(index.docs), len(index.postings))
+	}
+
+	// adding a message deleted for everyone removes it too
+	other := newTestMessage(t, d, &models.Message{Sender: bob.ID, Recipient: alice.ID, Content: "dinner it is"})
+	index.Add(other)
+	expectSearch(t, "added", index, search("dinner"), []*models.Message{other})
+
+	if other, err = d.DeleteMessage(other.ID); err != nil {
+		t.Fatal(err)
+	}
+	index.Add(other)
+
+	if len(index.docs) != 0 || len(index.postings) != 0 {
+		t.Errorf("expected a deleted message to be removed when added, got %d docs and %d terms", len(index.docs), len(index.postings))
+	}
+}
+
+func TestIndexRebuild(t *testing.T) {
+	d := &scanDriver{Driver: mem.NewDriver()}
+	alice := newTestUser(t, d, "alice")
+	bob := newTestUser(t, d, "bob")
+
+	// enough for two full batches and the start of a third
+	count := rebuildBatch*2 + 1
+	for i := 0; i < count; i++ {
+		newTestMessage(t, d, &models.Message{Sender: alice.ID, Recipient: bob.ID, Content: "message " + strconv.Itoa(i)})
+	}
+
+	deleted := newTestMessage(t, d, &models.Message{Sender: alice.ID, Recipient: bob.ID, Content: "deleted message"})
+	if _, err := d.DeleteMessage(deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	index := NewIndex(d)
+	if err := index.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := d.ScanMessages("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.afters = d.afters[:len(d.afters)-1]
+
+	// each batch starts after the last message of the one before
+	want := []string{"", all[rebuildBatch-1].ID, all[rebuildBatch*2-1].ID}
+	if !reflect.DeepEqual(d.afters, want) {
+		t.Errorf("expected batches after %q, got %q", want, d.afters)
+	}
+
+	if len(index.docs) != count {
+		t.Errorf("expected %d messages indexed, got %d", count, len(index.docs))
+	}
+
+	msgs, err := index.SearchMessages(db.Search{Text: "message", Viewer: bob.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != count {
+		t.Errorf("expected %d messages found, got %d", count, len(msgs))
+	}
+}
+
+// newTestIndex - an index rebuilt from d, failing the test on error
+func newTestIndex(t *testing.T, d db.Driver) *Index {
+	t.Helper()
+
+	index := NewIndex(d)
+	if err := index.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+// newTestUser - creates a user, failing the test on error
+func newTestUser(t *testing.T, d db.Driver, name string) *models.User {
+	t.Helper()
+
+	user, err := d.CreateUser(&models.User{Username: name, Email: name + "@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// newTestMessage - creates a message, failing the test on error. Dates are a moment apart, so every message has
+// its own, as the date filters expect
+func newTestMessage(t *testing.T, d db.Driver, msg *models.Message) *models.Message {
+	t.Helper()
+
+	created, err := d.CreateMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for now := time.Now(); !now.After(*created.Date); now = time.Now() {
+	}
+	return created
+}
+
+// expectSearch - fails the test unless searching the index finds want, in order
+func expectSearch(t *testing.T, name string, index *Index, search db.Search, want []*models.Message) {
+	t.Helper()
+
+	msgs, err := index.SearchMessages(search)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	got, expected := []string{}, []string{}
+	for _, msg := range msgs {
+		got = append(got, msg.Content)
+	}
+	for _, msg := range want {
+		expected = append(expected, msg.Content)
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("%s: expected %q, got %q", name, expected, got)
+	}
+}
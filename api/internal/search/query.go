@@ -0,0 +1,82 @@
+package search
+
+import (
+	"strings"
+)
+
+// Query - a parsed search. Every phrase must be in a message, its terms next to each other and in order. A word on
+// its own is a phrase of one term
+type Query struct {
+	Phrases [][]string
+}
+
+// Parse - reads a search made up of words and "quoted phrases". An unclosed quote runs to the end of the search
+func Parse(text string) Query {
+	query := Query{}
+
+	// splitting on quotes leaves what was outside them at even indexes, and inside at odd
+	for i, part := range strings.Split(text, `"`) {
+		terms := Tokenize(part)
+		if len(terms) == 0 {
+			continue
+		}
+
+		if i%2 == 1 {
+			query.Phrases = append(query.Phrases, terms)
+			continue
+		}
+
+		for _, term := range terms {
+			query.Phrases = append(query.Phrases, []string{term})
+		}
+	}
+
+	return query
+}
+
+// Empty - whether there is nothing to search for
+func (q Query) Empty() bool {
+	return len(q.Phrases) == 0
+}
+
+// Terms - every distinct term in the query
+func (q Query) Terms() []string {
+	seen := map[string]bool{}
+	terms := []string{}
+	for _, phrase := range q.Phrases {
+		for _, term := range phrase {
+			if !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// Matches - whether every phrase is in terms, the terms of a message in order
+func (q Query) Matches(terms []string) bool {
+	for _, phrase := range q.Phrases {
+		if !hasPhrase(terms, phrase) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasPhrase(terms, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(terms); i++ {
+		found := true
+		for j, term := range phrase {
+			if terms[i+j] != term {
+				found = false
+				break
+			}
+		}
+
+		if found {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		want [][]string
+	}{
+		{"", nil},
+		{`  "" , `, nil},
+		{"lunch", [][]string{{"lunch"}}},
+		{"Team Meetings", [][]string{{"team"}, {"meet"}}},
+		{`"team meetings"`, [][]string{{"team", "meet"}}},
+		{`lunch "team meetings" friday`, [][]string{{"lunch"}, {"team", "meet"}, {"fridai"}}},
+		{`"one" "two three"`, [][]string{{"one"}, {"two", "three"}}},
+
+		// an unclosed quote runs to the end
+		{`lunch "team meetings`, [][]string{{"lunch"}, {"team", "meet"}}},
+		{`"a" "b c`, [][]string{{"a"}, {"b", "c"}}},
+	}
+
+	for _, tt := range tests {
+		query := Parse(tt.text)
+		if !reflect.DeepEqual(query.Phrases, tt.want) {
+			t.Errorf("Parse(%q): expected %q, got %q", tt.text, tt.want, query.Phrases)
+		}
+
+		if query.Empty() != (len(tt.want) == 0) {
+			t.Errorf("Parse(%q): expected Empty to be %v", tt.text, len(tt.want) == 0)
+		}
+	}
+}
+
+func TestQueryTerms(t *testing.T) {
+	query := Parse(`lunch "lunch meeting" meetings`)
+
+	want := []string{"lunch", "meet"}
+	if got := query.Terms(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestQueryMatches(t *testing.T) {
+	terms := Tokenize("The team meetings moved to Friday, after lunch")
+
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"lunch", true},
+		{"LUNCH friday", true},
+		{"meeting", true},
+		{"lunch dinner", false},
+		{`"team meeting"`, true},
+		{`"meeting team"`, false},
+		{`"team friday"`, false},
+		{`"friday after lunch" team`, true},
+		{`"friday after lunch" dinner`, false},
+		{`"after lunch today`, false},
+	}
+
+	for _, tt := range tests {
+		if got := Parse(tt.text).Matches(terms); got != tt.want {
+			t.Errorf("Matches(%q): expected %v, got %v", tt.text, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize - splits text into lower case, stemmed words. Anything that isn't a letter or number separates words,
+// except apostrophes, which are dropped so "don't" is "dont"
+func Tokenize(text string) []string {
+	terms := []string{}
+	word := strings.Builder{}
+
+	flush := func() {
+		if word.Len() > 0 {
+			terms = append(terms, Stem(word.String()))
+			word.Reset()
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			word.WriteRune(unicode.ToLower(r))
+		case r == '\'' || r == '’':
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return terms
+}
+
+// Stem - reduces an english word to its stem, so that plurals and -ed and -ing forms match each other, ie:
+// "meetings", "meeting" and "meet" are all "meet". Only the first step of the Porter stemmer is run, which is most of
+// what matters for short messages, so other suffixes are kept: "happiness" doesn't match "happy". Words that aren't
+// plain ascii are left as they are
+func Stem(word string) string {
+	if len(word) <= 2 || !ascii(word) {
+		return word
+	}
+
+	// plurals
+	switch {
+	case strings.HasSuffix(word, "sses"), strings.HasSuffix(word, "ies"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "ss"):
+	case strings.HasSuffix(word, "s"):
+		word = word[:len(word)-1]
+	}
+
+	// -ed and -ing
+	if strings.HasSuffix(word, "eed") {
+		if measure(word[:len(word)-3]) > 0 {
+			word = word[:len(word)-1]
+		}
+	} else {
+		for _, suffix := range []string{"ed", "ing"} {
+			if stem := strings.TrimSuffix(word, suffix); stem != word && hasVowel(stem) {
+				word = tidy(stem)
+				break
+			}
+		}
+	}
+
+	// a final y is i when the rest of the word has a vowel, so "party" matches "parties" but "cry" stays as it is
+	if strings.HasSuffix(word, "y") && hasVowel(word[:len(word)-1]) {
+		word = word[:len(word)-1] + "i"
+	}
+
+	return word
+}
+
+// tidy - fixes up a stem once -ed or -ing is taken off, ie: "hoping" -> "hop" -> "hope", "hopping" -> "hopp" -> "hop"
+func tidy(stem string) string {
+	switch {
+	case strings.HasSuffix(stem, "at"), strings.HasSuffix(stem, "bl"), strings.HasSuffix(stem, "iz"):
+		return stem + "e"
+	case doubleConsonant(stem) && !strings.ContainsAny(stem[len(stem)-1:], "lsz"):
+		return stem[:len(stem)-1]
+	case measure(stem) == 1 && cvc(stem):
+		return stem + "e"
+	}
+
+	return stem
+}
+
+func ascii(word string) bool {
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// consonant - whether the letter at i is a consonant. y is one, unless it follows a consonant
+func consonant(word string, i int) bool {
+	switch word[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !consonant(word, i-1)
+	}
+	return true
+}
+
+// measure - how many times a run of vowels is followed by a run of consonants in word, roughly its syllables
+func measure(word string) int {
+	m, i := 0, 0
+	for i < len(word) && consonant(word, i) {
+		i++
+	}
+
+	for i < len(word) {
+		for i < len(word) && !consonant(word, i) {
+			i++
+		}
+		if i == len(word) {
+			break
+		}
+
+		for i < len(word) && consonant(word, i) {
+			i++
+		}
+		m++
+	}
+
+	return m
+}
+
+func hasVowel(word string) bool {
+	for i := range word {
+		if !consonant(word, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doubleConsonant - whether word ends in the same consonant twice
+func doubleConsonant(word string) bool {
+	n := len(word)
+	return n >= 2 && word[n-1] == word[n-2] && consonant(word, n-1)
+}
+
+// cvc - whether word ends consonant, vowel, consonant, where the last consonant isn't w, x or y, ie: "hop"
+func cvc(word string) bool {
+	n := len(word)
+	if n < 3 || !consonant(word, n-3) || consonant(word, n-2) || !consonant(word, n-1) {
+		return false
+	}
+
+	last := word[n-1]
+	return last != 'w' && last != 'x' && last != 'y'
+}
@@ -0,0 +1,89 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", []string{}},
+		{"  ,.! ", []string{}},
+		{"Hello, World!", []string{"hello", "world"}},
+		{"don't won’t", []string{"dont", "wont"}},
+		{"room 101b", []string{"room", "101b"}},
+		{"well-known e.g.", []string{"well", "known", "e", "g"}},
+		{"Meetings at NOON", []string{"meet", "at", "noon"}},
+		{"Grüße café", []string{"grüße", "café"}},
+	}
+
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q): expected %q, got %q", tt.text, tt.want, got)
+		}
+	}
+}
+
+func TestStem(t *testing.T) {
+	tests := []struct {
+		word, want string
+	}{
+		// too short, or not plain ascii
+		{"is", "is"},
+		{"as", "as"},
+		{"cafés", "cafés"},
+		{"r2d2s", "r2d2s"},
+
+		// plurals
+		{"caresses", "caress"},
+		{"ponies", "poni"},
+		{"ties", "ti"},
+		{"caress", "caress"},
+		{"cats", "cat"},
+
+		// -eed only loses its d after a syllable
+		{"agreed", "agree"},
+		{"feed", "feed"},
+
+		// -ed and -ing, only when what is left has a vowel
+		{"plastered", "plaster"},
+		{"bled", "bled"},
+		{"motoring", "motor"},
+		{"sing", "sing"},
+		{"meetings", "meet"},
+		{"meeting", "meet"},
+		{"meet", "meet"},
+
+		// tidying the stem up afterwards
+		{"conflated", "conflate"},
+		{"troubled", "trouble"},
+		{"sized", "size"},
+		{"hopping", "hop"},
+		{"tanned", "tan"},
+		{"falling", "fall"},
+		{"hissing", "hiss"},
+		{"fizzed", "fizz"},
+		{"failing", "fail"},
+		{"filing", "file"},
+		{"hoping", "hope"},
+
+		// a final y
+		{"happy", "happi"},
+		{"party", "parti"},
+		{"parties", "parti"},
+		{"sky", "sky"},
+
+		// only the first step is run, so other suffixes are kept
+		{"happiness", "happiness"},
+		{"relational", "relational"},
+	}
+
+	for _, tt := range tests {
+		if got := Stem(tt.word); got != tt.want {
+			t.Errorf("Stem(%q): expected %q, got %q", tt.word, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package local
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/storage"
+)
+
+// Config - settings for a blob store on the local filesystem
+type Config struct {
+	Dir string // directory blobs are stored in, created if it doesn't exist
+}
+
+// Store - keeps blobs as files on the local filesystem. Blobs are spread over subdirectories by the first two
+// characters of their key, so no single directory grows too large
+type Store struct {
+	dir string
+}
+
+var (
+	_ storage.BlobStore = new(Store)
+)
+
+// NewStore - creates a blob store in cfg.Dir
+func NewStore(cfg Config) (*Store, error) {
+	if cfg.Dir == "" {
+		return nil, constants.ErrBadRequest
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Store{dir: cfg.Dir}, nil
+}
+
+// Put - stores everything read from r under key, replacing any blob already there. The blob is written to a
+// temporary file and renamed into place, so a failed upload never leaves a partial blob behind
+func (s *Store) Put(key string, r io.Reader) error {
+	if err := storage.CheckKey(key); err != nil {
+		return err
+	}
+
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get - opens the blob stored under key
+func (s *Store) Get(key string) (io.ReadCloser, error) {
+	if err := storage.CheckKey(key); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, constants.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Delete - removes the blob stored under key
+func (s *Store) Delete(key string) error {
+	if err := storage.CheckKey(key); err != nil {
+		return err
+	}
+
+	err := os.Remove(s.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// path - where the blob stored under key lives
+func (s *Store) path(key string) string {
+	prefix := key
+	if len(prefix) > 2 {
+		prefix = prefix[:2]
+	}
+
+	return filepath.Join(s.dir, prefix, key)
+}
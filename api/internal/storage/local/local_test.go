@@ -0,0 +1,165 @@
+package local
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+)
+
+// failingReader - reads data, then fails with err, as an upload cut off part way through does
+type failingReader struct {
+	data io.Reader
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, r.err
+	}
+	return n, err
+}
+
+func TestStore(t *testing.T) {
+	s, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+
+	if err := s.Put("blob-1", strings.NewReader("first")); err != nil {
+		t.Fatal(err)
+	}
+	expectBlob(t, s, "blob-1", "first")
+
+	// putting again replaces the blob
+	if err := s.Put("blob-1", strings.NewReader("second")); err != nil {
+		t.Fatal(err)
+	}
+	expectBlob(t, s, "blob-1", "second")
+
+	if err := s.Delete("blob-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("blob-1"); err != constants.ErrNotFound {
+		t.Errorf("Get(deleted): expected not found, got %v", err)
+	}
+
+	// deleting what isn't there changes nothing
+	if err := s.Delete("blob-1"); err != nil {
+		t.Errorf("Delete(missing): expected no error, got %v", err)
+	}
+
+	expectFiles(t, dir, nil)
+}
+
+func TestStoreKeys(t *testing.T) {
+	s, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+
+	// nothing that could reach outside the store's directory is accepted
+	for _, key := range []string{"", "../escape", "a/b", `a\b`, ".", "..", strings.Repeat("a", 129)} {
+		if err := s.Put(key, strings.NewReader("data")); err != constants.ErrBadRequest {
+			t.Errorf("Put(%q): expected bad request, got %v", key, err)
+		}
+		if _, err := s.Get(key); err != constants.ErrBadRequest {
+			t.Errorf("Get(%q): expected bad request, got %v", key, err)
+		}
+		if err := s.Delete(key); err != constants.ErrBadRequest {
+			t.Errorf("Delete(%q): expected bad request, got %v", key, err)
+		}
+	}
+
+	expectFiles(t, dir, nil)
+}
+
+func TestStoreFailedPut(t *testing.T) {
+	s, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+
+	if err := s.Put("kept", strings.NewReader("original")); err != nil {
+		t.Fatal(err)
+	}
+
+	// an upload that fails part way leaves neither a partial blob nor its temporary file, and doesn't touch
+	// the blob it would have replaced
+	r := &failingReader{data: bytes.NewReader(make([]byte, 64<<10)), err: constants.ErrTooLarge}
+	if err := s.Put("partial", r); !errors.Is(err, constants.ErrTooLarge) {
+		t.Fatalf("Put(failing): expected the reader's error, got %v", err)
+	}
+
+	r = &failingReader{data: strings.NewReader("replacement"), err: constants.ErrTooLarge}
+	if err := s.Put("kept", r); !errors.Is(err, constants.ErrTooLarge) {
+		t.Fatalf("Put(failing replacement): expected the reader's error, got %v", err)
+	}
+
+	if _, err := s.Get("partial"); err != constants.ErrNotFound {
+		t.Errorf("Get(partial): expected not found, got %v", err)
+	}
+	expectBlob(t, s, "kept", "original")
+
+	expectFiles(t, dir, []string{filepath.Join("ke", "kept")})
+}
+
+// newTestStore - a store in a new temporary directory, which the caller removes
+func newTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "guild-blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStore(Config{Dir: dir})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+// expectBlob - fails the test unless the blob stored under key holds want
+func expectBlob(t *testing.T, s *Store, key, want string) {
+	t.Helper()
+
+	file, err := s.Get(key)
+	if err != nil {
+		t.Fatalf("Get(%s): %v", key, err)
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("Get(%s): expected %q, got %q", key, want, data)
+	}
+}
+
+// expectFiles - fails the test unless dir holds exactly the files want, relative to dir
+func expectFiles(t *testing.T, dir string, want []string) {
+	t.Helper()
+
+	got := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		got = append(got, rel)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected the files %v, got %v", want, got)
+	}
+}
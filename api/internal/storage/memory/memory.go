@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/storage"
+)
+
+// Store - an in-memory blob store for local development and tests, nothing survives a restart
+type Store struct {
+	mux   sync.RWMutex
+	blobs map[string][]byte
+}
+
+var (
+	_ storage.BlobStore = new(Store)
+)
+
+// NewStore - creates an empty in-memory blob store
+func NewStore() *Store {
+	return &Store{blobs: map[string][]byte{}}
+}
+
+// Put - stores everything read from r under key, replacing any blob already there
+func (s *Store) Put(key string, r io.Reader) error {
+	if err := storage.CheckKey(key); err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.blobs[key] = data
+
+	return nil
+}
+
+// Get - opens the blob stored under key
+func (s *Store) Get(key string) (io.ReadCloser, error) {
+	if err := storage.CheckKey(key); err != nil {
+		return nil, err
+	}
+
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, constants.ErrNotFound
+	}
+
+	// blobs are never modified in place, only replaced, so readers can share the bytes
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Delete - removes the blob stored under key
+func (s *Store) Delete(key string) error {
+	if err := storage.CheckKey(key); err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.blobs, key)
+
+	return nil
+}
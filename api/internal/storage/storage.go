@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"io"
+	"regexp"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+)
+
+// BlobStore - stores files as opaque blobs by key. The datastore keeps what a file is, a blob store only keeps
+// its bytes, so stores can be swapped (local disk, S3 compatible object storage etc) without touching the datastore.
+// Missing blobs are reported as constants.ErrNotFound
+type BlobStore interface {
+	// Put - stores everything read from r under key, replacing any blob already there. If reading from r fails,
+	// nothing is stored and its error is returned
+	Put(key string, r io.Reader) error
+	// Get - opens the blob stored under key, the caller must close it
+	Get(key string) (io.ReadCloser, error)
+	// Delete - removes the blob stored under key. Deleting a blob that isn't there changes nothing
+	Delete(key string) error
+}
+
+// validKey - keys are generated ids, so anything that could escape a directory or bucket prefix is refused
+var validKey = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// CheckKey - a bad request unless key is safe to store a blob under
+func CheckKey(key string) error {
+	if !validKey.MatchString(key) {
+		return constants.ErrBadRequest
+	}
+	return nil
+}
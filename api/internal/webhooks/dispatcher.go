@@ -0,0 +1,320 @@
+// Package webhooks posts events from the bus to the URLs integrations register. Every event is recorded as a
+// delivery before it is posted, then retried with exponential backoff until the receiver accepts it or it runs out
+// of attempts, when it is left failed on the webhook's dead-letter list
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/events"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// Defaults for anything left out of Config
+const (
+	DefaultMaxAttempts = 8
+	DefaultBackoff     = 30 * time.Second
+	DefaultMaxBackoff  = time.Hour
+	DefaultTimeout     = 10 * time.Second
+	DefaultWorkers     = 16
+)
+
+// Events - the event types webhooks can subscribe to
+var Events = []string{events.MessageCreated, events.MessageEdited, events.MessageDeleted, events.UserArchived}
+
+type (
+	// Config - delivery settings, anything left as 0 takes its default
+	Config struct {
+		Client      *http.Client  // posts the payloads, defaults to NewClient with a DefaultTimeout
+		MaxAttempts int           // attempts at a delivery before it is failed
+		Backoff     time.Duration // wait before the first retry, doubling after each failed attempt
+		MaxBackoff  time.Duration // longest wait between attempts
+		Workers     int           // most payloads being posted at once
+	}
+
+	// Payload - the JSON body posted to a webhook. Message is set for message events, User for user events
+	Payload struct {
+		Type      string             `json:"type"`
+		Date      time.Time          `json:"date"`
+		WebhookID string             `json:"webhook_id"`
+		Message   *models.Message    `json:"message,omitempty"`
+		User      *models.PublicUser `json:"user,omitempty"`
+	}
+
+	// Dispatcher - delivers events to the webhooks subscribed to them. Deliveries are kept in the datastore, so any
+	// left pending when the service stops are picked up by Resume when it starts again
+	Dispatcher struct {
+		driver db.Driver
+		cfg    Config
+
+		sem  chan struct{} // a slot for each payload being posted
+		stop chan struct{} // closed to stop retrying
+		once sync.Once
+		wg   sync.WaitGroup
+	}
+)
+
+// ValidEvent - whether webhooks can subscribe to an event type
+func ValidEvent(event string) bool {
+	for _, valid := range Events {
+		if event == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// NewDispatcher - creates a dispatcher delivering to the webhooks in driver
+func NewDispatcher(driver db.Driver, cfg Config) *Dispatcher {
+	if cfg.Client == nil {
+		cfg.Client = NewClient(DefaultTimeout)
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = DefaultWorkers
+	}
+
+	return &Dispatcher{
+		driver: driver,
+		cfg:    cfg,
+		sem:    make(chan struct{}, cfg.Workers),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Resume - carries on with the deliveries left pending when the service last stopped
+func (d *Dispatcher) Resume() error {
+	pending, err := d.driver.ListDeliveries("", models.DeliveryPending, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range pending {
+		d.schedule(delivery)
+	}
+
+	return nil
+}
+
+// HandleEvent - records a delivery of an event for every webhook subscribed to it, and starts posting them
+func (d *Dispatcher) HandleEvent(evt *events.Event) {
+	for _, hook := range d.subscribers(evt) {
+		if !hook.Wants(evt.Type) {
+			continue
+		}
+
+		body, err := json.Marshal(&Payload{Type: evt.Type, Date: evt.Date, WebhookID: hook.ID, Message: evt.Message, User: evt.User.Public()})
+		if err != nil {
+			continue
+		}
+
+		now := time.Now()
+		delivery, err := d.driver.CreateDelivery(&models.Delivery{WebhookID: hook.ID, Event: evt.Type, Payload: body, NextAttempt: &now})
+		if err != nil {
+			continue
+		}
+
+		d.schedule(delivery)
+	}
+}
+
+// Retry - starts a failed delivery over, with a fresh set of attempts. Only failed deliveries can be retried, any
+// other is still being attempted or was delivered
+func (d *Dispatcher) Retry(delivery *models.Delivery) (*models.Delivery, error) {
+	if delivery.Status != models.DeliveryFailed {
+		return nil, constants.ErrBadRequest
+	}
+
+	now := time.Now()
+	retried := *delivery
+	retried.Status = models.DeliveryPending
+	retried.Attempts = 0
+	retried.NextAttempt = &now
+
+	updated, err := d.driver.UpdateDelivery(&retried)
+	if err != nil {
+		return nil, err
+	}
+
+	d.schedule(updated)
+
+	return updated, nil
+}
+
+// Close - stops posting and waits for any attempt in flight. Deliveries still pending are picked up by Resume
+func (d *Dispatcher) Close() {
+	d.once.Do(func() { close(d.stop) })
+	d.wg.Wait()
+}
+
+// subscribers - the webhooks that can see an event. Messages go to the webhooks of a channel's guild, or of each
+// user in a conversation or group. A deleted user goes to their own webhooks, and those of the guilds they were in
+func (d *Dispatcher) subscribers(evt *events.Event) []*models.Webhook {
+	users, guilds := []string{}, []string{}
+
+	switch {
+	case evt.Message != nil && evt.Message.ChannelID != "":
+		if channel, err := d.driver.GetChannel(evt.Message.ChannelID); err == nil {
+			guilds = append(guilds, channel.GuildID)
+		}
+
+	case evt.Message != nil && evt.Message.GroupID != "":
+		users = evt.Recipients
+
+	case evt.Message != nil:
+		users = append(users, evt.Message.Sender)
+		if evt.Message.Recipient != evt.Message.Sender {
+			users = append(users, evt.Message.Recipient)
+		}
+
+	case evt.User != nil:
+		users = append(users, evt.User.ID)
+		if joined, err := d.driver.ListGuilds(evt.User.ID, time.Time{}, time.Time{}); err == nil {
+			for _, guild := range joined {
+				guilds = append(guilds, guild.ID)
+			}
+		}
+	}
+
+	hooks := []*models.Webhook{}
+	for _, userID := range users {
+		if owned, err := d.driver.ListWebhooks(userID, ""); err == nil {
+			hooks = append(hooks, owned...)
+		}
+	}
+
+	for _, guildID := range guilds {
+		if owned, err := d.driver.ListWebhooks("", guildID); err == nil {
+			hooks = append(hooks, owned...)
+		}
+	}
+
+	return hooks
+}
+
+// schedule - keeps attempting a delivery in the background until it is no longer pending
+func (d *Dispatcher) schedule(delivery *models.Delivery) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.run(delivery)
+	}()
+}
+
+// run - attempts a delivery whenever it is next due, recording each attempt, until it is delivered or failed. It
+// gives up early if the service is stopping, the webhook is deleted or the attempt can't be recorded, leaving it
+// pending for Resume
+func (d *Dispatcher) run(delivery *models.Delivery) {
+	for delivery.Status == models.DeliveryPending {
+		if delivery.NextAttempt != nil {
+			timer := time.NewTimer(time.Until(*delivery.NextAttempt))
+			select {
+			case <-timer.C:
+			case <-d.stop:
+				timer.Stop()
+				return
+			}
+		}
+
+		select {
+		case d.sem <- struct{}{}:
+		case <-d.stop:
+			return
+		}
+
+		hook, err := d.driver.GetWebhook(delivery.WebhookID)
+		if err != nil {
+			<-d.sem
+			return
+		}
+
+		attempt := *delivery
+		attempt.StatusCode, err = d.post(hook, delivery)
+		<-d.sem
+
+		now := time.Now()
+		attempt.Attempts++
+		attempt.LastAttempt = &now
+		attempt.NextAttempt = nil
+		attempt.Error = ""
+
+		switch {
+		case err == nil:
+			attempt.Status = models.DeliveryDelivered
+		case attempt.Attempts >= d.cfg.MaxAttempts:
+			attempt.Status = models.DeliveryFailed
+			attempt.Error = err.Error()
+		default:
+			next := now.Add(d.backoff(attempt.Attempts))
+			attempt.NextAttempt = &next
+			attempt.Error = err.Error()
+		}
+
+		if delivery, err = d.driver.UpdateDelivery(&attempt); err != nil {
+			return
+		}
+	}
+}
+
+// post - signs and posts a delivery's payload to its webhook, returning the status code if there was a response.
+// Anything but a 2xx is an error
+func (d *Dispatcher) post(hook *models.Webhook, delivery *models.Delivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, delivery.Payload))
+
+	res, err := d.cfg.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// drain a little of the body so the connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4096))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// backoff - how long to wait after a number of failed attempts: Backoff, doubling each time, up to MaxBackoff
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.cfg.Backoff
+	for i := 1; i < attempts && wait < d.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+
+	if wait > d.cfg.MaxBackoff {
+		wait = d.cfg.MaxBackoff
+	}
+
+	return wait
+}
@@ -0,0 +1,269 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/db"
+	"github.com/radean0909/guild-chat/api/internal/db/mem"
+	"github.com/radean0909/guild-chat/api/internal/events"
+	"github.com/radean0909/guild-chat/api/models"
+)
+
+// receiver - a webhook endpoint that records what is posted to it, answering with the statuses it is given in turn,
+// then 200 once they run out
+type receiver struct {
+	*httptest.Server
+
+	mux      sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+
+		r.mux.Lock()
+		defer r.mux.Unlock()
+
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	return r
+}
+
+// received - how many posts the receiver has had
+func (r *receiver) received() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return len(r.requests)
+}
+
+// post - the nth post the receiver had, and its body
+func (r *receiver) post(n int) (*http.Request, []byte) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.requests[n], r.bodies[n]
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	d, recv := newTestDispatcher(Config{})
+	defer recv.Close()
+	defer d.Close()
+
+	alice := newTestUser(t, d.driver, "alice")
+	bob := newTestUser(t, d.driver, "bob")
+	hook := newTestWebhook(t, d.driver, &models.Webhook{Owner: alice.ID, URL: recv.URL})
+
+	publishMessage(d, alice, bob)
+
+	delivery := awaitDelivery(t, d.driver, hook, models.DeliveryDelivered)
+	if delivery.Attempts != 1 || delivery.StatusCode != http.StatusOK {
+		t.Errorf("expected one successful attempt, got %d attempts and status %d", delivery.Attempts, delivery.StatusCode)
+	}
+
+	req, body := recv.post(0)
+	if req.Header.Get(HeaderEvent) != events.MessageCreated || req.Header.Get(HeaderDelivery) != delivery.ID {
+		t.Errorf("expected event and delivery headers, got %v", req.Header)
+	}
+	if !Verify(hook.Secret, req.Header.Get(HeaderTimestamp), req.Header.Get(HeaderSignature), body, time.Minute) {
+		t.Error("expected the payload to be signed with the webhook's secret")
+	}
+
+	payload := &Payload{}
+	if err := json.Unmarshal(body, payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Type != events.MessageCreated || payload.WebhookID != hook.ID || payload.Message == nil || payload.Message.Content != "hi" {
+		t.Errorf("unexpected payload %s", body)
+	}
+}
+
+func TestDispatcherOmitsEmail(t *testing.T) {
+	d, recv := newTestDispatcher(Config{})
+	defer recv.Close()
+	defer d.Close()
+
+	alice := newTestUser(t, d.driver, "alice")
+	hook := newTestWebhook(t, d.driver, &models.Webhook{Owner: alice.ID, URL: recv.URL})
+
+	d.HandleEvent(&events.Event{Type: events.UserArchived, Date: time.Now(), User: alice})
+	awaitDelivery(t, d.driver, hook, models.DeliveryDelivered)
+
+	_, body := recv.post(0)
+	if !strings.Contains(string(body), alice.ID) || strings.Contains(string(body), alice.Email) {
+		t.Errorf("expected the user without their email, got %s", body)
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	d, recv := newTestDispatcher(Config{Backoff: time.Millisecond}, http.StatusInternalServerError, http.StatusBadGateway)
+	defer recv.Close()
+	defer d.Close()
+
+	alice := newTestUser(t, d.driver, "alice")
+	bob := newTestUser(t, d.driver, "bob")
+	hook := newTestWebhook(t, d.driver, &models.Webhook{Owner: alice.ID, URL: recv.URL})
+
+	publishMessage(d, alice, bob)
+
+	delivery := awaitDelivery(t, d.driver, hook, models.DeliveryDelivered)
+	if delivery.Attempts != 3 || recv.received() != 3 {
+		t.Errorf("expected 3 attempts, got %d with %d received", delivery.Attempts, recv.received())
+	}
+
+	// every attempt is the same delivery
+	for i := 0; i < recv.received(); i++ {
+		if req, _ := recv.post(i); req.Header.Get(HeaderDelivery) != delivery.ID {
+			t.Errorf("expected delivery %s, got %s", delivery.ID, req.Header.Get(HeaderDelivery))
+		}
+	}
+}
+
+func TestDispatcherDeadLetters(t *testing.T) {
+	failures := []int{}
+	for i := 0; i < 3; i++ {
+		failures = append(failures, http.StatusInternalServerError)
+	}
+
+	d, recv := newTestDispatcher(Config{MaxAttempts: 3, Backoff: time.Millisecond}, failures...)
+	defer recv.Close()
+	defer d.Close()
+
+	alice := newTestUser(t, d.driver, "alice")
+	bob := newTestUser(t, d.driver, "bob")
+	hook := newTestWebhook(t, d.driver, &models.Webhook{Owner: alice.ID, URL: recv.URL})
+
+	publishMessage(d, alice, bob)
+
+	failed := awaitDelivery(t, d.driver, hook, models.DeliveryFailed)
+	if failed.Attempts != 3 || failed.StatusCode != http.StatusInternalServerError || failed.Error == "" {
+		t.Errorf("expected 3 failed attempts with the last status and error, got %+v", failed)
+	}
+	if failed.NextAttempt != nil {
+		t.Error("expected a failed delivery not to be attempted again")
+	}
+
+	if _, err := d.Retry(&models.Delivery{ID: failed.ID, Status: models.DeliveryPending}); err == nil {
+		t.Error("expected only failed deliveries to be retried")
+	}
+
+	// the receiver has recovered, so a retry goes through
+	if _, err := d.Retry(failed); err != nil {
+		t.Fatal(err)
+	}
+	retried := awaitDelivery(t, d.driver, hook, models.DeliveryDelivered)
+	if retried.Attempts != 1 || recv.received() != 4 {
+		t.Errorf("expected the retry to be delivered on its first attempt, got %d", retried.Attempts)
+	}
+}
+
+func TestDispatcherBackoff(t *testing.T) {
+	d := NewDispatcher(mem.NewDriver(), Config{Backoff: time.Second, MaxBackoff: 5 * time.Second})
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, wait := range expected {
+		if backoff := d.backoff(i + 1); backoff != wait {
+			t.Errorf("after %d attempts: expected %v, got %v", i+1, wait, backoff)
+		}
+	}
+}
+
+func TestDispatcherFiltersEvents(t *testing.T) {
+	d, recv := newTestDispatcher(Config{})
+	defer recv.Close()
+	defer d.Close()
+
+	alice := newTestUser(t, d.driver, "alice")
+	bob := newTestUser(t, d.driver, "bob")
+	hook := newTestWebhook(t, d.driver, &models.Webhook{Owner: alice.ID, URL: recv.URL})
+	deletions := newTestWebhook(t, d.driver, &models.Webhook{Owner: bob.ID, URL: recv.URL, Events: []string{events.MessageDeleted}})
+
+	publishMessage(d, alice, bob)
+	awaitDelivery(t, d.driver, hook, models.DeliveryDelivered)
+
+	deliveries, err := d.driver.ListDeliveries(deletions.ID, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 0 {
+		t.Errorf("expected no deliveries for an event the webhook isn't subscribed to, got %d", len(deliveries))
+	}
+}
+
+// newTestDispatcher - a dispatcher with an empty datastore, and a receiver for its webhooks to post to, answering
+// with statuses as newReceiver does
+func newTestDispatcher(cfg Config, statuses ...int) (*Dispatcher, *receiver) {
+	recv := newReceiver(statuses...)
+
+	// the receiver is on loopback, which the default client refuses
+	cfg.Client = recv.Client()
+	return NewDispatcher(mem.NewDriver(), cfg), recv
+}
+
+// newTestUser - creates a user, failing the test on error
+func newTestUser(t *testing.T, driver db.Driver, name string) *models.User {
+	t.Helper()
+
+	user, err := driver.CreateUser(&models.User{Username: name, Email: name + "@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// newTestWebhook - creates a webhook, with a secret unless it has one, failing the test on error
+func newTestWebhook(t *testing.T, driver db.Driver, hook *models.Webhook) *models.Webhook {
+	t.Helper()
+
+	if hook.Secret == "" {
+		hook.Secret = "secret"
+	}
+
+	created, err := driver.CreateWebhook(hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created
+}
+
+// publishMessage - hands the dispatcher a message from sender to recipient, as the bus does once it is stored
+func publishMessage(d *Dispatcher, sender, recipient *models.User) {
+	msg := &models.Message{ID: "message", Sender: sender.ID, Recipient: recipient.ID, Content: "hi"}
+	d.HandleEvent(&events.Event{Type: events.MessageCreated, Date: time.Now(), Message: msg})
+}
+
+// awaitDelivery - waits for a webhook's only delivery to have status, failing the test if it doesn't in time
+func awaitDelivery(t *testing.T, driver db.Driver, hook *models.Webhook, status string) *models.Delivery {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		deliveries, err := driver.ListDeliveries(hook.ID, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) == 1 && deliveries[0].Status == status {
+			return deliveries[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for a %s delivery", status)
+	return nil
+}
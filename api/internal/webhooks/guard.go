@@ -0,0 +1,124 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/radean0909/guild-chat/api/internal/constants"
+)
+
+// ErrPrivateAddress - a URL pointed somewhere only the server can reach, like loopback or a private network
+var ErrPrivateAddress = errors.New("private address")
+
+// privateNets - ranges that aren't reachable on the public internet, so a URL registered by a user has no business
+// pointing there: it could only be aimed at the server itself or the services next to it
+var privateNets = parseNets(
+	"0.0.0.0/8",      // this network
+	"10.0.0.0/8",     // private
+	"100.64.0.0/10",  // carrier grade NAT
+	"127.0.0.0/8",    // loopback
+	"169.254.0.0/16", // link local, including cloud metadata services
+	"172.16.0.0/12",  // private
+	"192.0.0.0/24",   // protocol assignments
+	"192.168.0.0/16", // private
+	"198.18.0.0/15",  // benchmarking
+	"224.0.0.0/4",    // multicast
+	"240.0.0.0/4",    // reserved, and broadcast
+	"::/128",         // unspecified
+	"::1/128",        // loopback
+	"64:ff9b::/96",   // IPv4 translation, which could reach any of the above
+	"fc00::/7",       // unique local
+	"fe80::/10",      // link local
+	"ff00::/8",       // multicast
+)
+
+// parseNets - parses CIDR ranges known to be valid
+func parseNets(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// PublicIP - whether an address is on the public internet
+func PublicIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	// IPv4 addresses mapped into IPv6 are checked as IPv4
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CheckURL - bad request unless raw is an http or https URL whose host only resolves to public addresses. Checked
+// when a URL is registered; NewClient checks again when it is posted to, as the host can resolve differently later
+func CheckURL(raw string) error {
+	target, err := url.Parse(raw)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return constants.ErrBadRequest
+	}
+
+	ips, err := net.LookupIP(target.Hostname())
+	if err != nil || len(ips) == 0 {
+		return constants.ErrBadRequest
+	}
+
+	for _, ip := range ips {
+		if !PublicIP(ip) {
+			return constants.ErrBadRequest
+		}
+	}
+
+	return nil
+}
+
+// NewClient - an http client that refuses to connect to anything but public addresses, for posting to URLs users
+// register. The address is checked as it is dialed, after it has been resolved, so a host can't pass CheckURL and then
+// be pointed somewhere private. Proxies from the environment aren't used, as they would be dialed instead
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialPublic}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
+
+// dialPublic - a net.Dialer Control refusing connections to anything but public addresses
+func dialPublic(network, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if !PublicIP(net.ParseIP(host)) {
+		return ErrPrivateAddress
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package webhooks
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"255.255.255.255", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"64:ff9b::a00:1", false},
+	}
+
+	for _, tt := range tests {
+		if public := PublicIP(net.ParseIP(tt.ip)); public != tt.public {
+			t.Errorf("%s: expected public to be %v", tt.ip, tt.public)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://93.184.216.34/hook", true},
+		{"http://93.184.216.34:8080/hook", true},
+		{"http://127.0.0.1/hook", false},
+		{"http://localhost:8080/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://10.0.0.1/hook", false},
+		{"ftp://93.184.216.34/hook", false},
+		{"/hook", false},
+		{"http://", false},
+		{"not a url", false},
+	}
+
+	for _, tt := range tests {
+		if err := CheckURL(tt.url); (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid to be %v, got %v", tt.url, tt.valid, err)
+		}
+	}
+}
+
+func TestNewClientRefusesPrivateAddresses(t *testing.T) {
+	posted := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted = true
+	}))
+	defer srv.Close()
+
+	if _, err := NewClient(time.Second).Get(srv.URL); err == nil {
+		t.Error("expected a request to loopback to fail")
+	}
+	if posted {
+		t.Error("expected the request never to reach the server")
+	}
+}
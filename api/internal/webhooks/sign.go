@@ -0,0 +1,54 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Guild-Event"     // the event type
+	HeaderDelivery  = "X-Guild-Delivery"  // the delivery id, the same on every attempt
+	HeaderTimestamp = "X-Guild-Timestamp" // unix seconds the attempt was signed at
+	HeaderSignature = "X-Guild-Signature" // see Sign
+)
+
+// signaturePrefix - names the signing algorithm, so it can change without breaking receivers
+const signaturePrefix = "sha256="
+
+// NewSecret - generates a random secret to sign a webhook's payloads with
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// Sign - the signature of a payload sent at timestamp: the hex HMAC-SHA256, keyed with the webhook's secret, of the
+// timestamp, a dot and the body. The timestamp is signed along with the body so a captured delivery can't be replayed
+// later on, receivers should reject timestamps that are too old
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify - whether signature is the body's signature at timestamp, and the timestamp is no older than maxAge. For
+// receivers written in Go, others can follow Sign
+func Verify(secret, timestamp, signature string, body []byte, maxAge time.Duration) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(seconds, 0)) > maxAge {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
@@ -0,0 +1,37 @@
+package webhooks
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"type":"message.created"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	signature := Sign("secret", now, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+		valid     bool
+	}{
+		{"signed", "secret", now, signature, body, true},
+		{"wrong secret", "other", now, signature, body, false},
+		{"changed body", "secret", now, signature, []byte(`{"type":"message.deleted"}`), false},
+		{"changed timestamp", "secret", strconv.FormatInt(time.Now().Unix()+1, 10), signature, body, false},
+		{"too old", "secret", old, Sign("secret", old, body), body, false},
+		{"bad timestamp", "secret", "yesterday", Sign("secret", "yesterday", body), body, false},
+		{"no prefix", "secret", now, signature[len(signaturePrefix):], body, false},
+	}
+
+	for _, tt := range tests {
+		if valid := Verify(tt.secret, tt.timestamp, tt.signature, tt.body, 5*time.Minute); valid != tt.valid {
+			t.Errorf("%s: expected valid to be %v", tt.name, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Attachment - a file attached to a message. The file itself is kept in blob storage under the attachment's id,
+// the datastore only keeps what it is
+type Attachment struct {
+	ID        string     `json:"id,omitempty"`
+	MessageID string     `json:"message_id,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	Size      int64      `json:"size"`
+	MIMEType  string     `json:"mime_type,omitempty"`
+	Checksum  string     `json:"checksum,omitempty"` // hex encoded sha256 of the file
+	Date      *time.Time `json:"date,omitempty"`
+}
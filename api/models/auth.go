@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Credentials - exchanged for a token, identifying the user by username and password
+type Credentials struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// Registration - a new account, the password is hashed and never stored or returned as given
+type Registration struct {
+	Username string `json:"username,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// PasswordChange - replaces the caller's password, proving they know the current one
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password,omitempty"`
+	NewPassword     string `json:"new_password,omitempty"`
+}
+
+// ResetRequest - asks for a password reset token to be sent to a user
+type ResetRequest struct {
+	Username string `json:"username,omitempty"`
+}
+
+// PasswordReset - sets a new password using a reset token
+type PasswordReset struct {
+	Token       string `json:"token,omitempty"`
+	NewPassword string `json:"new_password,omitempty"`
+}
+
+// Token - a signed access token, sent as "Authorization: Bearer <token>"
+type Token struct {
+	Token   string     `json:"token"`
+	UserID  string     `json:"user_id"`
+	Expires *time.Time `json:"expires"`
+}
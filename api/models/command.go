@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Command - a slash command a bot has registered. When someone invokes it, the invocation is posted to URL, signed
+// with Secret, and the bot answers either in the conversation or only to whoever invoked it. In a guild channel the
+// invoker needs every one of Permissions
+type Command struct {
+	ID          string     `json:"id,omitempty"`
+	BotID       string     `json:"bot_id,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Usage       string     `json:"usage,omitempty"`
+	URL         string     `json:"url,omitempty"`
+	Permissions Permission `json:"permissions,omitempty"`
+	Secret      string     `json:"secret,omitempty"`
+	Created     *time.Time `json:"created,omitempty"`
+}
@@ -4,10 +4,23 @@ import (
 	"time"
 )
 
+// Conversation - either between a sender and recipient, or a group conversation between any number of
+// participants. Groups have a name, owner and participants instead of a sender and recipient. When conversations are
+// listed for a user, Unread counts the messages others sent since the last one they read, and LastRead is its id
 type Conversation struct {
-	ID        string     `json:"id,omitempty"`
-	Sender    string     `json:"sender,omitempty"`
-	Recipient string     `json:"recipient,omitempty"`
-	Updated   *time.Time `json:"updated,omitempty"`
-	Messages  []*Message `json:"messages,omitempty"`
+	ID           string     `json:"id,omitempty"`
+	Sender       string     `json:"sender,omitempty"`
+	Recipient    string     `json:"recipient,omitempty"`
+	Name         string     `json:"name,omitempty"`
+	Owner        string     `json:"owner,omitempty"`
+	Participants []string   `json:"participants,omitempty"`
+	Updated      *time.Time `json:"updated,omitempty"`
+	Unread       int        `json:"unread,omitempty"`
+	LastRead     string     `json:"last_read,omitempty"`
+	Messages     []*Message `json:"messages,omitempty"`
+}
+
+// Participant - a user being added to a group conversation
+type Participant struct {
+	UserID string `json:"user_id,omitempty"`
 }
@@ -0,0 +1,86 @@
+package models
+
+import "time"
+
+// Roles every guild has. The user who creates a guild owns it, everyone who joins is a member until
+// given another role
+const (
+	RoleOwner     = "owner"
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+// Permission - what a role allows its members to do in a guild, as bit flags
+type Permission uint64
+
+// Permissions a role can grant
+const (
+	PermSend           Permission = 1 << iota // send messages to the guild's channels
+	PermManageChannels                        // create channels
+	PermKick                                  // remove other members from the guild
+	PermDeleteMessages                        // delete other members' messages
+	PermManageRoles                           // create roles and give them to members
+	PermManageWebhooks                        // register webhooks for the guild's events, and read their deliveries
+	PermMute                                  // stop other members sending to the guild's channels for a while
+
+	PermAll = PermSend | PermManageChannels | PermKick | PermDeleteMessages | PermManageRoles | PermManageWebhooks | PermMute
+)
+
+// DefaultRoles - the permissions of the roles every guild has. They can't be redefined, and no one
+// can be given the owner role
+var DefaultRoles = map[string]Permission{
+	RoleOwner:     PermAll,
+	RoleAdmin:     PermAll,
+	RoleModerator: PermSend | PermKick | PermDeleteMessages | PermMute,
+	RoleMember:    PermSend,
+}
+
+// Has - whether every permission in perm is set
+func (p Permission) Has(perm Permission) bool {
+	return p&perm == perm
+}
+
+// DefaultChannel - the channel every new guild starts with
+const DefaultChannel = "general"
+
+// Guild - a shared space with members and named text channels
+type Guild struct {
+	ID       string     `json:"id,omitempty"`
+	Name     string     `json:"name,omitempty"`
+	Owner    string     `json:"owner,omitempty"`
+	Created  *time.Time `json:"created,omitempty"`
+	Updated  *time.Time `json:"updated,omitempty"`
+	Channels []*Channel `json:"channels,omitempty"`
+}
+
+// Channel - a named text channel in a guild. Names are unique within a guild
+type Channel struct {
+	ID       string     `json:"id,omitempty"`
+	GuildID  string     `json:"guild_id,omitempty"`
+	Name     string     `json:"name,omitempty"`
+	Updated  *time.Time `json:"updated,omitempty"`
+	Messages []*Message `json:"messages,omitempty"`
+}
+
+// Member - a user's membership of a guild, and the role they have in it. A muted member can't send to the guild's
+// channels until MutedUntil
+type Member struct {
+	GuildID    string     `json:"guild_id,omitempty"`
+	UserID     string     `json:"user_id,omitempty"`
+	Role       string     `json:"role,omitempty"`
+	Joined     *time.Time `json:"joined,omitempty"`
+	MutedUntil *time.Time `json:"muted_until,omitempty"`
+}
+
+// Muted - whether the member is muted at a time
+func (m *Member) Muted(at time.Time) bool {
+	return m.MutedUntil != nil && at.Before(*m.MutedUntil)
+}
+
+// Role - a named set of permissions in a guild, either one of the default roles or a custom one
+type Role struct {
+	GuildID     string     `json:"guild_id,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	Permissions Permission `json:"permissions"`
+}
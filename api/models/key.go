@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// API key scope areas. Each area has a read scope, for GET requests, and a write scope for everything else, ie:
+// "messages:read" and "messages:write". Write includes read
+const (
+	ScopeMessages = "messages" // conversations, groups, messages, search, typing and /ws
+	ScopeGuilds   = "guilds"   // guilds, their members, roles and channels
+	ScopeUsers    = "users"    // users and their presence
+	ScopeWebhooks = "webhooks" // webhooks and their deliveries
+)
+
+// Scopes - every scope an API key can be given
+var Scopes = []string{
+	ReadScope(ScopeMessages), WriteScope(ScopeMessages),
+	ReadScope(ScopeGuilds), WriteScope(ScopeGuilds),
+	ReadScope(ScopeUsers), WriteScope(ScopeUsers),
+	ReadScope(ScopeWebhooks), WriteScope(ScopeWebhooks),
+}
+
+// ReadScope - the scope to read an area
+func ReadScope(area string) string {
+	return area + ":read"
+}
+
+// WriteScope - the scope to change anything in an area
+func WriteScope(area string) string {
+	return area + ":write"
+}
+
+// ValidScope - whether a scope is one an API key can be given
+func ValidScope(scope string) bool {
+	for _, valid := range Scopes {
+		if scope == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey - a long-lived credential for a user, usually a bot, sent as "Authorization: Bearer <key>". Only a hash of
+// the key is stored, so Key is only ever returned when the key is created. Prefix is the start of the key, enough to
+// tell keys apart. A key can only do what its Scopes allow, and stops working once it is revoked
+type APIKey struct {
+	ID       string     `json:"id,omitempty"`
+	UserID   string     `json:"user_id,omitempty"`
+	Name     string     `json:"name,omitempty"`
+	Scopes   []string   `json:"scopes,omitempty"`
+	Prefix   string     `json:"prefix,omitempty"`
+	Key      string     `json:"key,omitempty"`
+	Created  *time.Time `json:"created,omitempty"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+	Revoked  *time.Time `json:"revoked,omitempty"`
+}
+
+// Allows - whether the key can read an area, or change it when write is set
+func (k *APIKey) Allows(area string, write bool) bool {
+	for _, granted := range k.Scopes {
+		if granted == WriteScope(area) || (!write && granted == ReadScope(area)) {
+			return true
+		}
+	}
+	return false
+}
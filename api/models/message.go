@@ -2,10 +2,41 @@ package models
 
 import "time"
 
+// Message - sent either to a recipient, to a group conversation's participants, or to a guild channel. A message to
+// a recipient belongs to the conversation between the pair, and carries its id.
+// A message deleted for everyone keeps its place, with its content replaced by a tombstone. A reply names the
+// message it replies to as its parent, and the parent counts its replies so a thread can be shown collapsed.
+// Reactions and attachments are filled in by the datastore, and can't be sent with a message. An ephemeral message is
+// a reply to a slash command that only the user who invoked it sees, it is never stored and has no id
 type Message struct {
-	ID        string     `json:"id,omitempty"`
-	Sender    string     `json:"sender,omitempty"`
-	Recipient string     `json:"recipient,omitempty"`
+	ID             string        `json:"id,omitempty"`
+	Sender         string        `json:"sender,omitempty"`
+	Recipient      string        `json:"recipient,omitempty"`
+	GroupID        string        `json:"group_id,omitempty"`
+	ChannelID      string        `json:"channel_id,omitempty"`
+	ConversationID string        `json:"conversation_id,omitempty"`
+	ParentID       string        `json:"parent_id,omitempty"`
+	Content        string        `json:"content,omitempty"`
+	Date           *time.Time    `json:"date,omitempty"`
+	EditedAt       *time.Time    `json:"edited_at,omitempty"`
+	DeletedAt      *time.Time    `json:"deleted_at,omitempty"`
+	ReplyCount     int           `json:"reply_count,omitempty"`
+	LastReplyAt    *time.Time    `json:"last_reply_at,omitempty"`
+	Reactions      []*Reaction   `json:"reactions,omitempty"`
+	Attachments    []*Attachment `json:"attachments,omitempty"`
+	Ephemeral      bool          `json:"ephemeral,omitempty"`
+}
+
+// Revision - content a message had before it was edited, and when that content was written
+type Revision struct {
+	MessageID string     `json:"message_id,omitempty"`
 	Content   string     `json:"content,omitempty"`
 	Date      *time.Time `json:"date,omitempty"`
 }
+
+// MessagePage - one page of a message listing, oldest first. NextCursor carries on in the same direction the page
+// was fetched in, and is empty once there is nothing more
+type MessagePage struct {
+	Messages   []*Message `json:"messages"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Presence statuses. A user is offline unless they have been heard from recently
+const (
+	StatusOnline  = "online"
+	StatusIdle    = "idle"
+	StatusOffline = "offline"
+)
+
+// Presence - whether a user is online, idle or offline, and when they were last heard from. Users who have never
+// been heard from are offline, without a last seen date
+type Presence struct {
+	UserID   string     `json:"user_id,omitempty"`
+	Status   string     `json:"status,omitempty"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// Typing - a user has started or stopped typing in a conversation, group or channel, named the same way as a
+// message's recipient, group_id or channel_id. Someone typing stops at Expires unless they say they still are
+type Typing struct {
+	UserID    string     `json:"user_id,omitempty"`
+	Recipient string     `json:"recipient,omitempty"`
+	GroupID   string     `json:"group_id,omitempty"`
+	ChannelID string     `json:"channel_id,omitempty"`
+	Typing    bool       `json:"typing"`
+	Expires   *time.Time `json:"expires,omitempty"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Reaction - an emoji users have reacted to a message with, and who reacted with it
+type Reaction struct {
+	Emoji string   `json:"emoji"`
+	Count int      `json:"count"`
+	Users []string `json:"users"`
+}
+
+// shortCode - a custom emoji, ie: :party_parrot:
+var shortCode = regexp.MustCompile(`^:[a-z0-9_+-]{1,32}:$`)
+
+// maxEmojiRunes - the longest unicode emoji allowed. Skin tones and joined sequences take several runes
+const maxEmojiRunes = 10
+
+// ValidEmoji - whether emoji is a custom short code, or looks like a single unicode emoji. Unicode emoji
+// can't contain letters or spaces, and only the digits, # and * that start a keycap
+func ValidEmoji(emoji string) bool {
+	if shortCode.MatchString(emoji) {
+		return true
+	}
+
+	if emoji == "" || !utf8.ValidString(emoji) || utf8.RuneCountInString(emoji) > maxEmojiRunes {
+		return false
+	}
+
+	symbol := false
+	for _, r := range emoji {
+		switch {
+		case r < utf8.RuneSelf:
+			if !unicode.IsDigit(r) && r != '#' && r != '*' {
+				return false
+			}
+		case unicode.IsLetter(r) || unicode.IsSpace(r) || unicode.IsControl(r):
+			return false
+		default:
+			symbol = true
+		}
+	}
+
+	return symbol
+}
+
+// Tally - adds a user's reaction to a message's reactions, which are kept in the order each emoji was first used
+func Tally(reactions []*Reaction, emoji, userID string) []*Reaction {
+	for _, reaction := range reactions {
+		if reaction.Emoji == emoji {
+			reaction.Count++
+			reaction.Users = append(reaction.Users, userID)
+			return reactions
+		}
+	}
+
+	return append(reactions, &Reaction{Emoji: emoji, Count: 1, Users: []string{userID}})
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Receipt - how far a user has read a conversation or group: every message up to and including MessageID. Date is
+// when it was read. ConversationID is the id of the conversation or group
+type Receipt struct {
+	ConversationID string     `json:"conversation_id,omitempty"`
+	UserID         string     `json:"user_id,omitempty"`
+	MessageID      string     `json:"message_id,omitempty"`
+	Date           *time.Time `json:"date,omitempty"`
+}
@@ -2,9 +2,30 @@ package models
 
 import "time"
 
+// User - a person, or a bot acting for one. Bots have an Owner, the user who created them, and no email or
+// password; they authenticate with API keys instead of logging in
 type User struct {
 	ID         string     `json:"id,omitempty"`
 	Username   string     `json:"username,omitempty"`
 	Email      string     `json:"email,omitempty"`
+	Bot        bool       `json:"bot,omitempty"`
+	Owner      string     `json:"owner,omitempty"`
 	ArchivedOn *time.Time `json:"archived_on,omitempty"`
 }
+
+// PublicUser - who a user is, without their email or anything else only they should see. Sent to third parties,
+// like webhook and bot command receivers
+type PublicUser struct {
+	ID       string `json:"id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Bot      bool   `json:"bot,omitempty"`
+}
+
+// Public - the user as others can see them, nil for a nil user
+func (u *User) Public() *PublicUser {
+	if u == nil {
+		return nil
+	}
+
+	return &PublicUser{ID: u.ID, Username: u.Username, Bot: u.Bot}
+}
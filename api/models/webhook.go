@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Delivery statuses. A delivery is pending until the receiver accepts it, or it runs out of attempts and is failed,
+// which leaves it on the webhook's dead-letter list
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook - a URL events are posted to. A webhook with a GuildID gets the events of a guild, otherwise it gets the
+// events of its owner's conversations and account. Events filters which event types are posted, all of them when
+// empty. Secret signs every payload, and is only ever returned when the webhook is created
+type Webhook struct {
+	ID      string     `json:"id,omitempty"`
+	Owner   string     `json:"owner,omitempty"`
+	GuildID string     `json:"guild_id,omitempty"`
+	URL     string     `json:"url,omitempty"`
+	Events  []string   `json:"events,omitempty"`
+	Secret  string     `json:"secret,omitempty"`
+	Created *time.Time `json:"created,omitempty"`
+}
+
+// Wants - whether the webhook is subscribed to an event type
+func (w *Webhook) Wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, want := range w.Events {
+		if want == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Delivery - a single event posted to a webhook, and how the last attempt at it went. Payload is the JSON body that
+// is signed and posted, the same on every attempt
+type Delivery struct {
+	ID          string          `json:"id,omitempty"`
+	WebhookID   string          `json:"webhook_id,omitempty"`
+	Event       string          `json:"event,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Status      string          `json:"status,omitempty"`
+	Attempts    int             `json:"attempts"`
+	StatusCode  int             `json:"status_code,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Created     *time.Time      `json:"created,omitempty"`
+	LastAttempt *time.Time      `json:"last_attempt,omitempty"`
+	NextAttempt *time.Time      `json:"next_attempt,omitempty"`
+}
@@ -1,12 +1,54 @@
 package main
 
 import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
 	"github.com/radean0909/guild-chat/api"
 )
 
 func main() {
+	cfg := api.Config{}
+
+	// flags default to environment variables so the service is easy to configure in a container
+	flag.StringVar(&cfg.DBDriver, "db", env("GUILD_DB", api.DriverMem), "datastore to use: mem, pg or sqlite")
+	flag.StringVar(&cfg.Mem.Dir, "mem-dir", env("GUILD_MEM_DIR", ""), "directory to persist the in-memory datastore to, empty keeps nothing")
+	flag.DurationVar(&cfg.Mem.SnapshotInterval, "mem-snapshot-interval", 5*time.Minute, "how often the in-memory datastore is snapshotted")
+	flag.StringVar(&cfg.PG.URL, "pg-url", env("GUILD_PG_URL", "postgres://localhost/guild?sslmode=disable"), "postgres connection string")
+	flag.IntVar(&cfg.PG.MaxOpenConns, "pg-max-open", 20, "maximum open postgres connections")
+	flag.IntVar(&cfg.PG.MaxIdleConns, "pg-max-idle", 5, "maximum idle postgres connections")
+	flag.DurationVar(&cfg.PG.ConnMaxLifetime, "pg-conn-lifetime", 30*time.Minute, "maximum lifetime of a postgres connection")
+	flag.StringVar(&cfg.SQLite.Path, "sqlite-path", env("GUILD_SQLITE_PATH", "guild-chat.db"), "sqlite database file")
+	flag.StringVar(&cfg.Auth.Key, "jwt-key", env("GUILD_JWT_KEY", ""), "key tokens are signed with, a random key is generated if empty")
+	flag.DurationVar(&cfg.Auth.TokenTTL, "token-ttl", api.DefaultTokenTTL, "how long issued tokens are valid for")
+	flag.StringVar(&cfg.Attachments.Local.Dir, "attachment-dir", env("GUILD_ATTACHMENT_DIR", ""), "directory to store attached files in, empty keeps them in memory")
+	flag.Int64Var(&cfg.Attachments.MaxSize, "attachment-max-size", api.DefaultMaxAttachmentSize, "largest file that can be attached, in bytes")
+	flag.DurationVar(&cfg.Presence.TTL, "presence-ttl", api.DefaultPresenceTTL, "how long users stay online after they were last heard from")
+	flag.DurationVar(&cfg.Presence.TypingTTL, "typing-ttl", api.DefaultTypingTTL, "how long users are shown typing unless they say they still are")
+	flag.IntVar(&cfg.Webhooks.MaxAttempts, "webhook-attempts", api.DefaultWebhookAttempts, "how many times a webhook delivery is attempted before it is failed")
+	flag.DurationVar(&cfg.Webhooks.Backoff, "webhook-backoff", api.DefaultWebhookBackoff, "how long to wait before retrying a webhook delivery, doubling after each attempt")
+	flag.DurationVar(&cfg.Webhooks.MaxBackoff, "webhook-max-backoff", api.DefaultWebhookMaxBackoff, "longest wait between webhook delivery attempts")
+	flag.Float64Var(&cfg.RateLimits.Users.Rate, "rate-limit", api.DefaultUserRate, "requests a second each person can make")
+	flag.IntVar(&cfg.RateLimits.Users.Burst, "rate-burst", api.DefaultUserBurst, "requests each person can make at once")
+	flag.Float64Var(&cfg.RateLimits.Bots.Rate, "bot-rate-limit", api.DefaultBotRate, "requests a second each bot can make")
+	flag.IntVar(&cfg.RateLimits.Bots.Burst, "bot-rate-burst", api.DefaultBotBurst, "requests each bot can make at once")
+	flag.Parse()
+
 	// Create a new API service
-	svc := api.New()
+	svc, err := api.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	svc.Start(":8000")
 }
+
+// env - looks up an environment variable, falling back to def when it isn't set
+func env(key, def string) string {
+	if val, ok := os.LookupEnv(key); ok {
+		return val
+	}
+	return def
+}